@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminFeeRuleController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminFeeRuleController(config *config.Config, logger *zerolog.Logger) *AdminFeeRuleController {
+	return &AdminFeeRuleController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the fee rules.
+//
+// @Summary List fee rules
+// @Description Retrieve all fee rules, highest priority first. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param operation query string false "Filter by operation: transfer, payment, withdrawal or exchange"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/fee-rules [get]
+func (c *AdminFeeRuleController) ListController(ctx *fiber.Ctx) error {
+	query := database.DB
+	if operation := ctx.Query("operation"); operation != "" {
+		query = query.Where("operation = ?", operation)
+	}
+
+	var rules []models.FeeRule
+	result := query.Order("operation, priority desc, created_at desc").Find(&rules)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.FeeRuleResponse, 0, len(rules))
+	for i := range rules {
+		res = append(res, models.FeeRuleFilterRecord(&rules[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"fee_rules": res,
+		},
+	})
+}
+
+// CreateController creates a fee rule.
+//
+// @Summary Create a fee rule
+// @Description Creates a flat, percentage, tiered or free fee rule for an operation, optionally limited to a currency and a validity window. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.FeeRuleCreateRequest true "Fee rule payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/fee-rules [post]
+func (c *AdminFeeRuleController) CreateController(ctx *fiber.Ctx) error {
+	var payload *models.FeeRuleCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	rule, err := services.CreateFeeRule(database.DB, payload)
+	if err != nil {
+		if services.IsFeeRuleError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"fee_rule": models.FeeRuleFilterRecord(rule),
+		},
+	})
+}
+
+// UpdateController updates a fee rule.
+//
+// @Summary Update a fee rule
+// @Description Updates the amounts, caps, payer, priority, window or active flag of a fee rule. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Fee rule ID" format("uuid")
+// @Param payload body models.FeeRuleUpdateRequest true "Fee rule payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/fee-rules/{id} [patch]
+func (c *AdminFeeRuleController) UpdateController(ctx *fiber.Ctx) error {
+	var rule models.FeeRule
+	if err := database.DB.First(&rule, "id = ?", ctx.Params("id")).Error; err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Fee rule with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.FeeRuleUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	if err := services.UpdateFeeRule(database.DB, &rule, payload); err != nil {
+		if services.IsFeeRuleError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"fee_rule": models.FeeRuleFilterRecord(&rule),
+		},
+	})
+}
+
+// DeleteController deletes a fee rule.
+//
+// @Summary Delete a fee rule
+// @Description Deletes a fee rule. Transactions that were charged by it keep their fee. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Fee rule ID" format("uuid")
+// @Success 204 "No Content"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/fee-rules/{id} [delete]
+func (c *AdminFeeRuleController) DeleteController(ctx *fiber.Ctx) error {
+	result := database.DB.Delete(&models.FeeRule{}, "id = ?", ctx.Params("id"))
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+			Success: false,
+			Message: "Fee rule with this id was not found",
+		})
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
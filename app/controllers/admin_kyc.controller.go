@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/fatfatcocofat/rosamsoe/platform/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminKYCController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminKYCController(config *config.Config, logger *zerolog.Logger) *AdminKYCController {
+	return &AdminKYCController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the KYC review queue.
+//
+// @Summary List KYC submissions
+// @Description Retrieve KYC submissions by status, oldest first, pending ones by default. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "Filter by status: pending, approved or rejected"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/kyc [get]
+func (c *AdminKYCController) ListController(ctx *fiber.Ctx) error {
+	status := ctx.Query("status", models.KYCStatusPending)
+
+	var submissions []models.KYCSubmission
+	result := database.DB.Preload("User").Where("status = ?", status).Order("created_at asc").Limit(100).Find(&submissions)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.KYCSubmissionAdminResponse, 0, len(submissions))
+	for i := range submissions {
+		res = append(res, models.KYCSubmissionAdminFilterRecord(&submissions[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"submissions": res,
+		},
+	})
+}
+
+// ShowController retrieves a KYC submission.
+//
+// @Summary Show a KYC submission
+// @Description Retrieve a KYC submission with the full NIK and its status history. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "KYC submission ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/kyc/{id} [get]
+func (c *AdminKYCController) ShowController(ctx *fiber.Ctx) error {
+	submission, err := services.FindKYCSubmission(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "KYC submission with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"submission": models.KYCSubmissionAdminFilterRecord(submission),
+		},
+	})
+}
+
+// DocumentController streams a document of a KYC submission.
+//
+// @Summary Show a KYC document
+// @Description Returns the ID photo or the selfie of a KYC submission as an image. Only available to administrators.
+// @Tags Admin
+// @Produce image/jpeg,image/png
+// @Security ApiKeyAuth
+// @Param id path string true "KYC submission ID" format("uuid")
+// @Param document path string true "Document: id_photo or selfie"
+// @Success 200 {file} binary
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/kyc/{id}/documents/{document} [get]
+func (c *AdminKYCController) DocumentController(ctx *fiber.Ctx) error {
+	document := ctx.Params("document")
+	if document != models.KYCDocumentIDPhoto && document != models.KYCDocumentSelfie {
+		return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+			Success: false,
+			Message: "Document must be id_photo or selfie",
+		})
+	}
+
+	submission, err := services.FindKYCSubmission(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "KYC submission with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	content, contentType, err := services.OpenKYCDocument(storage.Storage, submission, document)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	ctx.Set(fiber.HeaderContentType, contentType)
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	return ctx.Send(content)
+}
+
+// ApproveController approves a KYC submission.
+//
+// @Summary Approve a KYC submission
+// @Description Approves a pending KYC submission and moves the user up to the tier it was submitted for. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "KYC submission ID" format("uuid")
+// @Param payload body models.KYCReviewRequest false "Approval payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/kyc/{id}/approve [post]
+func (c *AdminKYCController) ApproveController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	payload := new(models.KYCReviewRequest)
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(payload); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	submission, err := services.ApproveKYC(database.DB, ctx.Params("id"), admin.ID, payload.Reason)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "KYC submission with this id was not found",
+			})
+		}
+
+		if services.IsKYCError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"submission": models.KYCSubmissionAdminFilterRecord(submission),
+		},
+	})
+}
+
+// RejectController rejects a KYC submission.
+//
+// @Summary Reject a KYC submission
+// @Description Rejects a pending KYC submission with a reason that is shown to the user, who can submit again. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "KYC submission ID" format("uuid")
+// @Param payload body models.KYCRejectRequest true "Rejection payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/kyc/{id}/reject [post]
+func (c *AdminKYCController) RejectController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.KYCRejectRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	submission, err := services.RejectKYC(database.DB, ctx.Params("id"), admin.ID, payload.Reason)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "KYC submission with this id was not found",
+			})
+		}
+
+		if services.IsKYCError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"submission": models.KYCSubmissionAdminFilterRecord(submission),
+		},
+	})
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminPromotionController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminPromotionController(config *config.Config, logger *zerolog.Logger) *AdminPromotionController {
+	return &AdminPromotionController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the promotion campaigns.
+//
+// @Summary List promotion campaigns
+// @Description Retrieve all promotion campaigns, newest first. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param active query bool false "Only active or only inactive campaigns"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/promotions [get]
+func (c *AdminPromotionController) ListController(ctx *fiber.Ctx) error {
+	query := database.DB.Preload("FundingWallet")
+	if active := ctx.Query("active"); active != "" {
+		query = query.Where("active = ?", ctx.QueryBool("active"))
+	}
+
+	var campaigns []models.PromotionCampaign
+	result := query.Order("created_at desc").Find(&campaigns)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.PromotionCampaignResponse, 0, len(campaigns))
+	for i := range campaigns {
+		res = append(res, models.PromotionCampaignFilterRecord(&campaigns[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"promotions": res,
+		},
+	})
+}
+
+// CreateController creates a promotion campaign.
+//
+// @Summary Create a promotion campaign
+// @Description Creates a promo code that pays a flat or percentage cashback on transfers and payments of users, from the funding wallet, until the budget is spent. The campaign uses the currency of the funding wallet, which must hold enough balance for the cashback. Only transactions of at least min_amount made within the window qualify, at most per_user_limit times per user (once by default). A new_users_only campaign only pays cashback on the first transfer or payment of a user. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.PromotionCampaignCreateRequest true "Promotion campaign payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/promotions [post]
+func (c *AdminPromotionController) CreateController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.PromotionCampaignCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	campaign, err := services.CreatePromotionCampaign(database.DB, payload, admin.ID)
+	if err != nil {
+		if services.IsPromotionError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"promotion": models.PromotionCampaignFilterRecord(campaign),
+		},
+	})
+}
+
+// ShowController retrieves a promotion campaign with its statistics.
+//
+// @Summary Show a promotion campaign
+// @Description Retrieve a promotion campaign with its redemption statistics: redemptions, unique users, cashback paid, total of the qualifying transactions, remaining budget and the balance of the funding wallet. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Promotion campaign ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/promotions/{id} [get]
+func (c *AdminPromotionController) ShowController(ctx *fiber.Ctx) error {
+	campaign, err := services.FindPromotionCampaign(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Promotion campaign with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	stats, err := services.PromotionCampaignStats(database.DB, campaign)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := models.PromotionCampaignFilterRecord(campaign)
+	res.Stats = stats
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"promotion": res,
+		},
+	})
+}
+
+// UpdateController updates a promotion campaign.
+//
+// @Summary Update a promotion campaign
+// @Description Updates the name, description, cap, minimum amount, new users flag, budget, per user limit, window or active flag of a promotion campaign. The budget can not be lowered below the cashback already paid. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Promotion campaign ID" format("uuid")
+// @Param payload body models.PromotionCampaignUpdateRequest true "Promotion campaign payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/promotions/{id} [patch]
+func (c *AdminPromotionController) UpdateController(ctx *fiber.Ctx) error {
+	campaign, err := services.FindPromotionCampaign(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Promotion campaign with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.PromotionCampaignUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	if err := services.UpdatePromotionCampaign(database.DB, campaign, payload); err != nil {
+		if services.IsPromotionError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"promotion": models.PromotionCampaignFilterRecord(campaign),
+		},
+	})
+}
+
+// RedemptionsController retrieves the redemptions of a promotion campaign.
+//
+// @Summary List promotion redemptions
+// @Description Retrieve the latest redemptions of a promotion campaign, newest first. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Promotion campaign ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/promotions/{id}/redemptions [get]
+func (c *AdminPromotionController) RedemptionsController(ctx *fiber.Ctx) error {
+	redemptions, err := services.FindPromotionRedemptions(database.DB, ctx.Params("id"), "")
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.PromotionRedemptionResponse, 0, len(redemptions))
+	for i := range redemptions {
+		res = append(res, models.PromotionRedemptionFilterRecord(&redemptions[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"redemptions": res,
+		},
+	})
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"io"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminReconciliationController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminReconciliationController(config *config.Config, logger *zerolog.Logger) *AdminReconciliationController {
+	return &AdminReconciliationController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the latest reconciliation runs.
+//
+// @Summary List reconciliation runs
+// @Description Retrieve the latest reconciliation runs, newest first, without their discrepancies. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param scope query string false "Filter by scope: balances or settlement"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/reconciliation/runs [get]
+func (c *AdminReconciliationController) ListController(ctx *fiber.Ctx) error {
+	query := database.DB.Order("created_at desc").Limit(100)
+	if scope := ctx.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	var runs []models.ReconciliationRun
+	if err := query.Find(&runs).Error; err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.ReconciliationRunResponse, 0, len(runs))
+	for i := range runs {
+		res = append(res, models.ReconciliationRunFilterRecord(&runs[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"runs": res,
+		},
+	})
+}
+
+// CreateController starts a reconciliation of every wallet balance.
+//
+// @Summary Run a balance reconciliation
+// @Description Queues a run that recomputes every wallet balance from its ledger entries and transactions, the same check the daily job makes. When freeze is set, wallets that do not match are frozen. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.ReconciliationRunRequest false "Run payload"
+// @Success 202 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/reconciliation/runs [post]
+func (c *AdminReconciliationController) CreateController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	payload := new(models.ReconciliationRunRequest)
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(payload); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	run, err := services.StartReconciliation(database.DB, models.ReconciliationScopeBalances, nil, payload.Freeze, admin.ID)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"run": models.ReconciliationRunFilterRecord(run),
+		},
+	})
+}
+
+// ShowController retrieves a reconciliation run.
+//
+// @Summary Show a reconciliation run
+// @Description Retrieve a reconciliation run with the discrepancies it found. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Reconciliation run ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/reconciliation/runs/{id} [get]
+func (c *AdminReconciliationController) ShowController(ctx *fiber.Ctx) error {
+	run, err := services.FindReconciliationRun(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Reconciliation run with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"run": models.ReconciliationRunFilterRecord(run),
+		},
+	})
+}
+
+// SettlementsController retrieves the imported settlement files.
+//
+// @Summary List settlement files
+// @Description Retrieve the latest imported settlement files, newest first. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/reconciliation/settlements [get]
+func (c *AdminReconciliationController) SettlementsController(ctx *fiber.Ctx) error {
+	var files []models.SettlementFile
+	result := database.DB.Order("created_at desc").Limit(100).Find(&files)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.SettlementFileResponse, 0, len(files))
+	for i := range files {
+		res = append(res, models.SettlementFileFilterRecord(&files[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"settlements": res,
+		},
+	})
+}
+
+// ImportSettlementController imports a provider settlement file.
+//
+// @Summary Import a settlement file
+// @Description Imports a settlement CSV of a payment provider with a reference, amount and currency column, and queues a run that compares it with the transactions. When transaction_type is set, transactions of that type created on the settlement date that are missing from the file are reported too. Files must be at most 10 MB. Only available to administrators.
+// @Tags Admin
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param provider formData string true "Payment provider"
+// @Param settlement_date formData string true "Settlement date, YYYY-MM-DD"
+// @Param transaction_type formData string false "Transaction type the file covers: transfer, payment, payout, refund or reversal"
+// @Param file formData file true "Settlement CSV"
+// @Success 202 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/reconciliation/settlements [post]
+func (c *AdminReconciliationController) ImportSettlementController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.SettlementImportRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	filename, content, err := readSettlementFile(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	file, run, err := services.ImportSettlementFile(database.DB, payload, filename, content, admin.ID)
+	if err != nil {
+		if services.IsReconciliationError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"settlement": models.SettlementFileFilterRecord(file),
+			"run":        models.ReconciliationRunFilterRecord(run),
+		},
+	})
+}
+
+// FreezeController freezes a wallet.
+//
+// @Summary Freeze a wallet
+// @Description Stops a wallet from sending or receiving transfers and placing holds, e.g. while a discrepancy is investigated. Administrators can still reverse its transactions. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address"
+// @Param payload body models.WalletFreezeRequest true "Freeze payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/wallets/{address}/freeze [post]
+func (c *AdminReconciliationController) FreezeController(ctx *fiber.Ctx) error {
+	var payload *models.WalletFreezeRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	wallet, err := services.FreezeWallet(database.DB, utils.ParseAddressFromCtx(ctx), payload.Reason)
+
+	return c.walletResponse(ctx, wallet, err)
+}
+
+// UnfreezeController unfreezes a wallet.
+//
+// @Summary Unfreeze a wallet
+// @Description Lets a frozen wallet send and receive transfers again. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/wallets/{address}/unfreeze [post]
+func (c *AdminReconciliationController) UnfreezeController(ctx *fiber.Ctx) error {
+	wallet, err := services.UnfreezeWallet(database.DB, utils.ParseAddressFromCtx(ctx))
+
+	return c.walletResponse(ctx, wallet, err)
+}
+
+func (c *AdminReconciliationController) walletResponse(ctx *fiber.Ctx, wallet *models.Wallet, err error) error {
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet with this address was not found",
+			})
+		}
+
+		if services.IsReconciliationError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"wallet":        models.WalletFilterRecord(wallet),
+			"frozen_reason": wallet.FrozenReason,
+		},
+	})
+}
+
+// readSettlementFile reads the uploaded settlement CSV.
+func readSettlementFile(ctx *fiber.Ctx) (string, []byte, error) {
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return "", nil, services.ErrSettlementMissing
+	}
+
+	if header.Size > services.SettlementMaxFileSize {
+		return "", nil, services.ErrSettlementFileSize
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, services.SettlementMaxFileSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return header.Filename, content, nil
+}
@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type AdminRiskController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminRiskController(config *config.Config, logger *zerolog.Logger) *AdminRiskController {
+	return &AdminRiskController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ReviewsController retrieves the risk review queue.
+//
+// @Summary List risk reviews
+// @Description Retrieve transactions held for review by status, oldest first, pending ones by default. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "Filter by status: pending, approved, rejected or completed"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/risk/reviews [get]
+func (c *AdminRiskController) ReviewsController(ctx *fiber.Ctx) error {
+	status := ctx.Query("status", models.RiskReviewPending)
+
+	var reviews []models.RiskReview
+	result := database.DB.Preload("Hold").Where("status = ?", status).Order("created_at asc").Limit(100).Find(&reviews)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.RiskReviewResponse, 0, len(reviews))
+	for i := range reviews {
+		res = append(res, models.RiskReviewFilterRecord(&reviews[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"reviews": res,
+		},
+	})
+}
+
+// ApproveController approves a transaction held for review.
+//
+// @Summary Approve a risk review
+// @Description Approves a held transaction, which is then made out of the funds held for it. When it can no longer be made, e.g. because the hold expired, the funds are released and the sender can retry the same transaction within 24 hours, it then passes the review rules once. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Risk review ID" format("uuid")
+// @Param payload body models.RiskReviewDecisionRequest false "Decision payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/risk/reviews/{id}/approve [post]
+func (c *AdminRiskController) ApproveController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	payload := new(models.RiskReviewDecisionRequest)
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(payload); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	review, err := services.ApproveRiskReview(database.DB, ctx.Params("id"), admin.ID, payload.Note)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Risk review with this id was not found",
+			})
+		}
+
+		if err == services.ErrRiskReviewNotPending {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"review": models.RiskReviewFilterRecord(review),
+		},
+	})
+}
+
+// RejectController rejects a transaction held for review.
+//
+// @Summary Reject a risk review
+// @Description Rejects a held transaction and releases the funds held for it. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Risk review ID" format("uuid")
+// @Param payload body models.RiskReviewDecisionRequest false "Decision payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/risk/reviews/{id}/reject [post]
+func (c *AdminRiskController) RejectController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	payload := new(models.RiskReviewDecisionRequest)
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(payload); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	review, err := services.RejectRiskReview(database.DB, ctx.Params("id"), admin.ID, payload.Note)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Risk review with this id was not found",
+			})
+		}
+
+		if err == services.ErrRiskReviewNotPending {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"review": models.RiskReviewFilterRecord(review),
+		},
+	})
+}
+
+// EvaluationsController retrieves the risk evaluation log.
+//
+// @Summary List risk evaluations
+// @Description Retrieve the latest 100 evaluations of the risk rules, newest first. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param user_id query string false "Filter by user ID" format("uuid")
+// @Param outcome query string false "Filter by outcome: allow, review or block"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/risk/evaluations [get]
+func (c *AdminRiskController) EvaluationsController(ctx *fiber.Ctx) error {
+	query := database.DB.Order("created_at desc").Limit(100)
+
+	if userID := ctx.Query("user_id"); userID != "" {
+		if _, err := uuid.Parse(userID); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "Invalid user_id format",
+			})
+		}
+
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if outcome := ctx.Query("outcome"); outcome != "" {
+		query = query.Where("outcome = ?", outcome)
+	}
+
+	var evaluations []models.RiskEvaluation
+	result := query.Find(&evaluations)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.RiskEvaluationResponse, 0, len(evaluations))
+	for i := range evaluations {
+		res = append(res, models.RiskEvaluationFilterRecord(&evaluations[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"evaluations": res,
+		},
+	})
+}
+
+// RulesController retrieves the risk rules in use.
+//
+// @Summary List risk rules
+// @Description Retrieve the risk rules in use and the file they were loaded from. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Router /admin/risk/rules [get]
+func (c *AdminRiskController) RulesController(ctx *fiber.Ctx) error {
+	rules, source := services.CurrentRiskRules()
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"source": source,
+			"rules":  rules,
+		},
+	})
+}
+
+// ReloadRulesController reloads the risk rules from RISK_RULES_FILE.
+//
+// @Summary Reload risk rules
+// @Description Reloads the risk rules from the configured rules file without a restart. The current rules are kept when the file is invalid. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Router /admin/risk/rules/reload [post]
+func (c *AdminRiskController) ReloadRulesController(ctx *fiber.Ctx) error {
+	err := services.LoadRiskRules(c.Config.RiskRulesFile)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	rules, source := services.CurrentRiskRules()
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"source": source,
+			"rules":  rules,
+		},
+	})
+}
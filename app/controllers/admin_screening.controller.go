@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminScreeningController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminScreeningController(config *config.Config, logger *zerolog.Logger) *AdminScreeningController {
+	return &AdminScreeningController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the screening review queue.
+//
+// @Summary List screening cases
+// @Description Retrieve names that potentially matched the watchlist by status, oldest first, pending ones by default. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "Filter by status: pending, cleared or confirmed"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/screening/cases [get]
+func (c *AdminScreeningController) ListController(ctx *fiber.Ctx) error {
+	status := ctx.Query("status", models.ScreeningCasePending)
+
+	var cases []models.ScreeningCase
+	result := database.DB.Preload("User").Where("status = ?", status).Order("created_at asc").Limit(100).Find(&cases)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.ScreeningCaseResponse, 0, len(cases))
+	for i := range cases {
+		res = append(res, models.ScreeningCaseFilterRecord(&cases[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"cases": res,
+		},
+	})
+}
+
+// ShowController retrieves a screening case.
+//
+// @Summary Show a screening case
+// @Description Retrieve a screening case with the watchlist entries the name matched. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Screening case ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/screening/cases/{id} [get]
+func (c *AdminScreeningController) ShowController(ctx *fiber.Ctx) error {
+	screeningCase, err := services.FindScreeningCase(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Screening case with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"case": models.ScreeningCaseFilterRecord(screeningCase),
+		},
+	})
+}
+
+// ClearController clears a screening case.
+//
+// @Summary Clear a screening case
+// @Description Closes a screening case as a false positive. The user can make transactions again once none of their cases are pending. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Screening case ID" format("uuid")
+// @Param payload body models.ScreeningDecisionRequest true "Decision payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/screening/cases/{id}/clear [post]
+func (c *AdminScreeningController) ClearController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.ScreeningDecisionRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	screeningCase, err := services.ClearScreeningCase(database.DB, ctx.Params("id"), admin.ID, payload.Note)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Screening case with this id was not found",
+			})
+		}
+
+		if err == services.ErrScreeningCaseNotPending {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"case": models.ScreeningCaseFilterRecord(screeningCase),
+		},
+	})
+}
+
+// ConfirmController confirms a screening case.
+//
+// @Summary Confirm a screening case
+// @Description Closes a screening case as a true match. The user is blocked from making and receiving transactions. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Screening case ID" format("uuid")
+// @Param payload body models.ScreeningDecisionRequest true "Decision payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/screening/cases/{id}/confirm [post]
+func (c *AdminScreeningController) ConfirmController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.ScreeningDecisionRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	screeningCase, err := services.ConfirmScreeningCase(database.DB, ctx.Params("id"), admin.ID, payload.Note)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Screening case with this id was not found",
+			})
+		}
+
+		if err == services.ErrScreeningCaseNotPending {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"case": models.ScreeningCaseFilterRecord(screeningCase),
+		},
+	})
+}
+
+// CheckController screens a name against the watchlist.
+//
+// @Summary Screen a name
+// @Description Screens a name against the watchlist without opening a case, to look up a name or tune the threshold. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.ScreeningCheckRequest true "Name to screen"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Router /admin/screening/check [post]
+func (c *AdminScreeningController) CheckController(ctx *fiber.Ctx) error {
+	var payload *models.ScreeningCheckRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	list, _, threshold := services.CurrentSanctionsList()
+	if list == nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: services.ErrScreeningListUnavailable.Error(),
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"threshold": threshold,
+			"matches":   list.Screen(payload.Name, threshold),
+		},
+	})
+}
+
+// WatchlistController retrieves the watchlist in use.
+//
+// @Summary Show the watchlist
+// @Description Retrieve the file the watchlist was loaded from, its number of entries and the match threshold. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Router /admin/screening/watchlist [get]
+func (c *AdminScreeningController) WatchlistController(ctx *fiber.Ctx) error {
+	list, source, threshold := services.CurrentSanctionsList()
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"source":    source,
+			"entries":   list.Len(),
+			"threshold": threshold,
+		},
+	})
+}
+
+// ReloadWatchlistController reloads the watchlist from SANCTIONS_LIST_FILE.
+//
+// @Summary Reload the watchlist
+// @Description Reloads the watchlist from the configured file without a restart. The current list is kept when the file is invalid. Names that were screened before are not screened again. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Router /admin/screening/watchlist/reload [post]
+func (c *AdminScreeningController) ReloadWatchlistController(ctx *fiber.Ctx) error {
+	err := services.LoadSanctionsList(c.Config.SanctionsListFile, c.Config.SanctionsMatchThreshold)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	list, source, threshold := services.CurrentSanctionsList()
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"source":    source,
+			"entries":   list.Len(),
+			"threshold": threshold,
+		},
+	})
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminTierLimitController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminTierLimitController(config *config.Config, logger *zerolog.Logger) *AdminTierLimitController {
+	return &AdminTierLimitController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the tier limits.
+//
+// @Summary List tier limits
+// @Description Retrieve the limits of every KYC tier and currency. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/tier-limits [get]
+func (c *AdminTierLimitController) ListController(ctx *fiber.Ctx) error {
+	var limits []models.TierLimit
+	result := database.DB.Order("tier, currency").Find(&limits)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.TierLimitResponse, 0, len(limits))
+	for i := range limits {
+		res = append(res, models.TierLimitFilterRecord(&limits[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"tier_limits": res,
+		},
+	})
+}
+
+// UpdateController updates a tier limit.
+//
+// @Summary Update a tier limit
+// @Description Changes the limits of a KYC tier in a currency, a limit of zero removes it. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Tier limit ID" format("uuid")
+// @Param payload body models.TierLimitUpdateRequest true "Tier limit payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/tier-limits/{id} [patch]
+func (c *AdminTierLimitController) UpdateController(ctx *fiber.Ctx) error {
+	var limit models.TierLimit
+	if err := database.DB.First(&limit, "id = ?", ctx.Params("id")).Error; err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Tier limit with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.TierLimitUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	if err := services.UpdateTierLimit(database.DB, &limit, payload); err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"tier_limit": models.TierLimitFilterRecord(&limit),
+		},
+	})
+}
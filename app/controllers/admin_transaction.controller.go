@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminTransactionController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewAdminTransactionController(config *config.Config, logger *zerolog.Logger) *AdminTransactionController {
+	return &AdminTransactionController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ShowController retrieves any transaction.
+//
+// @Summary Show a transaction
+// @Description Retrieve any transaction by reference, together with its refunds and reversals. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param reference path string true "Transaction reference" format("string")
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/transactions/{reference} [get]
+func (c *AdminTransactionController) ShowController(ctx *fiber.Ctx) error {
+	transaction, err := services.FindTransaction(database.DB, ctx.Params("reference"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Transaction with this reference was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	refunds, err := services.FindTransactionRefunds(database.DB, fmt.Sprint(transaction.ID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.TransactionResponse, 0, len(refunds))
+	for i := range refunds {
+		res = append(res, models.TransactionFilterRecord(&refunds[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"transaction": models.TransactionFilterRecord(transaction),
+			"refunds":     res,
+		},
+	})
+}
+
+// ReverseController reverses a transaction.
+//
+// @Summary Reverse a transaction
+// @Description Posts a reversal of everything that has not been refunded yet of a transfer, payment or payout. A reason code and a note are mandatory. Only available to administrators.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param reference path string true "Transaction reference" format("string")
+// @Param payload body models.TransactionReverseRequest true "Reversal payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /admin/transactions/{reference}/reverse [post]
+func (c *AdminTransactionController) ReverseController(ctx *fiber.Ctx) error {
+	admin := utils.ParseUserFromCtx(ctx)
+
+	transaction, err := services.FindTransaction(database.DB, ctx.Params("reference"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Transaction with this reference was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.TransactionReverseRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	reversal, err := services.RefundTransaction(database.DB, services.RefundParams{
+		TransactionID: transaction.ID,
+		Type:          models.TransactionTypeReversal,
+		Description:   payload.Note,
+		ReasonCode:    payload.ReasonCode,
+		InitiatedByID: admin.ID,
+	})
+	if err != nil {
+		if services.IsRefundError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	c.Logger.Info().
+		Str("admin_id", fmt.Sprint(admin.ID)).
+		Str("reference", transaction.Reference).
+		Str("reason_code", payload.ReasonCode).
+		Msg("Transaction reversed")
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"reversal": models.TransactionFilterRecord(reversal),
+		},
+	})
+}
@@ -0,0 +1,560 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type ApprovalController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewApprovalController(config *config.Config, logger *zerolog.Logger) *ApprovalController {
+	return &ApprovalController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// PolicyController retrieves the approval policy of a wallet.
+//
+// @Summary Show the approval policy
+// @Description Retrieve the approval policy of a wallet the authenticated user has access to
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approval-policy [get]
+func (c *ApprovalController) PolicyController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	policy, err := services.FindApprovalPolicy(database.DB, fmt.Sprint(wallet.ID))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "This wallet has no approval policy",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"policy": models.ApprovalPolicyFilterRecord(policy),
+		},
+	})
+}
+
+// UpdatePolicyController sets the approval policy of a wallet.
+//
+// @Summary Set the approval policy
+// @Description Puts a wallet of the authenticated user under dual control. Transfers and payments of at least the threshold initiated by any member, and payout batches totalling at least the threshold, must be approved by required_approvals owners other than the initiator, within expires_in seconds (24 hours by default). The wallet needs one owner more than approvals are required, as owners can not approve their own transfers.
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.ApprovalPolicyRequest true "Approval policy payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approval-policy [put]
+func (c *ApprovalController) UpdatePolicyController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.ApprovalPolicyRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	policy, err := services.SetApprovalPolicy(database.DB, wallet, user.ID, payload)
+	if err != nil {
+		if services.IsApprovalError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"policy": models.ApprovalPolicyFilterRecord(policy),
+		},
+	})
+}
+
+// DeletePolicyController removes the approval policy of a wallet.
+//
+// @Summary Remove the approval policy
+// @Description Removes the approval policy of a wallet of the authenticated user. Transfers already waiting for approval still need it.
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Success 204 "No Content"
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approval-policy [delete]
+func (c *ApprovalController) DeletePolicyController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if err := services.DeleteApprovalPolicy(database.DB, fmt.Sprint(wallet.ID)); err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "This wallet has no approval policy",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ListController retrieves the transfer approvals of a wallet.
+//
+// @Summary List transfer approvals
+// @Description Retrieve the latest transfers of a wallet that need approval, filter by status pending for the queue of transfers waiting for a decision
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param status query string false "Filter by status: pending, executed, rejected, cancelled, expired or failed"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approvals [get]
+func (c *ApprovalController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	approvals, err := services.FindWalletTransferApprovals(database.DB, fmt.Sprint(wallet.ID), ctx.Query("status"))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.TransferApprovalResponse, 0, len(approvals))
+	for i := range approvals {
+		res = append(res, models.TransferApprovalFilterRecord(&approvals[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"approvals": res,
+		},
+	})
+}
+
+// ShowController retrieves a transfer approval.
+//
+// @Summary Show a transfer approval
+// @Description Retrieve a transfer approval of a wallet with the decisions of the owners
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Approval ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approvals/{id} [get]
+func (c *ApprovalController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	approval, err := services.FindWalletTransferApproval(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Transfer approval with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"approval": models.TransferApprovalFilterRecord(approval),
+		},
+	})
+}
+
+// ApproveController approves a pending transfer.
+//
+// @Summary Approve a transfer
+// @Description Approves a pending transfer of a wallet of the authenticated user, who must be an owner other than the requester. The transfer is made out of the held funds with the last required approval, a payout batch is started instead and its items are paid out of the held funds. When it is refused the approval is closed as failed and the funds are released.
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Approval ID" format("uuid")
+// @Param payload body models.TransferApprovalDecisionRequest false "Decision payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approvals/{id}/approve [post]
+func (c *ApprovalController) ApproveController(ctx *fiber.Ctx) error {
+	return c.decide(ctx, services.ApproveTransfer)
+}
+
+// RejectController rejects a pending transfer.
+//
+// @Summary Reject a transfer
+// @Description Rejects a pending transfer of a wallet of the authenticated user, who must be an owner other than the requester. The held funds are released.
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Approval ID" format("uuid")
+// @Param payload body models.TransferApprovalDecisionRequest false "Decision payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approvals/{id}/reject [post]
+func (c *ApprovalController) RejectController(ctx *fiber.Ctx) error {
+	return c.decide(ctx, services.RejectTransfer)
+}
+
+func (c *ApprovalController) decide(ctx *fiber.Ctx, decide func(db *gorm.DB, walletID string, id string, userID *uuid.UUID, comment string) (*models.TransferApproval, error)) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload models.TransferApprovalDecisionRequest
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&payload); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		errors := validator.ValidateStruct(payload)
+		if errors != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Errors:  errors,
+			})
+		}
+	}
+
+	approval, err := decide(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"), user.ID, payload.Comment)
+	if err != nil {
+		if err == services.ErrApprovalNotFound {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		if services.IsApprovalError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"approval": models.TransferApprovalFilterRecord(approval),
+		},
+	})
+}
+
+// CancelController withdraws a pending transfer.
+//
+// @Summary Cancel a transfer
+// @Description Withdraws a pending transfer requested by the authenticated user and releases the held funds
+// @Tags Approval
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Approval ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/approvals/{id}/cancel [post]
+func (c *ApprovalController) CancelController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	approval, err := services.CancelTransferApproval(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"), user.ID)
+	if err != nil {
+		if err == services.ErrApprovalNotFound {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		if services.IsApprovalError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"approval": models.TransferApprovalFilterRecord(approval),
+		},
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/fatfatcocofat/rosamsoe/app/response"
 
 	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
 	"github.com/fatfatcocofat/rosamsoe/pkg/config"
 	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
 	"github.com/fatfatcocofat/rosamsoe/platform/database"
@@ -14,6 +15,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/rs/zerolog"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type AuthController struct {
@@ -73,14 +75,24 @@ func (c *AuthController) RegisterController(ctx *fiber.Ctx) error {
 		Password: string(hashedPassword),
 	}
 
-	result := database.DB.Create(&newUser)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newUser).Error; err != nil {
+			return err
+		}
 
-	if result.Error != nil && database.IsDuplicateError(result.Error) {
+		_, err := services.ScreenName(tx, newUser.ID, nil, models.ScreeningSubjectUser, newUser.Name)
+
+		return err
+	})
+
+	if err != nil && database.IsDuplicateError(err) {
 		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
 			Success: false,
 			Message: "User with that email already exists",
 		})
-	} else if result.Error != nil {
+	} else if err != nil {
+		c.Logger.Error().Err(err).Send()
+
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadRequest{
 			Success: false,
 			Message: response.BAD_GATEWAY_MSG,
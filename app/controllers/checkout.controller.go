@@ -0,0 +1,415 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+const defaultCheckoutExpiresIn = 1800
+
+type CheckoutController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewCheckoutController(config *config.Config, logger *zerolog.Logger) *CheckoutController {
+	return &CheckoutController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// CreateController creates a checkout session for a merchant.
+//
+// @Summary Create a checkout session
+// @Description Creates a checkout session for an order of the merchant that a customer can pay from their wallet.
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Merchant ID" format("uuid")
+// @Param payload body models.CheckoutSessionCreateRequest true "Checkout session payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /merchant/{id}/checkout [post]
+func (c *CheckoutController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	merchant, err := services.FindUserMerchant(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Merchant with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.CheckoutSessionCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	currency := strings.ToUpper(payload.Currency)
+	if _, err := services.MerchantSettlementWallet(database.DB, fmt.Sprint(merchant.ID), currency); err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "The merchant has no settlement wallet for " + currency,
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	expiresIn := payload.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = defaultCheckoutExpiresIn
+	}
+
+	expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second)
+	newSession := models.CheckoutSession{
+		MerchantID:  merchant.ID,
+		OrderID:     payload.OrderID,
+		Amount:      utils.RoundAmount(payload.Amount),
+		Currency:    currency,
+		Description: payload.Description,
+		SuccessURL:  payload.SuccessURL,
+		CancelURL:   payload.CancelURL,
+		Status:      models.CheckoutStatusPending,
+		ExpiresAt:   &expiresAt,
+	}
+
+	result := database.DB.Create(&newSession)
+	if result.Error != nil && database.IsDuplicateError(result.Error) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "A checkout session for this order already exists",
+		})
+	} else if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	newSession.Merchant = *merchant
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"checkout": models.CheckoutSessionFilterRecord(&newSession),
+		},
+	})
+}
+
+// ListController lists the checkout sessions of a merchant.
+//
+// @Summary List checkout sessions of a merchant
+// @Description Retrieve the checkout sessions of a merchant, optionally filtered by status
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Merchant ID" format("uuid")
+// @Param status query string false "Filter by status: pending, paid, expired or cancelled"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /merchant/{id}/checkout [get]
+func (c *CheckoutController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	merchant, err := services.FindUserMerchant(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Merchant with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if _, err := services.ExpireCheckoutSessions(database.DB); err != nil {
+		c.Logger.Error().Err(err).Send()
+	}
+
+	query := database.DB.Preload("Merchant").Preload("Transaction.FromWallet").Preload("Transaction.ToWallet").
+		Where("merchant_id = ?", fmt.Sprint(merchant.ID))
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var sessions []models.CheckoutSession
+	results := query.Order("created_at desc").Find(&sessions)
+	if results.Error != nil {
+		c.Logger.Error().Err(results.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	sessionRes := []models.CheckoutSessionResponse{}
+	for _, s := range sessions {
+		sessionRes = append(sessionRes, models.CheckoutSessionFilterRecord(&s))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"checkouts": sessionRes,
+		},
+	})
+}
+
+// ShowController get checkout session by id.
+//
+// @Summary Get a checkout session
+// @Description Retrieves a checkout session so the customer can review the order and the fee before paying
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Checkout session ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /checkout/{id} [get]
+func (c *CheckoutController) ShowController(ctx *fiber.Ctx) error {
+	session, err := services.FindCheckoutSession(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Checkout session with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	fee, err := services.QuoteFee(database.DB, models.FeeOperationPayment, session.Currency, session.Amount)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"checkout": models.CheckoutSessionFilterRecord(session),
+			"fee":      fee,
+		},
+	})
+}
+
+// PayController pays a checkout session.
+//
+// @Summary Pay a checkout session
+// @Description Pays a pending checkout session from one of the customer's wallets. The response contains the success URL to redirect the customer to. Amounts that need approval under the approval policy of the wallet are refused.
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Checkout session ID" format("uuid")
+// @Param payload body models.CheckoutSessionPayRequest true "Checkout payment payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /checkout/{id}/pay [post]
+func (c *CheckoutController) PayController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.CheckoutSessionPayRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	fromAddress, err := utils.ValidateWalletAddress(payload.FromAddress)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	from, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), fromAddress, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	session, err := services.PayCheckoutSession(database.DB.WithContext(services.WithRequestDevice(ctx.UserContext(), utils.ParseDeviceFromCtx(ctx))), ctx.Params("id"), from.ID, user.ID)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Checkout session with this id was not found",
+			})
+		}
+
+		if err == services.ErrCheckoutNotPending || err == services.ErrCheckoutExpired || services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"checkout":    models.CheckoutSessionFilterRecord(session),
+			"redirect_to": session.SuccessURL,
+		},
+	})
+}
+
+// CancelController cancels a checkout session.
+//
+// @Summary Cancel a checkout session
+// @Description Cancels a pending checkout session, either by the customer abandoning it or by the merchant. The response contains the cancel URL to redirect the customer to.
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Checkout session ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /checkout/{id}/cancel [post]
+func (c *CheckoutController) CancelController(ctx *fiber.Ctx) error {
+	session, err := services.CancelCheckoutSession(database.DB, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Checkout session with this id was not found",
+			})
+		}
+
+		if err == services.ErrCheckoutNotPending {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"checkout":    models.CheckoutSessionFilterRecord(session),
+			"redirect_to": session.CancelURL,
+		},
+	})
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/platform/broker"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+const eventStreamHeartbeat = 15 * time.Second
+
+type EventController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewEventController(config *config.Config, logger *zerolog.Logger) *EventController {
+	return &EventController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// StreamController streams the events of the user.
+//
+// @Summary Stream realtime wallet events
+// @Description Streams the events of the authenticated user, such as balance changes, incoming transfers and wallet changes, as Server-Sent Events. Browsers using EventSource can pass the token as access_token query parameter. Use the types query parameter to only receive some event types.
+// @Tags Events
+// @Produce text/event-stream
+// @Security ApiKeyAuth
+// @Param types query string false "Comma separated event types, e.g. wallet.balance_changed,transfer.completed"
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /events/stream [get]
+func (c *EventController) StreamController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	types := make(map[string]bool)
+	for _, t := range strings.Split(ctx.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	messages, err := broker.Broker.Subscribe(subCtx, broker.UserTopic(fmt.Sprint(user.ID)))
+	if err != nil {
+		cancel()
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+	ctx.Set("X-Accel-Buffering", "no")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		heartbeat := time.NewTicker(eventStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event models.Event
+				if err := json.Unmarshal(message.Payload, &event); err != nil {
+					continue
+				}
+
+				if len(types) > 0 && !types[event.Type] {
+					continue
+				}
+
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, message.Payload)
+			case <-heartbeat.C:
+				fmt.Fprintf(w, ": heartbeat\n\n")
+			}
+
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
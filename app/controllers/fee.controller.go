@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type FeeController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewFeeController(config *config.Config, logger *zerolog.Logger) *FeeController {
+	return &FeeController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// QuoteController quotes the fee of an operation.
+//
+// @Summary Quote a fee
+// @Description Shows the fee that will be charged for an operation of the given amount and currency, who pays it, the total paid by the sender and the amount the receiver gets.
+// @Tags Fee
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.FeeQuoteRequest true "Fee quote payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /fees/quote [post]
+func (c *FeeController) QuoteController(ctx *fiber.Ctx) error {
+	var payload *models.FeeQuoteRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	quote, err := services.QuoteFee(database.DB, payload.Operation, payload.Currency, payload.Amount)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"quote": quote,
+		},
+	})
+}
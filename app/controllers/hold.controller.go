@@ -0,0 +1,457 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+const defaultHoldExpiresIn = 7 * 24 * 3600
+
+type HoldController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewHoldController(config *config.Config, logger *zerolog.Logger) *HoldController {
+	return &HoldController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the holds of a wallet.
+//
+// @Summary List holds
+// @Description Retrieve the holds placed on a wallet of the authenticated user, newest first
+// @Tags Hold
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param status query string false "Filter by status: active, captured, released or expired"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/holds [get]
+func (c *HoldController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	query := database.DB.Preload("Wallet").Where("wallet_id = ?", fmt.Sprint(wallet.ID))
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var holds []models.Hold
+	result := query.Order("created_at desc").Limit(100).Find(&holds)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.HoldResponse, 0, len(holds))
+	for i := range holds {
+		res = append(res, models.HoldFilterRecord(&holds[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"holds": res,
+		},
+	})
+}
+
+// ShowController retrieves a hold.
+//
+// @Summary Show a hold
+// @Description Retrieve a hold placed on a wallet of the authenticated user
+// @Tags Hold
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Hold ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/holds/{id} [get]
+func (c *HoldController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	hold, err := services.FindWalletHold(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Hold with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"hold": models.HoldFilterRecord(hold),
+		},
+	})
+}
+
+// CreateController places a hold on a wallet.
+//
+// @Summary Place a hold
+// @Description Reserves an amount of the available balance of the wallet without moving it, until the hold is captured, released or expires.
+// @Tags Hold
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.HoldCreateRequest true "Hold payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/holds [post]
+func (c *HoldController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.HoldCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	expiresIn := payload.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = defaultHoldExpiresIn
+	}
+
+	hold, err := services.PlaceHold(database.DB, wallet.ID, payload.Amount, payload.Reason, time.Now().Add(time.Duration(expiresIn)*time.Second))
+	if err != nil {
+		if services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"hold": models.HoldFilterRecord(hold),
+		},
+	})
+}
+
+// CaptureController captures a hold.
+//
+// @Summary Capture a hold
+// @Description Transfers all or part of the held amount to the recipient, given by wallet address or @handle. The rest of the hold is released. Amounts that need approval under the approval policy of the wallet are refused.
+// @Tags Hold
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Hold ID" format("uuid")
+// @Param payload body models.HoldCaptureRequest true "Hold capture payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/holds/{id}/capture [post]
+func (c *HoldController) CaptureController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	hold, err := services.FindWalletHold(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Hold with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.HoldCaptureRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	recipient, err := services.ResolveRecipient(database.DB, payload.Recipient, wallet.Currency)
+	if err != nil {
+		if services.IsRecipientError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	hold, err = services.CaptureHold(database.DB.WithContext(services.WithRequestDevice(ctx.UserContext(), utils.ParseDeviceFromCtx(ctx))), fmt.Sprint(hold.ID), recipient.ID, payload.Amount, payload.Description, user.ID)
+	if err != nil {
+		if services.IsHoldError(err) || services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"hold": models.HoldFilterRecord(hold),
+		},
+	})
+}
+
+// ReleaseController releases a hold.
+//
+// @Summary Release a hold
+// @Description Closes an active hold without moving money, the held amount becomes available again.
+// @Tags Hold
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Hold ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/holds/{id}/release [post]
+func (c *HoldController) ReleaseController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	hold, err := services.FindWalletHold(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Hold with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	hold, err = services.ReleaseHold(database.DB, fmt.Sprint(hold.ID))
+	if err != nil {
+		if services.IsHoldError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"hold": models.HoldFilterRecord(hold),
+		},
+	})
+}
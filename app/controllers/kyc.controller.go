@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/fatfatcocofat/rosamsoe/platform/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type KYCController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewKYCController(config *config.Config, logger *zerolog.Logger) *KYCController {
+	return &KYCController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the KYC submissions of the user.
+//
+// @Summary List KYC submissions
+// @Description Retrieve the KYC submissions of the authenticated user with their status history, newest first.
+// @Tags KYC
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /kyc [get]
+func (c *KYCController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	submissions, err := services.FindUserKYCSubmissions(database.DB, fmt.Sprint(user.ID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.KYCSubmissionResponse, 0, len(submissions))
+	for i := range submissions {
+		res = append(res, models.KYCSubmissionFilterRecord(&submissions[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"tier":        user.KYCTier,
+			"submissions": res,
+		},
+	})
+}
+
+// CreateController submits identity data for verification.
+//
+// @Summary Submit KYC
+// @Description Submits the NIK, legal name, date of birth, a photo of the ID card and a selfie for review. Photos must be JPEG or PNG images of at most 5 MB. When the submission is approved the account moves up to the next tier.
+// @Tags KYC
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param nik formData string true "NIK, 16 digits"
+// @Param legal_name formData string true "Full legal name as printed on the ID card"
+// @Param date_of_birth formData string true "Date of birth, YYYY-MM-DD"
+// @Param id_photo formData file true "Photo of the ID card"
+// @Param selfie formData file true "Selfie holding the ID card"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /kyc [post]
+func (c *KYCController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.KYCSubmitRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	idPhoto, err := readKYCDocument(ctx, models.KYCDocumentIDPhoto)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	selfie, err := readKYCDocument(ctx, models.KYCDocumentSelfie)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	submission, err := services.SubmitKYC(database.DB, storage.Storage, user.ID, payload, idPhoto, selfie)
+	if err != nil {
+		if services.IsKYCError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"submission": models.KYCSubmissionFilterRecord(submission),
+		},
+	})
+}
+
+// readKYCDocument reads an uploaded document, a missing file is returned as
+// empty so that the service reports it.
+func readKYCDocument(ctx *fiber.Ctx, name string) ([]byte, error) {
+	header, err := ctx.FormFile(name)
+	if err != nil {
+		return nil, nil
+	}
+
+	if header.Size > services.KYCMaxDocumentSize {
+		return nil, services.ErrKYCDocumentSize
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, services.KYCMaxDocumentSize+1))
+}
@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type MerchantController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewMerchantController(config *config.Config, logger *zerolog.Logger) *MerchantController {
+	return &MerchantController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the merchants of the user.
+//
+// @Summary List user's merchants
+// @Description Retrieve a list of merchant accounts belonging to the authenticated user
+// @Tags Merchant
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /merchant [get]
+func (c *MerchantController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var merchants []models.Merchant
+	results := database.DB.Preload("Wallets").Where("user_id = ?", fmt.Sprint(user.ID)).Order("created_at").Find(&merchants)
+	if results.Error != nil {
+		c.Logger.Error().Err(results.Error).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	merchantRes := []models.MerchantResponse{}
+	for _, m := range merchants {
+		merchantRes = append(merchantRes, models.MerchantFilterRecord(&m))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"merchants": merchantRes,
+		},
+	})
+}
+
+// ShowController get merchant by id.
+//
+// @Summary Get details of a specific merchant
+// @Description Retrieves a merchant account of the authenticated user with its settlement wallets
+// @Tags Merchant
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Merchant ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /merchant/{id} [get]
+func (c *MerchantController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	merchant, err := services.FindUserMerchant(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Merchant with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"merchant": models.MerchantFilterRecord(merchant),
+		},
+	})
+}
+
+// CreateController create new merchant.
+//
+// @Summary Create a new merchant account
+// @Description Creates a merchant account owned by the authenticated user with a settlement wallet for every requested currency.
+// @Tags Merchant
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.MerchantCreateRequest true "Merchant creation payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 500 {object} response.ServerError
+// @Failure 502 {object} response.BadGateway
+// @Router /merchant [post]
+func (c *MerchantController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.MerchantCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	currencies := map[string]bool{}
+	for _, currency := range payload.Currencies {
+		if !utils.ValidWalletCurrency(currency) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "Currency not supported, allowed currencies: " + strings.Join(models.WalletCurrencies, ", "),
+			})
+		}
+
+		currencies[strings.ToUpper(currency)] = true
+	}
+
+	newMerchant := models.Merchant{
+		UserID:           user.ID,
+		Name:             payload.Name,
+		City:             payload.City,
+		MerchantCategory: payload.MerchantCategory,
+		Website:          payload.Website,
+	}
+
+	if newMerchant.MerchantCategory == "" {
+		newMerchant.MerchantCategory = utils.QRISDefaultMerchantCategory
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newMerchant).Error; err != nil {
+			return err
+		}
+
+		if _, err := services.ScreenName(tx, user.ID, newMerchant.ID, models.ScreeningSubjectMerchant, newMerchant.Name); err != nil {
+			return err
+		}
+
+		for _, currency := range models.WalletCurrencies {
+			if !currencies[currency] {
+				continue
+			}
+
+			address, err := services.GenerateUniqueWalletAddress(tx)
+			if err != nil {
+				return err
+			}
+
+			wallet := models.Wallet{
+				UserID:     user.ID,
+				MerchantID: newMerchant.ID,
+				Address:    address,
+				Currency:   currency,
+			}
+
+			if err := tx.Create(&wallet).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	database.DB.Preload("Wallets").First(&newMerchant, "id = ?", fmt.Sprint(newMerchant.ID))
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"merchant": models.MerchantFilterRecord(&newMerchant),
+		},
+	})
+}
+
+// UpdateController update merchant by id.
+//
+// @Summary Update details of a specific merchant
+// @Description Updates the profile of a merchant account of the authenticated user
+// @Tags Merchant
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Merchant ID" format("uuid")
+// @Param payload body models.MerchantUpdateRequest true "Merchant update payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /merchant/{id} [patch]
+func (c *MerchantController) UpdateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	merchant, err := services.FindUserMerchant(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Merchant with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.MerchantUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	updates := make(map[string]interface{})
+
+	if payload.Name != "" {
+		updates["name"] = payload.Name
+	}
+
+	if payload.City != "" {
+		updates["city"] = payload.City
+	}
+
+	if payload.MerchantCategory != "" {
+		updates["merchant_category"] = payload.MerchantCategory
+	}
+
+	if payload.Website != "" {
+		updates["website"] = payload.Website
+	}
+
+	updates["updated_at"] = time.Now()
+
+	// A new name is screened like the name the merchant was created with,
+	// so a listed name can not be taken by renaming.
+	renamed := payload.Name != "" && payload.Name != merchant.Name
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(merchant).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if !renamed {
+			return nil
+		}
+
+		_, err := services.ScreenName(tx, user.ID, merchant.ID, models.ScreeningSubjectMerchant, payload.Name)
+
+		return err
+	})
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	merchant, _ = services.FindUserMerchant(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"merchant": models.MerchantFilterRecord(merchant),
+		},
+	})
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"bytes"
+
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type MetricsController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewMetricsController(config *config.Config, logger *zerolog.Logger) *MetricsController {
+	return &MetricsController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ShowController exposes operational metrics in the Prometheus text format.
+//
+// @Summary Operational metrics
+// @Description Returns outbox relay metrics (published, failed, given up, pending events and relay lag) in the Prometheus text format. Only administrators can read them.
+// @Tags Metrics
+// @Produce plain
+// @Security ApiKeyAuth
+// @Success 200 {string} string "Prometheus metrics"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Router /metrics [get]
+func (c *MetricsController) ShowController(ctx *fiber.Ctx) error {
+	var buf bytes.Buffer
+	services.OutboxMetrics.WritePrometheus(&buf)
+
+	ctx.Set(fiber.HeaderContentType, "text/plain; version=0.0.4")
+
+	return ctx.Send(buf.Bytes())
+}
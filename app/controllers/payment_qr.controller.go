@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/qrcode"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const defaultPaymentQRExpiresIn = 3600
+
+type PaymentQRController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewPaymentQRController(config *config.Config, logger *zerolog.Logger) *PaymentQRController {
+	return &PaymentQRController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// CreateController creates a signed payment request for a wallet.
+//
+// @Summary Create a payment request QR payload
+// @Description Creates a server signed payment request for one of the user's wallets that can be shown to a payer as a QR code.
+// @Tags Payment QR
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.PaymentQRCreateRequest true "Payment request payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 500 {object} response.ServerError
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/qr [post]
+func (c *PaymentQRController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	var payload *models.PaymentQRCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	expiresIn := payload.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = defaultPaymentQRExpiresIn
+	}
+
+	id := uuid.New()
+	now := time.Now()
+	qr := models.PaymentQRPayload{
+		ID:        &id,
+		Address:   wallet.Address,
+		Amount:    math.Round(payload.Amount*100) / 100,
+		Currency:  wallet.Currency,
+		Reference: payload.Reference,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Duration(expiresIn) * time.Second).Unix(),
+	}
+
+	token, err := utils.SignPaymentQR(c.Config.PaymentSigningSecret, &qr)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(response.ServerError{
+			Success: false,
+			Message: response.SERVER_ERROR_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentQRFilterRecord(&qr, token),
+		},
+	})
+}
+
+// ImageController renders a signed payment request as a QR image.
+//
+// @Summary Render a payment request QR image
+// @Description Renders a payment request payload created for the wallet as a PNG or SVG QR code.
+// @Tags Payment QR
+// @Produce png
+// @Produce image/svg+xml
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload query string true "Signed payment request payload"
+// @Param format query string false "Image format, png (default) or svg"
+// @Param size query int false "Image size in pixels, 128-1024 (default 256)"
+// @Success 200 {file} binary
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 500 {object} response.ServerError
+// @Router /wallet/{address}/qr [get]
+func (c *PaymentQRController) ImageController(ctx *fiber.Ctx) error {
+	address := utils.ParseAddressFromCtx(ctx)
+
+	qr, err := utils.VerifyPaymentQR(c.Config.PaymentSigningSecret, ctx.Query("payload"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if qr.Address != address {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "The payment QR code does not belong to this wallet",
+		})
+	}
+
+	size := ctx.QueryInt("size", 256)
+	if size < 128 || size > 1024 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Image size must be between 128 and 1024 pixels",
+		})
+	}
+
+	var image []byte
+
+	switch ctx.Query("format", qrcode.FormatPNG) {
+	case qrcode.FormatPNG:
+		image, err = qrcode.PNG(ctx.Query("payload"), size)
+		ctx.Type("png")
+	case qrcode.FormatSVG:
+		image, err = qrcode.SVG(ctx.Query("payload"), size)
+		ctx.Type("svg")
+	default:
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Image format not supported, allowed formats: png, svg",
+		})
+	}
+
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(response.ServerError{
+			Success: false,
+			Message: response.SERVER_ERROR_MSG,
+		})
+	}
+
+	return ctx.Send(image)
+}
+
+// DecodeController validates a scanned payment request.
+//
+// @Summary Preview a scanned payment request
+// @Description Validates the signature and expiry of a scanned payment request and shows who is being paid before the payer confirms.
+// @Tags Payment QR
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.PaymentQRDecodeRequest true "Scanned payment request"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-qr/decode [post]
+func (c *PaymentQRController) DecodeController(ctx *fiber.Ctx) error {
+	var payload *models.PaymentQRDecodeRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	qr, err := utils.VerifyPaymentQR(c.Config.PaymentSigningSecret, payload.Payload)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	wallet, err := services.FindWalletByAddress(database.DB, qr.Address)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "The wallet of this payment request no longer exists",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if wallet.Currency != qr.Currency {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "The wallet of this payment request no longer accepts " + qr.Currency,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentQRPreviewFilterRecord(qr, wallet),
+		},
+	})
+}
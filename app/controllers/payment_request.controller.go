@@ -0,0 +1,453 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+const defaultPaymentRequestExpiresIn = 7 * 24 * 3600
+
+type PaymentRequestController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewPaymentRequestController(config *config.Config, logger *zerolog.Logger) *PaymentRequestController {
+	return &PaymentRequestController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the payment requests of the user.
+//
+// @Summary List payment requests
+// @Description Retrieve the payment requests the authenticated user sent (outgoing) or received (incoming)
+// @Tags Payment Request
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param role query string false "incoming or outgoing, both when empty"
+// @Param status query string false "Filter by status"
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-request [get]
+func (c *PaymentRequestController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	query := database.DB.Preload("Requester").Preload("Payer").Preload("Wallet")
+	switch ctx.Query("role") {
+	case "incoming":
+		query = query.Where("payer_id = ?", fmt.Sprint(user.ID))
+	case "outgoing":
+		query = query.Where("requester_id = ?", fmt.Sprint(user.ID))
+	default:
+		query = query.Where("payer_id = ? or requester_id = ?", fmt.Sprint(user.ID), fmt.Sprint(user.ID))
+	}
+
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var requests []models.PaymentRequest
+	result := query.Order("created_at desc").Limit(100).Find(&requests)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.PaymentRequestResponse, 0, len(requests))
+	for i := range requests {
+		res = append(res, models.PaymentRequestFilterRecord(&requests[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_requests": res,
+		},
+	})
+}
+
+// ShowController retrieves a payment request.
+//
+// @Summary Show a payment request
+// @Description Retrieve a payment request the authenticated user is the requester or the payer of
+// @Tags Payment Request
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Payment request ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-request/{id} [get]
+func (c *PaymentRequestController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	request, err := services.FindUserPaymentRequest(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payment request with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	fee, err := services.QuoteFee(database.DB, models.FeeOperationTransfer, request.Currency, request.Amount)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentRequestFilterRecord(request),
+			"fee":             fee,
+		},
+	})
+}
+
+// CreateController asks another user for money.
+//
+// @Summary Create a payment request
+// @Description Asks the payer, given by @handle or by one of their wallet addresses, to pay an amount into a wallet of the authenticated user.
+// @Tags Payment Request
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.PaymentRequestCreateRequest true "Payment request payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-request [post]
+func (c *PaymentRequestController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.PaymentRequestCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	toAddress, err := utils.ValidateWalletAddress(payload.ToAddress)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), toAddress, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	payer, err := services.ResolvePayer(database.DB, payload.Payer)
+	if err != nil {
+		if services.IsRecipientError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	expiresIn := payload.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = defaultPaymentRequestExpiresIn
+	}
+
+	request, err := services.CreatePaymentRequest(database.DB, services.PaymentRequestParams{
+		RequesterID: user.ID,
+		Wallet:      wallet,
+		Payer:       payer,
+		Amount:      payload.Amount,
+		Note:        payload.Note,
+		ExpiresAt:   time.Now().Add(time.Duration(expiresIn) * time.Second),
+	})
+
+	if err != nil {
+		if services.IsPaymentRequestError(err) || services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentRequestFilterRecord(request),
+		},
+	})
+}
+
+// AcceptController pays a payment request.
+//
+// @Summary Accept a payment request
+// @Description Pays a pending payment request the authenticated user received from one of their wallets. Amounts that need approval under the approval policy of the wallet are refused.
+// @Tags Payment Request
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Payment request ID" format("uuid")
+// @Param payload body models.PaymentRequestAcceptRequest true "Payment request accept payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-request/{id}/accept [post]
+func (c *PaymentRequestController) AcceptController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.PaymentRequestAcceptRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	fromAddress, err := utils.ValidateWalletAddress(payload.FromAddress)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	from, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), fromAddress, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	request, err := services.PayPaymentRequest(database.DB.WithContext(services.WithRequestDevice(ctx.UserContext(), utils.ParseDeviceFromCtx(ctx))), ctx.Params("id"), user.ID, from.ID)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payment request with this id was not found",
+			})
+		}
+
+		if services.IsPaymentRequestError(err) || services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentRequestFilterRecord(request),
+		},
+	})
+}
+
+// DeclineController declines a payment request.
+//
+// @Summary Decline a payment request
+// @Description Declines a pending payment request the authenticated user received, the requester is notified.
+// @Tags Payment Request
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Payment request ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-request/{id}/decline [post]
+func (c *PaymentRequestController) DeclineController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	request, err := services.DeclinePaymentRequest(database.DB, ctx.Params("id"), fmt.Sprint(user.ID))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payment request with this id was not found",
+			})
+		}
+
+		if services.IsPaymentRequestError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentRequestFilterRecord(request),
+		},
+	})
+}
+
+// CancelController cancels a payment request.
+//
+// @Summary Cancel a payment request
+// @Description Withdraws a pending payment request the authenticated user sent, the payer is notified.
+// @Tags Payment Request
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Payment request ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /payment-request/{id}/cancel [post]
+func (c *PaymentRequestController) CancelController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	request, err := services.CancelPaymentRequest(database.DB, ctx.Params("id"), fmt.Sprint(user.ID))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payment request with this id was not found",
+			})
+		}
+
+		if services.IsPaymentRequestError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payment_request": models.PaymentRequestFilterRecord(request),
+		},
+	})
+}
@@ -0,0 +1,483 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type PayoutController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewPayoutController(config *config.Config, logger *zerolog.Logger) *PayoutController {
+	return &PayoutController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the payout batches of a wallet.
+//
+// @Summary List payout batches
+// @Description Retrieve the latest payout batches of a wallet the authenticated user has access to, newest first, without their items
+// @Tags Payout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param status query string false "Filter by status: draft, processing, completed or cancelled"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/payouts [get]
+func (c *PayoutController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	batches, err := services.FindWalletPayoutBatches(database.DB, fmt.Sprint(wallet.ID), ctx.Query("status"))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.PayoutBatchResponse, 0, len(batches))
+	for i := range batches {
+		res = append(res, models.PayoutBatchFilterRecord(&batches[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payouts": res,
+		},
+	})
+}
+
+// CreateController uploads a payout file.
+//
+// @Summary Upload a payout file
+// @Description Uploads a CSV with a recipient (wallet address or @handle, the column may also be called address or handle), amount and optional reference column, at most 1000 rows and 1 MB. Every row is validated first: when any row can not be paid, nothing is created and the errors of all the rows are returned. Otherwise the file is saved as a draft batch with the total amount and fees as a preview, nothing is paid until the batch is executed.
+// @Tags Payout
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param file formData file true "Payout CSV"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid file, errors lists the rows that can not be paid"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Viewers of the wallet can not do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/payouts [post]
+func (c *PayoutController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	filename, content, err := readPayoutFile(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	batch, rowErrors, err := services.CreatePayoutBatch(database.DB, wallet, user.ID, filename, content)
+	if err != nil {
+		if services.IsPayoutError(err) {
+			res := response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			}
+			if len(rowErrors) > 0 {
+				res.Errors = rowErrors
+			}
+
+			return ctx.Status(fiber.StatusBadRequest).JSON(res)
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payout":            models.PayoutBatchFilterRecord(batch),
+			"available_balance": wallet.AvailableBalance(),
+			"sufficient_funds":  wallet.AvailableBalance() >= batch.Total,
+		},
+	})
+}
+
+// ShowController retrieves a payout batch.
+//
+// @Summary Show a payout batch
+// @Description Retrieve a payout batch of a wallet with the status of every item
+// @Tags Payout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Payout batch ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/payouts/{id} [get]
+func (c *PayoutController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	batch, err := services.FindWalletPayoutBatch(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payout batch with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payout": models.PayoutBatchFilterRecord(batch),
+		},
+	})
+}
+
+// ExecuteController starts paying a draft payout batch.
+//
+// @Summary Execute a payout batch
+// @Description Starts paying a draft payout batch in the background, one transfer per item. The available balance of the wallet must cover the total of the batch. Items that can not be paid, e.g. because the recipient was frozen since the upload, fail without stopping the others. A payout_batch.completed event is sent when every item was processed. When the wallet has an approval policy and the total amount of the batch reaches its threshold, the total is held and the batch is awaiting_approval instead, it starts once enough other owners approve the transfer approval given by approval.
+// @Tags Payout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Payout batch ID" format("uuid")
+// @Success 202 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Viewers of the wallet can not do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/payouts/{id}/execute [post]
+func (c *PayoutController) ExecuteController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	batch, err := services.ExecutePayoutBatch(database.DB, wallet, ctx.Params("id"), user.ID)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payout batch with this id was not found",
+			})
+		}
+
+		if services.IsPayoutError(err) || services.IsApprovalError(err) || services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payout": models.PayoutBatchFilterRecord(batch),
+		},
+	})
+}
+
+// DeleteController cancels a draft payout batch.
+//
+// @Summary Cancel a payout batch
+// @Description Discards a draft payout batch, batches that were executed can not be cancelled
+// @Tags Payout
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Payout batch ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Viewers of the wallet can not do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/payouts/{id} [delete]
+func (c *PayoutController) DeleteController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	batch, err := services.CancelPayoutBatch(database.DB, wallet, ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payout batch with this id was not found",
+			})
+		}
+
+		if services.IsPayoutError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"payout": models.PayoutBatchFilterRecord(batch),
+		},
+	})
+}
+
+// ResultController downloads the result of a payout batch.
+//
+// @Summary Download the result of a payout batch
+// @Description Downloads a CSV with the status, transaction reference and error of every item of a payout batch, in the order of the uploaded file
+// @Tags Payout
+// @Produce text/csv
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Payout batch ID" format("uuid")
+// @Success 200 {file} file
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/payouts/{id}/result [get]
+func (c *PayoutController) ResultController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	batch, err := services.FindWalletPayoutBatch(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Payout batch with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	content, name, err := services.RenderPayoutResult(batch)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	return ctx.Send(content)
+}
+
+// readPayoutFile reads the uploaded payout CSV.
+func readPayoutFile(ctx *fiber.Ctx) (string, []byte, error) {
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return "", nil, services.ErrPayoutMissing
+	}
+
+	if header.Size > services.PayoutMaxFileSize {
+		return "", nil, services.ErrPayoutFileSize
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, services.PayoutMaxFileSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return header.Filename, content, nil
+}
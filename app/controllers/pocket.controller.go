@@ -0,0 +1,567 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type PocketController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewPocketController(config *config.Config, logger *zerolog.Logger) *PocketController {
+	return &PocketController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the pockets of a wallet.
+//
+// @Summary List pockets
+// @Description Retrieve the pockets of a wallet of the authenticated user with their progress towards their target
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets [get]
+func (c *PocketController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	pockets, err := services.FindWalletPockets(database.DB, fmt.Sprint(wallet.ID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.PocketResponse, 0, len(pockets))
+	for i := range pockets {
+		res = append(res, models.PocketFilterRecord(&pockets[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"wallet":  models.WalletFilterRecord(wallet),
+			"pockets": res,
+		},
+	})
+}
+
+// ShowController retrieves a pocket.
+//
+// @Summary Show a pocket
+// @Description Retrieve a pocket of a wallet of the authenticated user with its latest movements
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Pocket ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets/{id} [get]
+func (c *PocketController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	pocket, err := services.FindWalletPocket(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Pocket with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var movements []models.PocketMovement
+	result := database.DB.Where("pocket_id = ?", fmt.Sprint(pocket.ID)).Order("created_at desc").Limit(50).Find(&movements)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := models.PocketFilterRecord(pocket)
+	for i := range movements {
+		res.Movements = append(res.Movements, models.PocketMovementFilterRecord(&movements[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"pocket": res,
+		},
+	})
+}
+
+// CreateController creates a pocket in a wallet.
+//
+// @Summary Create a pocket
+// @Description Creates an empty pocket in a wallet of the authenticated user, with an optional target amount and date. With round_up_to every outgoing transfer of the wallet is rounded up to a multiple of it and the difference is saved into the pocket, with auto_save a fixed amount is saved on a schedule. Automatic savings stop once the target is reached. A wallet can have at most 10 pockets.
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.PocketCreateRequest true "Pocket payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets [post]
+func (c *PocketController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.PocketCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	pocket, err := services.CreatePocket(database.DB, wallet, payload)
+	if err != nil {
+		if services.IsPocketError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"pocket": models.PocketFilterRecord(pocket),
+		},
+	})
+}
+
+// UpdateController updates a pocket.
+//
+// @Summary Update a pocket
+// @Description Changes the name, target and automatic savings of a pocket. A zero target_amount or round_up_to and an empty target_date remove them, disable_auto_save stops the scheduled savings. Only one pocket of a wallet saves round ups, setting round_up_to turns it off on the other pockets.
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Pocket ID" format("uuid")
+// @Param payload body models.PocketUpdateRequest true "Pocket update payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets/{id} [patch]
+func (c *PocketController) UpdateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	pocket, err := services.FindWalletPocket(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Pocket with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.PocketUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	pocket, err = services.UpdatePocket(database.DB, pocket, payload)
+	if err != nil {
+		if services.IsPocketError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"pocket": models.PocketFilterRecord(pocket),
+		},
+	})
+}
+
+// DeleteController deletes a pocket.
+//
+// @Summary Delete a pocket
+// @Description Deletes a pocket, its balance is moved back to the main balance of the wallet
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Pocket ID" format("uuid")
+// @Success 204 "No Content"
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets/{id} [delete]
+func (c *PocketController) DeleteController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	pocket, err := services.FindWalletPocket(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err == nil {
+		err = services.DeletePocket(database.DB, pocket)
+	}
+
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Pocket with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// DepositController moves money from the wallet into a pocket.
+//
+// @Summary Move money into a pocket
+// @Description Sets part of the available balance of the wallet aside in the pocket. The move is instant and free, no transaction is made.
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Pocket ID" format("uuid")
+// @Param payload body models.PocketMoveRequest true "Move payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets/{id}/deposit [post]
+func (c *PocketController) DepositController(ctx *fiber.Ctx) error {
+	return c.move(ctx, 1)
+}
+
+// WithdrawController moves money from a pocket back into the wallet.
+//
+// @Summary Move money out of a pocket
+// @Description Moves money from the pocket back to the available balance of the wallet. The move is instant and free, no transaction is made.
+// @Tags Pocket
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Pocket ID" format("uuid")
+// @Param payload body models.PocketMoveRequest true "Move payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/pockets/{id}/withdraw [post]
+func (c *PocketController) WithdrawController(ctx *fiber.Ctx) error {
+	return c.move(ctx, -1)
+}
+
+// move moves the requested amount into the pocket when sign is positive and
+// out of it when sign is negative.
+func (c *PocketController) move(ctx *fiber.Ctx, sign float64) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	pocket, err := services.FindWalletPocket(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Pocket with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.PocketMoveRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	pocket, err = services.MovePocketFunds(database.DB, pocket, sign*payload.Amount)
+	if err != nil {
+		if services.IsPocketError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	wallet, err = services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"pocket": models.PocketFilterRecord(pocket),
+			"wallet": models.WalletFilterRecord(wallet),
+		},
+	})
+}
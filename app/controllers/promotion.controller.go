@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type PromotionController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewPromotionController(config *config.Config, logger *zerolog.Logger) *PromotionController {
+	return &PromotionController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// CheckController checks a promo code.
+//
+// @Summary Check a promo code
+// @Description Shows the promotion of a code and the cashback it would pay the authenticated user on a transfer or payment of the given amount and currency made now. Fails with the reason when the user is not eligible.
+// @Tags Promotion
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.PromotionCheckRequest true "Promo code check payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /promotions/check [post]
+func (c *PromotionController) CheckController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.PromotionCheckRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	campaign, cashback, err := services.CheckPromotion(database.DB, user.ID, payload)
+	if err != nil {
+		if services.IsPromotionError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"promotion": models.PromotionFilterRecord(campaign),
+			"cashback":  cashback,
+		},
+	})
+}
+
+// RedeemController redeems a promo code.
+//
+// @Summary Redeem a promo code
+// @Description Claims the cashback of a promo code for a transfer or payment the authenticated user sent, given by its reference. The cashback is credited to the wallet that paid. A transaction earns cashback at most once, and refunded or reversed transactions do not qualify.
+// @Tags Promotion
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.PromotionRedeemRequest true "Promo code redemption payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /promotions/redeem [post]
+func (c *PromotionController) RedeemController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.PromotionRedeemRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	redemption, err := services.RedeemPromotion(database.DB, user.ID, payload)
+	if err != nil {
+		if services.IsPromotionError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"redemption": models.PromotionRedemptionFilterRecord(redemption),
+		},
+	})
+}
+
+// RedemptionsController retrieves the promo codes the user redeemed.
+//
+// @Summary List my redemptions
+// @Description Retrieve the latest promo codes the authenticated user redeemed, newest first, with the cashback they earned
+// @Tags Promotion
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /promotions/redemptions [get]
+func (c *PromotionController) RedemptionsController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	redemptions, err := services.FindPromotionRedemptions(database.DB, "", fmt.Sprint(user.ID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.PromotionRedemptionResponse, 0, len(redemptions))
+	for i := range redemptions {
+		res = append(res, models.PromotionRedemptionFilterRecord(&redemptions[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"redemptions": res,
+		},
+	})
+}
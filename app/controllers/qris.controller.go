@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/qris"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type QRISController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewQRISController(config *config.Config, logger *zerolog.Logger) *QRISController {
+	return &QRISController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// CreateController generates a QRIS payload for a wallet.
+//
+// @Summary Generate a QRIS merchant payload
+// @Description Generates a QRIS compatible merchant presented payload for a merchant settlement wallet, with the merchant name and, unless given, its city and category. Without an amount the payload is static and the payer enters the amount, with an amount it is dynamic.
+// @Tags QRIS
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.QRISCreateRequest true "QRIS creation payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/qris [post]
+func (c *QRISController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	var payload *models.QRISCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if wallet.MerchantID == nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: services.ErrNotMerchantWallet.Error(),
+		})
+	}
+
+	merchant, err := services.FindUserMerchant(database.DB, fmt.Sprint(wallet.UserID), fmt.Sprint(wallet.MerchantID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if payload.MerchantCity == "" {
+		payload.MerchantCity = merchant.City
+	}
+
+	if payload.MerchantCategory == "" {
+		payload.MerchantCategory = merchant.MerchantCategory
+	}
+
+	data, err := utils.BuildWalletQRIS(wallet, merchant.Name, payload)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	p, _ := qris.Parse(data)
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"qris": utils.QRISFilterRecord(data, p, merchant),
+		},
+	})
+}
+
+// ParseController decodes a scanned QRIS payload.
+//
+// @Summary Parse a scanned QRIS payload
+// @Description Validates the CRC of a scanned QRIS payload and shows the merchant, amount, the fee when the amount is known and whether it can be paid with Rosamsoe. Payloads of Rosamsoe merchant wallets show the name, city and category of the merchant rather than those written in the payload.
+// @Tags QRIS
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.QRISParseRequest true "Scanned QRIS payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Router /qris/parse [post]
+func (c *QRISController) ParseController(ctx *fiber.Ctx) error {
+	var payload *models.QRISParseRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	p, err := qris.Parse(payload.Payload)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	var merchant *models.Merchant
+	if address, ok := utils.QRISWalletAddress(p); ok {
+		wallet, found, err := services.FindMerchantWallet(database.DB, address)
+		if err != nil && !database.IsRecordNotFoundError(err) && err != services.ErrNotMerchantWallet {
+			c.Logger.Error().Err(err).Send()
+
+			return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+				Success: false,
+				Message: response.BAD_GATEWAY_MSG,
+			})
+		}
+
+		if currency, _ := qris.CurrencyName(p.Currency); err == nil && currency == wallet.Currency {
+			merchant = found
+		}
+	}
+
+	res := utils.QRISFilterRecord(payload.Payload, p, merchant)
+
+	data := fiber.Map{
+		"qris": res,
+	}
+
+	if res.Payable && res.Amount > 0 {
+		fee, err := services.QuoteFee(database.DB, models.FeeOperationPayment, res.Currency, res.Amount)
+		if err != nil {
+			c.Logger.Error().Err(err).Send()
+
+			return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+				Success: false,
+				Message: response.BAD_GATEWAY_MSG,
+			})
+		}
+
+		data["fee"] = fee
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// PayController pays a scanned QRIS payload.
+//
+// @Summary Pay a scanned QRIS payload
+// @Description Pays the merchant settlement wallet of a scanned QRIS payload from one of the user's wallets, payloads of other wallets are refused. Static payloads require an amount. When the wallet has an approval policy and the amount reaches its threshold, the total is held and a transfer approval is returned with status 202 instead, the payment is made once enough other owners of the wallet approve it.
+// @Tags QRIS
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.QRISPayRequest true "QRIS payment payload"
+// @Success 201 {object} response.Success
+// @Success 202 {object} response.Success "The payment waits for approval"
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /qris/pay [post]
+func (c *QRISController) PayController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.QRISPayRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	p, err := qris.Parse(payload.Payload)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	merchantAddress, ok := utils.QRISWalletAddress(p)
+	if !ok {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "This QRIS code can not be paid with Rosamsoe",
+		})
+	}
+
+	amount := p.Amount
+	if !p.Dynamic {
+		amount = payload.Amount
+	} else if payload.Amount > 0 && utils.RoundAmount(payload.Amount) != utils.RoundAmount(p.Amount) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "The amount does not match the amount of the QRIS code",
+		})
+	}
+
+	if amount <= 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "This QRIS code is static, please enter the amount to pay",
+		})
+	}
+
+	fromAddress, err := utils.ValidateWalletAddress(payload.FromAddress)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	from, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), fromAddress, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	to, merchant, err := services.FindMerchantWallet(database.DB, merchantAddress)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "The merchant wallet of this QRIS code no longer exists",
+			})
+		}
+
+		if err == services.ErrNotMerchantWallet {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "This QRIS code can not be paid with Rosamsoe",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if currency, _ := qris.CurrencyName(p.Currency); currency != to.Currency {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "The currency of this QRIS code does not match the merchant wallet",
+		})
+	}
+
+	description := "QRIS payment to " + merchant.Name
+	if p.BillNumber != "" {
+		description += " (" + p.BillNumber + ")"
+	}
+
+	db := database.DB.WithContext(services.WithRequestDevice(ctx.UserContext(), utils.ParseDeviceFromCtx(ctx)))
+
+	transaction, approval, err := services.SendWalletTransfer(db, from, to, to.Address, user.ID, models.TransactionTypePayment, amount, description)
+	if err != nil {
+		if services.IsTransferError(err) || services.IsApprovalError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if approval != nil {
+		return ctx.Status(fiber.StatusAccepted).JSON(response.Success{
+			Success: true,
+			Data: fiber.Map{
+				"approval": models.TransferApprovalFilterRecord(approval),
+			},
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"transaction": models.TransactionFilterRecord(transaction),
+		},
+	})
+}
@@ -0,0 +1,588 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type RecurringTransferController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewRecurringTransferController(config *config.Config, logger *zerolog.Logger) *RecurringTransferController {
+	return &RecurringTransferController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the recurring transfers of a wallet.
+//
+// @Summary List recurring transfers
+// @Description Retrieve the recurring transfers sent from a wallet of the authenticated user
+// @Tags Recurring Transfer
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/recurring [get]
+func (c *RecurringTransferController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var rules []models.RecurringTransfer
+	result := database.DB.Preload("Wallet").Where("wallet_id = ?", fmt.Sprint(wallet.ID)).Order("created_at desc").Find(&rules)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.RecurringTransferResponse, 0, len(rules))
+	for i := range rules {
+		res = append(res, models.RecurringTransferFilterRecord(&rules[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"recurring_transfers": res,
+		},
+	})
+}
+
+// ShowController retrieves a recurring transfer with its latest runs.
+//
+// @Summary Show a recurring transfer
+// @Description Retrieve a recurring transfer of a wallet with the results of its latest occurrences
+// @Tags Recurring Transfer
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Recurring transfer ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/recurring/{id} [get]
+func (c *RecurringTransferController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	rule, err := services.FindWalletRecurringTransfer(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Recurring transfer with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var runs []models.RecurringTransferRun
+	result := database.DB.Preload("Transaction").Where("recurring_transfer_id = ?", fmt.Sprint(rule.ID)).
+		Order("scheduled_for desc").Limit(20).Find(&runs)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := models.RecurringTransferFilterRecord(rule)
+	for i := range runs {
+		res.Runs = append(res.Runs, models.RecurringTransferRunFilterRecord(&runs[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"recurring_transfer": res,
+		},
+	})
+}
+
+// CreateController creates a recurring transfer from a wallet.
+//
+// @Summary Create a recurring transfer
+// @Description Schedules a transfer of a fixed amount from the wallet to a wallet address or @handle, daily, weekly, monthly or on a cron expression. Amounts that need approval under the approval policy of the wallet are refused.
+// @Tags Recurring Transfer
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.RecurringTransferCreateRequest true "Recurring transfer payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/recurring [post]
+func (c *RecurringTransferController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.RecurringTransferCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	expr, timezone, err := services.RecurringSchedule(&payload.RecurringTransferScheduleRequest)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	recipient, err := services.ResolveRecipient(database.DB, payload.Recipient, wallet.Currency)
+	if err != nil {
+		if services.IsRecipientError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if recipient.ID.String() == wallet.ID.String() {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: services.ErrSameWallet.Error(),
+		})
+	}
+
+	if err := services.CheckPaymentApproval(database.DB, wallet.ID, payload.Amount); err != nil {
+		if err == services.ErrApprovalUnsupported {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	startAt := time.Now()
+	if payload.StartAt != nil {
+		startAt = *payload.StartAt
+	}
+
+	if payload.EndAt != nil && payload.EndAt.Before(startAt) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "The end date must be after the start date",
+		})
+	}
+
+	// Handles are stored as given, so later occurrences follow the
+	// recipient's default wallet, addresses in their canonical form.
+	recipientName := payload.Recipient
+	if !utils.IsHandle(recipientName) {
+		recipientName = recipient.Address
+	}
+
+	newRule := models.RecurringTransfer{
+		UserID:         user.ID,
+		WalletID:       wallet.ID,
+		Wallet:         *wallet,
+		Recipient:      recipientName,
+		Amount:         utils.RoundAmount(payload.Amount),
+		Currency:       wallet.Currency,
+		Description:    payload.Description,
+		Frequency:      payload.Frequency,
+		Cron:           expr,
+		Timezone:       timezone,
+		StartAt:        &startAt,
+		EndAt:          payload.EndAt,
+		MaxOccurrences: payload.MaxOccurrences,
+		Status:         models.RecurringStatusActive,
+	}
+
+	newRule.NextRunAt = services.NextRecurringRun(&newRule, time.Now())
+	if newRule.NextRunAt == nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: services.ErrRecurringEnded.Error(),
+		})
+	}
+
+	result := database.DB.Omit("User", "Wallet").Create(&newRule)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"recurring_transfer": models.RecurringTransferFilterRecord(&newRule),
+		},
+	})
+}
+
+// UpdateController updates, pauses or resumes a recurring transfer.
+//
+// @Summary Update a recurring transfer
+// @Description Changes the schedule, amount or end of a recurring transfer, or pauses and resumes it with the status field. Amounts that need approval under the approval policy of the wallet are refused.
+// @Tags Recurring Transfer
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Recurring transfer ID" format("uuid")
+// @Param payload body models.RecurringTransferUpdateRequest true "Recurring transfer update payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/recurring/{id} [patch]
+func (c *RecurringTransferController) UpdateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	rule, err := services.FindWalletRecurringTransfer(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Recurring transfer with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if rule.Status != models.RecurringStatusActive && rule.Status != models.RecurringStatusPaused {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: services.ErrRecurringStatus.Error(),
+		})
+	}
+
+	var payload *models.RecurringTransferUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	if payload.Schedule != nil {
+		expr, timezone, err := services.RecurringSchedule(payload.Schedule)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		rule.Frequency, rule.Cron, rule.Timezone = payload.Schedule.Frequency, expr, timezone
+	}
+
+	if payload.Amount > 0 {
+		rule.Amount = utils.RoundAmount(payload.Amount)
+	}
+
+	if payload.Description != nil {
+		rule.Description = *payload.Description
+	}
+
+	if err := services.CheckPaymentApproval(database.DB, wallet.ID, rule.Amount); err != nil {
+		if err == services.ErrApprovalUnsupported {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if payload.EndAt != nil {
+		rule.EndAt = payload.EndAt
+	}
+
+	if payload.MaxOccurrences != nil {
+		rule.MaxOccurrences = *payload.MaxOccurrences
+	}
+
+	if payload.Status != "" {
+		rule.Status = payload.Status
+	}
+
+	rule.NextRunAt = services.NextRecurringRun(rule, time.Now())
+	if rule.NextRunAt == nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: services.ErrRecurringEnded.Error(),
+		})
+	}
+
+	result := database.DB.Model(rule).Updates(map[string]interface{}{
+		"frequency":       rule.Frequency,
+		"cron":            rule.Cron,
+		"timezone":        rule.Timezone,
+		"amount":          rule.Amount,
+		"description":     rule.Description,
+		"end_at":          rule.EndAt,
+		"max_occurrences": rule.MaxOccurrences,
+		"status":          rule.Status,
+		"next_run_at":     rule.NextRunAt,
+		"updated_at":      time.Now(),
+	})
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"recurring_transfer": models.RecurringTransferFilterRecord(rule),
+		},
+	})
+}
+
+// DeleteController cancels a recurring transfer.
+//
+// @Summary Cancel a recurring transfer
+// @Description Cancels a recurring transfer, no further occurrences are executed. The history of earlier occurrences is kept.
+// @Tags Recurring Transfer
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Recurring transfer ID" format("uuid")
+// @Success 204 "No Content"
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/recurring/{id} [delete]
+func (c *RecurringTransferController) DeleteController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	rule, err := services.FindWalletRecurringTransfer(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Recurring transfer with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	result := database.DB.Model(rule).Updates(map[string]interface{}{
+		"status":      models.RecurringStatusCancelled,
+		"next_run_at": nil,
+		"updated_at":  time.Now(),
+	})
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
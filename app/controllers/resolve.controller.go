@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type ResolveController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewResolveController(config *config.Config, logger *zerolog.Logger) *ResolveController {
+	return &ResolveController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ShowController resolves a payment handle.
+//
+// @Summary Resolve a payment handle
+// @Description Resolve a @handle to the public name of the user and the default wallet address for every currency they can receive.
+// @Tags Resolve
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param handle path string true "Payment handle, e.g. @alice"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /resolve/{handle} [get]
+func (c *ResolveController) ShowController(ctx *fiber.Ctx) error {
+	handle, err := utils.NormalizeHandle(ctx.Params("handle"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	user, err := services.FindUserByHandle(database.DB, handle)
+	if err != nil {
+		if err == services.ErrHandleNotFound {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	wallets, err := services.DefaultWallets(database.DB, user.ID.String())
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	walletRes := []models.WalletReceiveResponse{}
+	for _, w := range wallets {
+		walletRes = append(walletRes, models.WalletReceiveFilterRecord(&w))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"handle":  user.Handle,
+			"name":    user.Name,
+			"alias":   user.Handle == nil || *user.Handle != handle,
+			"wallets": walletRes,
+		},
+	})
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type SplitBillController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewSplitBillController(config *config.Config, logger *zerolog.Logger) *SplitBillController {
+	return &SplitBillController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ListController retrieves the split bills of the user.
+//
+// @Summary List split bills
+// @Description Retrieve the split bills created by the authenticated user with how much has been collected
+// @Tags Split Bill
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /split-bill [get]
+func (c *SplitBillController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var bills []models.SplitBill
+	result := database.DB.Preload("Wallet").Preload("Requests.Requester").Preload("Requests.Payer").Preload("Requests.Wallet").
+		Where("requester_id = ?", fmt.Sprint(user.ID)).Order("created_at desc").Limit(100).Find(&bills)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.SplitBillResponse, 0, len(bills))
+	for i := range bills {
+		res = append(res, models.SplitBillFilterRecord(&bills[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"split_bills": res,
+		},
+	})
+}
+
+// ShowController retrieves a split bill.
+//
+// @Summary Show a split bill
+// @Description Retrieve a split bill of the authenticated user with its payment requests and collected total
+// @Tags Split Bill
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Split bill ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /split-bill/{id} [get]
+func (c *SplitBillController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	bill, err := services.FindUserSplitBill(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Split bill with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"split_bill": models.SplitBillFilterRecord(bill),
+		},
+	})
+}
+
+// CreateController splits a bill between several users.
+//
+// @Summary Create a split bill
+// @Description Splits a total between participants, given by @handle or wallet address, by sending each of them a linked payment request. Without amounts the total is split equally, optionally including the requester.
+// @Tags Split Bill
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.SplitBillCreateRequest true "Split bill payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /split-bill [post]
+func (c *SplitBillController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.SplitBillCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	toAddress, err := utils.ValidateWalletAddress(payload.ToAddress)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), toAddress, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	amounts := make([]float64, 0, len(payload.Participants))
+	for _, p := range payload.Participants {
+		amounts = append(amounts, p.Amount)
+	}
+
+	shares, err := services.SplitBillShares(payload.TotalAmount, payload.IncludeRequester, amounts)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	participants := make([]services.SplitBillParticipant, 0, len(payload.Participants))
+	for i, p := range payload.Participants {
+		payer, err := services.ResolvePayer(database.DB, p.Payer)
+		if err != nil {
+			if services.IsRecipientError(err) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+					Success: false,
+					Message: p.Payer + ": " + err.Error(),
+				})
+			}
+
+			c.Logger.Error().Err(err).Send()
+
+			return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+				Success: false,
+				Message: response.BAD_GATEWAY_MSG,
+			})
+		}
+
+		participants = append(participants, services.SplitBillParticipant{Payer: payer, Amount: shares[i]})
+	}
+
+	expiresIn := payload.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = defaultPaymentRequestExpiresIn
+	}
+
+	bill, err := services.CreateSplitBill(database.DB, user.ID, wallet, payload.Title, payload.TotalAmount, participants,
+		time.Now().Add(time.Duration(expiresIn)*time.Second))
+	if err != nil {
+		if services.IsPaymentRequestError(err) || services.IsTransferError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"split_bill": models.SplitBillFilterRecord(bill),
+		},
+	})
+}
+
+// CancelController cancels a split bill.
+//
+// @Summary Cancel a split bill
+// @Description Cancels an open split bill and every payment request of it that is still pending. Paid requests are not refunded.
+// @Tags Split Bill
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Split bill ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /split-bill/{id}/cancel [post]
+func (c *SplitBillController) CancelController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	bill, err := services.CancelSplitBill(database.DB, fmt.Sprint(user.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Split bill with this id was not found",
+			})
+		}
+
+		if services.IsPaymentRequestError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"split_bill": models.SplitBillFilterRecord(bill),
+		},
+	})
+}
@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/fatfatcocofat/rosamsoe/platform/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type StatementController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewStatementController(config *config.Config, logger *zerolog.Logger) *StatementController {
+	return &StatementController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ShowController generates the statement of a wallet.
+//
+// @Summary Download a wallet statement
+// @Description Generates a statement with the opening balance, every transaction and the closing balance of a wallet between two dates, both included, as CSV or PDF. The PDF includes the details of the account holder. Periods longer than 31 days or with more than 1000 transactions are generated in the background: the response is then 202 with a statement whose download_url can be used once it is completed, a statement.ready event is sent at that moment. Dates are in the server's time zone.
+// @Tags Wallet
+// @Produce text/csv,application/pdf,json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param from query string false "First day, YYYY-MM-DD, defaults to the first day of the current month"
+// @Param to query string false "Last day, YYYY-MM-DD, defaults to today"
+// @Param format query string false "csv (default) or pdf"
+// @Success 200 {file} binary
+// @Success 202 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/statement [get]
+func (c *StatementController) ShowController(ctx *fiber.Ctx) error {
+	from, to, err := services.ParseStatementPeriod(ctx.Query("from"), ctx.Query("to"), time.Now())
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	format, err := services.ParseStatementFormat(ctx.Query("format"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	async, err := services.StatementNeedsExport(database.DB, wallet, from, to)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if async {
+		export, err := services.CreateStatementExport(database.DB, wallet, from, to, format)
+		if err != nil {
+			c.Logger.Error().Err(err).Send()
+
+			return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+				Success: false,
+				Message: response.BAD_GATEWAY_MSG,
+			})
+		}
+
+		return ctx.Status(fiber.StatusAccepted).JSON(response.Success{
+			Success: true,
+			Data: fiber.Map{
+				"statement": models.StatementExportFilterRecord(export),
+			},
+		})
+	}
+
+	statement, err := services.BuildStatement(database.DB, wallet, from, to)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	content, contentType, name, err := services.RenderStatement(statement, format)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	ctx.Set(fiber.HeaderContentType, contentType)
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	return ctx.Send(content)
+}
+
+// ExportController retrieves a statement generated in the background.
+//
+// @Summary Show a wallet statement export
+// @Description Retrieve the status of a statement that is generated in the background, with its download_url once it is completed. Statements can be downloaded for 7 days.
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Statement ID" format("uuid")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/statements/{id} [get]
+func (c *StatementController) ExportController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	export, err := services.FindStatementExport(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Statement with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"statement": models.StatementExportFilterRecord(export),
+		},
+	})
+}
+
+// DownloadController downloads a statement generated in the background.
+//
+// @Summary Download a wallet statement export
+// @Description Downloads a completed statement that was generated in the background.
+// @Tags Wallet
+// @Produce text/csv,application/pdf,json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param id path string true "Statement ID" format("uuid")
+// @Success 200 {file} binary
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/statements/{id}/download [get]
+func (c *StatementController) DownloadController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	export, err := services.FindStatementExport(database.DB, fmt.Sprint(wallet.ID), ctx.Params("id"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Statement with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	content, contentType, name, err := services.OpenStatementExport(storage.Storage, export)
+	if err != nil {
+		if services.IsStatementError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	ctx.Set(fiber.HeaderContentType, contentType)
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	return ctx.Send(content)
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type TransactionController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewTransactionController(config *config.Config, logger *zerolog.Logger) *TransactionController {
+	return &TransactionController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// ShowController retrieves a transaction of a wallet.
+//
+// @Summary Show a transaction
+// @Description Retrieve a transaction sent or received by a wallet of the authenticated user, together with its refunds and reversals
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param reference path string true "Transaction reference" format("string")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/transactions/{reference} [get]
+func (c *TransactionController) ShowController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	transaction, err := services.FindWalletTransaction(database.DB, fmt.Sprint(wallet.ID), ctx.Params("reference"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Transaction with this reference was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	refunds, err := services.FindTransactionRefunds(database.DB, fmt.Sprint(transaction.ID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	res := make([]models.TransactionResponse, 0, len(refunds))
+	for i := range refunds {
+		res = append(res, models.TransactionFilterRecord(&refunds[i]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"transaction": models.TransactionFilterRecord(transaction),
+			"refunds":     res,
+		},
+	})
+}
+
+// RefundController refunds a received transaction.
+//
+// @Summary Refund a transaction
+// @Description Sends all or part of a received transfer, payment or payout back to the sender. Without an amount everything that has not been refunded yet is refunded. Refunds can never exceed the original amount together.
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param reference path string true "Transaction reference" format("string")
+// @Param payload body models.TransactionRefundRequest true "Refund payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/transactions/{reference}/refund [post]
+func (c *TransactionController) RefundController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	transaction, err := services.FindWalletTransaction(database.DB, fmt.Sprint(wallet.ID), ctx.Params("reference"))
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Transaction with this reference was not found",
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if transaction.ToWalletID == nil || transaction.ToWalletID.String() != wallet.ID.String() {
+		return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+			Success: false,
+			Message: "Only the receiving wallet can refund this transaction",
+		})
+	}
+
+	var payload *models.TransactionRefundRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	refund, err := services.RefundTransaction(database.DB, services.RefundParams{
+		TransactionID: transaction.ID,
+		Type:          models.TransactionTypeRefund,
+		Amount:        payload.Amount,
+		Description:   payload.Description,
+		InitiatedByID: user.ID,
+	})
+	if err != nil {
+		if services.IsRefundError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"refund": models.TransactionFilterRecord(refund),
+		},
+	})
+}
+
+// CreateController sends money from a wallet.
+//
+// @Summary Send money
+// @Description Sends money from a wallet of the authenticated user to a recipient, given by wallet address or @handle. When the wallet has an approval policy and the amount reaches its threshold, the total is held and a transfer approval is returned with status 202 instead, the transfer is made once enough other owners of the wallet approve it.
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Param payload body models.WalletTransferRequest true "Transfer payload"
+// @Success 201 {object} response.Success
+// @Success 202 {object} response.Success "The transfer waits for approval"
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Your role in this wallet does not allow this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/transactions [post]
+func (c *TransactionController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessSpend)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.WalletTransferRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	recipient, err := services.ResolveRecipient(database.DB, payload.Recipient, wallet.Currency)
+	if err != nil {
+		if services.IsRecipientError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	db := database.DB.WithContext(services.WithRequestDevice(ctx.UserContext(), utils.ParseDeviceFromCtx(ctx)))
+
+	transaction, approval, err := services.SendWalletTransfer(db, wallet, recipient, payload.Recipient, user.ID, models.TransactionTypeTransfer, payload.Amount, payload.Description)
+	if err != nil {
+		if services.IsTransferError(err) || services.IsApprovalError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if approval != nil {
+		return ctx.Status(fiber.StatusAccepted).JSON(response.Success{
+			Success: true,
+			Data: fiber.Map{
+				"approval": models.TransferApprovalFilterRecord(approval),
+			},
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"transaction": models.TransactionFilterRecord(transaction),
+		},
+	})
+}
@@ -1,12 +1,19 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/fatfatcocofat/rosamsoe/app/response"
 
 	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
 	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
+	"gorm.io/gorm"
 )
 
 type UserController struct {
@@ -42,3 +49,195 @@ func (c *UserController) InfoController(ctx *fiber.Ctx) error {
 		},
 	})
 }
+
+// UpdateHandleController sets or changes the payment handle of the user.
+//
+// @Summary Set user payment handle
+// @Description Claim a unique @handle that other users can send payments to. Previous handles stay reserved for the user.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.UserHandleRequest true "User handle payload"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /user/handle [put]
+func (c *UserController) UpdateHandleController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.UserHandleRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	handle, err := utils.NormalizeHandle(payload.Handle)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if user.Handle != nil && *user.Handle == handle {
+		var current models.User
+		if err := database.DB.First(&current, "id = ?", user.ID.String()).Error; err != nil {
+			c.Logger.Error().Err(err).Send()
+			return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+				Success: false,
+				Message: response.BAD_GATEWAY_MSG,
+			})
+		}
+
+		return ctx.JSON(response.Success{
+			Success: true,
+			Data: fiber.Map{
+				"user": models.UserFilterRecord(&current),
+			},
+		})
+	}
+
+	var alias models.UserHandleAlias
+	result := database.DB.Where("handle = ?", handle).First(&alias)
+	if result.Error == nil && alias.UserID.String() != user.ID.String() {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "This handle is already taken",
+		})
+	} else if result.Error != nil && !database.IsRecordNotFoundError(result.Error) {
+		c.Logger.Error().Err(result.Error).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var updated models.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		if err := tx.Model(&models.UserHandleAlias{}).Where("user_id = ? and retired_at is null", user.ID.String()).Update("retired_at", now).Error; err != nil {
+			return err
+		}
+
+		if alias.ID != nil {
+			if err := tx.Model(&alias).Update("retired_at", nil).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Create(&models.UserHandleAlias{UserID: user.ID, Handle: handle}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID.String()).Updates(map[string]interface{}{"handle": handle, "updated_at": now}).Error; err != nil {
+			return err
+		}
+
+		return tx.First(&updated, "id = ?", user.ID.String()).Error
+	})
+
+	if err != nil && database.IsDuplicateError(err) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "This handle is already taken",
+		})
+	} else if err != nil {
+		c.Logger.Error().Err(err).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"user": models.UserFilterRecord(&updated),
+		},
+	})
+}
+
+// HandleHistoryController lists the handles of the user.
+//
+// @Summary List user handle history
+// @Description Retrieve the current and previous handles of the authenticated user.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /user/handle [get]
+func (c *UserController) HandleHistoryController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var aliases []models.UserHandleAlias
+	result := database.DB.Where("user_id = ?", user.ID.String()).Order("created_at desc").Find(&aliases)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	aliasRes := []models.UserHandleAliasResponse{}
+	for _, a := range aliases {
+		aliasRes = append(aliasRes, models.UserHandleAliasFilterRecord(&a))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"handle":  user.Handle,
+			"history": aliasRes,
+		},
+	})
+}
+
+// LimitsController shows the limits of the user.
+//
+// @Summary Get user limits
+// @Description Retrieve the limits of the KYC tier of the authenticated user in every currency, how much of them is used and what remains. A null limit means there is no limit.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /user/limits [get]
+func (c *UserController) LimitsController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	limits, err := services.GetUserLimits(database.DB, user.ID)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"tier":   user.KYCTier,
+			"limits": limits,
+		},
+	})
+}
@@ -7,12 +7,14 @@ import (
 
 	"github.com/fatfatcocofat/rosamsoe/app/models"
 	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
 	"github.com/fatfatcocofat/rosamsoe/app/utils"
 	"github.com/fatfatcocofat/rosamsoe/pkg/config"
 	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
 	"github.com/fatfatcocofat/rosamsoe/platform/database"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
+	"gorm.io/gorm"
 )
 
 type WalletController struct {
@@ -30,7 +32,7 @@ func NewWalletController(config *config.Config, logger *zerolog.Logger) *WalletC
 // ListController retrieves wallet information.
 //
 // @Summary List user's wallets
-// @Description Retrieve a list of wallets belonging to the authenticated user
+// @Description Retrieve a list of wallets the authenticated user owns or is a member of, with the role of the user in each wallet
 // @Tags Wallet
 // @Accept json
 // @Produce json
@@ -42,10 +44,9 @@ func NewWalletController(config *config.Config, logger *zerolog.Logger) *WalletC
 func (c *WalletController) ListController(ctx *fiber.Ctx) error {
 	user := utils.ParseUserFromCtx(ctx)
 
-	var wallets []models.Wallet
-	results := database.DB.Preload("User").Where("user_id = ?", fmt.Sprint(user.ID)).Find(&wallets)
-	if results.Error != nil {
-		c.Logger.Error().Err(results.Error).Send()
+	wallets, err := services.FindUserWallets(database.DB, fmt.Sprint(user.ID))
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
 			Message: response.BAD_GATEWAY_MSG,
@@ -75,7 +76,7 @@ func (c *WalletController) ListController(ctx *fiber.Ctx) error {
 // @Security ApiKeyAuth
 // @Param address path string true "Wallet address" format("string")
 // @Success 200 {object} response.Success
-// @Failure 400 {object} response.BadRequest
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
 // @Failure 401 {object} response.Unauthorized
 // @Failure 404 {object} response.NotFound
 // @Failure 500 {object} response.ServerError
@@ -83,26 +84,18 @@ func (c *WalletController) ListController(ctx *fiber.Ctx) error {
 // @Router /wallet/{address} [get]
 func (c *WalletController) ShowController(ctx *fiber.Ctx) error {
 	user := utils.ParseUserFromCtx(ctx)
-	address := ctx.Params("address")
+	address := utils.ParseAddressFromCtx(ctx)
 
-	if address == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
-			Success: false,
-			Message: "Invalid wallet address",
-		})
-	}
-
-	var wallet models.Wallet
-	result := database.DB.Preload("User").Where("user_id = ? and address = ?", fmt.Sprint(user.ID), address).First(&wallet)
-	if result.Error != nil {
-		if database.IsRecordNotFoundError(result.Error) {
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessView)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
 			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
 				Success: false,
 				Message: "Wallet data with this address was not found",
 			})
 		}
 
-		c.Logger.Error().Err(result.Error).Send()
+		c.Logger.Error().Err(err).Send()
 
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
@@ -113,7 +106,7 @@ func (c *WalletController) ShowController(ctx *fiber.Ctx) error {
 	return ctx.JSON(response.Success{
 		Success: true,
 		Data: fiber.Map{
-			"wallet": models.WalletFilterRecord(&wallet),
+			"wallet": models.WalletFilterRecord(wallet),
 		},
 	})
 }
@@ -160,7 +153,7 @@ func (c *WalletController) CreateController(ctx *fiber.Ctx) error {
 	}
 
 	var wallets []models.Wallet
-	results := database.DB.Where("user_id = ?", fmt.Sprint(user.ID)).Find(&wallets)
+	results := database.DB.Where("user_id = ? and merchant_id is null", fmt.Sprint(user.ID)).Find(&wallets)
 	if results.Error != nil {
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
@@ -176,30 +169,44 @@ func (c *WalletController) CreateController(ctx *fiber.Ctx) error {
 	}
 
 	newWallet := models.Wallet{
-		UserID:   user.ID,
-		Currency: strings.ToUpper(payload.Currency),
+		UserID:    user.ID,
+		Currency:  strings.ToUpper(payload.Currency),
+		IsDefault: true,
 	}
 
-	for {
-		address, err := utils.GenerateWalletAddress()
-		if err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(response.ServerError{
-				Success: false,
-				Message: response.SERVER_ERROR_MSG,
-			})
-		}
-
-		var wallet models.Wallet
-		result := database.DB.First(&wallet, "address = ?", address)
-		if result.Error != nil { // FIX: It is currently assumed that the error is record not found.
-			newWallet.Address = address
+	for _, w := range wallets {
+		if w.Currency == newWallet.Currency && w.IsDefault {
+			newWallet.IsDefault = false
 			break
 		}
 	}
 
-	result := database.DB.Create(&newWallet)
-	if result.Error != nil {
-		c.Logger.Error().Err(result.Error).Send()
+	address, err := services.GenerateUniqueWalletAddress(database.DB)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusInternalServerError).JSON(response.ServerError{
+			Success: false,
+			Message: response.SERVER_ERROR_MSG,
+		})
+	}
+
+	newWallet.Address = address
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newWallet).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Preload("User").First(&newWallet, "address = ?", newWallet.Address).Error; err != nil {
+			return err
+		}
+
+		return services.PublishEvent(tx, user.ID, nil, models.EventWalletCreated, models.WalletFilterRecord(&newWallet))
+	})
+
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
 
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
@@ -207,8 +214,6 @@ func (c *WalletController) CreateController(ctx *fiber.Ctx) error {
 		})
 	}
 
-	database.DB.Preload("User").First(&newWallet, "address = ?", newWallet.Address)
-
 	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
 		Success: true,
 		Data: fiber.Map{
@@ -220,51 +225,64 @@ func (c *WalletController) CreateController(ctx *fiber.Ctx) error {
 // DeleteController delete wallet by address.
 //
 // @Summary Delete a specific wallet
-// @Description Deletes a wallet with the specified address for the authenticated user
+// @Description Deletes a wallet with the specified address for the authenticated user. The wallet must have no balance, holds or money in pockets.
 // @Tags Wallet
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param address path string true "Wallet address" format("string")
 // @Success 204 "No Content"
-// @Failure 400 {object} response.BadRequest
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
 // @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
 // @Failure 404 {object} response.NotFound
 // @Failure 502 {object} response.BadGateway
 // @Router /wallet/{address} [delete]
 func (c *WalletController) DeleteController(ctx *fiber.Ctx) error {
 	user := utils.ParseUserFromCtx(ctx)
-	address := ctx.Params("address")
-
-	if address == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
-			Success: false,
-			Message: "Invalid wallet address",
-		})
-	}
+	address := utils.ParseAddressFromCtx(ctx)
 
-	var wallet models.Wallet
-	result := database.DB.Where("user_id = ? and address = ?", fmt.Sprint(user.ID), address).First(&wallet)
-	if result.Error != nil {
-		if database.IsRecordNotFoundError(result.Error) {
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
 			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
 				Success: false,
 				Message: "Wallet data with this address was not found",
 			})
 		}
 
-		c.Logger.Error().Err(result.Error).Send()
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
 
-		return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
-			Message: "Wallet data with this address was not found",
+			Message: response.BAD_GATEWAY_MSG,
 		})
 	}
 
-	result = database.DB.Delete(&models.Wallet{}, "id = ?", fmt.Sprint(wallet.ID))
+	if wallet.MerchantID != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Merchant settlement wallets can not be deleted",
+		})
+	}
 
-	if result.Error != nil || result.RowsAffected == 0 {
-		c.Logger.Error().Err(result.Error).Send()
+	err = services.DeleteWallet(database.DB, wallet)
+	if err != nil {
+		if services.IsWalletDeleteError(err) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
 
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
@@ -278,7 +296,7 @@ func (c *WalletController) DeleteController(ctx *fiber.Ctx) error {
 // UpdateController update wallet by address.
 //
 // @Summary Update details of a specific wallet
-// @Description Updates details of a wallet with the specified address for the authenticated user
+// @Description Updates details of a wallet with the specified address for the authenticated user. The currency can only be changed while the wallet has no transactions.
 // @Tags Wallet
 // @Accept json
 // @Produce json
@@ -286,37 +304,37 @@ func (c *WalletController) DeleteController(ctx *fiber.Ctx) error {
 // @Param address path string true "Wallet address" format("string")
 // @Param payload body models.WalletUpdateRequest true "Wallet update request payload"
 // @Success 200 {object} response.Success
-// @Failure 400 {object} response.BadRequest
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
 // @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
 // @Failure 404 {object} response.NotFound
 // @Failure 502 {object} response.BadGateway
 // @Router /wallets/{address} [put]
 func (c *WalletController) UpdateController(ctx *fiber.Ctx) error {
 	user := utils.ParseUserFromCtx(ctx)
-	address := ctx.Params("address")
+	address := utils.ParseAddressFromCtx(ctx)
 
-	if address == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
-			Success: false,
-			Message: "Invalid wallet address",
-		})
-	}
-
-	var wallet models.Wallet
-	result := database.DB.Where("user_id = ? and address = ?", fmt.Sprint(user.ID), address).First(&wallet)
-	if result.Error != nil {
-		if database.IsRecordNotFoundError(result.Error) {
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
 			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
 				Success: false,
 				Message: "Wallet data with this address was not found",
 			})
 		}
 
-		c.Logger.Error().Err(result.Error).Send()
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
 
-		return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
-			Message: "Wallet data with this address was not found",
+			Message: response.BAD_GATEWAY_MSG,
 		})
 	}
 
@@ -339,6 +357,13 @@ func (c *WalletController) UpdateController(ctx *fiber.Ctx) error {
 	updates := make(map[string]interface{})
 
 	if payload.Currency != "" {
+		if wallet.MerchantID != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "The currency of merchant settlement wallets can not be changed",
+			})
+		}
+
 		if !utils.ValidWalletCurrency(payload.Currency) {
 			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
 				Success: false,
@@ -347,21 +372,64 @@ func (c *WalletController) UpdateController(ctx *fiber.Ctx) error {
 		}
 
 		updates["currency"] = strings.ToUpper(payload.Currency)
+
+		if updates["currency"] != wallet.Currency {
+			// Amounts in the ledger are in the currency of the wallet, they
+			// would silently change value with it.
+			var entries int64
+			if err := database.DB.Model(&models.LedgerEntry{}).Where("wallet_id = ?", fmt.Sprint(wallet.ID)).Count(&entries).Error; err != nil {
+				c.Logger.Error().Err(err).Send()
+
+				return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+					Success: false,
+					Message: response.BAD_GATEWAY_MSG,
+				})
+			}
+
+			if entries > 0 {
+				return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+					Success: false,
+					Message: "The currency of a wallet with transactions can not be changed",
+				})
+			}
+
+			updates["is_default"] = false
+		}
 	}
 
 	updates["updated_at"] = time.Now()
 
-	result = database.DB.Model(&wallet).Updates(updates)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		previousCurrency := wallet.Currency
+
+		if err := tx.Model(wallet).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if updates["is_default"] == false {
+			for _, currency := range []string{previousCurrency, updates["currency"].(string)} {
+				if err := services.EnsureDefaultWallet(tx, fmt.Sprint(wallet.UserID), currency); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Preload("User").First(wallet, "id = ?", fmt.Sprint(wallet.ID)).Error; err != nil {
+			return err
+		}
+
+		return services.PublishEvent(tx, wallet.UserID, wallet.MerchantID, models.EventWalletUpdated, models.WalletFilterRecord(wallet))
+	})
+
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
 
-	if result.Error != nil {
 		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
 			Success: false,
 			Message: response.BAD_GATEWAY_MSG,
 		})
 	}
 
-	database.DB.Preload("User").Where("user_id = ? and address = ?", fmt.Sprint(user.ID), address).First(&wallet)
-
 	return ctx.Status(fiber.StatusOK).JSON(response.Success{
 		Success: true,
 		Data: fiber.Map{
@@ -369,3 +437,90 @@ func (c *WalletController) UpdateController(ctx *fiber.Ctx) error {
 		},
 	})
 }
+
+// DefaultController marks a wallet as the default for its currency.
+//
+// @Summary Set the default wallet for a currency
+// @Description Marks the wallet as the one that receives payments sent to the user's @handle in the wallet currency.
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param address path string true "Wallet address" format("string")
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest "Invalid or mistyped wallet address"
+// @Failure 401 {object} response.Unauthorized
+// @Failure 403 {object} response.Forbidden "Only owners of the wallet can do this"
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /wallet/{address}/default [put]
+func (c *WalletController) DefaultController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+	address := utils.ParseAddressFromCtx(ctx)
+
+	wallet, err := services.FindUserWallet(database.DB, fmt.Sprint(user.ID), address, models.WalletAccessManage)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Wallet data with this address was not found",
+			})
+		}
+
+		if err == services.ErrWalletPermission {
+			return ctx.Status(fiber.StatusForbidden).JSON(response.Forbidden{
+				Success: false,
+				Message: err.Error(),
+			})
+		}
+
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if wallet.MerchantID != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Merchant settlement wallets can not be used as default wallet",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Wallet{}).
+			Where("user_id = ? and currency = ? and id <> ?", fmt.Sprint(wallet.UserID), wallet.Currency, fmt.Sprint(wallet.ID)).
+			Update("is_default", false).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(wallet).Updates(map[string]interface{}{"is_default": true, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Preload("User").First(wallet, "id = ?", fmt.Sprint(wallet.ID)).Error; err != nil {
+			return err
+		}
+
+		return services.PublishEvent(tx, wallet.UserID, nil, models.EventWalletUpdated, models.WalletFilterRecord(wallet))
+	})
+
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"wallet": models.WalletFilterRecord(wallet),
+		},
+	})
+}
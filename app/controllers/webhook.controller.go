@@ -0,0 +1,484 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/response"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/validator"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type WebhookController struct {
+	Config *config.Config
+	Logger *zerolog.Logger
+}
+
+func NewWebhookController(config *config.Config, logger *zerolog.Logger) *WebhookController {
+	return &WebhookController{
+		Config: config,
+		Logger: logger,
+	}
+}
+
+// validWebhookEvents checks the subscribed event types and joins them for storage.
+func validWebhookEvents(events []string) (string, bool) {
+	for _, e := range events {
+		valid := e == models.EventTypeAll
+		for _, t := range models.EventTypes {
+			valid = valid || e == t
+		}
+
+		if !valid {
+			return "", false
+		}
+	}
+
+	return strings.Join(events, ","), true
+}
+
+// ListController retrieves the webhook endpoints of the user.
+//
+// @Summary List webhook endpoints
+// @Description Retrieve the webhook endpoints registered by the authenticated user
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Success
+// @Failure 401 {object} response.Unauthorized
+// @Failure 502 {object} response.BadGateway
+// @Router /webhook [get]
+func (c *WebhookController) ListController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var endpoints []models.WebhookEndpoint
+	results := database.DB.Where("user_id = ?", fmt.Sprint(user.ID)).Order("created_at").Find(&endpoints)
+	if results.Error != nil {
+		c.Logger.Error().Err(results.Error).Send()
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	endpointRes := []models.WebhookEndpointResponse{}
+	for _, e := range endpoints {
+		endpointRes = append(endpointRes, models.WebhookEndpointFilterRecord(&e, false))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"webhooks":    endpointRes,
+			"event_types": models.EventTypes,
+		},
+	})
+}
+
+// CreateController registers a webhook endpoint.
+//
+// @Summary Register a webhook endpoint
+// @Description Registers a URL that receives HMAC-SHA256 signed event notifications. The signing secret is only returned once.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param payload body models.WebhookEndpointCreateRequest true "Webhook endpoint payload"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 500 {object} response.ServerError
+// @Failure 502 {object} response.BadGateway
+// @Router /webhook [post]
+func (c *WebhookController) CreateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var payload *models.WebhookEndpointCreateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	events, ok := validWebhookEvents(payload.Events)
+	if !ok {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Event type not supported, allowed event types: " + strings.Join(models.EventTypes, ", "),
+		})
+	}
+
+	if !strings.HasPrefix(payload.URL, "https://") && !strings.HasPrefix(payload.URL, "http://") {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Webhook URL must use http or https",
+		})
+	}
+
+	secret, err := utils.GenerateSecret("whsec_")
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(response.ServerError{
+			Success: false,
+			Message: response.SERVER_ERROR_MSG,
+		})
+	}
+
+	newEndpoint := models.WebhookEndpoint{
+		UserID: user.ID,
+		URL:    payload.URL,
+		Secret: secret,
+		Events: events,
+		Active: true,
+	}
+
+	if payload.MerchantID != "" {
+		merchant, err := services.FindUserMerchant(database.DB, fmt.Sprint(user.ID), payload.MerchantID)
+		if err != nil {
+			if database.IsRecordNotFoundError(err) {
+				return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+					Success: false,
+					Message: "Merchant with this id was not found",
+				})
+			}
+
+			c.Logger.Error().Err(err).Send()
+
+			return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+				Success: false,
+				Message: response.BAD_GATEWAY_MSG,
+			})
+		}
+
+		newEndpoint.MerchantID = merchant.ID
+	}
+
+	result := database.DB.Create(&newEndpoint)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"webhook": models.WebhookEndpointFilterRecord(&newEndpoint, true),
+		},
+	})
+}
+
+// UpdateController update webhook endpoint by id.
+//
+// @Summary Update a webhook endpoint
+// @Description Changes the URL or subscribed events of a webhook endpoint, or disables it
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook endpoint ID" format("uuid")
+// @Param payload body models.WebhookEndpointUpdateRequest true "Webhook endpoint update payload"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /webhook/{id} [patch]
+func (c *WebhookController) UpdateController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var endpoint models.WebhookEndpoint
+	result := database.DB.Where("user_id = ? and id = ?", fmt.Sprint(user.ID), ctx.Params("id")).First(&endpoint)
+	if result.Error != nil {
+		if database.IsRecordNotFoundError(result.Error) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Webhook endpoint with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	var payload *models.WebhookEndpointUpdateRequest
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	errors := validator.ValidateStruct(payload)
+	if errors != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Errors:  errors,
+		})
+	}
+
+	updates := make(map[string]interface{})
+
+	if payload.URL != "" {
+		if !strings.HasPrefix(payload.URL, "https://") && !strings.HasPrefix(payload.URL, "http://") {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "Webhook URL must use http or https",
+			})
+		}
+
+		updates["url"] = payload.URL
+	}
+
+	if len(payload.Events) > 0 {
+		events, ok := validWebhookEvents(payload.Events)
+		if !ok {
+			return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+				Success: false,
+				Message: "Event type not supported, allowed event types: " + strings.Join(models.EventTypes, ", "),
+			})
+		}
+
+		updates["events"] = events
+	}
+
+	if payload.Active != nil {
+		updates["active"] = *payload.Active
+	}
+
+	updates["updated_at"] = time.Now()
+
+	result = database.DB.Model(&endpoint).Updates(updates)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	database.DB.First(&endpoint, "id = ?", fmt.Sprint(endpoint.ID))
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"webhook": models.WebhookEndpointFilterRecord(&endpoint, false),
+		},
+	})
+}
+
+// DeleteController delete webhook endpoint by id.
+//
+// @Summary Delete a webhook endpoint
+// @Description Deletes a webhook endpoint together with its delivery log
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook endpoint ID" format("uuid")
+// @Success 204 "No Content"
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /webhook/{id} [delete]
+func (c *WebhookController) DeleteController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	result := database.DB.Where("user_id = ? and id = ?", fmt.Sprint(user.ID), ctx.Params("id")).Delete(&models.WebhookEndpoint{})
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+			Success: false,
+			Message: "Webhook endpoint with this id was not found",
+		})
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// DeliveriesController lists the delivery log of a webhook endpoint.
+//
+// @Summary List webhook deliveries
+// @Description Retrieve the latest deliveries of a webhook endpoint with every attempt made for them
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook endpoint ID" format("uuid")
+// @Param status query string false "Filter by status: pending, succeeded or failed"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /webhook/{id}/deliveries [get]
+func (c *WebhookController) DeliveriesController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	var endpoint models.WebhookEndpoint
+	result := database.DB.Where("user_id = ? and id = ?", fmt.Sprint(user.ID), ctx.Params("id")).First(&endpoint)
+	if result.Error != nil {
+		if database.IsRecordNotFoundError(result.Error) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Webhook endpoint with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	query := database.DB.Where("endpoint_id = ?", fmt.Sprint(endpoint.ID))
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	result = query.Order("created_at desc").Limit(100).Find(&deliveries)
+	if result.Error != nil {
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	ids := make([]string, 0, len(deliveries))
+	for _, d := range deliveries {
+		ids = append(ids, d.ID.String())
+	}
+
+	var attempts []models.WebhookAttempt
+	if len(ids) > 0 {
+		database.DB.Where("delivery_id in ?", ids).Order("created_at").Find(&attempts)
+	}
+
+	attemptsByDelivery := make(map[string][]models.WebhookAttempt)
+	for _, a := range attempts {
+		attemptsByDelivery[a.DeliveryID.String()] = append(attemptsByDelivery[a.DeliveryID.String()], a)
+	}
+
+	deliveryRes := []models.WebhookDeliveryResponse{}
+	for _, d := range deliveries {
+		deliveryRes = append(deliveryRes, models.WebhookDeliveryFilterRecord(&d, attemptsByDelivery[d.ID.String()]))
+	}
+
+	return ctx.JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"deliveries": deliveryRes,
+		},
+	})
+}
+
+// RedeliverController queues a delivery again.
+//
+// @Summary Redeliver a webhook event
+// @Description Queues a new delivery of the same event to the endpoint, e.g. after the receiver was fixed
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook endpoint ID" format("uuid")
+// @Param delivery path string true "Webhook delivery ID" format("uuid")
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.BadRequest
+// @Failure 401 {object} response.Unauthorized
+// @Failure 404 {object} response.NotFound
+// @Failure 502 {object} response.BadGateway
+// @Router /webhook/{id}/deliveries/{delivery}/redeliver [post]
+func (c *WebhookController) RedeliverController(ctx *fiber.Ctx) error {
+	user := utils.ParseUserFromCtx(ctx)
+
+	if _, err := uuid.Parse(ctx.Params("delivery")); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "Invalid delivery format",
+		})
+	}
+
+	var delivery models.WebhookDelivery
+	result := database.DB.Joins("Endpoint").
+		Where("\"Endpoint\".user_id = ? and \"Endpoint\".id = ? and webhook_deliveries.id = ?", fmt.Sprint(user.ID), ctx.Params("id"), ctx.Params("delivery")).
+		First(&delivery)
+	if result.Error != nil {
+		if database.IsRecordNotFoundError(result.Error) {
+			return ctx.Status(fiber.StatusNotFound).JSON(response.NotFound{
+				Success: false,
+				Message: "Webhook delivery with this id was not found",
+			})
+		}
+
+		c.Logger.Error().Err(result.Error).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	if !delivery.Endpoint.Active {
+		return ctx.Status(fiber.StatusBadRequest).JSON(response.BadRequest{
+			Success: false,
+			Message: "The webhook endpoint is disabled",
+		})
+	}
+
+	redelivery, err := services.RedeliverWebhook(database.DB, &delivery)
+	if err != nil {
+		c.Logger.Error().Err(err).Send()
+
+		return ctx.Status(fiber.StatusBadGateway).JSON(response.BadGateway{
+			Success: false,
+			Message: response.BAD_GATEWAY_MSG,
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(response.Success{
+		Success: true,
+		Data: fiber.Map{
+			"delivery": models.WebhookDeliveryFilterRecord(redelivery, nil),
+		},
+	})
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TransferApprovalPending   = "pending"
+	TransferApprovalExecuted  = "executed"
+	TransferApprovalRejected  = "rejected"
+	TransferApprovalCancelled = "cancelled"
+	TransferApprovalExpired   = "expired"
+	TransferApprovalFailed    = "failed"
+
+	ApprovalDecisionApprove = "approve"
+	ApprovalDecisionReject  = "reject"
+
+	// DefaultApprovalExpiresIn is how long, in seconds, a transfer waits for
+	// approval when the policy does not say otherwise.
+	DefaultApprovalExpiresIn = 24 * 60 * 60
+)
+
+// ApprovalPolicy puts a wallet under dual control. Transfers and payments of
+// at least Threshold initiated by any member of the wallet, and payout
+// batches totalling at least Threshold, must be approved by
+// RequiredApprovals owners other than the initiator before they are made.
+type ApprovalPolicy struct {
+	ID                *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID          *uuid.UUID `gorm:"type:uuid;uniqueIndex;not null"`
+	Wallet            Wallet     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Threshold         float64    `gorm:"type:numeric(18,2);not null"`
+	RequiredApprovals int        `gorm:"default:1;not null"`
+	ExpiresIn         int        `gorm:"default:86400;not null"`
+	UpdatedByID       *uuid.UUID `gorm:"type:uuid;default:null"`
+	CreatedAt         *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt         *time.Time `gorm:"default:null"`
+}
+
+// TransferApproval is a transfer or payment, as given by Type, waiting for
+// the approval of the owners of the wallet. The amount and the fee are
+// reserved by Hold until the transfer is executed, rejected, cancelled or
+// expires. An approval of Type payout is for the whole PayoutBatch, it has no
+// single recipient wallet and starts the batch when it is executed.
+type TransferApproval struct {
+	ID                *uuid.UUID                 `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID          *uuid.UUID                 `gorm:"type:uuid;index;not null"`
+	Wallet            Wallet                     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RequestedByID     *uuid.UUID                 `gorm:"type:uuid;index;not null"`
+	RequestedBy       User                       `gorm:"foreignKey:RequestedByID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Type              string                     `gorm:"type:varchar(50);default:'transfer';not null"`
+	Recipient         string                     `gorm:"type:varchar(100);not null"`
+	ToWalletID        *uuid.UUID                 `gorm:"type:uuid;default:null"`
+	ToWallet          Wallet                     `gorm:"foreignKey:ToWalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Amount            float64                    `gorm:"type:numeric(18,2);not null"`
+	Currency          string                     `gorm:"type:varchar(50);not null"`
+	Description       string                     `gorm:"type:varchar(255)"`
+	PayoutBatchID     *uuid.UUID                 `gorm:"type:uuid;index;default:null"`
+	HoldID            *uuid.UUID                 `gorm:"type:uuid;not null"`
+	Hold              Hold                       `gorm:"foreignKey:HoldID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RequiredApprovals int                        `gorm:"not null"`
+	Approvals         int                        `gorm:"default:0;not null"`
+	Status            string                     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	ExpiresAt         *time.Time                 `gorm:"index;not null"`
+	DecidedAt         *time.Time                 `gorm:"default:null"`
+	FailureReason     string                     `gorm:"type:varchar(255)"`
+	TransactionID     *uuid.UUID                 `gorm:"type:uuid;default:null"`
+	Transaction       *Transaction               `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Decisions         []TransferApprovalDecision `gorm:"foreignKey:ApprovalID"`
+	CreatedAt         *time.Time                 `gorm:"not null;default:now()"`
+	UpdatedAt         *time.Time                 `gorm:"default:null"`
+}
+
+// TransferApprovalDecision records the approval or the rejection of a
+// transfer by one owner. An owner decides at most once.
+type TransferApprovalDecision struct {
+	ID         *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	ApprovalID *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_transfer_approval_decisions_user;not null"`
+	UserID     *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_transfer_approval_decisions_user;not null"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Decision   string     `gorm:"type:varchar(50);not null"`
+	Comment    string     `gorm:"type:varchar(255)"`
+	CreatedAt  *time.Time `gorm:"not null;default:now()"`
+}
+
+type ApprovalPolicyResponse struct {
+	Wallet            string     `json:"wallet"`
+	Currency          string     `json:"currency"`
+	Threshold         float64    `json:"threshold"`
+	RequiredApprovals int        `json:"required_approvals"`
+	ExpiresIn         int        `json:"expires_in"`
+	CreatedAt         *time.Time `json:"created_at"`
+	UpdatedAt         *time.Time `json:"updated_at"`
+}
+
+type TransferApprovalResponse struct {
+	ID                *uuid.UUID                         `json:"id"`
+	Wallet            string                             `json:"wallet"`
+	RequestedBy       string                             `json:"requested_by"`
+	Type              string                             `json:"type"`
+	Recipient         string                             `json:"recipient"`
+	Amount            float64                            `json:"amount"`
+	Currency          string                             `json:"currency"`
+	Description       string                             `json:"description,omitempty"`
+	PayoutBatch       *uuid.UUID                         `json:"payout_batch,omitempty"`
+	HeldAmount        float64                            `json:"held_amount"`
+	RequiredApprovals int                                `json:"required_approvals"`
+	Approvals         int                                `json:"approvals"`
+	Status            string                             `json:"status"`
+	ExpiresAt         *time.Time                         `json:"expires_at"`
+	DecidedAt         *time.Time                         `json:"decided_at,omitempty"`
+	FailureReason     string                             `json:"failure_reason,omitempty"`
+	Decisions         []TransferApprovalDecisionResponse `json:"decisions"`
+	Transaction       *TransactionResponse               `json:"transaction,omitempty"`
+	CreatedAt         *time.Time                         `json:"created_at"`
+}
+
+type TransferApprovalDecisionResponse struct {
+	User      string     `json:"user"`
+	Decision  string     `json:"decision"`
+	Comment   string     `json:"comment,omitempty"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// ApprovalPolicyRequest sets the approval policy of a wallet. ExpiresIn is
+// in seconds, 24 hours when omitted.
+type ApprovalPolicyRequest struct {
+	Threshold         float64 `json:"threshold" validate:"required,gt=0"`
+	RequiredApprovals int     `json:"required_approvals" validate:"required,min=1,max=5"`
+	ExpiresIn         int     `json:"expires_in" validate:"omitempty,min=3600,max=604800"`
+}
+
+// WalletTransferRequest sends money to a recipient, given by address or
+// @handle.
+type WalletTransferRequest struct {
+	Recipient   string  `json:"recipient" validate:"required,max=100"`
+	Amount      float64 `json:"amount" validate:"required,gt=0"`
+	Description string  `json:"description" validate:"omitempty,max=255"`
+}
+
+type TransferApprovalDecisionRequest struct {
+	Comment string `json:"comment" validate:"omitempty,max=255"`
+}
+
+func ApprovalPolicyFilterRecord(policy *ApprovalPolicy) ApprovalPolicyResponse {
+	return ApprovalPolicyResponse{
+		Wallet:            policy.Wallet.Address,
+		Currency:          policy.Wallet.Currency,
+		Threshold:         policy.Threshold,
+		RequiredApprovals: policy.RequiredApprovals,
+		ExpiresIn:         policy.ExpiresIn,
+		CreatedAt:         policy.CreatedAt,
+		UpdatedAt:         policy.UpdatedAt,
+	}
+}
+
+func TransferApprovalFilterRecord(approval *TransferApproval) TransferApprovalResponse {
+	res := TransferApprovalResponse{
+		ID:                approval.ID,
+		Wallet:            approval.Wallet.Address,
+		RequestedBy:       approval.RequestedBy.Name,
+		Type:              approval.Type,
+		Recipient:         approval.Recipient,
+		Amount:            approval.Amount,
+		Currency:          approval.Currency,
+		Description:       approval.Description,
+		PayoutBatch:       approval.PayoutBatchID,
+		HeldAmount:        approval.Hold.Amount,
+		RequiredApprovals: approval.RequiredApprovals,
+		Approvals:         approval.Approvals,
+		Status:            approval.Status,
+		ExpiresAt:         approval.ExpiresAt,
+		DecidedAt:         approval.DecidedAt,
+		FailureReason:     approval.FailureReason,
+		Decisions:         make([]TransferApprovalDecisionResponse, 0, len(approval.Decisions)),
+		CreatedAt:         approval.CreatedAt,
+	}
+
+	for _, decision := range approval.Decisions {
+		res.Decisions = append(res.Decisions, TransferApprovalDecisionResponse{
+			User:      decision.User.Name,
+			Decision:  decision.Decision,
+			Comment:   decision.Comment,
+			CreatedAt: decision.CreatedAt,
+		})
+	}
+
+	if approval.Transaction != nil {
+		transaction := TransactionFilterRecord(approval.Transaction)
+		res.Transaction = &transaction
+	}
+
+	return res
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CheckoutStatusPending   = "pending"
+	CheckoutStatusPaid      = "paid"
+	CheckoutStatusExpired   = "expired"
+	CheckoutStatusCancelled = "cancelled"
+)
+
+// CheckoutSession is a single order of a merchant waiting to be paid by a
+// customer. Only pending sessions can be paid or cancelled.
+type CheckoutSession struct {
+	ID            *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	MerchantID    *uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_checkout_merchant_order"`
+	Merchant      Merchant     `gorm:"foreignKey:MerchantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	OrderID       string       `gorm:"type:varchar(100);not null;uniqueIndex:idx_checkout_merchant_order"`
+	Amount        float64      `gorm:"type:numeric(18,2);not null"`
+	Currency      string       `gorm:"type:varchar(50);not null"`
+	Description   string       `gorm:"type:varchar(255)"`
+	SuccessURL    string       `gorm:"type:varchar(500);not null"`
+	CancelURL     string       `gorm:"type:varchar(500);not null"`
+	Status        string       `gorm:"type:varchar(50);index;default:'pending';not null"`
+	ExpiresAt     *time.Time   `gorm:"not null"`
+	PaidAt        *time.Time   `gorm:"default:null"`
+	CancelledAt   *time.Time   `gorm:"default:null"`
+	TransactionID *uuid.UUID   `gorm:"type:uuid;default:null"`
+	Transaction   *Transaction `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	CreatedAt     *time.Time   `gorm:"not null;default:now()"`
+	UpdatedAt     *time.Time   `gorm:"default:null"`
+}
+
+type CheckoutSessionResponse struct {
+	ID          *uuid.UUID           `json:"id"`
+	Merchant    string               `json:"merchant"`
+	OrderID     string               `json:"order_id"`
+	Amount      float64              `json:"amount"`
+	Currency    string               `json:"currency"`
+	Description string               `json:"description,omitempty"`
+	SuccessURL  string               `json:"success_url"`
+	CancelURL   string               `json:"cancel_url"`
+	Status      string               `json:"status"`
+	ExpiresAt   *time.Time           `json:"expires_at"`
+	PaidAt      *time.Time           `json:"paid_at"`
+	CancelledAt *time.Time           `json:"cancelled_at"`
+	Transaction *TransactionResponse `json:"transaction,omitempty"`
+	CreatedAt   *time.Time           `json:"created_at"`
+}
+
+type CheckoutSessionCreateRequest struct {
+	OrderID     string  `json:"order_id" validate:"required,max=100"`
+	Amount      float64 `json:"amount" validate:"required,gt=0"`
+	Currency    string  `json:"currency" validate:"required"`
+	Description string  `json:"description" validate:"omitempty,max=255"`
+	SuccessURL  string  `json:"success_url" validate:"required,url,max=500"`
+	CancelURL   string  `json:"cancel_url" validate:"required,url,max=500"`
+	ExpiresIn   int     `json:"expires_in" validate:"omitempty,min=60,max=86400"`
+}
+
+type CheckoutSessionPayRequest struct {
+	FromAddress string `json:"from_address" validate:"required"`
+}
+
+func CheckoutSessionFilterRecord(session *CheckoutSession) CheckoutSessionResponse {
+	res := CheckoutSessionResponse{
+		ID:          session.ID,
+		Merchant:    session.Merchant.Name,
+		OrderID:     session.OrderID,
+		Amount:      session.Amount,
+		Currency:    session.Currency,
+		Description: session.Description,
+		SuccessURL:  session.SuccessURL,
+		CancelURL:   session.CancelURL,
+		Status:      session.Status,
+		ExpiresAt:   session.ExpiresAt,
+		PaidAt:      session.PaidAt,
+		CancelledAt: session.CancelledAt,
+		CreatedAt:   session.CreatedAt,
+	}
+
+	if session.Transaction != nil {
+		transaction := TransactionFilterRecord(session.Transaction)
+		res.Transaction = &transaction
+	}
+
+	return res
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventWalletCreated           = "wallet.created"
+	EventWalletUpdated           = "wallet.updated"
+	EventWalletDeleted           = "wallet.deleted"
+	EventWalletBalance           = "wallet.balance_changed"
+	EventTransferCompleted       = "transfer.completed"
+	EventPaymentCompleted        = "payment.completed"
+	EventRefundCompleted         = "refund.completed"
+	EventCashbackCompleted       = "cashback.completed"
+	EventReversalCompleted       = "reversal.completed"
+	EventCheckoutPaid            = "checkout.paid"
+	EventCheckoutExpired         = "checkout.expired"
+	EventCheckoutCancelled       = "checkout.cancelled"
+	EventRecurringFailed         = "recurring_transfer.failed"
+	EventRequestCreated          = "payment_request.created"
+	EventRequestPaid             = "payment_request.paid"
+	EventRequestDeclined         = "payment_request.declined"
+	EventRequestCancelled        = "payment_request.cancelled"
+	EventRequestExpired          = "payment_request.expired"
+	EventHoldCreated             = "hold.created"
+	EventHoldCaptured            = "hold.captured"
+	EventHoldReleased            = "hold.released"
+	EventHoldExpired             = "hold.expired"
+	EventKYCSubmitted            = "kyc.submitted"
+	EventKYCApproved             = "kyc.approved"
+	EventKYCRejected             = "kyc.rejected"
+	EventRiskReviewCreated       = "risk_review.created"
+	EventRiskReviewApproved      = "risk_review.approved"
+	EventRiskReviewRejected      = "risk_review.rejected"
+	EventStatementReady          = "statement.ready"
+	EventPocketMoved             = "pocket.moved"
+	EventPocketAutoSaveFailed    = "pocket.auto_save_failed"
+	EventWalletInvitationCreated = "wallet_invitation.created"
+	EventWalletMemberAdded       = "wallet_member.added"
+	EventApprovalRequested       = "transfer_approval.requested"
+	EventApprovalExecuted        = "transfer_approval.executed"
+	EventApprovalRejected        = "transfer_approval.rejected"
+	EventApprovalExpired         = "transfer_approval.expired"
+	EventApprovalFailed          = "transfer_approval.failed"
+	EventPayoutCompleted         = "payout_batch.completed"
+	EventTypeAll                 = "*"
+)
+
+var EventTypes = []string{
+	EventWalletCreated,
+	EventWalletUpdated,
+	EventWalletDeleted,
+	EventWalletBalance,
+	EventTransferCompleted,
+	EventPaymentCompleted,
+	EventRefundCompleted,
+	EventReversalCompleted,
+	EventCashbackCompleted,
+	EventCheckoutPaid,
+	EventCheckoutExpired,
+	EventCheckoutCancelled,
+	EventRecurringFailed,
+	EventRequestCreated,
+	EventRequestPaid,
+	EventRequestDeclined,
+	EventRequestCancelled,
+	EventRequestExpired,
+	EventHoldCreated,
+	EventHoldCaptured,
+	EventHoldReleased,
+	EventHoldExpired,
+	EventKYCSubmitted,
+	EventKYCApproved,
+	EventKYCRejected,
+	EventRiskReviewCreated,
+	EventRiskReviewApproved,
+	EventRiskReviewRejected,
+	EventStatementReady,
+	EventPocketMoved,
+	EventPocketAutoSaveFailed,
+	EventWalletInvitationCreated,
+	EventWalletMemberAdded,
+	EventApprovalRequested,
+	EventApprovalExecuted,
+	EventApprovalRejected,
+	EventApprovalExpired,
+	EventApprovalFailed,
+	EventPayoutCompleted,
+}
+
+// Event is a domain event that happened to resources of a user, it is the
+// envelope sent to webhook endpoints.
+type Event struct {
+	ID        *uuid.UUID  `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WalletBalanceEventData is sent with wallet.balance_changed events.
+type WalletBalanceEventData struct {
+	Address   string  `json:"address"`
+	Currency  string  `json:"currency"`
+	Balance   float64 `json:"balance"`
+	Available float64 `json:"available_balance"`
+	Change    float64 `json:"change"`
+	Reference string  `json:"reference"`
+}
+
+// RecurringFailedEventData is sent with recurring_transfer.failed events, e.g.
+// when the wallet did not have enough balance for an occurrence.
+type RecurringFailedEventData struct {
+	ID           *uuid.UUID `json:"id"`
+	Wallet       string     `json:"wallet"`
+	Recipient    string     `json:"recipient"`
+	Amount       float64    `json:"amount"`
+	Currency     string     `json:"currency"`
+	ScheduledFor *time.Time `json:"scheduled_for"`
+	Reason       string     `json:"reason"`
+}
+
+// PocketAutoSaveFailedEventData is sent with pocket.auto_save_failed events,
+// when the wallet did not have enough balance for a scheduled saving.
+type PocketAutoSaveFailedEventData struct {
+	ID       *uuid.UUID `json:"id"`
+	Wallet   string     `json:"wallet"`
+	Name     string     `json:"name"`
+	Amount   float64    `json:"amount"`
+	Currency string     `json:"currency"`
+	Reason   string     `json:"reason"`
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FeeOperationTransfer   = "transfer"
+	FeeOperationPayment    = "payment"
+	FeeOperationWithdrawal = "withdrawal"
+	FeeOperationExchange   = "exchange"
+
+	FeeTypeFlat       = "flat"
+	FeeTypePercentage = "percentage"
+	FeeTypeTiered     = "tiered"
+	FeeTypeFree       = "free"
+
+	FeePaidBySender   = "sender"
+	FeePaidByReceiver = "receiver"
+)
+
+// FeeTier is a bracket of a tiered fee rule. It applies to amounts up to and
+// including UpTo, the last tier should have an UpTo of zero which means there
+// is no upper bound.
+type FeeTier struct {
+	UpTo       float64 `json:"up_to" validate:"gte=0"`
+	Flat       float64 `json:"flat" validate:"gte=0"`
+	Percentage float64 `json:"percentage" validate:"gte=0,lte=100"`
+}
+
+// FeeRule decides the fee of an operation. Of all active rules matching the
+// operation and currency (an empty currency matches any) within their
+// validity window, the one with the highest priority is used. A promotional
+// zero-fee window is a free rule with a window and a high priority.
+type FeeRule struct {
+	ID         *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Name       string     `gorm:"type:varchar(100);not null"`
+	Operation  string     `gorm:"type:varchar(50);index;not null"`
+	Currency   string     `gorm:"type:varchar(50);not null;default:''"`
+	Type       string     `gorm:"type:varchar(50);not null"`
+	FlatAmount float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	Percentage float64    `gorm:"type:numeric(6,3);default:0;not null"`
+	Tiers      string     `gorm:"type:text;not null;default:'[]'"`
+	MinFee     float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	MaxFee     float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	PaidBy     string     `gorm:"type:varchar(50);default:'sender';not null"`
+	Priority   int        `gorm:"default:0;not null"`
+	Active     bool       `gorm:"default:true;not null"`
+	StartsAt   *time.Time `gorm:"default:null"`
+	EndsAt     *time.Time `gorm:"default:null"`
+	CreatedAt  *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt  *time.Time `gorm:"default:null"`
+}
+
+// DecodeTiers returns the tiers of a tiered rule.
+func (r *FeeRule) DecodeTiers() []FeeTier {
+	var tiers []FeeTier
+	_ = json.Unmarshal([]byte(r.Tiers), &tiers)
+
+	return tiers
+}
+
+type FeeRuleResponse struct {
+	ID         *uuid.UUID `json:"id"`
+	Name       string     `json:"name"`
+	Operation  string     `json:"operation"`
+	Currency   string     `json:"currency,omitempty"`
+	Type       string     `json:"type"`
+	FlatAmount float64    `json:"flat_amount"`
+	Percentage float64    `json:"percentage"`
+	Tiers      []FeeTier  `json:"tiers,omitempty"`
+	MinFee     float64    `json:"min_fee"`
+	MaxFee     float64    `json:"max_fee"`
+	PaidBy     string     `json:"paid_by"`
+	Priority   int        `json:"priority"`
+	Active     bool       `json:"active"`
+	StartsAt   *time.Time `json:"starts_at,omitempty"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	CreatedAt  *time.Time `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+type FeeRuleCreateRequest struct {
+	Name       string     `json:"name" validate:"required,max=100"`
+	Operation  string     `json:"operation" validate:"required,oneof=transfer payment withdrawal exchange"`
+	Currency   string     `json:"currency" validate:"omitempty,max=50"`
+	Type       string     `json:"type" validate:"required,oneof=flat percentage tiered free"`
+	FlatAmount float64    `json:"flat_amount" validate:"gte=0"`
+	Percentage float64    `json:"percentage" validate:"gte=0,lte=100"`
+	Tiers      []FeeTier  `json:"tiers" validate:"dive"`
+	MinFee     float64    `json:"min_fee" validate:"gte=0"`
+	MaxFee     float64    `json:"max_fee" validate:"gte=0"`
+	PaidBy     string     `json:"paid_by" validate:"omitempty,oneof=sender receiver"`
+	Priority   int        `json:"priority"`
+	Active     *bool      `json:"active"`
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+}
+
+type FeeRuleUpdateRequest struct {
+	Name       *string    `json:"name" validate:"omitempty,max=100"`
+	FlatAmount *float64   `json:"flat_amount" validate:"omitempty,gte=0"`
+	Percentage *float64   `json:"percentage" validate:"omitempty,gte=0,lte=100"`
+	Tiers      []FeeTier  `json:"tiers" validate:"omitempty,dive"`
+	MinFee     *float64   `json:"min_fee" validate:"omitempty,gte=0"`
+	MaxFee     *float64   `json:"max_fee" validate:"omitempty,gte=0"`
+	PaidBy     *string    `json:"paid_by" validate:"omitempty,oneof=sender receiver"`
+	Priority   *int       `json:"priority"`
+	Active     *bool      `json:"active"`
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+}
+
+// FeeQuote is the fee of an operation as it will be charged. Total is what
+// the sender pays and NetAmount what the receiver gets.
+type FeeQuote struct {
+	Operation string     `json:"operation"`
+	Currency  string     `json:"currency"`
+	Amount    float64    `json:"amount"`
+	Fee       float64    `json:"fee"`
+	PaidBy    string     `json:"paid_by"`
+	Total     float64    `json:"total"`
+	NetAmount float64    `json:"net_amount"`
+	RuleID    *uuid.UUID `json:"rule_id,omitempty"`
+	RuleName  string     `json:"rule_name,omitempty"`
+}
+
+type FeeQuoteRequest struct {
+	Operation string  `json:"operation" validate:"required,oneof=transfer payment withdrawal exchange"`
+	Currency  string  `json:"currency" validate:"required"`
+	Amount    float64 `json:"amount" validate:"required,gt=0"`
+}
+
+func FeeRuleFilterRecord(rule *FeeRule) FeeRuleResponse {
+	return FeeRuleResponse{
+		ID:         rule.ID,
+		Name:       rule.Name,
+		Operation:  rule.Operation,
+		Currency:   rule.Currency,
+		Type:       rule.Type,
+		FlatAmount: rule.FlatAmount,
+		Percentage: rule.Percentage,
+		Tiers:      rule.DecodeTiers(),
+		MinFee:     rule.MinFee,
+		MaxFee:     rule.MaxFee,
+		PaidBy:     rule.PaidBy,
+		Priority:   rule.Priority,
+		Active:     rule.Active,
+		StartsAt:   rule.StartsAt,
+		EndsAt:     rule.EndsAt,
+		CreatedAt:  rule.CreatedAt,
+		UpdatedAt:  rule.UpdatedAt,
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold reserves part of the balance of a wallet without moving it. While it
+// is active the amount counts towards the HeldBalance of the wallet. A hold
+// is closed by capturing it, which transfers all or part of the amount and
+// releases the rest, by releasing it or by expiring.
+type Hold struct {
+	ID             *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID       *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Wallet         Wallet       `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Amount         float64      `gorm:"type:numeric(18,2);not null"`
+	CapturedAmount float64      `gorm:"type:numeric(18,2);default:0;not null"`
+	Reason         string       `gorm:"type:varchar(255);not null"`
+	Status         string       `gorm:"type:varchar(50);index;default:'active';not null"`
+	ExpiresAt      *time.Time   `gorm:"index;not null"`
+	CapturedAt     *time.Time   `gorm:"default:null"`
+	ReleasedAt     *time.Time   `gorm:"default:null"`
+	TransactionID  *uuid.UUID   `gorm:"type:uuid;default:null"`
+	Transaction    *Transaction `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	CreatedAt      *time.Time   `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time   `gorm:"default:null"`
+}
+
+type HoldResponse struct {
+	ID             *uuid.UUID           `json:"id"`
+	Wallet         string               `json:"wallet"`
+	Amount         float64              `json:"amount"`
+	CapturedAmount float64              `json:"captured_amount"`
+	Currency       string               `json:"currency"`
+	Reason         string               `json:"reason"`
+	Status         string               `json:"status"`
+	ExpiresAt      *time.Time           `json:"expires_at"`
+	CapturedAt     *time.Time           `json:"captured_at"`
+	ReleasedAt     *time.Time           `json:"released_at"`
+	Transaction    *TransactionResponse `json:"transaction,omitempty"`
+	CreatedAt      *time.Time           `json:"created_at"`
+}
+
+type HoldCreateRequest struct {
+	Amount    float64 `json:"amount" validate:"required,gt=0"`
+	Reason    string  `json:"reason" validate:"required,max=255"`
+	ExpiresIn int     `json:"expires_in" validate:"omitempty,min=60,max=2592000"`
+}
+
+// HoldCaptureRequest captures the hold into the recipient wallet, given by
+// address or @handle. Without an amount the full hold is captured.
+type HoldCaptureRequest struct {
+	Recipient   string  `json:"recipient" validate:"required,max=100"`
+	Amount      float64 `json:"amount" validate:"omitempty,gt=0"`
+	Description string  `json:"description" validate:"omitempty,max=255"`
+}
+
+func HoldFilterRecord(hold *Hold) HoldResponse {
+	res := HoldResponse{
+		ID:             hold.ID,
+		Wallet:         hold.Wallet.Address,
+		Amount:         hold.Amount,
+		CapturedAmount: hold.CapturedAmount,
+		Currency:       hold.Wallet.Currency,
+		Reason:         hold.Reason,
+		Status:         hold.Status,
+		ExpiresAt:      hold.ExpiresAt,
+		CapturedAt:     hold.CapturedAt,
+		ReleasedAt:     hold.ReleasedAt,
+		CreatedAt:      hold.CreatedAt,
+	}
+
+	if hold.Transaction != nil {
+		transaction := TransactionFilterRecord(hold.Transaction)
+		res.Transaction = &transaction
+	}
+
+	return res
+}
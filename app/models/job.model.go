@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+const (
+	JobKindCheckoutExpire = "checkout.expire"
+	JobKindOutboxPurge    = "outbox.purge"
+	JobKindJobsPrune      = "jobs.prune"
+
+	JobKindRecurringDispatch = "recurring_transfers.dispatch"
+	JobKindRecurringExecute  = "recurring_transfers.execute"
+
+	JobKindPaymentRequestExpire = "payment_requests.expire"
+	JobKindHoldExpire           = "holds.expire"
+
+	JobKindStatementGenerate = "statements.generate"
+	JobKindStatementPurge    = "statements.purge"
+
+	JobKindReconciliationRun = "reconciliation.run"
+
+	JobKindPocketAutoSave = "pockets.auto_save"
+
+	JobKindApprovalExpire = "transfer_approvals.expire"
+
+	JobKindPayoutExecute = "payouts.execute"
+)
+
+// Job is a unit of background work. Failed jobs are retried with a backoff
+// until MaxAttempts, after which they are moved to the dead letter status and
+// kept for inspection. Jobs with a UniqueKey are only enqueued once while an
+// earlier job with the same key is not finished.
+type Job struct {
+	ID          *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Kind        string     `gorm:"type:varchar(100);index;not null"`
+	Payload     string     `gorm:"type:text;not null;default:'{}'"`
+	UniqueKey   *string    `gorm:"type:varchar(255);uniqueIndex:idx_jobs_unique_key,where:finished_at is null;default:null"`
+	Status      string     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Attempts    int        `gorm:"default:0;not null"`
+	MaxAttempts int        `gorm:"default:5;not null"`
+	RunAt       *time.Time `gorm:"index;not null;default:now()"`
+	LockedUntil *time.Time `gorm:"default:null"`
+	LastError   string     `gorm:"type:text"`
+	FinishedAt  *time.Time `gorm:"index;default:null"`
+	CreatedAt   *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt   *time.Time `gorm:"default:null"`
+}
+
+// DecodePayload unmarshals the JSON payload of the job into v.
+func (j *Job) DecodePayload(v interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
+
+// JobSchedule enqueues a job of its kind every time its cron expression
+// matches.
+type JobSchedule struct {
+	ID        *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Name      string     `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Kind      string     `gorm:"type:varchar(100);not null"`
+	Cron      string     `gorm:"type:varchar(100);not null"`
+	Payload   string     `gorm:"type:text;not null;default:'{}'"`
+	NextRunAt *time.Time `gorm:"index;not null"`
+	LastRunAt *time.Time `gorm:"default:null"`
+	CreatedAt *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt *time.Time `gorm:"default:null"`
+}
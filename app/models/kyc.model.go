@@ -0,0 +1,140 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	KYCStatusPending  = "pending"
+	KYCStatusApproved = "approved"
+	KYCStatusRejected = "rejected"
+
+	KYCDocumentIDPhoto = "id_photo"
+	KYCDocumentSelfie  = "selfie"
+)
+
+// KYCSubmission is the identity data a user submits to move up to
+// TargetTier. The photos are kept in blob storage, only their keys are
+// stored here.
+type KYCSubmission struct {
+	ID            *uuid.UUID         `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID        *uuid.UUID         `gorm:"type:uuid;index;not null"`
+	User          User               `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	NIK           string             `gorm:"column:nik;type:varchar(16);index;not null"`
+	LegalName     string             `gorm:"type:varchar(225);not null"`
+	DateOfBirth   time.Time          `gorm:"type:date;not null"`
+	IDPhotoKey    string             `gorm:"column:id_photo_key;type:varchar(255);not null"`
+	IDPhotoType   string             `gorm:"column:id_photo_type;type:varchar(50);not null"`
+	SelfieKey     string             `gorm:"type:varchar(255);not null"`
+	SelfieType    string             `gorm:"type:varchar(50);not null"`
+	TargetTier    string             `gorm:"type:varchar(50);not null"`
+	Status        string             `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Reason        string             `gorm:"type:varchar(255)"`
+	ReviewerID    *uuid.UUID         `gorm:"type:uuid;default:null"`
+	ReviewedAt    *time.Time         `gorm:"default:null"`
+	StatusHistory []KYCStatusHistory `gorm:"foreignKey:SubmissionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	CreatedAt     *time.Time         `gorm:"not null;default:now()"`
+	UpdatedAt     *time.Time         `gorm:"default:null"`
+}
+
+// KYCStatusHistory records every status a submission went through and who
+// changed it, ActorID is the user for submissions and the admin for reviews.
+type KYCStatusHistory struct {
+	ID           *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	SubmissionID *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Status       string     `gorm:"type:varchar(50);not null"`
+	Reason       string     `gorm:"type:varchar(255)"`
+	ActorID      *uuid.UUID `gorm:"type:uuid;default:null"`
+	CreatedAt    *time.Time `gorm:"not null;default:now()"`
+}
+
+// KYCSubmitRequest holds the form fields of a submission, the photos are
+// uploaded as the id_photo and selfie files of the same multipart form.
+type KYCSubmitRequest struct {
+	NIK         string `json:"nik" form:"nik" validate:"required,numeric,len=16"`
+	LegalName   string `json:"legal_name" form:"legal_name" validate:"required,min=2,max=225"`
+	DateOfBirth string `json:"date_of_birth" form:"date_of_birth" validate:"required"`
+}
+
+type KYCReviewRequest struct {
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+type KYCRejectRequest struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+type KYCStatusHistoryResponse struct {
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason,omitempty"`
+	ActorID   *uuid.UUID `json:"actor_id,omitempty"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// KYCSubmissionResponse masks the NIK, only administrators see it in full.
+type KYCSubmissionResponse struct {
+	ID            *uuid.UUID                 `json:"id"`
+	NIK           string                     `json:"nik"`
+	LegalName     string                     `json:"legal_name"`
+	DateOfBirth   string                     `json:"date_of_birth"`
+	TargetTier    string                     `json:"target_tier"`
+	Status        string                     `json:"status"`
+	Reason        string                     `json:"reason,omitempty"`
+	ReviewedAt    *time.Time                 `json:"reviewed_at,omitempty"`
+	StatusHistory []KYCStatusHistoryResponse `json:"status_history"`
+	CreatedAt     *time.Time                 `json:"created_at"`
+}
+
+type KYCSubmissionAdminResponse struct {
+	KYCSubmissionResponse
+	User       UserResponse `json:"user"`
+	ReviewerID *uuid.UUID   `json:"reviewer_id,omitempty"`
+}
+
+// MaskNIK keeps the first four and the last four digits of a NIK.
+func MaskNIK(nik string) string {
+	if len(nik) <= 8 {
+		return strings.Repeat("*", len(nik))
+	}
+
+	return nik[:4] + strings.Repeat("*", len(nik)-8) + nik[len(nik)-4:]
+}
+
+func KYCSubmissionFilterRecord(submission *KYCSubmission) KYCSubmissionResponse {
+	history := make([]KYCStatusHistoryResponse, 0, len(submission.StatusHistory))
+	for _, h := range submission.StatusHistory {
+		history = append(history, KYCStatusHistoryResponse{
+			Status:    h.Status,
+			Reason:    h.Reason,
+			ActorID:   h.ActorID,
+			CreatedAt: h.CreatedAt,
+		})
+	}
+
+	return KYCSubmissionResponse{
+		ID:            submission.ID,
+		NIK:           MaskNIK(submission.NIK),
+		LegalName:     submission.LegalName,
+		DateOfBirth:   submission.DateOfBirth.Format("2006-01-02"),
+		TargetTier:    submission.TargetTier,
+		Status:        submission.Status,
+		Reason:        submission.Reason,
+		ReviewedAt:    submission.ReviewedAt,
+		StatusHistory: history,
+		CreatedAt:     submission.CreatedAt,
+	}
+}
+
+func KYCSubmissionAdminFilterRecord(submission *KYCSubmission) KYCSubmissionAdminResponse {
+	res := KYCSubmissionAdminResponse{
+		KYCSubmissionResponse: KYCSubmissionFilterRecord(submission),
+		User:                  UserFilterRecord(&submission.User),
+		ReviewerID:            submission.ReviewerID,
+	}
+	res.NIK = submission.NIK
+
+	return res
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Merchant is a business account owned by a user. Payments to the merchant
+// are settled into its settlement wallets, one per currency.
+type Merchant struct {
+	ID               *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID           *uuid.UUID `gorm:"type:uuid;index;not null"`
+	User             User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Name             string     `gorm:"type:varchar(225);not null"`
+	City             string     `gorm:"type:varchar(50);not null"`
+	MerchantCategory string     `gorm:"type:varchar(4);default:'5999';not null"`
+	Website          string     `gorm:"type:varchar(225)"`
+	Wallets          []Wallet   `gorm:"foreignKey:MerchantID"`
+	CreatedAt        *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt        *time.Time `gorm:"default:null"`
+}
+
+type MerchantResponse struct {
+	ID               *uuid.UUID              `json:"id"`
+	Name             string                  `json:"name"`
+	City             string                  `json:"city"`
+	MerchantCategory string                  `json:"merchant_category"`
+	Website          string                  `json:"website,omitempty"`
+	Wallets          []WalletReceiveResponse `json:"settlement_wallets"`
+	CreatedAt        *time.Time              `json:"created_at"`
+	UpdatedAt        *time.Time              `json:"updated_at"`
+}
+
+type MerchantCreateRequest struct {
+	Name             string   `json:"name" validate:"required,min=3,max=225"`
+	City             string   `json:"city" validate:"required,max=50"`
+	MerchantCategory string   `json:"merchant_category" validate:"omitempty,numeric,len=4"`
+	Website          string   `json:"website" validate:"omitempty,url,max=225"`
+	Currencies       []string `json:"currencies" validate:"required,min=1,dive,required"`
+}
+
+type MerchantUpdateRequest struct {
+	Name             string `json:"name" validate:"omitempty,min=3,max=225"`
+	City             string `json:"city" validate:"omitempty,max=50"`
+	MerchantCategory string `json:"merchant_category" validate:"omitempty,numeric,len=4"`
+	Website          string `json:"website" validate:"omitempty,url,max=225"`
+}
+
+func MerchantFilterRecord(merchant *Merchant) MerchantResponse {
+	wallets := []WalletReceiveResponse{}
+	for _, w := range merchant.Wallets {
+		wallets = append(wallets, WalletReceiveFilterRecord(&w))
+	}
+
+	return MerchantResponse{
+		ID:               merchant.ID,
+		Name:             merchant.Name,
+		City:             merchant.City,
+		MerchantCategory: merchant.MerchantCategory,
+		Website:          merchant.Website,
+		Wallets:          wallets,
+		CreatedAt:        merchant.CreatedAt,
+		UpdatedAt:        merchant.UpdatedAt,
+	}
+}
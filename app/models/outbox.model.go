@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OutboxEventPending   = "pending"
+	OutboxEventPublished = "published"
+	// OutboxEventFailed events are no longer retried, they ran out of
+	// attempts or can never be published.
+	OutboxEventFailed = "failed"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// that caused it. The outbox relay publishes it after commit, so an event is
+// never sent for a rolled back change and never lost for a committed one. The
+// ID is the event ID and is used by consumers to drop duplicates.
+type OutboxEvent struct {
+	ID            *uuid.UUID `gorm:"type:uuid;primary_key"`
+	Type          string     `gorm:"type:varchar(100);not null"`
+	UserID        *uuid.UUID `gorm:"type:uuid;index;default:null"`
+	MerchantID    *uuid.UUID `gorm:"type:uuid;default:null"`
+	Payload       string     `gorm:"type:text;not null"`
+	Status        string     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Attempts      int        `gorm:"default:0;not null"`
+	NextAttemptAt *time.Time `gorm:"index;default:now()"`
+	LastError     string     `gorm:"type:text"`
+	PublishedAt   *time.Time `gorm:"index;default:null"`
+	CreatedAt     *time.Time `gorm:"not null;default:now()"`
+}
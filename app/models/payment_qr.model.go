@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PaymentQRPayload is the content of a payment request QR code. It is not
+// stored, instead it is signed by the server so that it can be verified when
+// the payer scans it.
+type PaymentQRPayload struct {
+	ID        *uuid.UUID `json:"id"`
+	Address   string     `json:"address"`
+	Amount    float64    `json:"amount,omitempty"`
+	Currency  string     `json:"currency"`
+	Reference string     `json:"reference,omitempty"`
+	IssuedAt  int64      `json:"iat"`
+	ExpiresAt int64      `json:"exp"`
+}
+
+type PaymentQRCreateRequest struct {
+	Amount    float64 `json:"amount" validate:"omitempty,gt=0"`
+	Reference string  `json:"reference" validate:"omitempty,max=140"`
+	ExpiresIn int     `json:"expires_in" validate:"omitempty,min=60,max=604800"`
+}
+
+type PaymentQRDecodeRequest struct {
+	Payload string `json:"payload" validate:"required"`
+}
+
+type PaymentQRResponse struct {
+	ID        *uuid.UUID `json:"id"`
+	Payload   string     `json:"payload"`
+	Address   string     `json:"address"`
+	Amount    float64    `json:"amount,omitempty"`
+	Currency  string     `json:"currency"`
+	Reference string     `json:"reference,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+type PaymentQRPreviewResponse struct {
+	ID        *uuid.UUID `json:"id"`
+	Recipient string     `json:"recipient"`
+	Handle    *string    `json:"handle"`
+	Address   string     `json:"address"`
+	Amount    float64    `json:"amount,omitempty"`
+	Currency  string     `json:"currency"`
+	Reference string     `json:"reference,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+func PaymentQRFilterRecord(payload *PaymentQRPayload, token string) PaymentQRResponse {
+	return PaymentQRResponse{
+		ID:        payload.ID,
+		Payload:   token,
+		Address:   payload.Address,
+		Amount:    payload.Amount,
+		Currency:  payload.Currency,
+		Reference: payload.Reference,
+		ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+	}
+}
+
+func PaymentQRPreviewFilterRecord(payload *PaymentQRPayload, wallet *Wallet) PaymentQRPreviewResponse {
+	return PaymentQRPreviewResponse{
+		ID:        payload.ID,
+		Recipient: wallet.User.Name,
+		Handle:    wallet.User.Handle,
+		Address:   payload.Address,
+		Amount:    payload.Amount,
+		Currency:  payload.Currency,
+		Reference: payload.Reference,
+		ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+	}
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PaymentRequestPending   = "pending"
+	PaymentRequestPaid      = "paid"
+	PaymentRequestDeclined  = "declined"
+	PaymentRequestCancelled = "cancelled"
+	PaymentRequestExpired   = "expired"
+
+	SplitBillOpen      = "open"
+	SplitBillCompleted = "completed"
+	SplitBillCancelled = "cancelled"
+)
+
+// PaymentRequest asks another user to pay an amount into a wallet of the
+// requester. Only the payer can accept or decline it and only the requester
+// can cancel it, and only while it is pending.
+type PaymentRequest struct {
+	ID            *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	RequesterID   *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Requester     User         `gorm:"foreignKey:RequesterID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	WalletID      *uuid.UUID   `gorm:"type:uuid;not null"`
+	Wallet        Wallet       `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	PayerID       *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Payer         User         `gorm:"foreignKey:PayerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	SplitBillID   *uuid.UUID   `gorm:"type:uuid;index;default:null"`
+	Amount        float64      `gorm:"type:numeric(18,2);not null"`
+	Currency      string       `gorm:"type:varchar(50);not null"`
+	Note          string       `gorm:"type:varchar(255)"`
+	Status        string       `gorm:"type:varchar(50);index;default:'pending';not null"`
+	ExpiresAt     *time.Time   `gorm:"not null"`
+	PaidAt        *time.Time   `gorm:"default:null"`
+	DeclinedAt    *time.Time   `gorm:"default:null"`
+	CancelledAt   *time.Time   `gorm:"default:null"`
+	TransactionID *uuid.UUID   `gorm:"type:uuid;default:null"`
+	Transaction   *Transaction `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	CreatedAt     *time.Time   `gorm:"not null;default:now()"`
+	UpdatedAt     *time.Time   `gorm:"default:null"`
+}
+
+// SplitBill divides a total between several users with one payment request
+// per participant. The requester's own share, if any, is the part of the
+// total that is not requested from anyone.
+type SplitBill struct {
+	ID          *uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	RequesterID *uuid.UUID       `gorm:"type:uuid;index;not null"`
+	Requester   User             `gorm:"foreignKey:RequesterID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	WalletID    *uuid.UUID       `gorm:"type:uuid;not null"`
+	Wallet      Wallet           `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Title       string           `gorm:"type:varchar(100);not null"`
+	TotalAmount float64          `gorm:"type:numeric(18,2);not null"`
+	Currency    string           `gorm:"type:varchar(50);not null"`
+	Status      string           `gorm:"type:varchar(50);index;default:'open';not null"`
+	Requests    []PaymentRequest `gorm:"foreignKey:SplitBillID"`
+	CreatedAt   *time.Time       `gorm:"not null;default:now()"`
+	UpdatedAt   *time.Time       `gorm:"default:null"`
+}
+
+// PaymentRequestParty is the public profile of a user taking part in a
+// payment request.
+type PaymentRequestParty struct {
+	Name   string  `json:"name"`
+	Handle *string `json:"handle"`
+}
+
+type PaymentRequestResponse struct {
+	ID          *uuid.UUID           `json:"id"`
+	Requester   PaymentRequestParty  `json:"requester"`
+	Payer       PaymentRequestParty  `json:"payer"`
+	ToAddress   string               `json:"to_address"`
+	SplitBillID *uuid.UUID           `json:"split_bill_id,omitempty"`
+	Amount      float64              `json:"amount"`
+	Currency    string               `json:"currency"`
+	Note        string               `json:"note,omitempty"`
+	Status      string               `json:"status"`
+	ExpiresAt   *time.Time           `json:"expires_at"`
+	PaidAt      *time.Time           `json:"paid_at"`
+	DeclinedAt  *time.Time           `json:"declined_at"`
+	CancelledAt *time.Time           `json:"cancelled_at"`
+	Transaction *TransactionResponse `json:"transaction,omitempty"`
+	CreatedAt   *time.Time           `json:"created_at"`
+}
+
+type SplitBillResponse struct {
+	ID          *uuid.UUID               `json:"id"`
+	ToAddress   string                   `json:"to_address"`
+	Title       string                   `json:"title"`
+	TotalAmount float64                  `json:"total_amount"`
+	Requested   float64                  `json:"requested"`
+	Collected   float64                  `json:"collected"`
+	Outstanding float64                  `json:"outstanding"`
+	Currency    string                   `json:"currency"`
+	Status      string                   `json:"status"`
+	Requests    []PaymentRequestResponse `json:"requests"`
+	CreatedAt   *time.Time               `json:"created_at"`
+}
+
+type PaymentRequestCreateRequest struct {
+	ToAddress string  `json:"to_address" validate:"required"`
+	Payer     string  `json:"payer" validate:"required,max=100"`
+	Amount    float64 `json:"amount" validate:"required,gt=0"`
+	Note      string  `json:"note" validate:"omitempty,max=255"`
+	ExpiresIn int     `json:"expires_in" validate:"omitempty,min=300,max=2592000"`
+}
+
+type PaymentRequestAcceptRequest struct {
+	FromAddress string `json:"from_address" validate:"required"`
+}
+
+// SplitBillParticipantRequest is one payer of a split bill. When no
+// participant has an amount the total is split equally.
+type SplitBillParticipantRequest struct {
+	Payer  string  `json:"payer" validate:"required,max=100"`
+	Amount float64 `json:"amount" validate:"omitempty,gt=0"`
+}
+
+type SplitBillCreateRequest struct {
+	ToAddress        string                        `json:"to_address" validate:"required"`
+	Title            string                        `json:"title" validate:"required,max=100"`
+	TotalAmount      float64                       `json:"total_amount" validate:"required,gt=0"`
+	IncludeRequester bool                          `json:"include_requester"`
+	Participants     []SplitBillParticipantRequest `json:"participants" validate:"required,min=1,max=50,dive"`
+	ExpiresIn        int                           `json:"expires_in" validate:"omitempty,min=300,max=2592000"`
+}
+
+func PaymentRequestPartyFilterRecord(user *User) PaymentRequestParty {
+	return PaymentRequestParty{
+		Name:   user.Name,
+		Handle: user.Handle,
+	}
+}
+
+func PaymentRequestFilterRecord(request *PaymentRequest) PaymentRequestResponse {
+	res := PaymentRequestResponse{
+		ID:          request.ID,
+		Requester:   PaymentRequestPartyFilterRecord(&request.Requester),
+		Payer:       PaymentRequestPartyFilterRecord(&request.Payer),
+		ToAddress:   request.Wallet.Address,
+		SplitBillID: request.SplitBillID,
+		Amount:      request.Amount,
+		Currency:    request.Currency,
+		Note:        request.Note,
+		Status:      request.Status,
+		ExpiresAt:   request.ExpiresAt,
+		PaidAt:      request.PaidAt,
+		DeclinedAt:  request.DeclinedAt,
+		CancelledAt: request.CancelledAt,
+		CreatedAt:   request.CreatedAt,
+	}
+
+	if request.Transaction != nil {
+		transaction := TransactionFilterRecord(request.Transaction)
+		res.Transaction = &transaction
+	}
+
+	return res
+}
+
+// SplitBillFilterRecord sums up the requests of the bill: collected is the
+// total of the paid requests and outstanding of the pending ones.
+func SplitBillFilterRecord(bill *SplitBill) SplitBillResponse {
+	res := SplitBillResponse{
+		ID:          bill.ID,
+		ToAddress:   bill.Wallet.Address,
+		Title:       bill.Title,
+		TotalAmount: bill.TotalAmount,
+		Currency:    bill.Currency,
+		Status:      bill.Status,
+		Requests:    make([]PaymentRequestResponse, 0, len(bill.Requests)),
+		CreatedAt:   bill.CreatedAt,
+	}
+
+	for i := range bill.Requests {
+		request := &bill.Requests[i]
+		res.Requests = append(res.Requests, PaymentRequestFilterRecord(request))
+
+		if request.Status == PaymentRequestCancelled {
+			continue
+		}
+
+		res.Requested += request.Amount
+		switch request.Status {
+		case PaymentRequestPaid:
+			res.Collected += request.Amount
+		case PaymentRequestPending:
+			res.Outstanding += request.Amount
+		}
+	}
+
+	res.Requested = math.Round(res.Requested*100) / 100
+	res.Collected = math.Round(res.Collected*100) / 100
+	res.Outstanding = math.Round(res.Outstanding*100) / 100
+
+	return res
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PayoutBatchDraft            = "draft"
+	PayoutBatchAwaitingApproval = "awaiting_approval"
+	PayoutBatchProcessing       = "processing"
+	PayoutBatchCompleted        = "completed"
+	PayoutBatchCancelled        = "cancelled"
+
+	PayoutItemPending   = "pending"
+	PayoutItemSucceeded = "succeeded"
+	PayoutItemFailed    = "failed"
+)
+
+// PayoutBatch pays many recipients from one wallet, uploaded as a CSV file.
+// Every row is validated and quoted when the file is uploaded, the batch is
+// then kept as a draft until it is executed in the background. When the
+// approval policy of the wallet applies to the total, executing it asks the
+// owners to approve the batch first, ApprovalID is the pending approval.
+type PayoutBatch struct {
+	ID             *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID       *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Wallet         Wallet       `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	CreatedByID    *uuid.UUID   `gorm:"type:uuid;not null"`
+	CreatedBy      User         `gorm:"foreignKey:CreatedByID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Filename       string       `gorm:"type:varchar(255)"`
+	Status         string       `gorm:"type:varchar(50);index;default:'draft';not null"`
+	ApprovalID     *uuid.UUID   `gorm:"type:uuid;default:null"`
+	ItemCount      int          `gorm:"not null"`
+	TotalAmount    float64      `gorm:"type:numeric(18,2);not null"`
+	TotalFee       float64      `gorm:"type:numeric(18,2);not null"`
+	Total          float64      `gorm:"type:numeric(18,2);not null"`
+	SucceededCount int          `gorm:"default:0;not null"`
+	FailedCount    int          `gorm:"default:0;not null"`
+	PaidAmount     float64      `gorm:"type:numeric(18,2);default:0;not null"`
+	StartedAt      *time.Time   `gorm:"default:null"`
+	CompletedAt    *time.Time   `gorm:"default:null"`
+	Items          []PayoutItem `gorm:"foreignKey:BatchID"`
+	CreatedAt      *time.Time   `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time   `gorm:"default:null"`
+}
+
+// PayoutItem is one row of a payout file. Fee is the fee quoted when the
+// file was uploaded.
+type PayoutItem struct {
+	ID            *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	BatchID       *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Line          int          `gorm:"not null"`
+	Recipient     string       `gorm:"type:varchar(100);not null"`
+	ToWalletID    *uuid.UUID   `gorm:"type:uuid;not null"`
+	Amount        float64      `gorm:"type:numeric(18,2);not null"`
+	Fee           float64      `gorm:"type:numeric(18,2);default:0;not null"`
+	Reference     string       `gorm:"type:varchar(64)"`
+	Status        string       `gorm:"type:varchar(50);default:'pending';not null"`
+	Error         string       `gorm:"type:varchar(255)"`
+	TransactionID *uuid.UUID   `gorm:"type:uuid;default:null"`
+	Transaction   *Transaction `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	ProcessedAt   *time.Time   `gorm:"default:null"`
+	CreatedAt     *time.Time   `gorm:"not null;default:now()"`
+}
+
+// PayoutRowError reports why a row of a payout file can not be paid.
+type PayoutRowError struct {
+	Line      int    `json:"line"`
+	Recipient string `json:"recipient,omitempty"`
+	Error     string `json:"error"`
+}
+
+type PayoutBatchResponse struct {
+	ID             *uuid.UUID           `json:"id"`
+	Wallet         string               `json:"wallet"`
+	Currency       string               `json:"currency"`
+	CreatedBy      string               `json:"created_by"`
+	Filename       string               `json:"filename"`
+	Status         string               `json:"status"`
+	Approval       *uuid.UUID           `json:"approval,omitempty"`
+	ItemCount      int                  `json:"item_count"`
+	TotalAmount    float64              `json:"total_amount"`
+	TotalFee       float64              `json:"total_fee"`
+	Total          float64              `json:"total"`
+	SucceededCount int                  `json:"succeeded_count"`
+	FailedCount    int                  `json:"failed_count"`
+	PaidAmount     float64              `json:"paid_amount"`
+	Items          []PayoutItemResponse `json:"items,omitempty"`
+	StartedAt      *time.Time           `json:"started_at,omitempty"`
+	CompletedAt    *time.Time           `json:"completed_at,omitempty"`
+	CreatedAt      *time.Time           `json:"created_at"`
+}
+
+type PayoutItemResponse struct {
+	Line        int        `json:"line"`
+	Recipient   string     `json:"recipient"`
+	Amount      float64    `json:"amount"`
+	Fee         float64    `json:"fee"`
+	Reference   string     `json:"reference,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Transaction string     `json:"transaction,omitempty"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
+
+func PayoutBatchFilterRecord(batch *PayoutBatch) PayoutBatchResponse {
+	res := PayoutBatchResponse{
+		ID:             batch.ID,
+		Wallet:         batch.Wallet.Address,
+		Currency:       batch.Wallet.Currency,
+		CreatedBy:      batch.CreatedBy.Name,
+		Filename:       batch.Filename,
+		Status:         batch.Status,
+		Approval:       batch.ApprovalID,
+		ItemCount:      batch.ItemCount,
+		TotalAmount:    batch.TotalAmount,
+		TotalFee:       batch.TotalFee,
+		Total:          batch.Total,
+		SucceededCount: batch.SucceededCount,
+		FailedCount:    batch.FailedCount,
+		PaidAmount:     batch.PaidAmount,
+		StartedAt:      batch.StartedAt,
+		CompletedAt:    batch.CompletedAt,
+		CreatedAt:      batch.CreatedAt,
+	}
+
+	for i := range batch.Items {
+		res.Items = append(res.Items, PayoutItemFilterRecord(&batch.Items[i]))
+	}
+
+	return res
+}
+
+func PayoutItemFilterRecord(item *PayoutItem) PayoutItemResponse {
+	res := PayoutItemResponse{
+		Line:        item.Line,
+		Recipient:   item.Recipient,
+		Amount:      item.Amount,
+		Fee:         item.Fee,
+		Reference:   item.Reference,
+		Status:      item.Status,
+		Error:       item.Error,
+		ProcessedAt: item.ProcessedAt,
+	}
+
+	if item.Transaction != nil {
+		res.Transaction = item.Transaction.Reference
+	}
+
+	return res
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PocketMovementManual   = "manual"
+	PocketMovementRoundUp  = "round_up"
+	PocketMovementSchedule = "schedule"
+	PocketMovementClose    = "close"
+)
+
+// Pocket sets part of the balance of a wallet aside for a goal. The money of
+// a pocket stays in the wallet, it counts towards the PocketBalance of the
+// wallet and is not available for spending until it is moved back.
+//
+// A pocket can save automatically: RoundUpTo rounds every outgoing transfer
+// of the wallet up to a multiple of it and moves the difference into the
+// pocket, AutoSaveAmount is moved in on the AutoSaveCron schedule.
+type Pocket struct {
+	ID               *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID         *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Wallet           Wallet     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Name             string     `gorm:"type:varchar(100);not null"`
+	Balance          float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	TargetAmount     float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	TargetDate       *time.Time `gorm:"type:date;default:null"`
+	RoundUpTo        float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	AutoSaveAmount   float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	AutoSaveCron     string     `gorm:"type:varchar(100)"`
+	AutoSaveTimezone string     `gorm:"type:varchar(50)"`
+	NextAutoSaveAt   *time.Time `gorm:"index;default:null"`
+	CreatedAt        *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt        *time.Time `gorm:"default:null"`
+}
+
+// PocketMovement is a move between the main balance of a wallet and one of
+// its pockets. Amount is positive when money went into the pocket.
+type PocketMovement struct {
+	ID            *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	PocketID      *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Amount        float64    `gorm:"type:numeric(18,2);not null"`
+	BalanceAfter  float64    `gorm:"type:numeric(18,2);not null"`
+	Source        string     `gorm:"type:varchar(50);not null"`
+	TransactionID *uuid.UUID `gorm:"type:uuid;default:null"`
+	CreatedAt     *time.Time `gorm:"not null;default:now()"`
+}
+
+// PocketProgress reports how far a pocket is from its target. DailyNeeded is
+// what has to be saved every day to reach the target on the target date.
+type PocketProgress struct {
+	Percentage  float64 `json:"percentage"`
+	Remaining   float64 `json:"remaining"`
+	Reached     bool    `json:"reached"`
+	DaysLeft    *int    `json:"days_left,omitempty"`
+	DailyNeeded float64 `json:"daily_needed,omitempty"`
+}
+
+type PocketResponse struct {
+	ID               *uuid.UUID               `json:"id"`
+	Wallet           string                   `json:"wallet"`
+	Name             string                   `json:"name"`
+	Balance          float64                  `json:"balance"`
+	Currency         string                   `json:"currency"`
+	TargetAmount     float64                  `json:"target_amount,omitempty"`
+	TargetDate       string                   `json:"target_date,omitempty"`
+	Progress         *PocketProgress          `json:"progress,omitempty"`
+	RoundUpTo        float64                  `json:"round_up_to,omitempty"`
+	AutoSaveAmount   float64                  `json:"auto_save_amount,omitempty"`
+	AutoSaveCron     string                   `json:"auto_save_cron,omitempty"`
+	AutoSaveTimezone string                   `json:"auto_save_timezone,omitempty"`
+	NextAutoSaveAt   *time.Time               `json:"next_auto_save_at,omitempty"`
+	Movements        []PocketMovementResponse `json:"movements,omitempty"`
+	CreatedAt        *time.Time               `json:"created_at"`
+	UpdatedAt        *time.Time               `json:"updated_at"`
+}
+
+type PocketMovementResponse struct {
+	Amount       float64    `json:"amount"`
+	BalanceAfter float64    `json:"balance_after"`
+	Source       string     `json:"source"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// PocketAutoSaveRequest moves Amount into the pocket on a schedule, see
+// RecurringTransferScheduleRequest for the fields of the schedule.
+type PocketAutoSaveRequest struct {
+	RecurringTransferScheduleRequest
+	Amount float64 `json:"amount" validate:"required,gt=0"`
+}
+
+type PocketCreateRequest struct {
+	Name         string                 `json:"name" validate:"required,max=100"`
+	TargetAmount float64                `json:"target_amount" validate:"omitempty,gt=0"`
+	TargetDate   string                 `json:"target_date" validate:"omitempty,len=10"`
+	RoundUpTo    float64                `json:"round_up_to" validate:"omitempty,gt=0"`
+	AutoSave     *PocketAutoSaveRequest `json:"auto_save"`
+}
+
+// PocketUpdateRequest changes the given fields. A zero target amount or
+// round up and an empty target date remove them, Disable auto save stops the
+// scheduled savings.
+type PocketUpdateRequest struct {
+	Name            string                 `json:"name" validate:"omitempty,max=100"`
+	TargetAmount    *float64               `json:"target_amount" validate:"omitempty,min=0"`
+	TargetDate      *string                `json:"target_date" validate:"omitempty,max=10"`
+	RoundUpTo       *float64               `json:"round_up_to" validate:"omitempty,min=0"`
+	AutoSave        *PocketAutoSaveRequest `json:"auto_save"`
+	DisableAutoSave bool                   `json:"disable_auto_save"`
+}
+
+type PocketMoveRequest struct {
+	Amount float64 `json:"amount" validate:"required,gt=0"`
+}
+
+// Progress compares the balance with the target as of now, nil when the
+// pocket has no target amount.
+func (p *Pocket) Progress(now time.Time) *PocketProgress {
+	if p.TargetAmount <= 0 {
+		return nil
+	}
+
+	progress := PocketProgress{
+		Percentage: math.Min(100, math.Floor(p.Balance/p.TargetAmount*10000)/100),
+		Remaining:  math.Max(0, math.Round((p.TargetAmount-p.Balance)*100)/100),
+	}
+	progress.Reached = progress.Remaining == 0
+
+	if p.TargetDate != nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		target := time.Date(p.TargetDate.Year(), p.TargetDate.Month(), p.TargetDate.Day(), 0, 0, 0, 0, time.UTC)
+
+		days := int(math.Max(0, target.Sub(today).Hours()/24))
+		progress.DaysLeft = &days
+
+		if days > 0 && !progress.Reached {
+			progress.DailyNeeded = math.Ceil(progress.Remaining/float64(days)*100) / 100
+		}
+	}
+
+	return &progress
+}
+
+func PocketFilterRecord(pocket *Pocket) PocketResponse {
+	res := PocketResponse{
+		ID:               pocket.ID,
+		Wallet:           pocket.Wallet.Address,
+		Name:             pocket.Name,
+		Balance:          pocket.Balance,
+		Currency:         pocket.Wallet.Currency,
+		TargetAmount:     pocket.TargetAmount,
+		Progress:         pocket.Progress(time.Now()),
+		RoundUpTo:        pocket.RoundUpTo,
+		AutoSaveAmount:   pocket.AutoSaveAmount,
+		AutoSaveCron:     pocket.AutoSaveCron,
+		AutoSaveTimezone: pocket.AutoSaveTimezone,
+		NextAutoSaveAt:   pocket.NextAutoSaveAt,
+		CreatedAt:        pocket.CreatedAt,
+		UpdatedAt:        pocket.UpdatedAt,
+	}
+
+	if pocket.TargetDate != nil {
+		res.TargetDate = pocket.TargetDate.Format("2006-01-02")
+	}
+
+	return res
+}
+
+func PocketMovementFilterRecord(movement *PocketMovement) PocketMovementResponse {
+	return PocketMovementResponse{
+		Amount:       movement.Amount,
+		BalanceAfter: movement.BalanceAfter,
+		Source:       movement.Source,
+		CreatedAt:    movement.CreatedAt,
+	}
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CashbackTypeFlat       = "flat"
+	CashbackTypePercentage = "percentage"
+)
+
+// PromotionCampaign is a promo code that pays cashback on transfers and
+// payments. Cashback is sent from FundingWallet until Budget is spent, at
+// most PerUserLimit times per user. A new users only campaign only pays
+// cashback on the first transfer or payment a user ever made.
+type PromotionCampaign struct {
+	ID              *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Name            string     `gorm:"type:varchar(100);not null"`
+	Code            string     `gorm:"type:varchar(50);uniqueIndex;not null"`
+	Description     string     `gorm:"type:varchar(255)"`
+	Currency        string     `gorm:"type:varchar(50);not null"`
+	FundingWalletID *uuid.UUID `gorm:"type:uuid;index;not null"`
+	FundingWallet   Wallet     `gorm:"foreignKey:FundingWalletID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	CashbackType    string     `gorm:"type:varchar(50);not null"`
+	CashbackValue   float64    `gorm:"type:numeric(10,3);not null"`
+	MaxCashback     float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	MinAmount       float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	NewUsersOnly    bool       `gorm:"default:false;not null"`
+	Budget          float64    `gorm:"type:numeric(18,2);not null"`
+	Spent           float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	Redemptions     int        `gorm:"default:0;not null"`
+	PerUserLimit    int        `gorm:"default:1;not null"`
+	Active          bool       `gorm:"default:true;not null"`
+	StartsAt        *time.Time `gorm:"not null"`
+	EndsAt          *time.Time `gorm:"not null"`
+	CreatedByID     *uuid.UUID `gorm:"type:uuid;default:null"`
+	CreatedAt       *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt       *time.Time `gorm:"default:null"`
+}
+
+// Cashback returns the cashback the campaign pays on amount, before the
+// remaining budget is taken into account.
+func (c *PromotionCampaign) Cashback(amount float64) float64 {
+	cashback := c.CashbackValue
+	if c.CashbackType == CashbackTypePercentage {
+		cashback = amount * c.CashbackValue / 100
+		if c.MaxCashback > 0 && cashback > c.MaxCashback {
+			cashback = c.MaxCashback
+		}
+	}
+
+	// Rounded down to whole cents, so that a campaign never pays more than
+	// its rate.
+	return math.Floor(cashback*100+1e-6) / 100
+}
+
+// PromotionRedemption is the cashback paid for one transfer or payment. A
+// transaction earns cashback at most once.
+type PromotionRedemption struct {
+	ID                    *uuid.UUID        `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	CampaignID            *uuid.UUID        `gorm:"type:uuid;index;not null"`
+	Campaign              PromotionCampaign `gorm:"foreignKey:CampaignID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID                *uuid.UUID        `gorm:"type:uuid;index;not null"`
+	User                  User              `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	TransactionID         *uuid.UUID        `gorm:"type:uuid;uniqueIndex;not null"`
+	Transaction           Transaction       `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	CashbackTransactionID *uuid.UUID        `gorm:"type:uuid;not null"`
+	CashbackTransaction   Transaction       `gorm:"foreignKey:CashbackTransactionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Amount                float64           `gorm:"type:numeric(18,2);not null"`
+	Cashback              float64           `gorm:"type:numeric(18,2);not null"`
+	CreatedAt             *time.Time        `gorm:"not null;default:now()"`
+}
+
+// PromotionStats sums up the redemptions of a campaign.
+type PromotionStats struct {
+	Redemptions     int64   `json:"redemptions"`
+	UniqueUsers     int64   `json:"unique_users"`
+	CashbackPaid    float64 `json:"cashback_paid"`
+	QualifyingTotal float64 `json:"qualifying_total"`
+	RemainingBudget float64 `json:"remaining_budget"`
+	FundingBalance  float64 `json:"funding_balance"`
+}
+
+type PromotionCampaignResponse struct {
+	ID            *uuid.UUID      `json:"id"`
+	Name          string          `json:"name"`
+	Code          string          `json:"code"`
+	Description   string          `json:"description,omitempty"`
+	Currency      string          `json:"currency"`
+	FundingWallet string          `json:"funding_wallet"`
+	CashbackType  string          `json:"cashback_type"`
+	CashbackValue float64         `json:"cashback_value"`
+	MaxCashback   float64         `json:"max_cashback"`
+	MinAmount     float64         `json:"min_amount"`
+	NewUsersOnly  bool            `json:"new_users_only"`
+	Budget        float64         `json:"budget"`
+	Spent         float64         `json:"spent"`
+	Redemptions   int             `json:"redemptions"`
+	PerUserLimit  int             `json:"per_user_limit"`
+	Active        bool            `json:"active"`
+	StartsAt      *time.Time      `json:"starts_at"`
+	EndsAt        *time.Time      `json:"ends_at"`
+	Stats         *PromotionStats `json:"stats,omitempty"`
+	CreatedAt     *time.Time      `json:"created_at"`
+	UpdatedAt     *time.Time      `json:"updated_at"`
+}
+
+// PromotionResponse is a campaign as users see it.
+type PromotionResponse struct {
+	Name          string     `json:"name"`
+	Code          string     `json:"code"`
+	Description   string     `json:"description,omitempty"`
+	Currency      string     `json:"currency"`
+	CashbackType  string     `json:"cashback_type"`
+	CashbackValue float64    `json:"cashback_value"`
+	MaxCashback   float64    `json:"max_cashback,omitempty"`
+	MinAmount     float64    `json:"min_amount"`
+	NewUsersOnly  bool       `json:"new_users_only"`
+	EndsAt        *time.Time `json:"ends_at"`
+}
+
+type PromotionRedemptionResponse struct {
+	ID          *uuid.UUID `json:"id"`
+	Code        string     `json:"code"`
+	User        string     `json:"user,omitempty"`
+	Transaction string     `json:"transaction"`
+	Amount      float64    `json:"amount"`
+	Cashback    float64    `json:"cashback"`
+	Currency    string     `json:"currency"`
+	Reference   string     `json:"cashback_reference"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+type PromotionCampaignCreateRequest struct {
+	Name          string     `json:"name" validate:"required,max=100"`
+	Code          string     `json:"code" validate:"required,min=3,max=50,alphanum"`
+	Description   string     `json:"description" validate:"omitempty,max=255"`
+	FundingWallet string     `json:"funding_wallet" validate:"required"`
+	CashbackType  string     `json:"cashback_type" validate:"required,oneof=flat percentage"`
+	CashbackValue float64    `json:"cashback_value" validate:"required,gt=0"`
+	MaxCashback   float64    `json:"max_cashback" validate:"gte=0"`
+	MinAmount     float64    `json:"min_amount" validate:"gte=0"`
+	NewUsersOnly  bool       `json:"new_users_only"`
+	Budget        float64    `json:"budget" validate:"required,gt=0"`
+	PerUserLimit  int        `json:"per_user_limit" validate:"omitempty,min=1,max=100"`
+	Active        *bool      `json:"active"`
+	StartsAt      *time.Time `json:"starts_at" validate:"required"`
+	EndsAt        *time.Time `json:"ends_at" validate:"required"`
+}
+
+type PromotionCampaignUpdateRequest struct {
+	Name         *string    `json:"name" validate:"omitempty,max=100"`
+	Description  *string    `json:"description" validate:"omitempty,max=255"`
+	MaxCashback  *float64   `json:"max_cashback" validate:"omitempty,gte=0"`
+	MinAmount    *float64   `json:"min_amount" validate:"omitempty,gte=0"`
+	NewUsersOnly *bool      `json:"new_users_only"`
+	Budget       *float64   `json:"budget" validate:"omitempty,gt=0"`
+	PerUserLimit *int       `json:"per_user_limit" validate:"omitempty,min=1,max=100"`
+	Active       *bool      `json:"active"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+}
+
+// PromotionCheckRequest asks what cashback a code would pay on a transfer or
+// payment of amount.
+type PromotionCheckRequest struct {
+	Code     string  `json:"code" validate:"required,max=50"`
+	Currency string  `json:"currency" validate:"required"`
+	Amount   float64 `json:"amount" validate:"required,gt=0"`
+}
+
+// PromotionRedeemRequest claims the cashback of a code for a transfer or
+// payment the user made, given by its reference.
+type PromotionRedeemRequest struct {
+	Code      string `json:"code" validate:"required,max=50"`
+	Reference string `json:"reference" validate:"required,max=64"`
+}
+
+func PromotionCampaignFilterRecord(campaign *PromotionCampaign) PromotionCampaignResponse {
+	return PromotionCampaignResponse{
+		ID:            campaign.ID,
+		Name:          campaign.Name,
+		Code:          campaign.Code,
+		Description:   campaign.Description,
+		Currency:      campaign.Currency,
+		FundingWallet: campaign.FundingWallet.Address,
+		CashbackType:  campaign.CashbackType,
+		CashbackValue: campaign.CashbackValue,
+		MaxCashback:   campaign.MaxCashback,
+		MinAmount:     campaign.MinAmount,
+		NewUsersOnly:  campaign.NewUsersOnly,
+		Budget:        campaign.Budget,
+		Spent:         campaign.Spent,
+		Redemptions:   campaign.Redemptions,
+		PerUserLimit:  campaign.PerUserLimit,
+		Active:        campaign.Active,
+		StartsAt:      campaign.StartsAt,
+		EndsAt:        campaign.EndsAt,
+		CreatedAt:     campaign.CreatedAt,
+		UpdatedAt:     campaign.UpdatedAt,
+	}
+}
+
+func PromotionFilterRecord(campaign *PromotionCampaign) PromotionResponse {
+	return PromotionResponse{
+		Name:          campaign.Name,
+		Code:          campaign.Code,
+		Description:   campaign.Description,
+		Currency:      campaign.Currency,
+		CashbackType:  campaign.CashbackType,
+		CashbackValue: campaign.CashbackValue,
+		MaxCashback:   campaign.MaxCashback,
+		MinAmount:     campaign.MinAmount,
+		NewUsersOnly:  campaign.NewUsersOnly,
+		EndsAt:        campaign.EndsAt,
+	}
+}
+
+func PromotionRedemptionFilterRecord(redemption *PromotionRedemption) PromotionRedemptionResponse {
+	return PromotionRedemptionResponse{
+		ID:          redemption.ID,
+		Code:        redemption.Campaign.Code,
+		User:        redemption.User.Name,
+		Transaction: redemption.Transaction.Reference,
+		Amount:      redemption.Amount,
+		Cashback:    redemption.Cashback,
+		Currency:    redemption.Campaign.Currency,
+		Reference:   redemption.CashbackTransaction.Reference,
+		CreatedAt:   redemption.CreatedAt,
+	}
+}
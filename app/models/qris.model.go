@@ -0,0 +1,32 @@
+package models
+
+type QRISCreateRequest struct {
+	Amount           float64 `json:"amount" validate:"omitempty,gt=0"`
+	MerchantCity     string  `json:"merchant_city" validate:"omitempty,max=15"`
+	PostalCode       string  `json:"postal_code" validate:"omitempty,numeric,max=10"`
+	MerchantCategory string  `json:"merchant_category" validate:"omitempty,numeric,len=4"`
+	BillNumber       string  `json:"bill_number" validate:"omitempty,max=25"`
+}
+
+type QRISParseRequest struct {
+	Payload string `json:"payload" validate:"required"`
+}
+
+type QRISPayRequest struct {
+	Payload     string  `json:"payload" validate:"required"`
+	FromAddress string  `json:"from_address" validate:"required"`
+	Amount      float64 `json:"amount" validate:"omitempty,gt=0"`
+}
+
+type QRISResponse struct {
+	Payload          string  `json:"payload"`
+	Dynamic          bool    `json:"dynamic"`
+	MerchantName     string  `json:"merchant_name"`
+	MerchantCity     string  `json:"merchant_city"`
+	MerchantCategory string  `json:"merchant_category"`
+	Amount           float64 `json:"amount,omitempty"`
+	Currency         string  `json:"currency"`
+	BillNumber       string  `json:"bill_number,omitempty"`
+	Address          string  `json:"address,omitempty"`
+	Payable          bool    `json:"payable"`
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReconciliationPending   = "pending"
+	ReconciliationRunning   = "running"
+	ReconciliationCompleted = "completed"
+	ReconciliationFailed    = "failed"
+
+	// ReconciliationScopeBalances compares every wallet balance with its
+	// ledger entries and the ledger with the transactions.
+	ReconciliationScopeBalances = "balances"
+	// ReconciliationScopeSettlement compares an imported settlement file
+	// with the transactions.
+	ReconciliationScopeSettlement = "settlement"
+
+	// DiscrepancyBalanceLedger is a stored balance that differs from the sum
+	// of the ledger entries of the wallet.
+	DiscrepancyBalanceLedger = "balance_ledger"
+	// DiscrepancyLedgerTransactions is a ledger that differs from the sum of
+	// the transactions sent and received by the wallet.
+	DiscrepancyLedgerTransactions = "ledger_transactions"
+	// DiscrepancySettlementUnknown is a settlement record without a
+	// transaction.
+	DiscrepancySettlementUnknown = "settlement_unknown_transaction"
+	// DiscrepancySettlementAmount is a settlement record whose amount or
+	// currency differs from its transaction.
+	DiscrepancySettlementAmount = "settlement_amount"
+	// DiscrepancySettlementMissing is a transaction of the settled type and
+	// day that is not in the settlement file.
+	DiscrepancySettlementMissing = "settlement_missing_record"
+)
+
+// ReconciliationRun is one execution of the reconciliation job.
+type ReconciliationRun struct {
+	ID               *uuid.UUID                  `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Scope            string                      `gorm:"type:varchar(50);not null"`
+	SettlementFileID *uuid.UUID                  `gorm:"type:uuid;default:null"`
+	Status           string                      `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Freeze           bool                        `gorm:"default:false;not null"`
+	TriggeredByID    *uuid.UUID                  `gorm:"type:uuid;default:null"`
+	Checked          int                         `gorm:"default:0;not null"`
+	Discrepancies    int                         `gorm:"default:0;not null"`
+	FrozenWallets    int                         `gorm:"default:0;not null"`
+	Error            string                      `gorm:"type:varchar(255)"`
+	Items            []ReconciliationDiscrepancy `gorm:"foreignKey:RunID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	StartedAt        *time.Time                  `gorm:"default:null"`
+	FinishedAt       *time.Time                  `gorm:"default:null"`
+	CreatedAt        *time.Time                  `gorm:"not null;default:now()"`
+	UpdatedAt        *time.Time                  `gorm:"default:null"`
+}
+
+// ReconciliationDiscrepancy is a difference found by a run. Expected is the
+// figure from the source of truth of the check, the ledger for balances and
+// the settlement file for settlements.
+type ReconciliationDiscrepancy struct {
+	ID         *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	RunID      *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Kind       string     `gorm:"type:varchar(50);not null"`
+	WalletID   *uuid.UUID `gorm:"type:uuid;index;default:null"`
+	Address    string     `gorm:"type:varchar(225)"`
+	Reference  string     `gorm:"type:varchar(64)"`
+	Currency   string     `gorm:"type:varchar(50)"`
+	Expected   float64    `gorm:"type:numeric(18,2);not null"`
+	Actual     float64    `gorm:"type:numeric(18,2);not null"`
+	Difference float64    `gorm:"type:numeric(18,2);not null"`
+	Detail     string     `gorm:"type:varchar(255)"`
+	Frozen     bool       `gorm:"default:false;not null"`
+	CreatedAt  *time.Time `gorm:"not null;default:now()"`
+}
+
+// SettlementFile is a settlement report of a payment provider, imported from
+// CSV. When TransactionType is set the file is expected to list every
+// transaction of that type created on SettlementDate.
+type SettlementFile struct {
+	ID              *uuid.UUID         `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Provider        string             `gorm:"type:varchar(100);not null"`
+	SettlementDate  time.Time          `gorm:"type:date;not null"`
+	TransactionType string             `gorm:"type:varchar(50)"`
+	Filename        string             `gorm:"type:varchar(255)"`
+	Records         []SettlementRecord `gorm:"foreignKey:FileID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RecordCount     int                `gorm:"default:0;not null"`
+	UploadedByID    *uuid.UUID         `gorm:"type:uuid;default:null"`
+	CreatedAt       *time.Time         `gorm:"not null;default:now()"`
+}
+
+type SettlementRecord struct {
+	ID        *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	FileID    *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Line      int        `gorm:"not null"`
+	Reference string     `gorm:"type:varchar(64);index;not null"`
+	Amount    float64    `gorm:"type:numeric(18,2);not null"`
+	Currency  string     `gorm:"type:varchar(50);not null"`
+}
+
+type ReconciliationRunRequest struct {
+	Freeze bool `json:"freeze"`
+}
+
+type SettlementImportRequest struct {
+	Provider        string `form:"provider" validate:"required,max=100"`
+	SettlementDate  string `form:"settlement_date" validate:"required"`
+	TransactionType string `form:"transaction_type" validate:"omitempty,oneof=transfer payment payout refund reversal"`
+}
+
+type WalletFreezeRequest struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+type ReconciliationDiscrepancyResponse struct {
+	ID         *uuid.UUID `json:"id"`
+	Kind       string     `json:"kind"`
+	Address    string     `json:"address,omitempty"`
+	Reference  string     `json:"reference,omitempty"`
+	Currency   string     `json:"currency,omitempty"`
+	Expected   float64    `json:"expected"`
+	Actual     float64    `json:"actual"`
+	Difference float64    `json:"difference"`
+	Detail     string     `json:"detail,omitempty"`
+	Frozen     bool       `json:"frozen"`
+}
+
+type ReconciliationRunResponse struct {
+	ID               *uuid.UUID                          `json:"id"`
+	Scope            string                              `json:"scope"`
+	SettlementFileID *uuid.UUID                          `json:"settlement_file_id,omitempty"`
+	Status           string                              `json:"status"`
+	Freeze           bool                                `json:"freeze"`
+	TriggeredByID    *uuid.UUID                          `json:"triggered_by_id,omitempty"`
+	Checked          int                                 `json:"checked"`
+	Discrepancies    int                                 `json:"discrepancies"`
+	FrozenWallets    int                                 `json:"frozen_wallets"`
+	Error            string                              `json:"error,omitempty"`
+	Items            []ReconciliationDiscrepancyResponse `json:"items,omitempty"`
+	StartedAt        *time.Time                          `json:"started_at"`
+	FinishedAt       *time.Time                          `json:"finished_at"`
+	CreatedAt        *time.Time                          `json:"created_at"`
+}
+
+type SettlementFileResponse struct {
+	ID              *uuid.UUID `json:"id"`
+	Provider        string     `json:"provider"`
+	SettlementDate  string     `json:"settlement_date"`
+	TransactionType string     `json:"transaction_type,omitempty"`
+	Filename        string     `json:"filename"`
+	Records         int        `json:"records"`
+	CreatedAt       *time.Time `json:"created_at"`
+}
+
+func ReconciliationRunFilterRecord(run *ReconciliationRun) ReconciliationRunResponse {
+	res := ReconciliationRunResponse{
+		ID:               run.ID,
+		Scope:            run.Scope,
+		SettlementFileID: run.SettlementFileID,
+		Status:           run.Status,
+		Freeze:           run.Freeze,
+		TriggeredByID:    run.TriggeredByID,
+		Checked:          run.Checked,
+		Discrepancies:    run.Discrepancies,
+		FrozenWallets:    run.FrozenWallets,
+		Error:            run.Error,
+		StartedAt:        run.StartedAt,
+		FinishedAt:       run.FinishedAt,
+		CreatedAt:        run.CreatedAt,
+	}
+
+	for _, item := range run.Items {
+		res.Items = append(res.Items, ReconciliationDiscrepancyResponse{
+			ID:         item.ID,
+			Kind:       item.Kind,
+			Address:    item.Address,
+			Reference:  item.Reference,
+			Currency:   item.Currency,
+			Expected:   item.Expected,
+			Actual:     item.Actual,
+			Difference: item.Difference,
+			Detail:     item.Detail,
+			Frozen:     item.Frozen,
+		})
+	}
+
+	return res
+}
+
+func SettlementFileFilterRecord(file *SettlementFile) SettlementFileResponse {
+	return SettlementFileResponse{
+		ID:              file.ID,
+		Provider:        file.Provider,
+		SettlementDate:  file.SettlementDate.Format("2006-01-02"),
+		TransactionType: file.TransactionType,
+		Filename:        file.Filename,
+		Records:         file.RecordCount,
+		CreatedAt:       file.CreatedAt,
+	}
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RecurringFrequencyDaily   = "daily"
+	RecurringFrequencyWeekly  = "weekly"
+	RecurringFrequencyMonthly = "monthly"
+	RecurringFrequencyCron    = "cron"
+
+	RecurringStatusActive    = "active"
+	RecurringStatusPaused    = "paused"
+	RecurringStatusCompleted = "completed"
+	RecurringStatusCancelled = "cancelled"
+
+	RecurringRunSucceeded = "succeeded"
+	RecurringRunFailed    = "failed"
+)
+
+// RecurringTransfer sends a fixed amount from a wallet of the user to a
+// recipient on a schedule. Every schedule is stored as a cron expression, the
+// daily, weekly and monthly frequencies are shortcuts for common ones.
+type RecurringTransfer struct {
+	ID             *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID         *uuid.UUID `gorm:"type:uuid;index;not null"`
+	User           User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	WalletID       *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Wallet         Wallet     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Recipient      string     `gorm:"type:varchar(100);not null"`
+	Amount         float64    `gorm:"type:numeric(18,2);not null"`
+	Currency       string     `gorm:"type:varchar(50);not null"`
+	Description    string     `gorm:"type:varchar(255)"`
+	Frequency      string     `gorm:"type:varchar(50);not null"`
+	Cron           string     `gorm:"type:varchar(100);not null"`
+	Timezone       string     `gorm:"type:varchar(50);default:'UTC';not null"`
+	StartAt        *time.Time `gorm:"not null"`
+	EndAt          *time.Time `gorm:"default:null"`
+	MaxOccurrences int        `gorm:"default:0;not null"`
+	Occurrences    int        `gorm:"default:0;not null"`
+	NextRunAt      *time.Time `gorm:"index;default:null"`
+	LastRunAt      *time.Time `gorm:"default:null"`
+	Status         string     `gorm:"type:varchar(50);index;default:'active';not null"`
+	CreatedAt      *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time `gorm:"default:null"`
+}
+
+// RecurringTransferRun is the result of one occurrence. An occurrence is
+// identified by its scheduled time and is executed at most once.
+type RecurringTransferRun struct {
+	ID                  *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	RecurringTransferID *uuid.UUID   `gorm:"type:uuid;uniqueIndex:idx_recurring_transfer_runs_occurrence;not null"`
+	ScheduledFor        *time.Time   `gorm:"uniqueIndex:idx_recurring_transfer_runs_occurrence;not null"`
+	Status              string       `gorm:"type:varchar(50);not null"`
+	TransactionID       *uuid.UUID   `gorm:"type:uuid;default:null"`
+	Transaction         *Transaction `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Error               string       `gorm:"type:varchar(255)"`
+	CreatedAt           *time.Time   `gorm:"not null;default:now()"`
+}
+
+type RecurringTransferResponse struct {
+	ID             *uuid.UUID                     `json:"id"`
+	Wallet         string                         `json:"wallet"`
+	Recipient      string                         `json:"recipient"`
+	Amount         float64                        `json:"amount"`
+	Currency       string                         `json:"currency"`
+	Description    string                         `json:"description,omitempty"`
+	Frequency      string                         `json:"frequency"`
+	Cron           string                         `json:"cron"`
+	Timezone       string                         `json:"timezone"`
+	StartAt        *time.Time                     `json:"start_at"`
+	EndAt          *time.Time                     `json:"end_at,omitempty"`
+	MaxOccurrences int                            `json:"max_occurrences"`
+	Occurrences    int                            `json:"occurrences"`
+	NextRunAt      *time.Time                     `json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time                     `json:"last_run_at,omitempty"`
+	Status         string                         `json:"status"`
+	Runs           []RecurringTransferRunResponse `json:"runs,omitempty"`
+	CreatedAt      *time.Time                     `json:"created_at"`
+	UpdatedAt      *time.Time                     `json:"updated_at"`
+}
+
+type RecurringTransferRunResponse struct {
+	ScheduledFor *time.Time `json:"scheduled_for"`
+	Status       string     `json:"status"`
+	Reference    string     `json:"reference,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// RecurringTransferScheduleRequest describes when a recurring transfer runs.
+// Time is the local time of day as HH:MM, DayOfWeek (0 is sunday) is used by
+// the weekly and DayOfMonth by the monthly frequency, Cron by the cron one.
+type RecurringTransferScheduleRequest struct {
+	Frequency  string `json:"frequency" validate:"required,oneof=daily weekly monthly cron"`
+	Time       string `json:"time" validate:"omitempty,len=5"`
+	DayOfWeek  int    `json:"day_of_week" validate:"omitempty,min=0,max=6"`
+	DayOfMonth int    `json:"day_of_month" validate:"omitempty,min=1,max=28"`
+	Cron       string `json:"cron" validate:"omitempty,max=100"`
+	Timezone   string `json:"timezone" validate:"omitempty,max=50"`
+}
+
+type RecurringTransferCreateRequest struct {
+	RecurringTransferScheduleRequest
+	Recipient      string     `json:"recipient" validate:"required,max=100"`
+	Amount         float64    `json:"amount" validate:"required,gt=0"`
+	Description    string     `json:"description" validate:"omitempty,max=255"`
+	StartAt        *time.Time `json:"start_at"`
+	EndAt          *time.Time `json:"end_at"`
+	MaxOccurrences int        `json:"max_occurrences" validate:"omitempty,min=1"`
+}
+
+type RecurringTransferUpdateRequest struct {
+	Schedule       *RecurringTransferScheduleRequest `json:"schedule"`
+	Amount         float64                           `json:"amount" validate:"omitempty,gt=0"`
+	Description    *string                           `json:"description" validate:"omitempty,max=255"`
+	EndAt          *time.Time                        `json:"end_at"`
+	MaxOccurrences *int                              `json:"max_occurrences" validate:"omitempty,min=0"`
+	Status         string                            `json:"status" validate:"omitempty,oneof=active paused"`
+}
+
+func RecurringTransferFilterRecord(rule *RecurringTransfer) RecurringTransferResponse {
+	return RecurringTransferResponse{
+		ID:             rule.ID,
+		Wallet:         rule.Wallet.Address,
+		Recipient:      rule.Recipient,
+		Amount:         rule.Amount,
+		Currency:       rule.Currency,
+		Description:    rule.Description,
+		Frequency:      rule.Frequency,
+		Cron:           rule.Cron,
+		Timezone:       rule.Timezone,
+		StartAt:        rule.StartAt,
+		EndAt:          rule.EndAt,
+		MaxOccurrences: rule.MaxOccurrences,
+		Occurrences:    rule.Occurrences,
+		NextRunAt:      rule.NextRunAt,
+		LastRunAt:      rule.LastRunAt,
+		Status:         rule.Status,
+		CreatedAt:      rule.CreatedAt,
+		UpdatedAt:      rule.UpdatedAt,
+	}
+}
+
+func RecurringTransferRunFilterRecord(run *RecurringTransferRun) RecurringTransferRunResponse {
+	res := RecurringTransferRunResponse{
+		ScheduledFor: run.ScheduledFor,
+		Status:       run.Status,
+		Error:        run.Error,
+		CreatedAt:    run.CreatedAt,
+	}
+
+	if run.Transaction != nil {
+		res.Reference = run.Transaction.Reference
+	}
+
+	return res
+}
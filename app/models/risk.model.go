@@ -0,0 +1,176 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/pkg/risk"
+	"github.com/google/uuid"
+)
+
+const (
+	RiskReviewPending   = "pending"
+	RiskReviewApproved  = "approved"
+	RiskReviewRejected  = "rejected"
+	RiskReviewCompleted = "completed"
+)
+
+// RequestDevice identifies the device a request was made from. ID is the
+// X-Device-ID header of the client, or a fingerprint of its user agent.
+type RequestDevice struct {
+	ID        string
+	IP        string
+	UserAgent string
+}
+
+// UserDevice is a device a user has moved money from before.
+type UserDevice struct {
+	ID          *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID      *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_user_devices_user_device;not null"`
+	DeviceID    string     `gorm:"type:varchar(128);uniqueIndex:idx_user_devices_user_device;not null"`
+	UserAgent   string     `gorm:"type:varchar(255)"`
+	IP          string     `gorm:"type:varchar(64)"`
+	FirstSeenAt time.Time  `gorm:"not null;default:now()"`
+	LastSeenAt  time.Time  `gorm:"not null;default:now()"`
+}
+
+// RiskEvaluation logs the outcome of every evaluation of the risk rules so
+// that the rules can be tuned. Wallets are referenced without foreign keys,
+// evaluations of allowed transactions are written while the wallets are
+// locked.
+type RiskEvaluation struct {
+	ID           *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID       *uuid.UUID `gorm:"type:uuid;index;not null"`
+	FromWalletID *uuid.UUID `gorm:"type:uuid"`
+	ToWalletID   *uuid.UUID `gorm:"type:uuid"`
+	Reference    string     `gorm:"type:varchar(64)"`
+	Type         string     `gorm:"type:varchar(50);not null"`
+	Amount       float64    `gorm:"type:numeric(18,2);not null"`
+	Currency     string     `gorm:"type:varchar(50);not null"`
+	DeviceID     string     `gorm:"type:varchar(128)"`
+	IP           string     `gorm:"type:varchar(64)"`
+	Outcome      string     `gorm:"type:varchar(50);index;not null"`
+	Hits         string     `gorm:"type:text;not null;default:'[]'"`
+	CreatedAt    *time.Time `gorm:"not null;default:now();index"`
+}
+
+// RiskReview is a transaction held for review because a rule asked for it.
+// The transaction is not executed yet, what it would debit is reserved by
+// Hold instead. Approving the review makes the transaction out of the hold,
+// rejecting it releases the hold. When the approved transaction can no
+// longer be made, for example because the hold expired, the sender can retry
+// it: the next identical transaction within the approval window passes the
+// review rules once, rules that block still apply.
+type RiskReview struct {
+	ID             *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID         *uuid.UUID `gorm:"type:uuid;index;not null"`
+	EvaluationID   *uuid.UUID `gorm:"type:uuid"`
+	FromWalletID   *uuid.UUID `gorm:"type:uuid;index;not null"`
+	ToWalletID     *uuid.UUID `gorm:"type:uuid;not null"`
+	FromAddress    string     `gorm:"type:varchar(225)"`
+	ToAddress      string     `gorm:"type:varchar(225)"`
+	Type           string     `gorm:"type:varchar(50);not null"`
+	Amount         float64    `gorm:"type:numeric(18,2);not null"`
+	Currency       string     `gorm:"type:varchar(50);not null"`
+	Description    string     `gorm:"type:varchar(255)"`
+	Reference      string     `gorm:"type:varchar(64)"`
+	InitiatedByID  *uuid.UUID `gorm:"type:uuid;default:null"`
+	ApprovalID     *uuid.UUID `gorm:"type:uuid;default:null"`
+	HoldID         *uuid.UUID `gorm:"type:uuid;default:null"`
+	Hold           *Hold      `gorm:"foreignKey:HoldID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Hits           string     `gorm:"type:text;not null;default:'[]'"`
+	Status         string     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Note           string     `gorm:"type:varchar(255)"`
+	ReviewerID     *uuid.UUID `gorm:"type:uuid;default:null"`
+	ReviewedAt     *time.Time `gorm:"default:null"`
+	ApprovalExpiry *time.Time `gorm:"default:null"`
+	UsedReference  string     `gorm:"type:varchar(64)"`
+	CreatedAt      *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time `gorm:"default:null"`
+}
+
+func decodeRiskHits(data string) []risk.Hit {
+	hits := []risk.Hit{}
+	_ = json.Unmarshal([]byte(data), &hits)
+
+	return hits
+}
+
+type RiskEvaluationResponse struct {
+	ID        *uuid.UUID `json:"id"`
+	UserID    *uuid.UUID `json:"user_id"`
+	Reference string     `json:"reference,omitempty"`
+	Type      string     `json:"type"`
+	Amount    float64    `json:"amount"`
+	Currency  string     `json:"currency"`
+	DeviceID  string     `json:"device_id,omitempty"`
+	IP        string     `json:"ip,omitempty"`
+	Outcome   string     `json:"outcome"`
+	Hits      []risk.Hit `json:"hits"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+type RiskReviewResponse struct {
+	ID             *uuid.UUID `json:"id"`
+	UserID         *uuid.UUID `json:"user_id"`
+	From           string     `json:"from"`
+	To             string     `json:"to"`
+	Type           string     `json:"type"`
+	Amount         float64    `json:"amount"`
+	Currency       string     `json:"currency"`
+	Description    string     `json:"description,omitempty"`
+	HeldAmount     float64    `json:"held_amount"`
+	Hits           []risk.Hit `json:"hits"`
+	Status         string     `json:"status"`
+	Note           string     `json:"note,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+	ApprovalExpiry *time.Time `json:"approval_expires_at,omitempty"`
+	UsedReference  string     `json:"used_reference,omitempty"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
+
+type RiskReviewDecisionRequest struct {
+	Note string `json:"note" validate:"max=255"`
+}
+
+func RiskEvaluationFilterRecord(evaluation *RiskEvaluation) RiskEvaluationResponse {
+	return RiskEvaluationResponse{
+		ID:        evaluation.ID,
+		UserID:    evaluation.UserID,
+		Reference: evaluation.Reference,
+		Type:      evaluation.Type,
+		Amount:    evaluation.Amount,
+		Currency:  evaluation.Currency,
+		DeviceID:  evaluation.DeviceID,
+		IP:        evaluation.IP,
+		Outcome:   evaluation.Outcome,
+		Hits:      decodeRiskHits(evaluation.Hits),
+		CreatedAt: evaluation.CreatedAt,
+	}
+}
+
+func RiskReviewFilterRecord(review *RiskReview) RiskReviewResponse {
+	res := RiskReviewResponse{
+		ID:             review.ID,
+		UserID:         review.UserID,
+		From:           review.FromAddress,
+		To:             review.ToAddress,
+		Type:           review.Type,
+		Amount:         review.Amount,
+		Currency:       review.Currency,
+		Description:    review.Description,
+		Hits:           decodeRiskHits(review.Hits),
+		Status:         review.Status,
+		Note:           review.Note,
+		ReviewedAt:     review.ReviewedAt,
+		ApprovalExpiry: review.ApprovalExpiry,
+		UsedReference:  review.UsedReference,
+		CreatedAt:      review.CreatedAt,
+	}
+
+	if review.Hold != nil && review.Hold.Status == HoldStatusActive {
+		res.HeldAmount = review.Hold.Amount
+	}
+
+	return res
+}
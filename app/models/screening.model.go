@@ -0,0 +1,89 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/pkg/sanctions"
+	"github.com/google/uuid"
+)
+
+const (
+	// ScreeningClear users have no open potential matches.
+	ScreeningClear = "clear"
+	// ScreeningPending users have a potential match waiting for review and
+	// can not move money until it is cleared.
+	ScreeningPending = "pending"
+	// ScreeningBlocked users were confirmed to be on the watchlist.
+	ScreeningBlocked = "blocked"
+
+	ScreeningCasePending   = "pending"
+	ScreeningCaseCleared   = "cleared"
+	ScreeningCaseConfirmed = "confirmed"
+
+	ScreeningSubjectUser     = "user"
+	ScreeningSubjectMerchant = "merchant"
+)
+
+// ScreeningCase is a name that potentially matched the watchlist. The user
+// it belongs to is held until the case is reviewed. Cases are never shown to
+// the user themselves.
+type ScreeningCase struct {
+	ID         *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index;not null"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	MerchantID *uuid.UUID `gorm:"type:uuid;default:null"`
+	Subject    string     `gorm:"type:varchar(50);not null"`
+	Name       string     `gorm:"type:varchar(225);not null"`
+	Matches    string     `gorm:"type:text;not null;default:'[]'"`
+	TopScore   float64    `gorm:"type:numeric(4,3);not null"`
+	Status     string     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Note       string     `gorm:"type:varchar(255)"`
+	ReviewerID *uuid.UUID `gorm:"type:uuid;default:null"`
+	ReviewedAt *time.Time `gorm:"default:null"`
+	CreatedAt  *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt  *time.Time `gorm:"default:null"`
+}
+
+type ScreeningCaseResponse struct {
+	ID         *uuid.UUID        `json:"id"`
+	User       UserResponse      `json:"user"`
+	MerchantID *uuid.UUID        `json:"merchant_id,omitempty"`
+	Subject    string            `json:"subject"`
+	Name       string            `json:"name"`
+	Matches    []sanctions.Match `json:"matches"`
+	TopScore   float64           `json:"top_score"`
+	Status     string            `json:"status"`
+	Note       string            `json:"note,omitempty"`
+	ReviewerID *uuid.UUID        `json:"reviewer_id,omitempty"`
+	ReviewedAt *time.Time        `json:"reviewed_at,omitempty"`
+	CreatedAt  *time.Time        `json:"created_at"`
+}
+
+type ScreeningDecisionRequest struct {
+	Note string `json:"note" validate:"required,max=255"`
+}
+
+type ScreeningCheckRequest struct {
+	Name string `json:"name" validate:"required,max=225"`
+}
+
+func ScreeningCaseFilterRecord(screeningCase *ScreeningCase) ScreeningCaseResponse {
+	matches := []sanctions.Match{}
+	_ = json.Unmarshal([]byte(screeningCase.Matches), &matches)
+
+	return ScreeningCaseResponse{
+		ID:         screeningCase.ID,
+		User:       UserFilterRecord(&screeningCase.User),
+		MerchantID: screeningCase.MerchantID,
+		Subject:    screeningCase.Subject,
+		Name:       screeningCase.Name,
+		Matches:    matches,
+		TopScore:   screeningCase.TopScore,
+		Status:     screeningCase.Status,
+		Note:       screeningCase.Note,
+		ReviewerID: screeningCase.ReviewerID,
+		ReviewedAt: screeningCase.ReviewedAt,
+		CreatedAt:  screeningCase.CreatedAt,
+	}
+}
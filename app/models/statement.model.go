@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatementFormatCSV = "csv"
+	StatementFormatPDF = "pdf"
+
+	StatementExportPending   = "pending"
+	StatementExportCompleted = "completed"
+	StatementExportFailed    = "failed"
+)
+
+// StatementExport is a statement of a long period that is generated in the
+// background. The file is kept in blob storage until ExpiresAt.
+type StatementExport struct {
+	ID          *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID      *uuid.UUID `gorm:"type:uuid;index;not null"`
+	WalletID    *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Wallet      Wallet     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	From        time.Time  `gorm:"type:date;not null"`
+	To          time.Time  `gorm:"type:date;not null"`
+	Format      string     `gorm:"type:varchar(10);not null"`
+	Status      string     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	StorageKey  string     `gorm:"type:varchar(255)"`
+	Error       string     `gorm:"type:varchar(255)"`
+	CompletedAt *time.Time `gorm:"default:null"`
+	ExpiresAt   *time.Time `gorm:"index;default:null"`
+	CreatedAt   *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt   *time.Time `gorm:"default:null"`
+}
+
+type StatementExportResponse struct {
+	ID          *uuid.UUID `json:"id"`
+	Address     string     `json:"address"`
+	From        string     `json:"from"`
+	To          string     `json:"to"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// StatementLine is a transaction as it appears on a statement. Debit and
+// Credit include the fee when it was paid by the wallet.
+type StatementLine struct {
+	Date         time.Time
+	Reference    string
+	Type         string
+	Description  string
+	Counterparty string
+	Debit        float64
+	Credit       float64
+	Balance      float64
+}
+
+// Statement lists every transaction of a wallet between two dates, both
+// included, with the balance before the first and after the last day.
+type Statement struct {
+	User           UserResponse
+	Address        string
+	Currency       string
+	From           time.Time
+	To             time.Time
+	OpeningBalance float64
+	ClosingBalance float64
+	TotalDebit     float64
+	TotalCredit    float64
+	Lines          []StatementLine
+	GeneratedAt    time.Time
+}
+
+func StatementExportFilterRecord(export *StatementExport) StatementExportResponse {
+	res := StatementExportResponse{
+		ID:          export.ID,
+		Address:     export.Wallet.Address,
+		From:        export.From.Format("2006-01-02"),
+		To:          export.To.Format("2006-01-02"),
+		Format:      export.Format,
+		Status:      export.Status,
+		Error:       export.Error,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+		CreatedAt:   export.CreatedAt,
+	}
+
+	if export.Status == StatementExportCompleted {
+		res.DownloadURL = "/api/v1/wallet/" + export.Wallet.Address + "/statements/" + export.ID.String() + "/download"
+	}
+
+	return res
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TierLimit caps what users of a KYC tier can do with their personal wallets
+// of a currency. A limit of zero means there is no limit. Volumes are the sum
+// of outgoing transactions, the inflow the sum of incoming ones, refunds and
+// reversals are not counted.
+type TierLimit struct {
+	ID             *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Tier           string     `gorm:"type:varchar(50);uniqueIndex:idx_tier_limits_tier_currency;not null"`
+	Currency       string     `gorm:"type:varchar(50);uniqueIndex:idx_tier_limits_tier_currency;not null"`
+	MaxBalance     float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	PerTransaction float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	DailyVolume    float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	MonthlyVolume  float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	MonthlyInflow  float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	CreatedAt      *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time `gorm:"default:null"`
+}
+
+type TierLimitResponse struct {
+	ID             *uuid.UUID `json:"id"`
+	Tier           string     `json:"tier"`
+	Currency       string     `json:"currency"`
+	MaxBalance     float64    `json:"max_balance"`
+	PerTransaction float64    `json:"per_transaction"`
+	DailyVolume    float64    `json:"daily_volume"`
+	MonthlyVolume  float64    `json:"monthly_volume"`
+	MonthlyInflow  float64    `json:"monthly_inflow"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+}
+
+type TierLimitUpdateRequest struct {
+	MaxBalance     *float64 `json:"max_balance" validate:"omitempty,gte=0"`
+	PerTransaction *float64 `json:"per_transaction" validate:"omitempty,gte=0"`
+	DailyVolume    *float64 `json:"daily_volume" validate:"omitempty,gte=0"`
+	MonthlyVolume  *float64 `json:"monthly_volume" validate:"omitempty,gte=0"`
+	MonthlyInflow  *float64 `json:"monthly_inflow" validate:"omitempty,gte=0"`
+}
+
+// UserLimitsResponse shows a user how much of each limit of their tier is
+// used and what remains. Limits and remaining amounts are null when there is
+// no limit.
+type UserLimitsResponse struct {
+	Tier     string `json:"tier"`
+	Currency string `json:"currency"`
+
+	Balance          float64  `json:"balance"`
+	MaxBalance       *float64 `json:"max_balance"`
+	BalanceRemaining *float64 `json:"balance_remaining"`
+
+	PerTransaction *float64 `json:"per_transaction"`
+
+	DailyUsed      float64  `json:"daily_used"`
+	DailyVolume    *float64 `json:"daily_volume"`
+	DailyRemaining *float64 `json:"daily_remaining"`
+
+	MonthlyUsed      float64  `json:"monthly_used"`
+	MonthlyVolume    *float64 `json:"monthly_volume"`
+	MonthlyRemaining *float64 `json:"monthly_remaining"`
+
+	MonthlyInflowUsed      float64  `json:"monthly_inflow_used"`
+	MonthlyInflow          *float64 `json:"monthly_inflow"`
+	MonthlyInflowRemaining *float64 `json:"monthly_inflow_remaining"`
+}
+
+func TierLimitFilterRecord(limit *TierLimit) TierLimitResponse {
+	return TierLimitResponse{
+		ID:             limit.ID,
+		Tier:           limit.Tier,
+		Currency:       limit.Currency,
+		MaxBalance:     limit.MaxBalance,
+		PerTransaction: limit.PerTransaction,
+		DailyVolume:    limit.DailyVolume,
+		MonthlyVolume:  limit.MonthlyVolume,
+		MonthlyInflow:  limit.MonthlyInflow,
+		UpdatedAt:      limit.UpdatedAt,
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TransactionTypeTransfer = "transfer"
+	TransactionTypePayment  = "payment"
+	TransactionTypePayout   = "payout"
+	TransactionTypeRefund   = "refund"
+	TransactionTypeReversal = "reversal"
+	TransactionTypeCashback = "cashback"
+
+	TransactionStatusCompleted         = "completed"
+	TransactionStatusPartiallyRefunded = "partially_refunded"
+	TransactionStatusRefunded          = "refunded"
+	TransactionStatusReversed          = "reversed"
+)
+
+// ReversalReasonCodes are the reasons an administrator can give for
+// reversing a transaction.
+var ReversalReasonCodes = []string{
+	"duplicate",
+	"fraud",
+	"unauthorized",
+	"merchant_error",
+	"customer_dispute",
+	"technical_error",
+	"other",
+}
+
+// Transaction is a single movement of money between two wallets. Balances are
+// never edited directly, every change is a Transaction with one LedgerEntry
+// per affected wallet. Refunds and reversals are new transactions in the
+// opposite direction linked to the original one, which keeps track of the
+// refunded amount.
+type Transaction struct {
+	ID           *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Reference    string     `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Type         string     `gorm:"type:varchar(50);index;not null"`
+	Status       string     `gorm:"type:varchar(50);default:'completed';not null"`
+	FromWalletID *uuid.UUID `gorm:"type:uuid;index"`
+	FromWallet   *Wallet    `gorm:"foreignKey:FromWalletID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	ToWalletID   *uuid.UUID `gorm:"type:uuid;index"`
+	ToWallet     *Wallet    `gorm:"foreignKey:ToWalletID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Amount       float64    `gorm:"type:numeric(18,2);not null"`
+	Currency     string     `gorm:"type:varchar(50);not null"`
+	Description  string     `gorm:"type:varchar(255)"`
+
+	Fee       float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	FeePaidBy string     `gorm:"type:varchar(50)"`
+	FeeRuleID *uuid.UUID `gorm:"type:uuid;default:null"`
+
+	OriginalTransactionID *uuid.UUID `gorm:"type:uuid;index;default:null"`
+	RefundedAmount        float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	ReasonCode            string     `gorm:"type:varchar(50)"`
+	InitiatedByID         *uuid.UUID `gorm:"type:uuid;default:null"`
+
+	CreatedAt *time.Time `gorm:"not null;default:now()"`
+}
+
+// DebitAmount is what the transaction took from the sending wallet, the
+// amount plus the fee when the sender pays it.
+func (t *Transaction) DebitAmount() float64 {
+	if t.FeePaidBy == FeePaidBySender {
+		return math.Round((t.Amount+t.Fee)*100) / 100
+	}
+
+	return t.Amount
+}
+
+// CreditAmount is what the transaction added to the receiving wallet, the
+// amount minus the fee when the receiver pays it.
+func (t *Transaction) CreditAmount() float64 {
+	if t.FeePaidBy == FeePaidByReceiver {
+		return math.Round((t.Amount-t.Fee)*100) / 100
+	}
+
+	return t.Amount
+}
+
+// LedgerEntry is the effect of a Transaction on a single wallet. The sum of
+// all entries of a wallet always equals its balance.
+type LedgerEntry struct {
+	ID            *uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	TransactionID *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Transaction   *Transaction `gorm:"foreignKey:TransactionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	WalletID      *uuid.UUID   `gorm:"type:uuid;index;not null"`
+	Amount        float64      `gorm:"type:numeric(18,2);not null"`
+	BalanceAfter  float64      `gorm:"type:numeric(18,2);not null"`
+	CreatedAt     *time.Time   `gorm:"not null;default:now()"`
+}
+
+type TransactionResponse struct {
+	ID          *uuid.UUID `json:"id"`
+	Reference   string     `json:"reference"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	From        string     `json:"from,omitempty"`
+	To          string     `json:"to,omitempty"`
+	Amount      float64    `json:"amount"`
+	Currency    string     `json:"currency"`
+	Description string     `json:"description,omitempty"`
+	Fee         float64    `json:"fee"`
+	FeePaidBy   string     `json:"fee_paid_by,omitempty"`
+
+	OriginalTransactionID *uuid.UUID `json:"original_transaction_id,omitempty"`
+	RefundedAmount        float64    `json:"refunded_amount"`
+	ReasonCode            string     `json:"reason_code,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+type TransactionRefundRequest struct {
+	Amount      float64 `json:"amount" validate:"omitempty,gt=0"`
+	Description string  `json:"description" validate:"omitempty,max=255"`
+}
+
+type TransactionReverseRequest struct {
+	ReasonCode string `json:"reason_code" validate:"required,oneof=duplicate fraud unauthorized merchant_error customer_dispute technical_error other"`
+	Note       string `json:"note" validate:"required,max=255"`
+}
+
+func TransactionFilterRecord(transaction *Transaction) TransactionResponse {
+	res := TransactionResponse{
+		ID:          transaction.ID,
+		Reference:   transaction.Reference,
+		Type:        transaction.Type,
+		Status:      transaction.Status,
+		Amount:      transaction.Amount,
+		Currency:    transaction.Currency,
+		Description: transaction.Description,
+		Fee:         transaction.Fee,
+		FeePaidBy:   transaction.FeePaidBy,
+
+		OriginalTransactionID: transaction.OriginalTransactionID,
+		RefundedAmount:        transaction.RefundedAmount,
+		ReasonCode:            transaction.ReasonCode,
+
+		CreatedAt: transaction.CreatedAt,
+	}
+
+	if transaction.FromWallet != nil {
+		res.From = transaction.FromWallet.Address
+	}
+
+	if transaction.ToWallet != nil {
+		res.To = transaction.ToWallet.Address
+	}
+
+	return res
+}
@@ -6,11 +6,25 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+
+	KYCTierUnverified = "unverified"
+	KYCTierVerified   = "verified"
+)
+
+var KYCTiers = []string{KYCTierUnverified, KYCTierVerified}
+
 type User struct {
 	ID              *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
 	Name            string     `gorm:"type:varchar(225);not null"`
+	Handle          *string    `gorm:"type:varchar(30);uniqueIndex;default:null"`
 	Email           string     `gorm:"type:varchar(225);uniqueIndex;not null"`
 	Password        string     `gorm:"type:varchar(225);not null"`
+	Role            string     `gorm:"type:varchar(50);default:'user';not null"`
+	KYCTier         string     `gorm:"column:kyc_tier;type:varchar(50);default:'unverified';not null"`
+	ScreeningStatus string     `gorm:"type:varchar(50);default:'clear';not null"`
 	EmailVerifiedAt *time.Time `gorm:"default:null"`
 	CreatedAt       *time.Time `gorm:"not null;default:now()"`
 	UpdatedAt       *time.Time `gorm:"default:null"`
@@ -19,7 +33,10 @@ type User struct {
 type UserResponse struct {
 	ID              *uuid.UUID `json:"id"`
 	Name            string     `json:"name"`
+	Handle          *string    `json:"handle"`
 	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	KYCTier         string     `json:"kyc_tier"`
 	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 	CreatedAt       *time.Time `json:"created_at"`
 	UpdatedAt       *time.Time `json:"updated_at"`
@@ -37,12 +54,45 @@ type UserLoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type UserHandleRequest struct {
+	Handle string `json:"handle" validate:"required,min=3,max=31"`
+}
+
+// UserHandleAlias records every handle a user has ever claimed. Old handles
+// stay reserved for their original owner so they can not be hijacked to
+// receive payments meant for someone else.
+type UserHandleAlias struct {
+	ID        *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index;not null"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Handle    string     `gorm:"type:varchar(30);uniqueIndex;not null"`
+	CreatedAt *time.Time `gorm:"not null;default:now()"`
+	RetiredAt *time.Time `gorm:"default:null"`
+}
+
+type UserHandleAliasResponse struct {
+	Handle    string     `json:"handle"`
+	CreatedAt *time.Time `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at"`
+}
+
 func UserFilterRecord(user *User) UserResponse {
 	return UserResponse{
 		ID:        user.ID,
 		Name:      user.Name,
+		Handle:    user.Handle,
 		Email:     user.Email,
+		Role:      user.Role,
+		KYCTier:   user.KYCTier,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 	}
 }
+
+func UserHandleAliasFilterRecord(alias *UserHandleAlias) UserHandleAliasResponse {
+	return UserHandleAliasResponse{
+		Handle:    alias.Handle,
+		CreatedAt: alias.CreatedAt,
+		RetiredAt: alias.RetiredAt,
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,25 +9,70 @@ import (
 
 var WalletCurrencies = []string{"IDR", "USD"}
 
+// SystemAccountFeeRevenue marks the wallets, one per currency, that collect
+// the fees charged on transactions. System wallets have no owner.
+const SystemAccountFeeRevenue = "fee_revenue"
+
 type Wallet struct {
-	ID        *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
-	UserID    *uuid.UUID
-	User      User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Address   string     `gorm:"type:varchar(225);uniqueIndex;not null"`
-	Balance   float64    `gorm:"type:numeric(10,2);default:0;not null"`
-	Currency  string     `gorm:"type:varchar(50);default:'IDR';not null"`
+	ID            *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID        *uuid.UUID
+	User          User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	MerchantID    *uuid.UUID `gorm:"type:uuid;index;default:null"`
+	Address       string     `gorm:"type:varchar(225);uniqueIndex;not null"`
+	Balance       float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	HeldBalance   float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	PocketBalance float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	Currency      string     `gorm:"type:varchar(50);default:'IDR';not null"`
+	IsDefault     bool       `gorm:"default:false;not null"`
+
+	SystemAccount string `gorm:"type:varchar(50);index;not null;default:''"`
+
+	// FrozenAt is set while a wallet is frozen, e.g. by reconciliation when
+	// its balance does not match its history. Frozen wallets can not send or
+	// receive transfers until an administrator unfreezes them.
+	FrozenAt     *time.Time `gorm:"default:null"`
+	FrozenReason string     `gorm:"type:varchar(255)"`
+
+	// Role is the role of the user the wallet was looked up for, set by
+	// FindUserWallet.
+	Role string `gorm:"-"`
+
 	CreatedAt *time.Time `gorm:"not null;default:now()"`
 	UpdatedAt *time.Time `gorm:"default:null"`
 }
 
+// AvailableBalance is the balance that can be spent: the ledger balance minus
+// HeldBalance, the part reserved by active holds until they are captured or
+// released, and minus PocketBalance, the part set aside in pockets.
+func (w *Wallet) AvailableBalance() float64 {
+	return math.Round((w.Balance-w.HeldBalance-w.PocketBalance)*100) / 100
+}
+
+// WalletResponse shows the ledger balance as balance, next to the balance
+// that is available for spending, the balance that is held and the balance
+// set aside in pockets.
 type WalletResponse struct {
-	ID        *uuid.UUID   `json:"id"`
-	User      UserResponse `json:"user"`
-	Address   string       `json:"address"`
-	Balance   float64      `json:"balance"`
-	Currency  string       `json:"currency"`
-	CreatedAt *time.Time   `json:"created_at"`
-	UpdatedAt *time.Time   `json:"updated_at"`
+	ID               *uuid.UUID   `json:"id"`
+	User             UserResponse `json:"user"`
+	MerchantID       *uuid.UUID   `json:"merchant_id,omitempty"`
+	Address          string       `json:"address"`
+	Balance          float64      `json:"balance"`
+	AvailableBalance float64      `json:"available_balance"`
+	HeldBalance      float64      `json:"held_balance"`
+	PocketBalance    float64      `json:"pocket_balance"`
+	Currency         string       `json:"currency"`
+	IsDefault        bool         `json:"is_default"`
+	Role             string       `json:"role,omitempty"`
+	FrozenAt         *time.Time   `json:"frozen_at,omitempty"`
+	CreatedAt        *time.Time   `json:"created_at"`
+	UpdatedAt        *time.Time   `json:"updated_at"`
+}
+
+// WalletReceiveResponse is the public part of a wallet that is shared with
+// other users who want to send money to it.
+type WalletReceiveResponse struct {
+	Address  string `json:"address"`
+	Currency string `json:"currency"`
 }
 
 type WalletCreateRequest struct {
@@ -39,12 +85,26 @@ type WalletUpdateRequest struct {
 
 func WalletFilterRecord(wallet *Wallet) WalletResponse {
 	return WalletResponse{
-		ID:        wallet.ID,
-		User:      UserFilterRecord(&wallet.User),
-		Address:   wallet.Address,
-		Balance:   wallet.Balance,
-		Currency:  wallet.Currency,
-		CreatedAt: wallet.CreatedAt,
-		UpdatedAt: wallet.UpdatedAt,
+		ID:               wallet.ID,
+		User:             UserFilterRecord(&wallet.User),
+		MerchantID:       wallet.MerchantID,
+		Address:          wallet.Address,
+		Balance:          wallet.Balance,
+		AvailableBalance: wallet.AvailableBalance(),
+		HeldBalance:      wallet.HeldBalance,
+		PocketBalance:    wallet.PocketBalance,
+		Currency:         wallet.Currency,
+		IsDefault:        wallet.IsDefault,
+		Role:             wallet.Role,
+		FrozenAt:         wallet.FrozenAt,
+		CreatedAt:        wallet.CreatedAt,
+		UpdatedAt:        wallet.UpdatedAt,
+	}
+}
+
+func WalletReceiveFilterRecord(wallet *Wallet) WalletReceiveResponse {
+	return WalletReceiveResponse{
+		Address:  wallet.Address,
+		Currency: wallet.Currency,
 	}
 }
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// WalletRoleOwner can spend from the wallet and manage it and its
+	// members. The user of Wallet.UserID is always an owner.
+	WalletRoleOwner = "owner"
+	// WalletRoleSpender can spend from the wallet, up to their daily
+	// spending limit when one is set.
+	WalletRoleSpender = "spender"
+	// WalletRoleViewer can only see the wallet and its history.
+	WalletRoleViewer = "viewer"
+
+	// WalletAccessView, WalletAccessSpend and WalletAccessManage are the
+	// levels of access a wallet lookup can require.
+	WalletAccessView   = "view"
+	WalletAccessSpend  = "spend"
+	WalletAccessManage = "manage"
+
+	WalletInvitationPending  = "pending"
+	WalletInvitationAccepted = "accepted"
+	WalletInvitationDeclined = "declined"
+	WalletInvitationRevoked  = "revoked"
+	WalletInvitationExpired  = "expired"
+)
+
+// WalletRoles lists the roles a member can be given, most powerful first.
+var WalletRoles = []string{WalletRoleOwner, WalletRoleSpender, WalletRoleViewer}
+
+// WalletRoleAllows reports whether a role grants the access level.
+func WalletRoleAllows(role string, access string) bool {
+	switch access {
+	case WalletAccessManage:
+		return role == WalletRoleOwner
+	case WalletAccessSpend:
+		return role == WalletRoleOwner || role == WalletRoleSpender
+	case WalletAccessView:
+		return role == WalletRoleOwner || role == WalletRoleSpender || role == WalletRoleViewer
+	}
+
+	return false
+}
+
+// WalletMember gives a user other than the owner of a wallet access to it.
+// DailySpendingLimit caps what a spender can send from the wallet per day,
+// refunds included, zero means no limit.
+type WalletMember struct {
+	ID                 *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID           *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_wallet_members_user;not null"`
+	Wallet             Wallet     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID             *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_wallet_members_user;index;not null"`
+	User               User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Role               string     `gorm:"type:varchar(50);not null"`
+	DailySpendingLimit float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	AddedByID          *uuid.UUID `gorm:"type:uuid;default:null"`
+	CreatedAt          *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt          *time.Time `gorm:"default:null"`
+}
+
+// WalletInvitation invites a registered user, found by email or @handle, to
+// become a member of a wallet. Pending invitations expire at ExpiresAt.
+type WalletInvitation struct {
+	ID                 *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	WalletID           *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Wallet             Wallet     `gorm:"foreignKey:WalletID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	InviteeID          *uuid.UUID `gorm:"type:uuid;index;not null"`
+	Invitee            User       `gorm:"foreignKey:InviteeID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	InvitedByID        *uuid.UUID `gorm:"type:uuid;not null"`
+	InvitedBy          User       `gorm:"foreignKey:InvitedByID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Role               string     `gorm:"type:varchar(50);not null"`
+	DailySpendingLimit float64    `gorm:"type:numeric(18,2);default:0;not null"`
+	Status             string     `gorm:"type:varchar(50);index;default:'pending';not null"`
+	ExpiresAt          *time.Time `gorm:"not null"`
+	RespondedAt        *time.Time `gorm:"default:null"`
+	CreatedAt          *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt          *time.Time `gorm:"default:null"`
+}
+
+type WalletMemberResponse struct {
+	ID                 *uuid.UUID `json:"id,omitempty"`
+	UserID             *uuid.UUID `json:"user_id"`
+	Name               string     `json:"name"`
+	Handle             *string    `json:"handle"`
+	Role               string     `json:"role"`
+	DailySpendingLimit float64    `json:"daily_spending_limit,omitempty"`
+	CreatedAt          *time.Time `json:"created_at"`
+}
+
+type WalletInvitationResponse struct {
+	ID                 *uuid.UUID `json:"id"`
+	Wallet             string     `json:"wallet"`
+	Currency           string     `json:"currency"`
+	Invitee            string     `json:"invitee"`
+	InvitedBy          string     `json:"invited_by"`
+	Role               string     `json:"role"`
+	DailySpendingLimit float64    `json:"daily_spending_limit,omitempty"`
+	Status             string     `json:"status"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	RespondedAt        *time.Time `json:"responded_at,omitempty"`
+	CreatedAt          *time.Time `json:"created_at"`
+}
+
+// WalletInviteRequest invites a user by email address or @handle.
+type WalletInviteRequest struct {
+	Invitee            string  `json:"invitee" validate:"required,max=225"`
+	Role               string  `json:"role" validate:"required,oneof=owner spender viewer"`
+	DailySpendingLimit float64 `json:"daily_spending_limit" validate:"omitempty,gt=0"`
+}
+
+// WalletMemberUpdateRequest changes the role or the limit of a member, a zero
+// limit removes it.
+type WalletMemberUpdateRequest struct {
+	Role               string   `json:"role" validate:"omitempty,oneof=owner spender viewer"`
+	DailySpendingLimit *float64 `json:"daily_spending_limit" validate:"omitempty,min=0"`
+}
+
+func WalletMemberFilterRecord(member *WalletMember) WalletMemberResponse {
+	return WalletMemberResponse{
+		ID:                 member.ID,
+		UserID:             member.UserID,
+		Name:               member.User.Name,
+		Handle:             member.User.Handle,
+		Role:               member.Role,
+		DailySpendingLimit: member.DailySpendingLimit,
+		CreatedAt:          member.CreatedAt,
+	}
+}
+
+// WalletOwnerFilterRecord shows the owner of a wallet next to its members.
+func WalletOwnerFilterRecord(wallet *Wallet) WalletMemberResponse {
+	return WalletMemberResponse{
+		UserID:    wallet.UserID,
+		Name:      wallet.User.Name,
+		Handle:    wallet.User.Handle,
+		Role:      WalletRoleOwner,
+		CreatedAt: wallet.CreatedAt,
+	}
+}
+
+func WalletInvitationFilterRecord(invitation *WalletInvitation) WalletInvitationResponse {
+	invitee := invitation.Invitee.Email
+	if invitation.Invitee.Handle != nil {
+		invitee = "@" + *invitation.Invitee.Handle
+	}
+
+	return WalletInvitationResponse{
+		ID:                 invitation.ID,
+		Wallet:             invitation.Wallet.Address,
+		Currency:           invitation.Wallet.Currency,
+		Invitee:            invitee,
+		InvitedBy:          invitation.InvitedBy.Name,
+		Role:               invitation.Role,
+		DailySpendingLimit: invitation.DailySpendingLimit,
+		Status:             invitation.Status,
+		ExpiresAt:          invitation.ExpiresAt,
+		RespondedAt:        invitation.RespondedAt,
+		CreatedAt:          invitation.CreatedAt,
+	}
+}
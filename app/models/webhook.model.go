@@ -0,0 +1,162 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL of a user, optionally scoped to one of their
+// merchants, that receives signed event notifications.
+type WebhookEndpoint struct {
+	ID         *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index;not null"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	MerchantID *uuid.UUID `gorm:"type:uuid;index;default:null"`
+	Merchant   *Merchant  `gorm:"foreignKey:MerchantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	URL        string     `gorm:"type:varchar(500);not null"`
+	Secret     string     `gorm:"type:varchar(100);not null"`
+	Events     string     `gorm:"type:text;not null"`
+	Active     bool       `gorm:"default:true;not null"`
+	CreatedAt  *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt  *time.Time `gorm:"default:null"`
+}
+
+// Subscribed reports whether the endpoint wants to receive the event type.
+func (e *WebhookEndpoint) Subscribed(eventType string) bool {
+	for _, t := range strings.Split(e.Events, ",") {
+		if t == EventTypeAll || t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery is one event to be delivered to one endpoint. Failed
+// attempts are retried with an exponential backoff until MaxAttempts.
+type WebhookDelivery struct {
+	ID             *uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	EndpointID     *uuid.UUID      `gorm:"type:uuid;index;not null"`
+	Endpoint       WebhookEndpoint `gorm:"foreignKey:EndpointID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	EventID        *uuid.UUID      `gorm:"type:uuid;index;not null"`
+	EventType      string          `gorm:"type:varchar(100);not null"`
+	Payload        string          `gorm:"type:text;not null"`
+	Status         string          `gorm:"type:varchar(50);index;default:'pending';not null"`
+	Attempts       int             `gorm:"default:0;not null"`
+	MaxAttempts    int             `gorm:"default:10;not null"`
+	NextAttemptAt  *time.Time      `gorm:"index;default:now()"`
+	LastStatusCode int             `gorm:"default:0;not null"`
+	LastError      string          `gorm:"type:text"`
+	DeliveredAt    *time.Time      `gorm:"default:null"`
+	CreatedAt      *time.Time      `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time      `gorm:"default:null"`
+}
+
+// WebhookAttempt is a single HTTP request made for a delivery.
+type WebhookAttempt struct {
+	ID           *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	DeliveryID   *uuid.UUID `gorm:"type:uuid;index;not null"`
+	StatusCode   int        `gorm:"default:0;not null"`
+	ResponseBody string     `gorm:"type:text"`
+	Error        string     `gorm:"type:text"`
+	DurationMs   int64      `gorm:"default:0;not null"`
+	CreatedAt    *time.Time `gorm:"not null;default:now()"`
+}
+
+type WebhookEndpointResponse struct {
+	ID         *uuid.UUID `json:"id"`
+	MerchantID *uuid.UUID `json:"merchant_id,omitempty"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"`
+	Events     []string   `json:"events"`
+	Active     bool       `json:"active"`
+	CreatedAt  *time.Time `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             *uuid.UUID               `json:"id"`
+	EventID        *uuid.UUID               `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         string                   `json:"status"`
+	Attempts       int                      `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at"`
+	LastStatusCode int                      `json:"last_status_code"`
+	LastError      string                   `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time               `json:"delivered_at"`
+	AttemptLog     []WebhookAttemptResponse `json:"attempt_log,omitempty"`
+	CreatedAt      *time.Time               `json:"created_at"`
+}
+
+type WebhookAttemptResponse struct {
+	StatusCode   int        `json:"status_code"`
+	ResponseBody string     `json:"response_body,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	DurationMs   int64      `json:"duration_ms"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+type WebhookEndpointCreateRequest struct {
+	URL        string   `json:"url" validate:"required,url,max=500"`
+	Events     []string `json:"events" validate:"required,min=1,dive,required"`
+	MerchantID string   `json:"merchant_id" validate:"omitempty,uuid"`
+}
+
+type WebhookEndpointUpdateRequest struct {
+	URL    string   `json:"url" validate:"omitempty,url,max=500"`
+	Events []string `json:"events" validate:"omitempty,min=1,dive,required"`
+	Active *bool    `json:"active"`
+}
+
+func WebhookEndpointFilterRecord(endpoint *WebhookEndpoint, withSecret bool) WebhookEndpointResponse {
+	res := WebhookEndpointResponse{
+		ID:         endpoint.ID,
+		MerchantID: endpoint.MerchantID,
+		URL:        endpoint.URL,
+		Events:     strings.Split(endpoint.Events, ","),
+		Active:     endpoint.Active,
+		CreatedAt:  endpoint.CreatedAt,
+		UpdatedAt:  endpoint.UpdatedAt,
+	}
+
+	if withSecret {
+		res.Secret = endpoint.Secret
+	}
+
+	return res
+}
+
+func WebhookDeliveryFilterRecord(delivery *WebhookDelivery, attempts []WebhookAttempt) WebhookDeliveryResponse {
+	res := WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+
+	for _, a := range attempts {
+		res.AttemptLog = append(res.AttemptLog, WebhookAttemptResponse{
+			StatusCode:   a.StatusCode,
+			ResponseBody: a.ResponseBody,
+			Error:        a.Error,
+			DurationMs:   a.DurationMs,
+			CreatedAt:    a.CreatedAt,
+		})
+	}
+
+	return res
+}
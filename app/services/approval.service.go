@@ -0,0 +1,629 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrApprovalRequired    = errors.New("Payments of this amount from this wallet must be approved by its owners first")
+	ErrApprovalOwners      = errors.New("The wallet does not have enough owners to approve transfers")
+	ErrApprovalNotFound    = errors.New("The transfer approval was not found or is no longer pending")
+	ErrApprovalExpired     = errors.New("This transfer approval has expired")
+	ErrApprovalSelf        = errors.New("You can not approve or reject your own transfer")
+	ErrApprovalDecided     = errors.New("You have already decided on this transfer")
+	ErrApprovalNotSelf     = errors.New("Only the member who requested the transfer can cancel it")
+	ErrApprovalPolicyShare = errors.New("Merchant settlement wallets can not have an approval policy")
+	ErrApprovalUnsupported = errors.New("Payments of this amount from this wallet need the approval of its owners, which this kind of payment can not wait for")
+)
+
+// IsApprovalError reports whether err is caused by the request rather than
+// by the database.
+func IsApprovalError(err error) bool {
+	switch err {
+	case ErrApprovalRequired, ErrApprovalOwners, ErrApprovalNotFound, ErrApprovalExpired, ErrApprovalSelf,
+		ErrApprovalDecided, ErrApprovalNotSelf, ErrApprovalPolicyShare, ErrApprovalUnsupported:
+		return true
+	}
+
+	return false
+}
+
+func preloadTransferApproval(db *gorm.DB) *gorm.DB {
+	return db.Preload("Wallet").Preload("RequestedBy").Preload("Hold").
+		Preload("Decisions", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).Preload("Decisions.User").
+		Preload("Transaction.FromWallet").Preload("Transaction.ToWallet")
+}
+
+// FindApprovalPolicy returns the approval policy of the wallet.
+func FindApprovalPolicy(db *gorm.DB, walletID string) (*models.ApprovalPolicy, error) {
+	var policy models.ApprovalPolicy
+	result := db.Preload("Wallet").Where("wallet_id = ?", walletID).First(&policy)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &policy, nil
+}
+
+// SetApprovalPolicy creates or replaces the approval policy of the wallet.
+// An owner can not approve their own transfers, so the wallet must have one
+// owner more than approvals are required.
+func SetApprovalPolicy(db *gorm.DB, wallet *models.Wallet, updatedByID *uuid.UUID, req *models.ApprovalPolicyRequest) (*models.ApprovalPolicy, error) {
+	if wallet.MerchantID != nil {
+		return nil, ErrApprovalPolicyShare
+	}
+
+	owners, err := walletOwnerIDs(db, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(owners)-1 < req.RequiredApprovals {
+		return nil, ErrApprovalOwners
+	}
+
+	expiresIn := req.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = models.DefaultApprovalExpiresIn
+	}
+
+	policy := models.ApprovalPolicy{
+		WalletID:          wallet.ID,
+		Threshold:         utils.RoundAmount(req.Threshold),
+		RequiredApprovals: req.RequiredApprovals,
+		ExpiresIn:         expiresIn,
+		UpdatedByID:       updatedByID,
+	}
+
+	err = db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "wallet_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"threshold":          policy.Threshold,
+			"required_approvals": policy.RequiredApprovals,
+			"expires_in":         policy.ExpiresIn,
+			"updated_by_id":      policy.UpdatedByID,
+			"updated_at":         time.Now(),
+		}),
+	}).Omit(clause.Associations).Create(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return FindApprovalPolicy(db, wallet.ID.String())
+}
+
+// DeleteApprovalPolicy removes the approval policy of the wallet. Transfers
+// already waiting for approval still need it.
+func DeleteApprovalPolicy(db *gorm.DB, walletID string) error {
+	result := db.Delete(&models.ApprovalPolicy{}, "wallet_id = ?", walletID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// walletOwnerIDs returns the users with the owner role in the wallet.
+func walletOwnerIDs(db *gorm.DB, wallet *models.Wallet) ([]*uuid.UUID, error) {
+	var members []models.WalletMember
+	if err := db.Where("wallet_id = ? and role = ?", wallet.ID, models.WalletRoleOwner).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	owners := []*uuid.UUID{wallet.UserID}
+	for _, member := range members {
+		owners = append(owners, member.UserID)
+	}
+
+	return owners, nil
+}
+
+// findApplyingApprovalPolicy returns the approval policy of the wallet when
+// a transfer or payment of amount needs the approval of its owners, or nil.
+func findApplyingApprovalPolicy(db *gorm.DB, walletID *uuid.UUID, amount float64) (*models.ApprovalPolicy, error) {
+	var policy models.ApprovalPolicy
+	result := db.Where("wallet_id = ?", walletID).Limit(1).Find(&policy)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 || utils.RoundAmount(amount) < policy.Threshold {
+		return nil, nil
+	}
+
+	return &policy, nil
+}
+
+// checkApprovalPolicy refuses transfers and payments initiated by a user that
+// need the approval of the owners of the wallet, unless they are made for an
+// approved TransferApproval.
+func checkApprovalPolicy(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet, approvalID *uuid.UUID) error {
+	if approvalID != nil || transaction.InitiatedByID == nil {
+		return nil
+	}
+
+	if transaction.Type != models.TransactionTypeTransfer && transaction.Type != models.TransactionTypePayment {
+		return nil
+	}
+
+	policy, err := findApplyingApprovalPolicy(tx, from.ID, transaction.Amount)
+	if err != nil {
+		return err
+	}
+
+	if policy != nil {
+		return ErrApprovalRequired
+	}
+
+	return nil
+}
+
+// CheckPaymentApproval returns ErrApprovalUnsupported when a payment of
+// amount from the wallet needs the approval of its owners. It is used by the
+// ways of paying that can not wait for an approval, like checkouts, payment
+// requests, recurring transfers and hold captures, to refuse such payments
+// up front instead of failing them later.
+func CheckPaymentApproval(db *gorm.DB, walletID *uuid.UUID, amount float64) error {
+	policy, err := findApplyingApprovalPolicy(db, walletID, amount)
+	if err != nil {
+		return err
+	}
+
+	if policy != nil {
+		return ErrApprovalUnsupported
+	}
+
+	return nil
+}
+
+// SendWalletTransfer sends amount from the wallet to the recipient wallet on
+// behalf of the user, as a transaction of transactionType, either a transfer
+// or a payment. When the approval policy of the wallet applies, no money is
+// moved yet: the total is held and the pending TransferApproval is returned
+// instead of the transaction.
+func SendWalletTransfer(db *gorm.DB, wallet *models.Wallet, to *models.Wallet, recipient string, userID *uuid.UUID, transactionType string, amount float64, description string) (*models.Transaction, *models.TransferApproval, error) {
+	amount = utils.RoundAmount(amount)
+
+	policy, err := findApplyingApprovalPolicy(db, wallet.ID, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if policy == nil {
+		transaction, err := Transfer(db, TransferParams{
+			FromWalletID:  wallet.ID,
+			ToWalletID:    to.ID,
+			Amount:        amount,
+			Type:          transactionType,
+			Description:   description,
+			InitiatedByID: userID,
+		})
+
+		return transaction, nil, err
+	}
+
+	approval, err := requestTransferApproval(db, policy, wallet, to, recipient, userID, transactionType, amount, description)
+
+	return nil, approval, err
+}
+
+// requestTransferApproval holds the total of the transfer and asks the owners
+// of the wallet other than the requester to approve it.
+func requestTransferApproval(db *gorm.DB, policy *models.ApprovalPolicy, wallet *models.Wallet, to *models.Wallet, recipient string, userID *uuid.UUID, transactionType string, amount float64, description string) (*models.TransferApproval, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	if wallet.ID.String() == to.ID.String() {
+		return nil, ErrSameWallet
+	}
+
+	approvers, err := transferApprovers(db, policy, wallet, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := QuoteFee(db, feeOperation(transactionType), wallet.Currency, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if description == "" {
+		description = "Transfer to " + recipient
+	}
+
+	expiresAt := time.Now().Add(time.Duration(policy.ExpiresIn) * time.Second)
+
+	approval := models.TransferApproval{
+		WalletID:          wallet.ID,
+		RequestedByID:     userID,
+		Type:              transactionType,
+		Recipient:         recipient,
+		ToWalletID:        to.ID,
+		Amount:            amount,
+		Currency:          wallet.Currency,
+		Description:       description,
+		RequiredApprovals: policy.RequiredApprovals,
+		ExpiresAt:         &expiresAt,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, wallet.ID)
+		if err != nil {
+			return err
+		}
+
+		// The spending limit of the requester is checked now as well, so a
+		// transfer the requester could never make is not queued.
+		err = checkMemberSpending(tx, &models.Transaction{
+			Type:          transactionType,
+			Amount:        amount,
+			Fee:           quote.Fee,
+			FeePaidBy:     quote.PaidBy,
+			InitiatedByID: userID,
+		}, wallets[wallet.ID.String()])
+		if err != nil {
+			return err
+		}
+
+		return openTransferApproval(tx, &approval, quote.Total, approvers)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &approval, nil
+}
+
+// transferApprovers returns the owners of the wallet other than the
+// requester, who can decide on what the requester asks for.
+func transferApprovers(db *gorm.DB, policy *models.ApprovalPolicy, wallet *models.Wallet, userID *uuid.UUID) ([]*uuid.UUID, error) {
+	owners, err := walletOwnerIDs(db, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	approvers := make([]*uuid.UUID, 0, len(owners))
+	for _, owner := range owners {
+		if owner.String() != userID.String() {
+			approvers = append(approvers, owner)
+		}
+	}
+
+	if len(approvers) < policy.RequiredApprovals {
+		return nil, ErrApprovalOwners
+	}
+
+	return approvers, nil
+}
+
+// openTransferApproval holds amount of the wallet until the approval expires,
+// saves the approval as pending and notifies the approvers.
+func openTransferApproval(tx *gorm.DB, approval *models.TransferApproval, amount float64, approvers []*uuid.UUID) error {
+	hold, err := PlaceHold(tx, approval.WalletID, amount, "Awaiting approval: "+approval.Description, *approval.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	approval.HoldID = hold.ID
+	approval.Status = models.TransferApprovalPending
+
+	if err := tx.Omit(clause.Associations).Create(approval).Error; err != nil {
+		return err
+	}
+
+	if err := preloadTransferApproval(tx).First(approval, "id = ?", approval.ID).Error; err != nil {
+		return err
+	}
+
+	data := models.TransferApprovalFilterRecord(approval)
+	for _, approver := range approvers {
+		if err := PublishEvent(tx, approver, nil, models.EventApprovalRequested, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindWalletTransferApprovals returns the latest transfer approvals of the
+// wallet, optionally only the ones with the given status.
+func FindWalletTransferApprovals(db *gorm.DB, walletID string, status string) ([]models.TransferApproval, error) {
+	query := preloadTransferApproval(db).Where("wallet_id = ?", walletID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var approvals []models.TransferApproval
+	if err := query.Order("created_at desc").Limit(100).Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+// FindWalletTransferApproval returns a transfer approval of the wallet,
+// expiring it when its expiry has passed while it was still pending.
+func FindWalletTransferApproval(db *gorm.DB, walletID string, id string) (*models.TransferApproval, error) {
+	var approval models.TransferApproval
+	if err := preloadTransferApproval(db).Where("wallet_id = ? and id = ?", walletID, id).First(&approval).Error; err != nil {
+		return nil, err
+	}
+
+	if approval.Status == models.TransferApprovalPending && approval.ExpiresAt.Before(time.Now()) {
+		if err := expireTransferApproval(db, approval.ID.String()); err != nil && err != ErrApprovalNotFound {
+			return nil, err
+		}
+
+		return FindWalletTransferApproval(db, walletID, id)
+	}
+
+	return &approval, nil
+}
+
+// ApproveTransfer records the approval of an owner. The transfer is executed
+// with the approval that reaches the required number, out of the held funds.
+// When the transfer itself fails, for example because the recipient can no
+// longer receive it, the approval is closed as failed and the hold released.
+func ApproveTransfer(db *gorm.DB, walletID string, id string, userID *uuid.UUID, comment string) (*models.TransferApproval, error) {
+	err := transactionWithRisk(db, func(tx *gorm.DB) error {
+		approval, err := decideTransferApproval(tx, walletID, id, userID, models.ApprovalDecisionApprove, comment)
+		if err != nil {
+			return err
+		}
+
+		approval.Approvals++
+		if approval.Approvals < approval.RequiredApprovals {
+			return tx.Model(approval).Updates(map[string]interface{}{"approvals": approval.Approvals, "updated_at": time.Now()}).Error
+		}
+
+		return executeTransferApproval(tx, approval)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletTransferApproval(db, walletID, id)
+}
+
+// executeTransferApproval makes the approved transfer, or starts the approved
+// payout batch, and closes the approval as failed when it is refused.
+func executeTransferApproval(tx *gorm.DB, approval *models.TransferApproval) error {
+	var transaction *models.Transaction
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if approval.PayoutBatchID != nil {
+			return executePayoutApproval(tx, approval)
+		}
+
+		hold, err := lockActiveHold(tx, approval.HoldID.String())
+		if err != nil {
+			return err
+		}
+
+		transaction, err = captureHold(tx, hold, TransferParams{
+			FromWalletID:  approval.WalletID,
+			ToWalletID:    approval.ToWalletID,
+			Amount:        approval.Amount,
+			Type:          approval.Type,
+			Description:   approval.Description,
+			InitiatedByID: approval.RequestedByID,
+			ApprovalID:    approval.ID,
+		})
+
+		return err
+	})
+
+	now := time.Now()
+	updates := map[string]interface{}{"approvals": approval.Approvals, "decided_at": now, "updated_at": now}
+	eventType := models.EventApprovalExecuted
+
+	switch {
+	case err == nil:
+		updates["status"] = models.TransferApprovalExecuted
+		if transaction != nil {
+			updates["transaction_id"] = transaction.ID
+		}
+	case IsTransferError(err) || IsHoldError(err) || IsPayoutError(err):
+		if err := closeHold(tx, approval.HoldID.String(), models.HoldStatusReleased, models.EventHoldReleased); err != nil && err != ErrHoldNotActive {
+			return err
+		}
+
+		updates["status"] = models.TransferApprovalFailed
+		updates["failure_reason"] = err.Error()
+		eventType = models.EventApprovalFailed
+	default:
+		return err
+	}
+
+	return closeTransferApproval(tx, approval, updates, eventType)
+}
+
+// RejectTransfer closes a pending transfer approval on the rejection of one
+// owner and releases the held funds.
+func RejectTransfer(db *gorm.DB, walletID string, id string, userID *uuid.UUID, comment string) (*models.TransferApproval, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		approval, err := decideTransferApproval(tx, walletID, id, userID, models.ApprovalDecisionReject, comment)
+		if err != nil {
+			return err
+		}
+
+		if err := closeHold(tx, approval.HoldID.String(), models.HoldStatusReleased, models.EventHoldReleased); err != nil && err != ErrHoldNotActive {
+			return err
+		}
+
+		now := time.Now()
+
+		return closeTransferApproval(tx, approval, map[string]interface{}{
+			"status":     models.TransferApprovalRejected,
+			"decided_at": now,
+			"updated_at": now,
+		}, models.EventApprovalRejected)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletTransferApproval(db, walletID, id)
+}
+
+// CancelTransferApproval lets the requester withdraw a pending transfer and
+// releases the held funds.
+func CancelTransferApproval(db *gorm.DB, walletID string, id string, userID *uuid.UUID) (*models.TransferApproval, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		approval, err := lockPendingTransferApproval(tx, walletID, id)
+		if err != nil {
+			return err
+		}
+
+		if approval.RequestedByID.String() != userID.String() {
+			return ErrApprovalNotSelf
+		}
+
+		if err := closeHold(tx, approval.HoldID.String(), models.HoldStatusReleased, models.EventHoldReleased); err != nil && err != ErrHoldNotActive {
+			return err
+		}
+
+		if err := reopenPayoutBatch(tx, approval); err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		return tx.Model(approval).Updates(map[string]interface{}{
+			"status":     models.TransferApprovalCancelled,
+			"decided_at": now,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletTransferApproval(db, walletID, id)
+}
+
+// ExpireTransferApprovals closes every pending transfer approval past its
+// expiry and releases the held funds.
+func ExpireTransferApprovals(db *gorm.DB) (int64, error) {
+	var approvals []models.TransferApproval
+	result := db.Select("id").Where("status = ? and expires_at < ?", models.TransferApprovalPending, time.Now()).Find(&approvals)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i, approval := range approvals {
+		if err := expireTransferApproval(db, approval.ID.String()); err != nil && err != ErrApprovalNotFound {
+			return int64(i), err
+		}
+	}
+
+	return int64(len(approvals)), nil
+}
+
+func expireTransferApproval(db *gorm.DB, id string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var approval models.TransferApproval
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? and status = ?", id, models.TransferApprovalPending).Limit(1).Find(&approval)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrApprovalNotFound
+		}
+
+		// The hold expires at the same time and may have been closed by the
+		// hold expiry already.
+		if err := closeHold(tx, approval.HoldID.String(), models.HoldStatusExpired, models.EventHoldExpired); err != nil && err != ErrHoldNotActive {
+			return err
+		}
+
+		return closeTransferApproval(tx, &approval, map[string]interface{}{
+			"status":     models.TransferApprovalExpired,
+			"updated_at": time.Now(),
+		}, models.EventApprovalExpired)
+	})
+}
+
+// lockPendingTransferApproval locks a pending transfer approval of the
+// wallet, ErrApprovalExpired is returned once its expiry has passed.
+func lockPendingTransferApproval(tx *gorm.DB, walletID string, id string) (*models.TransferApproval, error) {
+	var approval models.TransferApproval
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? and wallet_id = ? and status = ?", id, walletID, models.TransferApprovalPending).Limit(1).Find(&approval)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrApprovalNotFound
+	}
+
+	if approval.ExpiresAt.Before(time.Now()) {
+		return nil, ErrApprovalExpired
+	}
+
+	return &approval, nil
+}
+
+// decideTransferApproval locks a pending transfer approval and records the
+// decision of an owner other than the requester.
+func decideTransferApproval(tx *gorm.DB, walletID string, id string, userID *uuid.UUID, decision string, comment string) (*models.TransferApproval, error) {
+	approval, err := lockPendingTransferApproval(tx, walletID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if approval.RequestedByID.String() == userID.String() {
+		return nil, ErrApprovalSelf
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&models.TransferApprovalDecision{
+		ApprovalID: approval.ID,
+		UserID:     userID,
+		Decision:   decision,
+		Comment:    comment,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrApprovalDecided
+	}
+
+	return approval, nil
+}
+
+// closeTransferApproval applies the final updates to an approval and notifies
+// the requester.
+func closeTransferApproval(tx *gorm.DB, approval *models.TransferApproval, updates map[string]interface{}, eventType string) error {
+	if updates["status"] != models.TransferApprovalExecuted {
+		if err := reopenPayoutBatch(tx, approval); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(approval).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	if err := preloadTransferApproval(tx).First(approval, "id = ?", approval.ID).Error; err != nil {
+		return err
+	}
+
+	return PublishEvent(tx, approval.RequestedByID, nil, eventType, models.TransferApprovalFilterRecord(approval))
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCheckoutNotPending = errors.New("This checkout session is no longer pending")
+	ErrCheckoutExpired    = errors.New("This checkout session has expired")
+)
+
+// FindCheckoutSession loads a session and marks it as expired when its
+// expiry has passed while it was still pending.
+func FindCheckoutSession(db *gorm.DB, id string) (*models.CheckoutSession, error) {
+	var session models.CheckoutSession
+	result := db.Preload("Merchant").Preload("Transaction.FromWallet").Preload("Transaction.ToWallet").First(&session, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if session.Status == models.CheckoutStatusPending && session.ExpiresAt.Before(time.Now()) {
+		if err := expireCheckoutSession(db, &session); err != nil {
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+func expireCheckoutSession(db *gorm.DB, session *models.CheckoutSession) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(session).Where("status = ?", models.CheckoutStatusPending).
+			Updates(map[string]interface{}{"status": models.CheckoutStatusExpired, "updated_at": time.Now()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		session.Status = models.CheckoutStatusExpired
+
+		return publishCheckoutEvent(tx, session, models.EventCheckoutExpired)
+	})
+}
+
+// publishCheckoutEvent notifies the merchant about a change of the session.
+func publishCheckoutEvent(tx *gorm.DB, session *models.CheckoutSession, eventType string) error {
+	return PublishEvent(tx, session.Merchant.UserID, session.MerchantID, eventType, models.CheckoutSessionFilterRecord(session))
+}
+
+// PayCheckoutSession pays a pending session from the customer wallet into the
+// merchant settlement wallet on behalf of the paying user. The session row is
+// locked so it can only ever be paid once.
+func PayCheckoutSession(db *gorm.DB, id string, fromWalletID *uuid.UUID, payerID *uuid.UUID) (*models.CheckoutSession, error) {
+	err := transactionWithRisk(db, func(tx *gorm.DB) error {
+		var session models.CheckoutSession
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Merchant").First(&session, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if session.Status != models.CheckoutStatusPending {
+			return ErrCheckoutNotPending
+		}
+
+		if session.ExpiresAt.Before(time.Now()) {
+			return ErrCheckoutExpired
+		}
+
+		if err := CheckPaymentApproval(tx, fromWalletID, session.Amount); err != nil {
+			return err
+		}
+
+		wallet, err := MerchantSettlementWallet(tx, session.MerchantID.String(), session.Currency)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := Transfer(tx, TransferParams{
+			FromWalletID:  fromWalletID,
+			ToWalletID:    wallet.ID,
+			Amount:        session.Amount,
+			Type:          models.TransactionTypePayment,
+			Description:   "Payment to " + session.Merchant.Name + " for order " + session.OrderID,
+			InitiatedByID: payerID,
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		err = tx.Model(&session).Updates(map[string]interface{}{
+			"status":         models.CheckoutStatusPaid,
+			"paid_at":        now,
+			"transaction_id": transaction.ID,
+			"updated_at":     now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		session.Transaction = transaction
+
+		return publishCheckoutEvent(tx, &session, models.EventCheckoutPaid)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return FindCheckoutSession(db, id)
+}
+
+// CancelCheckoutSession cancels a session that has not been paid yet.
+func CancelCheckoutSession(db *gorm.DB, id string) (*models.CheckoutSession, error) {
+	session, err := FindCheckoutSession(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Status != models.CheckoutStatusPending {
+		return nil, ErrCheckoutNotPending
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(session).Where("status = ?", models.CheckoutStatusPending).
+			Updates(map[string]interface{}{"status": models.CheckoutStatusCancelled, "cancelled_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrCheckoutNotPending
+		}
+
+		session.Status = models.CheckoutStatusCancelled
+		session.CancelledAt = &now
+
+		return publishCheckoutEvent(tx, session, models.EventCheckoutCancelled)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return FindCheckoutSession(db, id)
+}
+
+// ExpireCheckoutSessions marks every pending session past its expiry as expired.
+func ExpireCheckoutSessions(db *gorm.DB) (int64, error) {
+	var sessions []models.CheckoutSession
+	result := db.Preload("Merchant").Where("status = ? and expires_at < ?", models.CheckoutStatusPending, time.Now()).Find(&sessions)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i := range sessions {
+		if err := expireCheckoutSession(db, &sessions[i]); err != nil {
+			return int64(i), err
+		}
+	}
+
+	return int64(len(sessions)), nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PublishEvent notifies the user, and when given the merchant, about a
+// domain event. It must be called with the transaction that made the change:
+// the event is written to the outbox and only published by the outbox relay
+// once the transaction is committed.
+func PublishEvent(tx *gorm.DB, userID *uuid.UUID, merchantID *uuid.UUID, eventType string, data interface{}) error {
+	id := uuid.New()
+	now := time.Now()
+	event := models.Event{
+		ID:        &id,
+		Type:      eventType,
+		CreatedAt: now,
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.OutboxEvent{
+		ID:            &id,
+		Type:          eventType,
+		UserID:        userID,
+		MerchantID:    merchantID,
+		Payload:       string(payload),
+		Status:        models.OutboxEventPending,
+		NextAttemptAt: &now,
+		CreatedAt:     &now,
+	}).Error
+}
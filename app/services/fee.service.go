@@ -0,0 +1,304 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFeeRuleTiers  = errors.New("Tiered fee rules need at least one tier, ordered by their upper bound")
+	ErrFeeRuleWindow = errors.New("The end of the fee rule must be after its start")
+	ErrFeeRuleCaps   = errors.New("The maximum fee must not be lower than the minimum fee")
+)
+
+// IsFeeRuleError reports whether err is caused by an invalid fee rule, as
+// opposed to a database failure.
+func IsFeeRuleError(err error) bool {
+	switch err {
+	case ErrFeeRuleTiers, ErrFeeRuleWindow, ErrFeeRuleCaps:
+		return true
+	}
+
+	return false
+}
+
+// feeOperation maps a transaction type to the operation its fee rules are
+// configured for. Payouts are charged like transfers, refunds and reversals
+// are never charged.
+func feeOperation(transactionType string) string {
+	switch transactionType {
+	case models.TransactionTypeTransfer, models.TransactionTypePayout:
+		return models.FeeOperationTransfer
+	case models.TransactionTypePayment:
+		return models.FeeOperationPayment
+	}
+
+	return ""
+}
+
+// FindFeeRule returns the rule that applies to the operation at the given
+// time, or nil when no rule does and the operation is free.
+func FindFeeRule(db *gorm.DB, operation string, currency string, at time.Time) (*models.FeeRule, error) {
+	var rule models.FeeRule
+	result := db.
+		Where("active and operation = ? and (currency = ? or currency = '')", operation, strings.ToUpper(currency)).
+		Where("(starts_at is null or starts_at <= ?) and (ends_at is null or ends_at > ?)", at, at).
+		Order("priority desc, currency desc, created_at desc").
+		First(&rule)
+	if database.IsRecordNotFoundError(result.Error) {
+		return nil, nil
+	} else if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &rule, nil
+}
+
+// CalculateFee applies a rule to an amount. The fee is capped by the min and
+// max of the rule, a max of zero meaning no cap, and never exceeds the amount.
+func CalculateFee(rule *models.FeeRule, amount float64) float64 {
+	var fee float64
+
+	switch rule.Type {
+	case models.FeeTypeFree:
+		return 0
+	case models.FeeTypeFlat:
+		fee = rule.FlatAmount
+	case models.FeeTypePercentage:
+		fee = rule.FlatAmount + amount*rule.Percentage/100
+	case models.FeeTypeTiered:
+		tiers := rule.DecodeTiers()
+		for i, tier := range tiers {
+			if tier.UpTo == 0 || amount <= tier.UpTo || i == len(tiers)-1 {
+				fee = tier.Flat + amount*tier.Percentage/100
+				break
+			}
+		}
+	}
+
+	fee = math.Max(fee, rule.MinFee)
+	if rule.MaxFee > 0 {
+		fee = math.Min(fee, rule.MaxFee)
+	}
+
+	return utils.RoundAmount(math.Min(fee, amount))
+}
+
+// QuoteFee evaluates the fee rules for an operation, it is used both to show
+// the fee before an operation is confirmed and to charge it.
+func QuoteFee(db *gorm.DB, operation string, currency string, amount float64) (*models.FeeQuote, error) {
+	amount = utils.RoundAmount(amount)
+
+	quote := &models.FeeQuote{
+		Operation: operation,
+		Currency:  strings.ToUpper(currency),
+		Amount:    amount,
+		PaidBy:    models.FeePaidBySender,
+		Total:     amount,
+		NetAmount: amount,
+	}
+
+	if operation == "" {
+		return quote, nil
+	}
+
+	rule, err := FindFeeRule(db, operation, currency, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if rule == nil {
+		return quote, nil
+	}
+
+	quote.Fee = CalculateFee(rule, amount)
+	quote.PaidBy = rule.PaidBy
+	quote.RuleID = rule.ID
+	quote.RuleName = rule.Name
+
+	if quote.PaidBy == models.FeePaidByReceiver {
+		quote.NetAmount = utils.RoundAmount(amount - quote.Fee)
+	} else {
+		quote.Total = utils.RoundAmount(amount + quote.Fee)
+	}
+
+	return quote, nil
+}
+
+// FindSystemWallet returns the system wallet of the account in a currency.
+func FindSystemWallet(db *gorm.DB, account string, currency string) (*models.Wallet, error) {
+	var wallet models.Wallet
+	result := db.Where("system_account = ? and currency = ?", account, currency).Order("created_at").First(&wallet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &wallet, nil
+}
+
+// CreateFeeRule validates and stores a new fee rule.
+func CreateFeeRule(db *gorm.DB, req *models.FeeRuleCreateRequest) (*models.FeeRule, error) {
+	rule := models.FeeRule{
+		Name:       req.Name,
+		Operation:  req.Operation,
+		Currency:   strings.ToUpper(req.Currency),
+		Type:       req.Type,
+		FlatAmount: utils.RoundAmount(req.FlatAmount),
+		Percentage: req.Percentage,
+		MinFee:     utils.RoundAmount(req.MinFee),
+		MaxFee:     utils.RoundAmount(req.MaxFee),
+		PaidBy:     req.PaidBy,
+		Priority:   req.Priority,
+		Active:     true,
+		StartsAt:   req.StartsAt,
+		EndsAt:     req.EndsAt,
+	}
+
+	if rule.PaidBy == "" {
+		rule.PaidBy = models.FeePaidBySender
+	}
+
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	if err := setFeeRuleTiers(&rule, req.Tiers); err != nil {
+		return nil, err
+	}
+
+	if err := validateFeeRule(&rule); err != nil {
+		return nil, err
+	}
+
+	// gorm skips a false Active in favour of the column default, so an
+	// inactive rule is deactivated right after it is created.
+	if err := db.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+
+	if !rule.Active {
+		if err := db.Model(&rule).Update("active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &rule, nil
+}
+
+// UpdateFeeRule changes the given fields of a fee rule. The operation,
+// currency and type of a rule can not be changed, a new rule has to be
+// created instead.
+func UpdateFeeRule(db *gorm.DB, rule *models.FeeRule, req *models.FeeRuleUpdateRequest) error {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+
+	if req.FlatAmount != nil {
+		rule.FlatAmount = utils.RoundAmount(*req.FlatAmount)
+	}
+
+	if req.Percentage != nil {
+		rule.Percentage = *req.Percentage
+	}
+
+	if req.Tiers != nil {
+		if err := setFeeRuleTiers(rule, req.Tiers); err != nil {
+			return err
+		}
+	}
+
+	if req.MinFee != nil {
+		rule.MinFee = utils.RoundAmount(*req.MinFee)
+	}
+
+	if req.MaxFee != nil {
+		rule.MaxFee = utils.RoundAmount(*req.MaxFee)
+	}
+
+	if req.PaidBy != nil {
+		rule.PaidBy = *req.PaidBy
+	}
+
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	if req.StartsAt != nil {
+		rule.StartsAt = req.StartsAt
+	}
+
+	if req.EndsAt != nil {
+		rule.EndsAt = req.EndsAt
+	}
+
+	if err := validateFeeRule(rule); err != nil {
+		return err
+	}
+
+	return db.Model(rule).Updates(map[string]interface{}{
+		"name":        rule.Name,
+		"flat_amount": rule.FlatAmount,
+		"percentage":  rule.Percentage,
+		"tiers":       rule.Tiers,
+		"min_fee":     rule.MinFee,
+		"max_fee":     rule.MaxFee,
+		"paid_by":     rule.PaidBy,
+		"priority":    rule.Priority,
+		"active":      rule.Active,
+		"starts_at":   rule.StartsAt,
+		"ends_at":     rule.EndsAt,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+func setFeeRuleTiers(rule *models.FeeRule, tiers []models.FeeTier) error {
+	if tiers == nil {
+		tiers = []models.FeeTier{}
+	}
+
+	data, err := json.Marshal(tiers)
+	if err != nil {
+		return err
+	}
+
+	rule.Tiers = string(data)
+
+	return nil
+}
+
+func validateFeeRule(rule *models.FeeRule) error {
+	if rule.StartsAt != nil && rule.EndsAt != nil && !rule.EndsAt.After(*rule.StartsAt) {
+		return ErrFeeRuleWindow
+	}
+
+	if rule.MaxFee > 0 && rule.MaxFee < rule.MinFee {
+		return ErrFeeRuleCaps
+	}
+
+	if rule.Type == models.FeeTypeTiered {
+		tiers := rule.DecodeTiers()
+		if len(tiers) == 0 {
+			return ErrFeeRuleTiers
+		}
+
+		for i := 1; i < len(tiers); i++ {
+			if tiers[i-1].UpTo == 0 || (tiers[i].UpTo != 0 && tiers[i].UpTo <= tiers[i-1].UpTo) {
+				return ErrFeeRuleTiers
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrHoldNotActive     = errors.New("This hold is no longer active")
+	ErrHoldExpired       = errors.New("This hold has expired")
+	ErrHoldCaptureAmount = errors.New("The capture amount exceeds the amount of the hold")
+)
+
+// IsHoldError reports whether err is caused by the state of a hold, as
+// opposed to a database failure.
+func IsHoldError(err error) bool {
+	switch err {
+	case ErrHoldNotActive, ErrHoldExpired, ErrHoldCaptureAmount:
+		return true
+	}
+
+	return false
+}
+
+func preloadHold(db *gorm.DB) *gorm.DB {
+	return db.Preload("Wallet").Preload("Transaction.FromWallet").Preload("Transaction.ToWallet")
+}
+
+// FindWalletHold returns a hold of the wallet, expiring it when its expiry
+// has passed while it was still active.
+func FindWalletHold(db *gorm.DB, walletID string, id string) (*models.Hold, error) {
+	var hold models.Hold
+	if err := preloadHold(db).Where("wallet_id = ? and id = ?", walletID, id).First(&hold).Error; err != nil {
+		return nil, err
+	}
+
+	if hold.Status == models.HoldStatusActive && hold.ExpiresAt.Before(time.Now()) {
+		if err := closeHold(db, hold.ID.String(), models.HoldStatusExpired, models.EventHoldExpired); err != nil && err != ErrHoldNotActive {
+			return nil, err
+		}
+
+		return FindWalletHold(db, walletID, id)
+	}
+
+	return &hold, nil
+}
+
+// PlaceHold reserves the amount on the wallet. The wallet is locked, so the
+// available balance can never be held or spent twice.
+func PlaceHold(db *gorm.DB, walletID *uuid.UUID, amount float64, reason string, expiresAt time.Time) (*models.Hold, error) {
+	amount = utils.RoundAmount(amount)
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	var hold models.Hold
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, walletID)
+		if err != nil {
+			return err
+		}
+
+		wallet := wallets[walletID.String()]
+		if wallet.FrozenAt != nil {
+			return ErrWalletFrozen
+		}
+
+		if wallet.AvailableBalance() < amount {
+			return ErrInsufficientFunds
+		}
+
+		if err := adjustHeldBalance(tx, wallet, amount); err != nil {
+			return err
+		}
+
+		hold = models.Hold{
+			WalletID:  wallet.ID,
+			Amount:    amount,
+			Reason:    reason,
+			Status:    models.HoldStatusActive,
+			ExpiresAt: &expiresAt,
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&hold).Error; err != nil {
+			return err
+		}
+
+		hold.Wallet = *wallet
+
+		return PublishEvent(tx, wallet.UserID, wallet.MerchantID, models.EventHoldCreated, models.HoldFilterRecord(&hold))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// CaptureHold transfers amount of an active hold, or all of it when amount
+// is zero, to the recipient wallet and releases the rest of the hold.
+// capturedByID is the user who captures the hold.
+func CaptureHold(db *gorm.DB, id string, toWalletID *uuid.UUID, amount float64, description string, capturedByID *uuid.UUID) (*models.Hold, error) {
+	err := transactionWithRisk(db, func(tx *gorm.DB) error {
+		hold, err := lockActiveHold(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if amount == 0 {
+			amount = hold.Amount
+		}
+
+		amount = utils.RoundAmount(amount)
+		if amount > hold.Amount {
+			return ErrHoldCaptureAmount
+		}
+
+		if err := CheckPaymentApproval(tx, hold.WalletID, amount); err != nil {
+			return err
+		}
+
+		if description == "" {
+			description = hold.Reason
+		}
+
+		_, err = captureHold(tx, hold, TransferParams{
+			FromWalletID:  hold.WalletID,
+			ToWalletID:    toWalletID,
+			Amount:        amount,
+			Type:          models.TransactionTypePayment,
+			Description:   description,
+			InitiatedByID: capturedByID,
+		})
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var hold models.Hold
+	if err := preloadHold(db).First(&hold, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// captureHold makes the transfer of params out of a hold locked by the
+// caller and closes the hold as captured, releasing what is not transferred.
+func captureHold(tx *gorm.DB, hold *models.Hold, params TransferParams) (*models.Transaction, error) {
+	wallets, err := lockWallets(tx, hold.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Releasing the full hold first makes the captured amount available
+	// again, the transfer below spends it within the same transaction.
+	if err := adjustHeldBalance(tx, wallets[hold.WalletID.String()], -hold.Amount); err != nil {
+		return nil, err
+	}
+
+	transaction, err := Transfer(tx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = tx.Model(hold).Updates(map[string]interface{}{
+		"status":          models.HoldStatusCaptured,
+		"captured_amount": transaction.Amount,
+		"captured_at":     now,
+		"transaction_id":  transaction.ID,
+		"updated_at":      now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := preloadHold(tx).First(hold, "id = ?", hold.ID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := PublishEvent(tx, hold.Wallet.UserID, hold.Wallet.MerchantID, models.EventHoldCaptured, models.HoldFilterRecord(hold)); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// captureHoldPart makes the transfer of params out of a hold locked by the
+// caller and keeps the hold active for the rest. The amount of the hold goes
+// down by what the transfer debited, fee included, and its captured amount
+// goes up by what was transferred.
+func captureHoldPart(tx *gorm.DB, hold *models.Hold, params TransferParams) (*models.Transaction, error) {
+	wallets, err := lockWallets(tx, hold.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := wallets[hold.WalletID.String()]
+	if err := adjustHeldBalance(tx, wallet, -hold.Amount); err != nil {
+		return nil, err
+	}
+
+	transaction, err := Transfer(tx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := utils.RoundAmount(max(hold.Amount-transaction.DebitAmount(), 0))
+	if err := adjustHeldBalance(tx, wallet, rest); err != nil {
+		return nil, err
+	}
+
+	err = tx.Model(hold).Updates(map[string]interface{}{
+		"amount":          rest,
+		"captured_amount": utils.RoundAmount(hold.CapturedAmount + transaction.Amount),
+		"updated_at":      time.Now(),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// ReleaseHold closes an active hold and makes its amount available again.
+func ReleaseHold(db *gorm.DB, id string) (*models.Hold, error) {
+	if err := closeHold(db, id, models.HoldStatusReleased, models.EventHoldReleased); err != nil {
+		return nil, err
+	}
+
+	var hold models.Hold
+	if err := preloadHold(db).First(&hold, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// ExpireHolds releases every active hold past its expiry, so funds of
+// abandoned holds return to the available balance.
+func ExpireHolds(db *gorm.DB) (int64, error) {
+	var holds []models.Hold
+	result := db.Where("status = ? and expires_at < ?", models.HoldStatusActive, time.Now()).Find(&holds)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i, hold := range holds {
+		err := closeHold(db, hold.ID.String(), models.HoldStatusExpired, models.EventHoldExpired)
+		if err != nil && err != ErrHoldNotActive {
+			return int64(i), err
+		}
+	}
+
+	return int64(len(holds)), nil
+}
+
+// closeHold releases or expires an active hold without moving money.
+func closeHold(db *gorm.DB, id string, status string, eventType string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var hold models.Hold
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&hold, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if hold.Status != models.HoldStatusActive {
+			return ErrHoldNotActive
+		}
+
+		wallets, err := lockWallets(tx, hold.WalletID)
+		if err != nil {
+			return err
+		}
+
+		wallet := wallets[hold.WalletID.String()]
+		if err := adjustHeldBalance(tx, wallet, -hold.Amount); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&hold).Updates(map[string]interface{}{
+			"status":      status,
+			"released_at": now,
+			"updated_at":  now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		hold.Wallet = *wallet
+
+		return PublishEvent(tx, wallet.UserID, wallet.MerchantID, eventType, models.HoldFilterRecord(&hold))
+	})
+}
+
+func lockActiveHold(tx *gorm.DB, id string) (*models.Hold, error) {
+	var hold models.Hold
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&hold, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if hold.Status != models.HoldStatusActive {
+		return nil, ErrHoldNotActive
+	}
+
+	if hold.ExpiresAt.Before(time.Now()) {
+		return nil, ErrHoldExpired
+	}
+
+	return &hold, nil
+}
+
+// adjustHeldBalance changes the held balance of a wallet locked by the caller.
+func adjustHeldBalance(tx *gorm.DB, wallet *models.Wallet, amount float64) error {
+	wallet.HeldBalance = utils.RoundAmount(wallet.HeldBalance + amount)
+
+	return tx.Model(wallet).Updates(map[string]interface{}{"held_balance": wallet.HeldBalance, "updated_at": time.Now()}).Error
+}
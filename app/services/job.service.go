@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/cron"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrJobHandlerNotFound = errors.New("no handler registered for job kind")
+
+// JobHandler runs a job. Returning an error schedules a retry.
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+var (
+	jobHandlersMu sync.RWMutex
+	jobHandlers   = map[string]JobHandler{}
+)
+
+// RegisterJobHandler sets the handler of a job kind.
+func RegisterJobHandler(kind string, handler JobHandler) {
+	jobHandlersMu.Lock()
+	defer jobHandlersMu.Unlock()
+
+	jobHandlers[kind] = handler
+}
+
+func jobHandler(kind string) (JobHandler, bool) {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+
+	handler, ok := jobHandlers[kind]
+
+	return handler, ok
+}
+
+// JobOptions are the optional settings of an enqueued job.
+type JobOptions struct {
+	// RunAt delays the job, it runs as soon as possible when nil.
+	RunAt *time.Time
+	// UniqueKey prevents enqueueing the job while another unfinished job
+	// has the same key, the existing job is returned instead.
+	UniqueKey   string
+	MaxAttempts int
+}
+
+// EnqueueJob adds a job to the queue. Pass the caller's transaction to only
+// run the job when the transaction commits.
+func EnqueueJob(db *gorm.DB, kind string, payload interface{}, options JobOptions) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := models.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		Status:      models.JobStatusPending,
+		MaxAttempts: 5,
+		RunAt:       &now,
+	}
+
+	if options.RunAt != nil {
+		job.RunAt = options.RunAt
+	}
+
+	if options.MaxAttempts > 0 {
+		job.MaxAttempts = options.MaxAttempts
+	}
+
+	if options.UniqueKey == "" {
+		if err := db.Create(&job).Error; err != nil {
+			return nil, err
+		}
+
+		return &job, nil
+	}
+
+	job.UniqueKey = &options.UniqueKey
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		var existing models.Job
+		if err := db.Where("unique_key = ? and finished_at is null", options.UniqueKey).First(&existing).Error; err != nil {
+			return nil, err
+		}
+
+		return &existing, nil
+	}
+
+	return &job, nil
+}
+
+// jobLease is how long a running job is hidden from other workers. The
+// worker running a job renews its lease every jobHeartbeat, so only jobs of
+// a worker that died are picked up again, once the lease has expired.
+const (
+	jobLease     = 5 * time.Minute
+	jobHeartbeat = jobLease / 5
+)
+
+// RunDueJobs claims up to limit due jobs and runs them. Jobs that were
+// claimed keep running when ctx is cancelled during shutdown, so they are not
+// counted as failed attempts.
+func RunDueJobs(ctx context.Context, db *gorm.DB, limit int) (int, error) {
+	var jobs []models.Job
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? and run_at <= ?) or (status = ? and locked_until < ?)",
+				models.JobStatusPending, now, models.JobStatusRunning, now).
+			Order("run_at").Limit(limit).Find(&jobs)
+		if result.Error != nil || len(jobs) == 0 {
+			return result.Error
+		}
+
+		ids := make([]string, 0, len(jobs))
+		for _, j := range jobs {
+			ids = append(ids, j.ID.String())
+		}
+
+		// Postgres keeps microseconds, the lease is compared when it is
+		// renewed.
+		lease := now.Add(jobLease).Truncate(time.Microsecond)
+		for i := range jobs {
+			jobs[i].LockedUntil = &lease
+		}
+
+		return tx.Model(&models.Job{}).Where("id in ?", ids).Updates(map[string]interface{}{
+			"status":       models.JobStatusRunning,
+			"locked_until": lease,
+			"updated_at":   now,
+		}).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	runCtx := context.WithoutCancel(ctx)
+	for i := range jobs {
+		if err := runJob(runCtx, db, &jobs[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(jobs), nil
+}
+
+// runJob runs a claimed job while renewing its lease and records the
+// outcome. A job whose lease ran out before it started, while the jobs
+// claimed with it ran, is left to the worker that claimed it since.
+func runJob(ctx context.Context, db *gorm.DB, job *models.Job) error {
+	lease, ok, err := renewJobLease(db, job, *job.LockedUntil)
+	if err != nil || !ok {
+		return err
+	}
+
+	stop, renewed := make(chan struct{}), make(chan time.Time, 1)
+	go func() {
+		renewed <- keepJobLease(db, job, lease, stop)
+	}()
+
+	var runErr error
+
+	if handler, ok := jobHandler(job.Kind); ok {
+		runErr = safeRunJob(ctx, handler, job)
+	} else {
+		runErr = fmt.Errorf("%w: %s", ErrJobHandlerNotFound, job.Kind)
+	}
+
+	close(stop)
+	lease = <-renewed
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts":     job.Attempts + 1,
+		"locked_until": nil,
+		"updated_at":   now,
+	}
+
+	switch {
+	case runErr == nil:
+		updates["status"] = models.JobStatusSucceeded
+		updates["finished_at"] = now
+		updates["last_error"] = ""
+	case job.Attempts+1 >= job.MaxAttempts:
+		updates["status"] = models.JobStatusDead
+		updates["finished_at"] = now
+		updates["last_error"] = runErr.Error()
+	default:
+		updates["status"] = models.JobStatusPending
+		updates["run_at"] = now.Add(JobBackoff(job.Attempts + 1))
+		updates["last_error"] = runErr.Error()
+	}
+
+	return db.Model(&models.Job{}).Where("id = ? and locked_until = ?", job.ID, lease).Updates(updates).Error
+}
+
+// renewJobLease extends the lease of a running job while it still is the
+// lease this worker holds. It returns false when another worker claimed the
+// job after the lease expired.
+func renewJobLease(db *gorm.DB, job *models.Job, lease time.Time) (time.Time, bool, error) {
+	now := time.Now()
+	next := now.Add(jobLease).Truncate(time.Microsecond)
+
+	result := db.Model(&models.Job{}).
+		Where("id = ? and status = ? and locked_until = ?", job.ID, models.JobStatusRunning, lease).
+		Updates(map[string]interface{}{"locked_until": next, "updated_at": now})
+	if result.Error != nil {
+		return lease, false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return lease, false, nil
+	}
+
+	return next, true, nil
+}
+
+// keepJobLease renews the lease of a running job every jobHeartbeat until
+// stop is closed or the lease is lost, and returns the last lease it held.
+func keepJobLease(db *gorm.DB, job *models.Job, lease time.Time, stop <-chan struct{}) time.Time {
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return lease
+		case <-ticker.C:
+			next, ok, err := renewJobLease(db, job, lease)
+			if err != nil {
+				log.Warn().Err(err).Str("job", job.ID.String()).Msg("Renewing the job lease failed")
+				continue
+			}
+
+			if !ok {
+				log.Warn().Str("job", job.ID.String()).Msg("The job lease was lost")
+				return lease
+			}
+
+			lease = next
+		}
+	}
+}
+
+func safeRunJob(ctx context.Context, handler JobHandler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// JobBackoff returns the delay before retrying a job that failed the given
+// number of times: 15 seconds doubling up to one hour.
+func JobBackoff(attempts int) time.Duration {
+	delay := 15 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+
+	return delay
+}
+
+// RetryDeadJob moves a dead job back to the queue with a fresh set of attempts.
+func RetryDeadJob(db *gorm.DB, id string) error {
+	result := db.Model(&models.Job{}).Where("id = ? and status = ?", id, models.JobStatusDead).Updates(map[string]interface{}{
+		"status":      models.JobStatusPending,
+		"attempts":    0,
+		"run_at":      time.Now(),
+		"finished_at": nil,
+		"updated_at":  time.Now(),
+	})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PruneJobs deletes succeeded jobs that finished before the retention period.
+// Dead jobs are kept until they are retried or removed by hand.
+func PruneJobs(db *gorm.DB, retention time.Duration) (int64, error) {
+	result := db.Where("status = ? and finished_at < ?", models.JobStatusSucceeded, time.Now().Add(-retention)).
+		Delete(&models.Job{})
+
+	return result.RowsAffected, result.Error
+}
+
+// EnsureJobSchedule creates or updates the named cron schedule.
+func EnsureJobSchedule(db *gorm.DB, name string, expr string, kind string, payload interface{}) error {
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	next := schedule.Next(time.Now())
+	if next.IsZero() {
+		return fmt.Errorf("%w: %q never matches", cron.ErrInvalidExpression, expr)
+	}
+
+	var existing models.JobSchedule
+	err = db.Where("name = ?", name).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.JobSchedule{
+			Name:      name,
+			Kind:      kind,
+			Cron:      expr,
+			Payload:   string(data),
+			NextRunAt: &next,
+		}).Error
+	}
+
+	if existing.Cron == expr && existing.Kind == kind && existing.Payload == string(data) {
+		return nil
+	}
+
+	return db.Model(&existing).Updates(map[string]interface{}{
+		"kind":        kind,
+		"cron":        expr,
+		"payload":     string(data),
+		"next_run_at": next,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// EnqueueScheduledJobs enqueues a job for every schedule that is due. A
+// schedule does not enqueue a new job while its previous one is unfinished.
+func EnqueueScheduledJobs(db *gorm.DB) (int, error) {
+	enqueued := 0
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var schedules []models.JobSchedule
+
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_run_at <= ?", now).Find(&schedules).Error
+		if err != nil {
+			return err
+		}
+
+		for _, schedule := range schedules {
+			parsed, err := cron.Parse(schedule.Cron)
+			if err != nil {
+				return err
+			}
+
+			_, err = EnqueueJob(tx, schedule.Kind, json.RawMessage(schedule.Payload), JobOptions{
+				UniqueKey: "schedule:" + schedule.Name,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&models.JobSchedule{}).Where("id = ?", schedule.ID.String()).Updates(map[string]interface{}{
+				"last_run_at": now,
+				"next_run_at": parsed.Next(now),
+				"updated_at":  now,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			enqueued++
+		}
+
+		return nil
+	})
+
+	return enqueued, err
+}
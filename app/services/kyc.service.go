@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	KYCMaxDocumentSize = 5 << 20
+	kycMinimumAge      = 17
+)
+
+var (
+	ErrKYCAlreadyVerified = errors.New("Your account is already at the highest verification tier")
+	ErrKYCPending         = errors.New("You already have a submission that is waiting for review")
+	ErrKYCDateOfBirth     = errors.New("Date of birth must be a date in the past formatted as YYYY-MM-DD")
+	ErrKYCUnderage        = errors.New("You must be at least 17 years old to verify your account")
+	ErrKYCDocumentMissing = errors.New("Both an ID photo and a selfie are required")
+	ErrKYCDocumentType    = errors.New("Documents must be JPEG or PNG images")
+	ErrKYCDocumentSize    = errors.New("Documents must be at most 5 MB")
+	ErrKYCNotPending      = errors.New("This submission has already been reviewed")
+)
+
+// IsKYCError reports whether err is caused by the submission or its state,
+// as opposed to a database or storage failure.
+func IsKYCError(err error) bool {
+	switch err {
+	case ErrKYCAlreadyVerified, ErrKYCPending, ErrKYCDateOfBirth, ErrKYCUnderage,
+		ErrKYCDocumentMissing, ErrKYCDocumentType, ErrKYCDocumentSize, ErrKYCNotPending:
+		return true
+	}
+
+	return false
+}
+
+var kycDocumentExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// nextKYCTier returns the tier a submission of a user in the given tier
+// verifies them for, or an empty string when there is none.
+func nextKYCTier(tier string) string {
+	for i, t := range models.KYCTiers {
+		if t == tier && i+1 < len(models.KYCTiers) {
+			return models.KYCTiers[i+1]
+		}
+	}
+
+	return ""
+}
+
+func preloadKYCSubmission(db *gorm.DB) *gorm.DB {
+	return db.Preload("User").Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at asc")
+	})
+}
+
+// FindKYCSubmission returns any submission with its status history.
+func FindKYCSubmission(db *gorm.DB, id string) (*models.KYCSubmission, error) {
+	var submission models.KYCSubmission
+	if err := preloadKYCSubmission(db).Where("id = ?", id).First(&submission).Error; err != nil {
+		return nil, err
+	}
+
+	return &submission, nil
+}
+
+// FindUserKYCSubmissions returns the submissions of a user, newest first.
+func FindUserKYCSubmissions(db *gorm.DB, userID string) ([]models.KYCSubmission, error) {
+	var submissions []models.KYCSubmission
+	err := preloadKYCSubmission(db).Where("user_id = ?", userID).Order("created_at desc").Find(&submissions).Error
+
+	return submissions, err
+}
+
+// SubmitKYC stores the documents in blob storage and queues the submission
+// for review. The documents are removed again when the submission can not be
+// saved.
+func SubmitKYC(db *gorm.DB, store storage.Blob, userID *uuid.UUID, req *models.KYCSubmitRequest, idPhoto []byte, selfie []byte) (*models.KYCSubmission, error) {
+	dateOfBirth, err := time.Parse("2006-01-02", req.DateOfBirth)
+	if err != nil || !dateOfBirth.Before(time.Now()) {
+		return nil, ErrKYCDateOfBirth
+	}
+
+	if dateOfBirth.AddDate(kycMinimumAge, 0, 0).After(time.Now()) {
+		return nil, ErrKYCUnderage
+	}
+
+	idPhotoType, err := kycDocumentType(idPhoto)
+	if err != nil {
+		return nil, err
+	}
+
+	selfieType, err := kycDocumentType(selfie)
+	if err != nil {
+		return nil, err
+	}
+
+	tier, err := userTier(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	targetTier := nextKYCTier(tier)
+	if targetTier == "" {
+		return nil, ErrKYCAlreadyVerified
+	}
+
+	var pending int64
+	result := db.Model(&models.KYCSubmission{}).Where("user_id = ? and status = ?", userID, models.KYCStatusPending).Count(&pending)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if pending > 0 {
+		return nil, ErrKYCPending
+	}
+
+	id := uuid.New()
+	prefix := "kyc/" + userID.String() + "/" + id.String() + "/"
+
+	submission := models.KYCSubmission{
+		ID:          &id,
+		UserID:      userID,
+		NIK:         req.NIK,
+		LegalName:   req.LegalName,
+		DateOfBirth: dateOfBirth,
+		IDPhotoKey:  prefix + models.KYCDocumentIDPhoto + kycDocumentExtensions[idPhotoType],
+		IDPhotoType: idPhotoType,
+		SelfieKey:   prefix + models.KYCDocumentSelfie + kycDocumentExtensions[selfieType],
+		SelfieType:  selfieType,
+		TargetTier:  targetTier,
+		Status:      models.KYCStatusPending,
+	}
+
+	ctx := context.Background()
+
+	if err := store.Put(ctx, submission.IDPhotoKey, bytes.NewReader(idPhoto), idPhotoType); err != nil {
+		return nil, err
+	}
+
+	if err := store.Put(ctx, submission.SelfieKey, bytes.NewReader(selfie), selfieType); err != nil {
+		_ = store.Delete(ctx, submission.IDPhotoKey)
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&submission).Error; err != nil {
+			return err
+		}
+
+		if err := addKYCStatusHistory(tx, &submission, userID); err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, userID, nil, models.EventKYCSubmitted, models.KYCSubmissionFilterRecord(&submission))
+	})
+	if err != nil {
+		_ = store.Delete(ctx, submission.IDPhotoKey)
+		_ = store.Delete(ctx, submission.SelfieKey)
+
+		return nil, err
+	}
+
+	return FindKYCSubmission(db, id.String())
+}
+
+// ApproveKYC approves a pending submission and moves the user up to the tier
+// it was submitted for.
+func ApproveKYC(db *gorm.DB, id string, reviewerID *uuid.UUID, reason string) (*models.KYCSubmission, error) {
+	return reviewKYC(db, id, reviewerID, models.KYCStatusApproved, reason)
+}
+
+// RejectKYC rejects a pending submission, the user can submit again.
+func RejectKYC(db *gorm.DB, id string, reviewerID *uuid.UUID, reason string) (*models.KYCSubmission, error) {
+	return reviewKYC(db, id, reviewerID, models.KYCStatusRejected, reason)
+}
+
+func reviewKYC(db *gorm.DB, id string, reviewerID *uuid.UUID, status string, reason string) (*models.KYCSubmission, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var submission models.KYCSubmission
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&submission)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if submission.Status != models.KYCStatusPending {
+			return ErrKYCNotPending
+		}
+
+		now := time.Now()
+		submission.Status, submission.Reason = status, reason
+		submission.ReviewerID, submission.ReviewedAt = reviewerID, &now
+
+		result = tx.Model(&submission).Updates(map[string]interface{}{
+			"status":      status,
+			"reason":      reason,
+			"reviewer_id": reviewerID,
+			"reviewed_at": now,
+			"updated_at":  now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := addKYCStatusHistory(tx, &submission, reviewerID); err != nil {
+			return err
+		}
+
+		eventType := models.EventKYCRejected
+		if status == models.KYCStatusApproved {
+			eventType = models.EventKYCApproved
+
+			result = tx.Model(&models.User{}).Where("id = ?", submission.UserID).Updates(map[string]interface{}{
+				"kyc_tier":   submission.TargetTier,
+				"updated_at": now,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return PublishEvent(tx, submission.UserID, nil, eventType, models.KYCSubmissionFilterRecord(&submission))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindKYCSubmission(db, id)
+}
+
+// OpenKYCDocument opens the ID photo or the selfie of a submission and
+// returns it with its content type.
+func OpenKYCDocument(store storage.Blob, submission *models.KYCSubmission, document string) ([]byte, string, error) {
+	key, contentType := submission.IDPhotoKey, submission.IDPhotoType
+	if document == models.KYCDocumentSelfie {
+		key, contentType = submission.SelfieKey, submission.SelfieType
+	}
+
+	r, err := store.Get(context.Background(), key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), contentType, nil
+}
+
+func addKYCStatusHistory(tx *gorm.DB, submission *models.KYCSubmission, actorID *uuid.UUID) error {
+	return tx.Create(&models.KYCStatusHistory{
+		SubmissionID: submission.ID,
+		Status:       submission.Status,
+		Reason:       submission.Reason,
+		ActorID:      actorID,
+	}).Error
+}
+
+func kycDocumentType(content []byte) (string, error) {
+	if len(content) == 0 {
+		return "", ErrKYCDocumentMissing
+	}
+
+	if len(content) > KYCMaxDocumentSize {
+		return "", ErrKYCDocumentSize
+	}
+
+	contentType := http.DetectContentType(content)
+	if _, ok := kycDocumentExtensions[contentType]; !ok {
+		return "", ErrKYCDocumentType
+	}
+
+	return contentType, nil
+}
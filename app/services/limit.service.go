@@ -0,0 +1,316 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLimitPerTransaction = errors.New("The amount exceeds the per transaction limit of your account tier")
+	ErrLimitDailyVolume    = errors.New("The amount exceeds the remaining daily limit of your account tier")
+	ErrLimitMonthlyVolume  = errors.New("The amount exceeds the remaining monthly limit of your account tier")
+	ErrLimitMaxBalance     = errors.New("The receiving account would exceed the maximum balance of its tier")
+	ErrLimitMonthlyInflow  = errors.New("The receiving account would exceed the monthly incoming limit of its tier")
+)
+
+// IsLimitError reports whether err is caused by a tier limit.
+func IsLimitError(err error) bool {
+	switch err {
+	case ErrLimitPerTransaction, ErrLimitDailyVolume, ErrLimitMonthlyVolume, ErrLimitMaxBalance, ErrLimitMonthlyInflow:
+		return true
+	}
+
+	return false
+}
+
+// FindTierLimit returns the limits of a tier in a currency, or nil when the
+// tier has no limits in that currency.
+func FindTierLimit(db *gorm.DB, tier string, currency string) (*models.TierLimit, error) {
+	var limit models.TierLimit
+	result := db.Where("tier = ? and currency = ?", tier, currency).First(&limit)
+	if database.IsRecordNotFoundError(result.Error) {
+		return nil, nil
+	} else if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &limit, nil
+}
+
+// UpdateTierLimit changes the given limits of a tier.
+func UpdateTierLimit(db *gorm.DB, limit *models.TierLimit, req *models.TierLimitUpdateRequest) error {
+	if req.MaxBalance != nil {
+		limit.MaxBalance = utils.RoundAmount(*req.MaxBalance)
+	}
+
+	if req.PerTransaction != nil {
+		limit.PerTransaction = utils.RoundAmount(*req.PerTransaction)
+	}
+
+	if req.DailyVolume != nil {
+		limit.DailyVolume = utils.RoundAmount(*req.DailyVolume)
+	}
+
+	if req.MonthlyVolume != nil {
+		limit.MonthlyVolume = utils.RoundAmount(*req.MonthlyVolume)
+	}
+
+	if req.MonthlyInflow != nil {
+		limit.MonthlyInflow = utils.RoundAmount(*req.MonthlyInflow)
+	}
+
+	return db.Model(limit).Updates(map[string]interface{}{
+		"max_balance":     limit.MaxBalance,
+		"per_transaction": limit.PerTransaction,
+		"daily_volume":    limit.DailyVolume,
+		"monthly_volume":  limit.MonthlyVolume,
+		"monthly_inflow":  limit.MonthlyInflow,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
+// limitPeriods returns the start of the current day and month.
+func limitPeriods(now time.Time) (time.Time, time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	return day, month
+}
+
+// userVolume sums the ledger entries of the personal wallets of a user in a
+// currency since the given time, the outgoing ones as a positive amount when
+// outgoing is set, the incoming ones otherwise. Incoming entries sent from
+// another wallet of the same user are left out, they already counted as
+// outgoing.
+func userVolume(db *gorm.DB, userID *uuid.UUID, currency string, since time.Time, outgoing bool) (float64, error) {
+	query := db.Model(&models.LedgerEntry{}).
+		Select("coalesce(abs(sum(ledger_entries.amount)), 0)").
+		Joins("join wallets on wallets.id = ledger_entries.wallet_id").
+		Joins("join transactions on transactions.id = ledger_entries.transaction_id").
+		Where("wallets.user_id = ? and wallets.currency = ? and wallets.merchant_id is null", userID, currency).
+		Where("transactions.type not in ?", []string{models.TransactionTypeRefund, models.TransactionTypeReversal}).
+		Where("ledger_entries.created_at >= ?", since)
+
+	if outgoing {
+		query = query.Where("ledger_entries.amount < 0")
+	} else {
+		query = query.
+			Joins("left join wallets senders on senders.id = transactions.from_wallet_id").
+			Where("ledger_entries.amount > 0 and senders.user_id is distinct from wallets.user_id")
+	}
+
+	var sum float64
+	result := query.Scan(&sum)
+
+	return sum, result.Error
+}
+
+// userBalance sums the balances of the personal wallets of a user in a
+// currency.
+func userBalance(db *gorm.DB, userID *uuid.UUID, currency string) (float64, error) {
+	var sum float64
+	result := db.Model(&models.Wallet{}).
+		Select("coalesce(sum(balance), 0)").
+		Where("user_id = ? and currency = ? and merchant_id is null", userID, currency).
+		Scan(&sum)
+
+	return sum, result.Error
+}
+
+func userTier(db *gorm.DB, userID *uuid.UUID) (string, error) {
+	var user models.User
+	if err := db.Select("id", "kyc_tier").First(&user, "id = ?", userID.String()).Error; err != nil {
+		return "", err
+	}
+
+	return user.KYCTier, nil
+}
+
+// checkTransferLimits enforces the tier limits of the sender and the
+// receiver of a transaction that is about to be posted. Only personal wallets
+// are limited, and refunds and reversals are never blocked. Cashback is
+// bounded by the budget of its campaign and does not count against the
+// funding wallet. A transfer between two wallets of the same user only counts
+// against the sender.
+func checkTransferLimits(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet, to *models.Wallet) error {
+	if transaction.Type == models.TransactionTypeRefund || transaction.Type == models.TransactionTypeReversal {
+		return nil
+	}
+
+	day, month := limitPeriods(time.Now())
+
+	if from.UserID != nil && from.MerchantID == nil && transaction.Type != models.TransactionTypeCashback {
+		if err := checkSenderLimits(tx, from.UserID, transaction.Currency, transaction.DebitAmount(), day, month); err != nil {
+			return err
+		}
+	}
+
+	if to.UserID != nil && to.MerchantID == nil && (from.UserID == nil || from.UserID.String() != to.UserID.String()) {
+		if err := checkReceiverLimits(tx, to.UserID, transaction.Currency, transaction.CreditAmount(), month); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkSenderLimits(tx *gorm.DB, userID *uuid.UUID, currency string, amount float64, day time.Time, month time.Time) error {
+	tier, err := userTier(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	limit, err := FindTierLimit(tx, tier, currency)
+	if err != nil || limit == nil {
+		return err
+	}
+
+	if limit.PerTransaction > 0 && amount > limit.PerTransaction {
+		return ErrLimitPerTransaction
+	}
+
+	if limit.DailyVolume > 0 {
+		used, err := userVolume(tx, userID, currency, day, true)
+		if err != nil {
+			return err
+		}
+
+		if utils.RoundAmount(used+amount) > limit.DailyVolume {
+			return ErrLimitDailyVolume
+		}
+	}
+
+	if limit.MonthlyVolume > 0 {
+		used, err := userVolume(tx, userID, currency, month, true)
+		if err != nil {
+			return err
+		}
+
+		if utils.RoundAmount(used+amount) > limit.MonthlyVolume {
+			return ErrLimitMonthlyVolume
+		}
+	}
+
+	return nil
+}
+
+func checkReceiverLimits(tx *gorm.DB, userID *uuid.UUID, currency string, amount float64, month time.Time) error {
+	tier, err := userTier(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	limit, err := FindTierLimit(tx, tier, currency)
+	if err != nil || limit == nil {
+		return err
+	}
+
+	if limit.MaxBalance > 0 {
+		balance, err := userBalance(tx, userID, currency)
+		if err != nil {
+			return err
+		}
+
+		if utils.RoundAmount(balance+amount) > limit.MaxBalance {
+			return ErrLimitMaxBalance
+		}
+	}
+
+	if limit.MonthlyInflow > 0 {
+		used, err := userVolume(tx, userID, currency, month, false)
+		if err != nil {
+			return err
+		}
+
+		if utils.RoundAmount(used+amount) > limit.MonthlyInflow {
+			return ErrLimitMonthlyInflow
+		}
+	}
+
+	return nil
+}
+
+// GetUserLimits returns the limits of the tier of the user in every currency
+// together with what has been used of them.
+func GetUserLimits(db *gorm.DB, userID *uuid.UUID) ([]models.UserLimitsResponse, error) {
+	tier, err := userTier(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	day, month := limitPeriods(time.Now())
+
+	res := make([]models.UserLimitsResponse, 0, len(models.WalletCurrencies))
+	for _, currency := range models.WalletCurrencies {
+		limit, err := FindTierLimit(db, tier, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		if limit == nil {
+			limit = &models.TierLimit{}
+		}
+
+		usage := models.UserLimitsResponse{
+			Tier:           tier,
+			Currency:       currency,
+			PerTransaction: limitValue(limit.PerTransaction),
+			MaxBalance:     limitValue(limit.MaxBalance),
+			DailyVolume:    limitValue(limit.DailyVolume),
+			MonthlyVolume:  limitValue(limit.MonthlyVolume),
+			MonthlyInflow:  limitValue(limit.MonthlyInflow),
+		}
+
+		if usage.Balance, err = userBalance(db, userID, currency); err != nil {
+			return nil, err
+		}
+
+		if usage.DailyUsed, err = userVolume(db, userID, currency, day, true); err != nil {
+			return nil, err
+		}
+
+		if usage.MonthlyUsed, err = userVolume(db, userID, currency, month, true); err != nil {
+			return nil, err
+		}
+
+		if usage.MonthlyInflowUsed, err = userVolume(db, userID, currency, month, false); err != nil {
+			return nil, err
+		}
+
+		usage.BalanceRemaining = limitRemaining(limit.MaxBalance, usage.Balance)
+		usage.DailyRemaining = limitRemaining(limit.DailyVolume, usage.DailyUsed)
+		usage.MonthlyRemaining = limitRemaining(limit.MonthlyVolume, usage.MonthlyUsed)
+		usage.MonthlyInflowRemaining = limitRemaining(limit.MonthlyInflow, usage.MonthlyInflowUsed)
+
+		res = append(res, usage)
+	}
+
+	return res, nil
+}
+
+func limitValue(limit float64) *float64 {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &limit
+}
+
+func limitRemaining(limit float64, used float64) *float64 {
+	if limit <= 0 {
+		return nil
+	}
+
+	remaining := utils.RoundAmount(limit - used)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &remaining
+}
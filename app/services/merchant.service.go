@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"gorm.io/gorm"
+)
+
+var ErrNotMerchantWallet = errors.New("Only merchant wallets can receive QRIS payments")
+
+// FindUserMerchant returns the merchant with its settlement wallets when it
+// is owned by the user.
+func FindUserMerchant(db *gorm.DB, userID string, id string) (*models.Merchant, error) {
+	var merchant models.Merchant
+	result := db.Preload("Wallets").Where("user_id = ? and id = ?", userID, id).First(&merchant)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &merchant, nil
+}
+
+// MerchantSettlementWallet returns the wallet a merchant receives payments in
+// for the given currency.
+func MerchantSettlementWallet(db *gorm.DB, merchantID string, currency string) (*models.Wallet, error) {
+	var wallet models.Wallet
+	result := db.Where("merchant_id = ? and currency = ?", merchantID, currency).Order("created_at").First(&wallet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &wallet, nil
+}
+
+// FindMerchantWallet returns the wallet with the address together with the
+// merchant it is a settlement wallet of. ErrNotMerchantWallet is returned for
+// any other wallet.
+func FindMerchantWallet(db *gorm.DB, address string) (*models.Wallet, *models.Merchant, error) {
+	wallet, err := FindWalletByAddress(db, address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if wallet.MerchantID == nil {
+		return nil, nil, ErrNotMerchantWallet
+	}
+
+	var merchant models.Merchant
+	if err := db.First(&merchant, "id = ?", wallet.MerchantID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return wallet, &merchant, nil
+}
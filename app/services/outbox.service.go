@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/outbox"
+	"github.com/fatfatcocofat/rosamsoe/pkg/pubsub"
+	"github.com/fatfatcocofat/rosamsoe/pkg/webhook"
+	"github.com/fatfatcocofat/rosamsoe/platform/broker"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxMetrics is updated by the outbox relay and exposed on /metrics.
+var OutboxMetrics = &outbox.Metrics{}
+
+// outboxLease is how long a claimed event is hidden from other relays while
+// it is being published.
+const outboxLease = time.Minute
+
+// outboxMaxAttempts is how often an event is published before it is failed,
+// with the backoff between attempts this is about a day.
+const outboxMaxAttempts = 12
+
+// RelayOutbox publishes up to limit pending outbox events to every publisher.
+// Events are claimed with SKIP LOCKED and a short lease, like webhook
+// deliveries, so several instances can relay concurrently. An event is only
+// marked as published when every publisher accepted it, otherwise it is
+// retried with a backoff and publishers may see it again. After
+// outboxMaxAttempts, or when it is too large for a publisher, the event is
+// marked as failed.
+func RelayOutbox(ctx context.Context, db *gorm.DB, publishers []outbox.EventPublisher, limit int) (int, error) {
+	var events []models.OutboxEvent
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? and next_attempt_at <= ?", models.OutboxEventPending, time.Now()).
+			Order("created_at").Limit(limit).Find(&events)
+		if result.Error != nil || len(events) == 0 {
+			return result.Error
+		}
+
+		ids := make([]string, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID.String())
+		}
+
+		return tx.Model(&models.OutboxEvent{}).Where("id in ?", ids).
+			Update("next_attempt_at", time.Now().Add(outboxLease)).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		if err := publishOutboxEvent(ctx, db, publishers, &events[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(events), refreshOutboxBacklog(db)
+}
+
+func publishOutboxEvent(ctx context.Context, db *gorm.DB, publishers []outbox.EventPublisher, event *models.OutboxEvent) error {
+	message := outbox.Message{
+		ID:        event.ID.String(),
+		Type:      event.Type,
+		Payload:   []byte(event.Payload),
+		CreatedAt: *event.CreatedAt,
+	}
+
+	if event.UserID != nil {
+		message.UserID = event.UserID.String()
+	}
+
+	if event.MerchantID != nil {
+		message.MerchantID = event.MerchantID.String()
+	}
+
+	// Every publisher is tried, so one that can never take the event does
+	// not keep it from the others.
+	var errs []error
+	retry := false
+	for _, publisher := range publishers {
+		if err := publisher.Publish(ctx, message); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", publisher.Name(), err))
+			retry = retry || !errors.Is(err, pubsub.ErrMessageTooLarge)
+		}
+	}
+
+	publishErr := errors.Join(errs...)
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts": event.Attempts + 1,
+	}
+
+	switch {
+	case publishErr == nil:
+		updates["status"] = models.OutboxEventPublished
+		updates["published_at"] = now
+		updates["last_error"] = ""
+		OutboxMetrics.ObservePublished(*event.CreatedAt)
+	case !retry || event.Attempts+1 >= outboxMaxAttempts:
+		updates["status"] = models.OutboxEventFailed
+		updates["last_error"] = publishErr.Error()
+		OutboxMetrics.ObserveFailed()
+		OutboxMetrics.ObserveDead()
+	default:
+		updates["next_attempt_at"] = now.Add(webhook.Backoff(event.Attempts + 1))
+		updates["last_error"] = publishErr.Error()
+		OutboxMetrics.ObserveFailed()
+	}
+
+	return db.Model(event).Updates(updates).Error
+}
+
+func refreshOutboxBacklog(db *gorm.DB) error {
+	var backlog struct {
+		Count  int64
+		Oldest *time.Time
+	}
+
+	err := db.Model(&models.OutboxEvent{}).Select("count(*) as count, min(created_at) as oldest").
+		Where("status = ?", models.OutboxEventPending).Scan(&backlog).Error
+	if err != nil {
+		return err
+	}
+
+	var oldest time.Duration
+	if backlog.Oldest != nil {
+		oldest = time.Since(*backlog.Oldest)
+	}
+
+	OutboxMetrics.ObserveBacklog(backlog.Count, oldest)
+
+	return nil
+}
+
+// PurgeOutbox deletes published events older than the retention period.
+func PurgeOutbox(db *gorm.DB, retention time.Duration) (int64, error) {
+	result := db.Where("status = ? and published_at < ?", models.OutboxEventPublished, time.Now().Add(-retention)).
+		Delete(&models.OutboxEvent{})
+
+	return result.RowsAffected, result.Error
+}
+
+// WebhookPublisher turns outbox events into webhook deliveries.
+type WebhookPublisher struct {
+	DB *gorm.DB
+}
+
+func (p *WebhookPublisher) Name() string {
+	return "webhooks"
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, message outbox.Message) error {
+	var event models.OutboxEvent
+	if err := p.DB.First(&event, "id = ?", message.ID).Error; err != nil {
+		return err
+	}
+
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		return EnqueueWebhookDeliveries(tx, &event)
+	})
+}
+
+// RealtimePublisher forwards outbox events to the realtime broker, which
+// streams them to the connected clients of the user.
+type RealtimePublisher struct{}
+
+func (p *RealtimePublisher) Name() string {
+	return "realtime"
+}
+
+func (p *RealtimePublisher) Publish(ctx context.Context, message outbox.Message) error {
+	if message.UserID == "" {
+		return nil
+	}
+
+	return broker.Broker.Publish(ctx, broker.UserTopic(message.UserID), message.Payload)
+}
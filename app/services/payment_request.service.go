@@ -0,0 +1,495 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPaymentRequestNotPending = errors.New("This payment request is no longer pending")
+	ErrPaymentRequestExpired    = errors.New("This payment request has expired")
+	ErrPaymentRequestSelf       = errors.New("You can not request money from yourself")
+	ErrSplitBillNotOpen         = errors.New("This split bill is no longer open")
+	ErrSplitBillDuplicate       = errors.New("Each participant can only be added once")
+	ErrSplitBillAmounts         = errors.New("Either all or none of the participants must have an amount")
+	ErrSplitBillTotal           = errors.New("The requested amounts exceed the total of the bill")
+)
+
+// IsPaymentRequestError reports whether err is caused by the state of a
+// payment request or split bill, as opposed to a database failure.
+func IsPaymentRequestError(err error) bool {
+	switch err {
+	case ErrPaymentRequestNotPending, ErrPaymentRequestExpired, ErrPaymentRequestSelf,
+		ErrSplitBillNotOpen, ErrSplitBillDuplicate, ErrSplitBillAmounts, ErrSplitBillTotal:
+		return true
+	}
+
+	return false
+}
+
+// ResolvePayer finds the user a payment is requested from, by "@handle" or
+// by the address of one of their wallets.
+func ResolvePayer(db *gorm.DB, payer string) (*models.User, error) {
+	if utils.IsHandle(payer) {
+		return FindUserByHandle(db, payer)
+	}
+
+	address, err := utils.ValidateWalletAddress(payer)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := FindWalletByAddress(db, address)
+	if err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return nil, ErrRecipientNotFound
+		}
+
+		return nil, err
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", wallet.UserID.String()).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+type PaymentRequestParams struct {
+	RequesterID *uuid.UUID
+	Wallet      *models.Wallet
+	Payer       *models.User
+	Amount      float64
+	Note        string
+	ExpiresAt   time.Time
+	SplitBillID *uuid.UUID
+}
+
+// CreatePaymentRequest creates a pending request and notifies the payer.
+func CreatePaymentRequest(db *gorm.DB, params PaymentRequestParams) (*models.PaymentRequest, error) {
+	var request models.PaymentRequest
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return createPaymentRequest(tx, params, &request)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return FindPaymentRequest(db, request.ID.String())
+}
+
+func createPaymentRequest(tx *gorm.DB, params PaymentRequestParams, request *models.PaymentRequest) error {
+	if params.Payer.ID.String() == params.RequesterID.String() {
+		return ErrPaymentRequestSelf
+	}
+
+	amount := utils.RoundAmount(params.Amount)
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	*request = models.PaymentRequest{
+		RequesterID: params.RequesterID,
+		WalletID:    params.Wallet.ID,
+		PayerID:     params.Payer.ID,
+		SplitBillID: params.SplitBillID,
+		Amount:      amount,
+		Currency:    params.Wallet.Currency,
+		Note:        params.Note,
+		Status:      models.PaymentRequestPending,
+		ExpiresAt:   &params.ExpiresAt,
+	}
+
+	if err := tx.Omit(clause.Associations).Create(request).Error; err != nil {
+		return err
+	}
+
+	if err := preloadPaymentRequest(tx).First(request, "id = ?", request.ID.String()).Error; err != nil {
+		return err
+	}
+
+	return PublishEvent(tx, request.PayerID, nil, models.EventRequestCreated, models.PaymentRequestFilterRecord(request))
+}
+
+func preloadPaymentRequest(db *gorm.DB) *gorm.DB {
+	return db.Preload("Requester").Preload("Payer").Preload("Wallet").
+		Preload("Transaction.FromWallet").Preload("Transaction.ToWallet")
+}
+
+// FindPaymentRequest loads a request and marks it as expired when its expiry
+// has passed while it was still pending.
+func FindPaymentRequest(db *gorm.DB, id string) (*models.PaymentRequest, error) {
+	var request models.PaymentRequest
+	if err := preloadPaymentRequest(db).First(&request, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	if request.Status == models.PaymentRequestPending && request.ExpiresAt.Before(time.Now()) {
+		if err := expirePaymentRequest(db, &request); err != nil {
+			return nil, err
+		}
+	}
+
+	return &request, nil
+}
+
+// FindUserPaymentRequest returns a request the user is the requester or the payer of.
+func FindUserPaymentRequest(db *gorm.DB, userID string, id string) (*models.PaymentRequest, error) {
+	request, err := FindPaymentRequest(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.RequesterID.String() != userID && request.PayerID.String() != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return request, nil
+}
+
+func expirePaymentRequest(db *gorm.DB, request *models.PaymentRequest) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(request).Where("status = ?", models.PaymentRequestPending).
+			Updates(map[string]interface{}{"status": models.PaymentRequestExpired, "updated_at": time.Now()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		request.Status = models.PaymentRequestExpired
+
+		if err := closeSplitBill(tx, request.SplitBillID); err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, request.RequesterID, nil, models.EventRequestExpired, models.PaymentRequestFilterRecord(request))
+	})
+}
+
+// ExpirePaymentRequests marks every pending request past its expiry as expired.
+func ExpirePaymentRequests(db *gorm.DB) (int64, error) {
+	var requests []models.PaymentRequest
+	result := preloadPaymentRequest(db).Where("status = ? and expires_at < ?", models.PaymentRequestPending, time.Now()).Find(&requests)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i := range requests {
+		if err := expirePaymentRequest(db, &requests[i]); err != nil {
+			return int64(i), err
+		}
+	}
+
+	return int64(len(requests)), nil
+}
+
+// PayPaymentRequest pays a pending request from a wallet of the payer into
+// the wallet of the requester. The request row is locked so it can only ever
+// be paid once.
+func PayPaymentRequest(db *gorm.DB, id string, payerID *uuid.UUID, fromWalletID *uuid.UUID) (*models.PaymentRequest, error) {
+	err := transactionWithRisk(db, func(tx *gorm.DB) error {
+		var request models.PaymentRequest
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, "id = ? and payer_id = ?", id, payerID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if request.Status != models.PaymentRequestPending {
+			return ErrPaymentRequestNotPending
+		}
+
+		if request.ExpiresAt.Before(time.Now()) {
+			return ErrPaymentRequestExpired
+		}
+
+		if err := CheckPaymentApproval(tx, fromWalletID, request.Amount); err != nil {
+			return err
+		}
+
+		description := "Payment request"
+		if request.Note != "" {
+			description += ": " + request.Note
+		}
+
+		transaction, err := Transfer(tx, TransferParams{
+			FromWalletID:  fromWalletID,
+			ToWalletID:    request.WalletID,
+			Amount:        request.Amount,
+			Description:   description,
+			InitiatedByID: payerID,
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&request).Updates(map[string]interface{}{
+			"status":         models.PaymentRequestPaid,
+			"paid_at":        now,
+			"transaction_id": transaction.ID,
+			"updated_at":     now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := closeSplitBill(tx, request.SplitBillID); err != nil {
+			return err
+		}
+
+		if err := preloadPaymentRequest(tx).First(&request, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, request.RequesterID, nil, models.EventRequestPaid, models.PaymentRequestFilterRecord(&request))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return FindPaymentRequest(db, id)
+}
+
+// DeclinePaymentRequest is used by the payer to refuse a pending request.
+func DeclinePaymentRequest(db *gorm.DB, id string, payerID string) (*models.PaymentRequest, error) {
+	return resolvePaymentRequest(db, id, payerID, models.PaymentRequestDeclined)
+}
+
+// CancelPaymentRequest is used by the requester to withdraw a pending request.
+func CancelPaymentRequest(db *gorm.DB, id string, requesterID string) (*models.PaymentRequest, error) {
+	return resolvePaymentRequest(db, id, requesterID, models.PaymentRequestCancelled)
+}
+
+// resolvePaymentRequest declines (as the payer) or cancels (as the
+// requester) a pending request and notifies the other party.
+func resolvePaymentRequest(db *gorm.DB, id string, userID string, status string) (*models.PaymentRequest, error) {
+	request, err := FindPaymentRequest(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, notify, eventType, timestampColumn := request.RequesterID, request.PayerID, models.EventRequestCancelled, "cancelled_at"
+	if status == models.PaymentRequestDeclined {
+		owner, notify, eventType, timestampColumn = request.PayerID, request.RequesterID, models.EventRequestDeclined, "declined_at"
+	}
+
+	if owner.String() != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if request.Status != models.PaymentRequestPending {
+		return nil, ErrPaymentRequestNotPending
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(request).Where("status = ?", models.PaymentRequestPending).
+			Updates(map[string]interface{}{"status": status, timestampColumn: now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrPaymentRequestNotPending
+		}
+
+		if err := closeSplitBill(tx, request.SplitBillID); err != nil {
+			return err
+		}
+
+		if err := preloadPaymentRequest(tx).First(request, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, notify, nil, eventType, models.PaymentRequestFilterRecord(request))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// SplitBillParticipant is a resolved participant of a split bill.
+type SplitBillParticipant struct {
+	Payer  *models.User
+	Amount float64
+}
+
+// SplitBillShares returns the amount requested from each participant. When
+// no participant has an amount the total is split equally in cents between
+// the participants, and the requester when included, with the remaining
+// cents going to the first participants. Otherwise the given amounts are used
+// and whatever is left of the total is the requester's own share.
+func SplitBillShares(total float64, includeRequester bool, amounts []float64) ([]float64, error) {
+	given := 0
+	sum := 0.0
+	for _, amount := range amounts {
+		if amount > 0 {
+			given++
+			sum += utils.RoundAmount(amount)
+		}
+	}
+
+	if given > 0 && given != len(amounts) {
+		return nil, ErrSplitBillAmounts
+	}
+
+	if given > 0 {
+		if utils.RoundAmount(sum) > utils.RoundAmount(total) {
+			return nil, ErrSplitBillTotal
+		}
+
+		shares := make([]float64, len(amounts))
+		for i, amount := range amounts {
+			shares[i] = utils.RoundAmount(amount)
+		}
+
+		return shares, nil
+	}
+
+	parts := int64(len(amounts))
+	if includeRequester {
+		parts++
+	}
+
+	cents := int64(math.Round(total * 100))
+	base, remainder := cents/parts, cents%parts
+
+	shares := make([]float64, len(amounts))
+	for i := range shares {
+		share := base
+		if int64(i) < remainder {
+			share++
+		}
+
+		shares[i] = float64(share) / 100
+	}
+
+	return shares, nil
+}
+
+// CreateSplitBill creates the bill and one payment request per participant.
+func CreateSplitBill(db *gorm.DB, requesterID *uuid.UUID, wallet *models.Wallet, title string, total float64, participants []SplitBillParticipant, expiresAt time.Time) (*models.SplitBill, error) {
+	seen := make(map[string]bool, len(participants))
+	for _, p := range participants {
+		if seen[p.Payer.ID.String()] {
+			return nil, ErrSplitBillDuplicate
+		}
+
+		seen[p.Payer.ID.String()] = true
+	}
+
+	bill := models.SplitBill{
+		RequesterID: requesterID,
+		WalletID:    wallet.ID,
+		Title:       title,
+		TotalAmount: utils.RoundAmount(total),
+		Currency:    wallet.Currency,
+		Status:      models.SplitBillOpen,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&bill).Error; err != nil {
+			return err
+		}
+
+		for _, p := range participants {
+			var request models.PaymentRequest
+			err := createPaymentRequest(tx, PaymentRequestParams{
+				RequesterID: requesterID,
+				Wallet:      wallet,
+				Payer:       p.Payer,
+				Amount:      p.Amount,
+				Note:        title,
+				ExpiresAt:   expiresAt,
+				SplitBillID: bill.ID,
+			}, &request)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return FindUserSplitBill(db, requesterID.String(), bill.ID.String())
+}
+
+// FindUserSplitBill returns a split bill of the requester with its requests.
+func FindUserSplitBill(db *gorm.DB, requesterID string, id string) (*models.SplitBill, error) {
+	var bill models.SplitBill
+	result := db.Preload("Wallet").
+		Preload("Requests", func(db *gorm.DB) *gorm.DB { return preloadPaymentRequest(db).Order("created_at") }).
+		Where("requester_id = ? and id = ?", requesterID, id).First(&bill)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &bill, nil
+}
+
+// CancelSplitBill cancels an open bill and every pending request of it.
+func CancelSplitBill(db *gorm.DB, requesterID string, id string) (*models.SplitBill, error) {
+	bill, err := FindUserSplitBill(db, requesterID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := db.Model(&models.SplitBill{}).Where("id = ? and status = ?", id, models.SplitBillOpen).
+		Updates(map[string]interface{}{"status": models.SplitBillCancelled, "updated_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrSplitBillNotOpen
+	}
+
+	for _, request := range bill.Requests {
+		if request.Status != models.PaymentRequestPending {
+			continue
+		}
+
+		_, err := CancelPaymentRequest(db, request.ID.String(), requesterID)
+		if err != nil && err != ErrPaymentRequestNotPending {
+			return nil, err
+		}
+	}
+
+	return FindUserSplitBill(db, requesterID, id)
+}
+
+// closeSplitBill marks an open bill as completed once none of its requests
+// is pending anymore.
+func closeSplitBill(tx *gorm.DB, id *uuid.UUID) error {
+	if id == nil {
+		return nil
+	}
+
+	var pending int64
+	err := tx.Model(&models.PaymentRequest{}).Where("split_bill_id = ? and status = ?", id.String(), models.PaymentRequestPending).
+		Count(&pending).Error
+	if err != nil || pending > 0 {
+		return err
+	}
+
+	return tx.Model(&models.SplitBill{}).Where("id = ? and status = ?", id.String(), models.SplitBillOpen).
+		Updates(map[string]interface{}{"status": models.SplitBillCompleted, "updated_at": time.Now()}).Error
+}
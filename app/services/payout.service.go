@@ -0,0 +1,775 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// PayoutMaxFileSize is the largest payout upload in bytes.
+	PayoutMaxFileSize = 1 << 20
+	// payoutMaxItems is the largest number of rows of a payout file.
+	payoutMaxItems = 1000
+	// payoutHoldWindow is how long the total of an approved batch stays
+	// held while its items are paid, the retries of its job included.
+	payoutHoldWindow = 72 * time.Hour
+)
+
+var (
+	ErrPayoutFile      = errors.New("The payout file is invalid")
+	ErrPayoutFileSize  = errors.New("Payout files must be at most 1 MB")
+	ErrPayoutMissing   = errors.New("A payout file is required")
+	ErrPayoutRows      = errors.New("Some rows of the payout file can not be paid")
+	ErrPayoutNotDraft  = errors.New("Only draft payout batches can be executed or cancelled")
+	ErrPayoutNoBalance = errors.New("The available balance of the wallet does not cover the total of the payout batch")
+)
+
+// IsPayoutError reports whether err is caused by the request.
+func IsPayoutError(err error) bool {
+	if errors.Is(err, ErrPayoutFile) {
+		return true
+	}
+
+	switch err {
+	case ErrPayoutFileSize, ErrPayoutMissing, ErrPayoutRows, ErrPayoutNotDraft, ErrPayoutNoBalance, ErrWalletFrozen:
+		return true
+	}
+
+	return false
+}
+
+type payoutJobPayload struct {
+	ID string `json:"id"`
+}
+
+// payoutRow is a row of a payout file as it was uploaded, before it is
+// validated.
+type payoutRow struct {
+	Line      int
+	Recipient string
+	Amount    string
+	Reference string
+}
+
+// CreatePayoutBatch validates every row of a payout CSV and saves the file
+// as a draft batch of the wallet, with the fee of every row quoted. When any
+// row can not be paid, no batch is created and the errors of all the rows
+// are returned instead.
+func CreatePayoutBatch(db *gorm.DB, wallet *models.Wallet, createdByID *uuid.UUID, filename string, content []byte) (*models.PayoutBatch, []models.PayoutRowError, error) {
+	rows, err := parsePayoutCSV(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batch := models.PayoutBatch{
+		WalletID:    wallet.ID,
+		CreatedByID: createdByID,
+		Filename:    filename,
+		Status:      models.PayoutBatchDraft,
+	}
+
+	rowErrors := []models.PayoutRowError{}
+	references := map[string]int{}
+
+	for _, row := range rows {
+		rowError := func(message string) {
+			rowErrors = append(rowErrors, models.PayoutRowError{Line: row.Line, Recipient: row.Recipient, Error: message})
+		}
+
+		if row.Recipient == "" {
+			rowError("The recipient is required")
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(row.Amount, 64)
+		if err != nil || utils.RoundAmount(amount) <= 0 {
+			rowError("The amount must be a number greater than zero")
+			continue
+		}
+		amount = utils.RoundAmount(amount)
+
+		if len(row.Reference) > 64 {
+			rowError("The reference must be at most 64 characters")
+			continue
+		}
+
+		if row.Reference != "" {
+			if line, ok := references[row.Reference]; ok {
+				rowError(fmt.Sprintf("The reference is already used on line %d", line))
+				continue
+			}
+
+			references[row.Reference] = row.Line
+		}
+
+		to, err := ResolveRecipient(db, row.Recipient, wallet.Currency)
+		if err != nil {
+			if IsRecipientError(err) {
+				rowError(err.Error())
+				continue
+			}
+
+			return nil, nil, err
+		}
+
+		switch {
+		case to.ID.String() == wallet.ID.String():
+			rowError(ErrSameWallet.Error())
+			continue
+		case to.SystemAccount != "":
+			rowError(ErrSystemWallet.Error())
+			continue
+		case to.FrozenAt != nil:
+			rowError(ErrRecipientFrozen.Error())
+			continue
+		}
+
+		quote, err := QuoteFee(db, models.FeeOperationTransfer, wallet.Currency, amount)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		batch.Items = append(batch.Items, models.PayoutItem{
+			Line:       row.Line,
+			Recipient:  row.Recipient,
+			ToWalletID: to.ID,
+			Amount:     amount,
+			Fee:        quote.Fee,
+			Reference:  row.Reference,
+			Status:     models.PayoutItemPending,
+		})
+
+		batch.TotalAmount = utils.RoundAmount(batch.TotalAmount + amount)
+		batch.TotalFee = utils.RoundAmount(batch.TotalFee + quote.Fee)
+		batch.Total = utils.RoundAmount(batch.Total + quote.Total)
+	}
+
+	if len(rowErrors) > 0 {
+		return nil, rowErrors, ErrPayoutRows
+	}
+
+	batch.ItemCount = len(batch.Items)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		items := batch.Items
+		batch.Items = nil
+
+		if err := tx.Omit(clause.Associations).Create(&batch).Error; err != nil {
+			return err
+		}
+
+		for i := range items {
+			items[i].BatchID = batch.ID
+		}
+
+		batch.Items = items
+
+		return tx.Omit(clause.Associations).CreateInBatches(&batch.Items, 500).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found, err := FindWalletPayoutBatch(db, wallet.ID.String(), batch.ID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return found, nil, nil
+}
+
+// parsePayoutCSV reads a payout file with a recipient, amount and an
+// optional reference column. The recipient column may also be called address
+// or handle. Only errors that make the whole file unreadable are returned,
+// the rows are validated by CreatePayoutBatch.
+func parsePayoutCSV(content []byte) ([]payoutRow, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: the header can not be read", ErrPayoutFile)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column == "address" || column == "handle" {
+			column = "recipient"
+		}
+
+		if _, ok := columns[column]; !ok {
+			columns[column] = i
+		}
+	}
+
+	for _, column := range []string{"recipient", "amount"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("%w: the %s column is missing", ErrPayoutFile, column)
+		}
+	}
+
+	field := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+
+		return ""
+	}
+
+	rows := []payoutRow{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: line %d can not be read", ErrPayoutFile, line)
+		}
+
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+
+		rows = append(rows, payoutRow{
+			Line:      line,
+			Recipient: field(row, "recipient"),
+			Amount:    field(row, "amount"),
+			Reference: field(row, "reference"),
+		})
+
+		if len(rows) > payoutMaxItems {
+			return nil, fmt.Errorf("%w: a file can have at most %d rows", ErrPayoutFile, payoutMaxItems)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: the file has no rows", ErrPayoutFile)
+	}
+
+	return rows, nil
+}
+
+func preloadPayoutBatch(db *gorm.DB) *gorm.DB {
+	return db.Preload("Wallet").Preload("CreatedBy")
+}
+
+// FindWalletPayoutBatches returns the latest payout batches of the wallet
+// without their items, optionally only the ones with the given status.
+func FindWalletPayoutBatches(db *gorm.DB, walletID string, status string) ([]models.PayoutBatch, error) {
+	query := preloadPayoutBatch(db).Where("wallet_id = ?", walletID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var batches []models.PayoutBatch
+	if err := query.Order("created_at desc").Limit(100).Find(&batches).Error; err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+// FindWalletPayoutBatch returns a payout batch of the wallet with its items
+// in the order of the file.
+func FindWalletPayoutBatch(db *gorm.DB, walletID string, id string) (*models.PayoutBatch, error) {
+	var batch models.PayoutBatch
+	result := preloadPayoutBatch(db).Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line")
+	}).Preload("Items.Transaction").Where("wallet_id = ? and id = ?", walletID, id).First(&batch)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &batch, nil
+}
+
+// ExecutePayoutBatch starts paying a draft batch in the background on behalf
+// of the user. The available balance of the wallet must cover the total of
+// the batch when it is started, every item is still checked again when it is
+// paid. When the approval policy of the wallet applies to the total amount
+// of the batch, the total is held and the batch waits for the approval of the
+// owners instead, it is started once they approve it.
+func ExecutePayoutBatch(db *gorm.DB, wallet *models.Wallet, id string, userID *uuid.UUID) (*models.PayoutBatch, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var batch models.PayoutBatch
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("wallet_id = ? and id = ?", wallet.ID, id).First(&batch).Error
+		if err != nil {
+			return err
+		}
+
+		if batch.Status != models.PayoutBatchDraft {
+			return ErrPayoutNotDraft
+		}
+
+		from, err := checkPayoutBalance(tx, &batch)
+		if err != nil {
+			return err
+		}
+
+		policy, err := findApplyingApprovalPolicy(tx, batch.WalletID, batch.TotalAmount)
+		if err != nil {
+			return err
+		}
+
+		if policy != nil {
+			return requestPayoutApproval(tx, policy, from, &batch, userID)
+		}
+
+		return startPayoutBatch(tx, &batch)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletPayoutBatch(db, wallet.ID.String(), id)
+}
+
+// checkPayoutBalance returns the wallet of a batch once its available balance
+// covers the total of the batch.
+func checkPayoutBalance(tx *gorm.DB, batch *models.PayoutBatch) (*models.Wallet, error) {
+	var from models.Wallet
+	if err := tx.First(&from, "id = ?", batch.WalletID.String()).Error; err != nil {
+		return nil, err
+	}
+
+	if from.FrozenAt != nil {
+		return nil, ErrWalletFrozen
+	}
+
+	if from.AvailableBalance() < batch.Total {
+		return nil, ErrPayoutNoBalance
+	}
+
+	return &from, nil
+}
+
+// startPayoutBatch marks a batch locked by the caller as processing and
+// queues the job that pays its items.
+func startPayoutBatch(tx *gorm.DB, batch *models.PayoutBatch) error {
+	now := time.Now()
+	err := tx.Model(batch).Updates(map[string]interface{}{
+		"status":     models.PayoutBatchProcessing,
+		"started_at": now,
+		"updated_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	_, err = EnqueueJob(tx, models.JobKindPayoutExecute, payoutJobPayload{ID: batch.ID.String()}, JobOptions{
+		UniqueKey:   "payout:" + batch.ID.String(),
+		MaxAttempts: 5,
+	})
+
+	return err
+}
+
+// requestPayoutApproval holds the total of a batch locked by the caller and
+// asks the owners of the wallet other than the user to approve the batch as
+// a whole.
+func requestPayoutApproval(tx *gorm.DB, policy *models.ApprovalPolicy, wallet *models.Wallet, batch *models.PayoutBatch, userID *uuid.UUID) error {
+	approvers, err := transferApprovers(tx, policy, wallet, userID)
+	if err != nil {
+		return err
+	}
+
+	description := "Payout batch"
+	if batch.Filename != "" {
+		description = "Payout of " + batch.Filename
+	}
+
+	expiresAt := time.Now().Add(time.Duration(policy.ExpiresIn) * time.Second)
+
+	approval := models.TransferApproval{
+		WalletID:          wallet.ID,
+		RequestedByID:     userID,
+		Type:              models.TransactionTypePayout,
+		Recipient:         fmt.Sprintf("%d recipients", batch.ItemCount),
+		Amount:            batch.TotalAmount,
+		Currency:          wallet.Currency,
+		Description:       description,
+		PayoutBatchID:     batch.ID,
+		RequiredApprovals: policy.RequiredApprovals,
+		ExpiresAt:         &expiresAt,
+	}
+
+	if err := openTransferApproval(tx, &approval, batch.Total, approvers); err != nil {
+		return err
+	}
+
+	return tx.Model(batch).Updates(map[string]interface{}{
+		"status":      models.PayoutBatchAwaitingApproval,
+		"approval_id": approval.ID,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// executePayoutApproval starts paying an approved batch. The total stays
+// held, every item is captured out of the hold as it is paid, so the wallet
+// can not spend the money of the batch in the meantime.
+func executePayoutApproval(tx *gorm.DB, approval *models.TransferApproval) error {
+	var batch models.PayoutBatch
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? and status = ?", approval.PayoutBatchID, models.PayoutBatchAwaitingApproval).Limit(1).Find(&batch)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrPayoutNotDraft
+	}
+
+	hold, err := lockActiveHold(tx, approval.HoldID.String())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(hold).Updates(map[string]interface{}{"expires_at": now.Add(payoutHoldWindow), "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	return startPayoutBatch(tx, &batch)
+}
+
+// reopenPayoutBatch puts the batch of a payout approval that is closed
+// without being executed back to draft, so that it can be executed again or
+// cancelled.
+func reopenPayoutBatch(tx *gorm.DB, approval *models.TransferApproval) error {
+	if approval.PayoutBatchID == nil {
+		return nil
+	}
+
+	return tx.Model(&models.PayoutBatch{}).
+		Where("id = ? and status = ?", approval.PayoutBatchID, models.PayoutBatchAwaitingApproval).
+		Updates(map[string]interface{}{
+			"status":      models.PayoutBatchDraft,
+			"approval_id": nil,
+			"updated_at":  time.Now(),
+		}).Error
+}
+
+// CancelPayoutBatch discards a draft batch.
+func CancelPayoutBatch(db *gorm.DB, wallet *models.Wallet, id string) (*models.PayoutBatch, error) {
+	var batch models.PayoutBatch
+	if err := db.Where("wallet_id = ? and id = ?", wallet.ID, id).First(&batch).Error; err != nil {
+		return nil, err
+	}
+
+	result := db.Model(&models.PayoutBatch{}).Where("id = ? and status = ?", batch.ID, models.PayoutBatchDraft).Updates(map[string]interface{}{
+		"status":     models.PayoutBatchCancelled,
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrPayoutNotDraft
+	}
+
+	return FindWalletPayoutBatch(db, wallet.ID.String(), id)
+}
+
+// ExecutePayoutJob pays the pending items of a batch. When the last attempt
+// fails, the items that could not be paid are marked failed so that the
+// batch completes.
+func ExecutePayoutJob(db *gorm.DB, job *models.Job) error {
+	var payload payoutJobPayload
+	if err := job.DecodePayload(&payload); err != nil {
+		return err
+	}
+
+	err := RunPayoutBatch(db, payload.ID)
+	if err != nil && job.Attempts+1 >= job.MaxAttempts {
+		result := db.Model(&models.PayoutItem{}).Where("batch_id = ? and status = ?", payload.ID, models.PayoutItemPending).Updates(map[string]interface{}{
+			"status":       models.PayoutItemFailed,
+			"error":        "The payout could not be processed",
+			"processed_at": time.Now(),
+		})
+		if result.Error != nil {
+			return err
+		}
+
+		return completePayoutBatch(db, payload.ID)
+	}
+
+	return err
+}
+
+// RunPayoutBatch pays every pending item of a processing batch, one transfer
+// per item. It is safe to run more than once: an item is marked in the same
+// transaction as its transfer and only pending items are paid. Business
+// failures such as insufficient funds fail the item, other errors stop the
+// run so that the job is retried.
+func RunPayoutBatch(db *gorm.DB, id string) error {
+	var batch models.PayoutBatch
+	result := db.Where("id = ?", id).First(&batch)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		return result.Error
+	}
+
+	if batch.Status != models.PayoutBatchProcessing {
+		return nil
+	}
+
+	var items []models.PayoutItem
+	if err := db.Select("id").Where("batch_id = ? and status = ?", id, models.PayoutItemPending).Order("line").Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := payPayoutItem(db, &batch, item.ID.String()); err != nil {
+			return err
+		}
+	}
+
+	return completePayoutBatch(db, id)
+}
+
+func payPayoutItem(db *gorm.DB, batch *models.PayoutBatch, id string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var item models.PayoutItem
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? and status = ?", id, models.PayoutItemPending).Limit(1).Find(&item)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		updates := map[string]interface{}{
+			"status":       models.PayoutItemSucceeded,
+			"processed_at": time.Now(),
+		}
+
+		// The savepoint undoes the capture of a hold when the transfer
+		// fails, the item is then marked failed below.
+		var transaction *models.Transaction
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			hold, err := lockPayoutHold(tx, batch)
+			if err != nil {
+				return err
+			}
+
+			if hold != nil {
+				transaction, err = captureHoldPart(tx, hold, payoutTransferParams(batch, &item))
+			} else {
+				transaction, err = Transfer(tx, payoutTransferParams(batch, &item))
+			}
+
+			return err
+		})
+		switch {
+		case err == nil:
+			updates["transaction_id"] = transaction.ID
+		case IsTransferError(err):
+			updates["status"] = models.PayoutItemFailed
+			updates["error"] = err.Error()
+		default:
+			return err
+		}
+
+		return tx.Model(&item).Updates(updates).Error
+	})
+}
+
+// lockPayoutHold locks the hold of the approval a batch was executed with.
+// It returns nil when the batch did not need an approval or its hold is no
+// longer active, the items are then paid out of the available balance.
+func lockPayoutHold(tx *gorm.DB, batch *models.PayoutBatch) (*models.Hold, error) {
+	if batch.ApprovalID == nil {
+		return nil, nil
+	}
+
+	var approval models.TransferApproval
+	if err := tx.Select("hold_id").First(&approval, "id = ?", batch.ApprovalID).Error; err != nil {
+		return nil, err
+	}
+
+	hold, err := lockActiveHold(tx, approval.HoldID.String())
+	switch err {
+	case ErrHoldNotActive:
+		return nil, nil
+	case ErrHoldExpired:
+		return nil, closeHold(tx, approval.HoldID.String(), models.HoldStatusExpired, models.EventHoldExpired)
+	}
+
+	return hold, err
+}
+
+// closePayoutHold closes the hold of an approved batch once its items are
+// processed, releasing what the items that failed did not spend.
+func closePayoutHold(tx *gorm.DB, batch *models.PayoutBatch) error {
+	hold, err := lockPayoutHold(tx, batch)
+	if err != nil || hold == nil {
+		return err
+	}
+
+	if hold.CapturedAmount == 0 {
+		return closeHold(tx, hold.ID.String(), models.HoldStatusReleased, models.EventHoldReleased)
+	}
+
+	wallets, err := lockWallets(tx, hold.WalletID)
+	if err != nil {
+		return err
+	}
+
+	if err := adjustHeldBalance(tx, wallets[hold.WalletID.String()], -hold.Amount); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = tx.Model(hold).Updates(map[string]interface{}{
+		"status":      models.HoldStatusCaptured,
+		"captured_at": now,
+		"updated_at":  now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if err := preloadHold(tx).First(hold, "id = ?", hold.ID).Error; err != nil {
+		return err
+	}
+
+	return PublishEvent(tx, hold.Wallet.UserID, hold.Wallet.MerchantID, models.EventHoldCaptured, models.HoldFilterRecord(hold))
+}
+
+// payoutTransferParams is the transfer that pays an item. Items are posted as
+// payouts rather than transfers, the velocity and new recipient risk rules
+// meant for single transfers would stop a batch after its first few items.
+func payoutTransferParams(batch *models.PayoutBatch, item *models.PayoutItem) TransferParams {
+	description := item.Reference
+	if description == "" {
+		description = "Payout"
+	}
+
+	return TransferParams{
+		FromWalletID:  batch.WalletID,
+		ToWalletID:    item.ToWalletID,
+		Amount:        item.Amount,
+		Type:          models.TransactionTypePayout,
+		Reference:     payoutReference(item.ID),
+		Description:   description,
+		InitiatedByID: batch.CreatedByID,
+	}
+}
+
+// payoutReference is the same for every attempt of an item, so the unique
+// transaction reference guards against paying an item twice.
+func payoutReference(id *uuid.UUID) string {
+	return "PAY" + strings.ToUpper(strings.ReplaceAll(id.String(), "-", ""))
+}
+
+// completePayoutBatch totals the items of a processing batch once none is
+// pending and notifies its creator and the owner of the wallet.
+func completePayoutBatch(db *gorm.DB, id string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var batch models.PayoutBatch
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? and status = ?", id, models.PayoutBatchProcessing).Limit(1).Find(&batch)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var totals struct {
+			Pending   int
+			Succeeded int
+			Failed    int
+			Paid      float64
+		}
+
+		err := tx.Model(&models.PayoutItem{}).
+			Select("count(*) filter (where status = ?) as pending, count(*) filter (where status = ?) as succeeded, "+
+				"count(*) filter (where status = ?) as failed, coalesce(sum(amount) filter (where status = ?), 0) as paid",
+				models.PayoutItemPending, models.PayoutItemSucceeded, models.PayoutItemFailed, models.PayoutItemSucceeded).
+			Where("batch_id = ?", id).Scan(&totals).Error
+		if err != nil || totals.Pending > 0 {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&batch).Updates(map[string]interface{}{
+			"status":          models.PayoutBatchCompleted,
+			"succeeded_count": totals.Succeeded,
+			"failed_count":    totals.Failed,
+			"paid_amount":     utils.RoundAmount(totals.Paid),
+			"completed_at":    now,
+			"updated_at":      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := closePayoutHold(tx, &batch); err != nil {
+			return err
+		}
+
+		if err := preloadPayoutBatch(tx).First(&batch, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		data := models.PayoutBatchFilterRecord(&batch)
+
+		if err := PublishEvent(tx, batch.Wallet.UserID, batch.Wallet.MerchantID, models.EventPayoutCompleted, data); err != nil {
+			return err
+		}
+
+		if batch.Wallet.UserID != nil && batch.Wallet.UserID.String() == batch.CreatedByID.String() {
+			return nil
+		}
+
+		return PublishEvent(tx, batch.CreatedByID, nil, models.EventPayoutCompleted, data)
+	})
+}
+
+// RenderPayoutResult writes the status of every item of a batch as CSV, in
+// the order of the uploaded file.
+func RenderPayoutResult(batch *models.PayoutBatch) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	rows := [][]string{
+		{"line", "recipient", "amount", "fee", "reference", "status", "transaction_reference", "error"},
+	}
+
+	for _, item := range batch.Items {
+		transaction := ""
+		if item.Transaction != nil {
+			transaction = item.Transaction.Reference
+		}
+
+		rows = append(rows, []string{
+			strconv.Itoa(item.Line),
+			item.Recipient,
+			fmt.Sprintf("%.2f", item.Amount),
+			fmt.Sprintf("%.2f", item.Fee),
+			item.Reference,
+			item.Status,
+			transaction,
+			item.Error,
+		})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), fmt.Sprintf("payout-%s.csv", batch.ID), nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/risk"
+	"github.com/google/uuid"
+)
+
+// payoutHistory is the outgoing history of the sender as the risk rules see
+// it, every paid item adds a transaction to a recipient never paid before.
+type payoutHistory struct {
+	count int
+	total float64
+}
+
+func (h *payoutHistory) Outgoing(window time.Duration) (int, float64, error) {
+	return h.count, h.total, nil
+}
+
+func (h *payoutHistory) NewRecipients(window time.Duration) (int, bool, error) {
+	return h.count, true, nil
+}
+
+func (h *payoutHistory) Device() (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
+
+func payoutFile(rows int) []byte {
+	var b strings.Builder
+	b.WriteString("recipient,amount,reference\n")
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&b, "@employee%d,%d,SALARY-%d\n", i, 100+i, i)
+	}
+
+	return []byte(b.String())
+}
+
+// TestPayoutBatchSkipsTransferRiskRules pays a batch of more than 50 rows
+// against the default risk rules, which review after 10 transfers an hour,
+// after 5 new recipients a day and block after 50 transfers a day.
+func TestPayoutBatchSkipsTransferRiskRules(t *testing.T) {
+	rows, err := parsePayoutCSV(payoutFile(60))
+	if err != nil {
+		t.Fatalf("parsePayoutCSV() error = %v", err)
+	}
+
+	if len(rows) != 60 {
+		t.Fatalf("parsePayoutCSV() = %d rows, want 60", len(rows))
+	}
+
+	walletID, userID := uuid.New(), uuid.New()
+	batch := &models.PayoutBatch{WalletID: &walletID, CreatedByID: &userID}
+	now := time.Now()
+
+	// pay runs the risk rules for every row in turn, with the type of the
+	// transfer changed to transactionType, and returns the first line that
+	// is not allowed.
+	pay := func(t *testing.T, transactionType string) (int, string) {
+		history := &payoutHistory{}
+		references := map[string]bool{}
+
+		for _, row := range rows {
+			id := uuid.New()
+			item := &models.PayoutItem{ID: &id, Line: row.Line, Recipient: row.Recipient, Amount: 150}
+
+			params := payoutTransferParams(batch, item)
+			if params.FromWalletID != batch.WalletID || params.InitiatedByID != batch.CreatedByID || params.Amount != item.Amount {
+				t.Fatalf("payoutTransferParams() = %+v, want the item paid from the batch wallet", params)
+			}
+
+			if references[params.Reference] {
+				t.Fatalf("payoutTransferParams() reference %q is used twice", params.Reference)
+			}
+			references[params.Reference] = true
+
+			if transactionType != "" {
+				params.Type = transactionType
+			}
+
+			if riskScreened(params.Type) {
+				result, err := risk.Evaluate(risk.DefaultRules(), "IDR", params.Amount, history, now)
+				if err != nil {
+					t.Fatalf("Evaluate() error = %v", err)
+				}
+
+				if result.Outcome != risk.OutcomeAllow {
+					return row.Line, result.Outcome
+				}
+			}
+
+			history.count++
+			history.total += params.Amount
+		}
+
+		return 0, risk.OutcomeAllow
+	}
+
+	t.Run("payouts", func(t *testing.T) {
+		if line, outcome := pay(t, ""); outcome != risk.OutcomeAllow {
+			t.Errorf("item on line %d: outcome %q, want every item allowed", line, outcome)
+		}
+	})
+
+	t.Run("transfers", func(t *testing.T) {
+		if line, outcome := pay(t, models.TransactionTypeTransfer); outcome == risk.OutcomeAllow || line > 50 {
+			t.Errorf("items paid as transfers stopped on line %d with %q, want them stopped within the first 50", line, outcome)
+		}
+	})
+}
+
+func TestPayoutTransferParams(t *testing.T) {
+	walletID, userID, itemID := uuid.New(), uuid.New(), uuid.New()
+	batch := &models.PayoutBatch{WalletID: &walletID, CreatedByID: &userID}
+
+	tests := []struct {
+		name            string
+		reference       string
+		wantDescription string
+	}{
+		{"with reference", "SALARY-1", "SALARY-1"},
+		{"without reference", "", "Payout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := payoutTransferParams(batch, &models.PayoutItem{ID: &itemID, Amount: 10, Reference: tt.reference})
+
+			if params.Type != models.TransactionTypePayout {
+				t.Errorf("Type = %q, want %q", params.Type, models.TransactionTypePayout)
+			}
+
+			if params.Description != tt.wantDescription {
+				t.Errorf("Description = %q, want %q", params.Description, tt.wantDescription)
+			}
+
+			if want := payoutReference(&itemID); params.Reference != want {
+				t.Errorf("Reference = %q, want %q", params.Reference, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/cron"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxWalletPockets is the number of pockets a wallet can have.
+const maxWalletPockets = 10
+
+var (
+	ErrPocketLimit          = errors.New("A wallet can have at most 10 pockets")
+	ErrPocketInsufficient   = errors.New("Insufficient balance in the pocket")
+	ErrPocketTargetDate     = errors.New("target_date must be a future date formatted as YYYY-MM-DD")
+	ErrPocketMerchantWallet = errors.New("Merchant settlement wallets can not have pockets")
+)
+
+// IsPocketError reports whether err is caused by the request rather than by
+// the database.
+func IsPocketError(err error) bool {
+	switch err {
+	case ErrPocketLimit, ErrPocketInsufficient, ErrPocketTargetDate, ErrPocketMerchantWallet, ErrInvalidAmount, ErrInsufficientFunds,
+		ErrRecurringTime, ErrRecurringTimezone, ErrRecurringCron:
+		return true
+	}
+
+	return false
+}
+
+// FindWalletPockets returns the pockets of a wallet, oldest first.
+func FindWalletPockets(db *gorm.DB, walletID string) ([]models.Pocket, error) {
+	var pockets []models.Pocket
+	result := db.Preload("Wallet").Where("wallet_id = ?", walletID).Order("created_at").Find(&pockets)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return pockets, nil
+}
+
+// FindWalletPocket returns a pocket of the wallet.
+func FindWalletPocket(db *gorm.DB, walletID string, id string) (*models.Pocket, error) {
+	var pocket models.Pocket
+	result := db.Preload("Wallet").Where("wallet_id = ? and id = ?", walletID, id).First(&pocket)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &pocket, nil
+}
+
+// CreatePocket adds an empty pocket to the wallet.
+func CreatePocket(db *gorm.DB, wallet *models.Wallet, req *models.PocketCreateRequest) (*models.Pocket, error) {
+	if wallet.MerchantID != nil {
+		return nil, ErrPocketMerchantWallet
+	}
+
+	pocket := models.Pocket{
+		WalletID:     wallet.ID,
+		Name:         req.Name,
+		TargetAmount: utils.RoundAmount(req.TargetAmount),
+		RoundUpTo:    utils.RoundAmount(req.RoundUpTo),
+	}
+
+	if req.TargetDate != "" {
+		targetDate, err := parsePocketTargetDate(req.TargetDate)
+		if err != nil {
+			return nil, err
+		}
+
+		pocket.TargetDate = targetDate
+	}
+
+	if req.AutoSave != nil {
+		if err := setPocketAutoSave(&pocket, req.AutoSave); err != nil {
+			return nil, err
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockWallets(tx, wallet.ID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Pocket{}).Where("wallet_id = ?", wallet.ID).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count >= maxWalletPockets {
+			return ErrPocketLimit
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&pocket).Error; err != nil {
+			return err
+		}
+
+		if pocket.RoundUpTo > 0 {
+			return clearOtherRoundUps(tx, &pocket)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletPocket(db, wallet.ID.String(), pocket.ID.String())
+}
+
+// UpdatePocket changes the name, target and auto save rules of a pocket.
+func UpdatePocket(db *gorm.DB, pocket *models.Pocket, req *models.PocketUpdateRequest) (*models.Pocket, error) {
+	updates := map[string]interface{}{"updated_at": time.Now()}
+
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+
+	if req.TargetAmount != nil {
+		updates["target_amount"] = utils.RoundAmount(*req.TargetAmount)
+	}
+
+	if req.TargetDate != nil {
+		updates["target_date"] = nil
+
+		if *req.TargetDate != "" {
+			targetDate, err := parsePocketTargetDate(*req.TargetDate)
+			if err != nil {
+				return nil, err
+			}
+
+			updates["target_date"] = targetDate
+		}
+	}
+
+	if req.RoundUpTo != nil {
+		pocket.RoundUpTo = utils.RoundAmount(*req.RoundUpTo)
+		updates["round_up_to"] = pocket.RoundUpTo
+	}
+
+	if req.DisableAutoSave {
+		updates["auto_save_amount"] = 0
+		updates["auto_save_cron"] = ""
+		updates["auto_save_timezone"] = ""
+		updates["next_auto_save_at"] = nil
+	} else if req.AutoSave != nil {
+		if err := setPocketAutoSave(pocket, req.AutoSave); err != nil {
+			return nil, err
+		}
+
+		updates["auto_save_amount"] = pocket.AutoSaveAmount
+		updates["auto_save_cron"] = pocket.AutoSaveCron
+		updates["auto_save_timezone"] = pocket.AutoSaveTimezone
+		updates["next_auto_save_at"] = pocket.NextAutoSaveAt
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Pocket{}).Where("id = ?", pocket.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if req.RoundUpTo != nil && pocket.RoundUpTo > 0 {
+			return clearOtherRoundUps(tx, pocket)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletPocket(db, pocket.WalletID.String(), pocket.ID.String())
+}
+
+// DeletePocket moves the balance of a pocket back to the main balance of its
+// wallet and deletes it.
+func DeletePocket(db *gorm.DB, pocket *models.Pocket) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, pocket.WalletID)
+		if err != nil {
+			return err
+		}
+
+		locked, err := lockPocket(tx, pocket.ID.String())
+		if err != nil {
+			return err
+		}
+
+		if locked.Balance > 0 {
+			if err := movePocketFunds(tx, wallets[pocket.WalletID.String()], locked, -locked.Balance, models.PocketMovementClose, nil); err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&models.Pocket{}, "id = ?", locked.ID).Error
+	})
+}
+
+// MovePocketFunds moves amount from the main balance of the wallet into the
+// pocket, or out of the pocket when amount is negative. The money stays in
+// the wallet, so no transaction is recorded.
+func MovePocketFunds(db *gorm.DB, pocket *models.Pocket, amount float64) (*models.Pocket, error) {
+	amount = utils.RoundAmount(amount)
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, pocket.WalletID)
+		if err != nil {
+			return err
+		}
+
+		locked, err := lockPocket(tx, pocket.ID.String())
+		if err != nil {
+			return err
+		}
+
+		return movePocketFunds(tx, wallets[pocket.WalletID.String()], locked, amount, models.PocketMovementManual, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletPocket(db, pocket.WalletID.String(), pocket.ID.String())
+}
+
+// movePocketFunds changes the balances of a wallet and a pocket, both locked
+// by the caller, and records the movement.
+func movePocketFunds(tx *gorm.DB, wallet *models.Wallet, pocket *models.Pocket, amount float64, source string, transactionID *uuid.UUID) error {
+	if amount > 0 && wallet.AvailableBalance() < amount {
+		return ErrInsufficientFunds
+	}
+
+	if amount < 0 && pocket.Balance < -amount {
+		return ErrPocketInsufficient
+	}
+
+	now := time.Now()
+
+	wallet.PocketBalance = utils.RoundAmount(wallet.PocketBalance + amount)
+	if err := tx.Model(wallet).Updates(map[string]interface{}{"pocket_balance": wallet.PocketBalance, "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	pocket.Balance = utils.RoundAmount(pocket.Balance + amount)
+	if err := tx.Model(pocket).Updates(map[string]interface{}{"balance": pocket.Balance, "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	movement := models.PocketMovement{
+		PocketID:      pocket.ID,
+		Amount:        amount,
+		BalanceAfter:  pocket.Balance,
+		Source:        source,
+		TransactionID: transactionID,
+	}
+
+	if err := tx.Create(&movement).Error; err != nil {
+		return err
+	}
+
+	pocket.Wallet = *wallet
+
+	return PublishEvent(tx, wallet.UserID, nil, models.EventPocketMoved, models.PocketFilterRecord(pocket))
+}
+
+// saveRoundUp moves the round up of a transfer into the round up pocket of
+// the sending wallet, locked by the caller. The round up is skipped when the
+// available balance can not cover it.
+func saveRoundUp(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet) error {
+	if transaction.Type != models.TransactionTypeTransfer && transaction.Type != models.TransactionTypePayment {
+		return nil
+	}
+
+	var pocket models.Pocket
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("wallet_id = ? and round_up_to > 0", from.ID).Limit(1).Find(&pocket)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	debit := transaction.DebitAmount()
+	amount := autoSaveAmount(&pocket, utils.RoundAmount(math.Ceil(debit/pocket.RoundUpTo)*pocket.RoundUpTo-debit))
+	if amount <= 0 || from.AvailableBalance() < amount {
+		return nil
+	}
+
+	return movePocketFunds(tx, from, &pocket, amount, models.PocketMovementRoundUp, transaction.ID)
+}
+
+// DispatchPocketAutoSaves makes the scheduled savings of every pocket that is
+// due. Like recurring transfers, occurrences missed while the scheduler was
+// not running are not caught up.
+func DispatchPocketAutoSaves(db *gorm.DB, limit int) (int, error) {
+	var pockets []models.Pocket
+
+	now := time.Now()
+	result := db.Where("next_auto_save_at <= ?", now).Order("next_auto_save_at").Limit(limit).Find(&pockets)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i := range pockets {
+		if err := executePocketAutoSave(db, &pockets[i], now); err != nil {
+			return i, err
+		}
+	}
+
+	return len(pockets), nil
+}
+
+// executePocketAutoSave moves the scheduled amount into a pocket and moves
+// the pocket to its next occurrence. When the available balance is too low
+// the occurrence is skipped and a pocket.auto_save_failed event is published.
+func executePocketAutoSave(db *gorm.DB, pocket *models.Pocket, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, pocket.WalletID)
+		if err != nil {
+			return err
+		}
+
+		locked, err := lockPocket(tx, pocket.ID.String())
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		if locked.NextAutoSaveAt == nil || locked.NextAutoSaveAt.After(now) {
+			return nil
+		}
+
+		err = tx.Model(locked).Updates(map[string]interface{}{"next_auto_save_at": nextPocketAutoSave(locked, now), "updated_at": now}).Error
+		if err != nil {
+			return err
+		}
+
+		wallet := wallets[pocket.WalletID.String()]
+
+		amount := autoSaveAmount(locked, locked.AutoSaveAmount)
+		if amount <= 0 {
+			return nil
+		}
+
+		if wallet.AvailableBalance() < amount {
+			return PublishEvent(tx, wallet.UserID, nil, models.EventPocketAutoSaveFailed, models.PocketAutoSaveFailedEventData{
+				ID:       locked.ID,
+				Wallet:   wallet.Address,
+				Name:     locked.Name,
+				Amount:   amount,
+				Currency: wallet.Currency,
+				Reason:   ErrInsufficientFunds.Error(),
+			})
+		}
+
+		return movePocketFunds(tx, wallet, locked, amount, models.PocketMovementSchedule, nil)
+	})
+}
+
+// autoSaveAmount limits an automatic saving to what is left to reach the
+// target, so that automatic savings stop once the target is reached.
+func autoSaveAmount(pocket *models.Pocket, amount float64) float64 {
+	if pocket.TargetAmount <= 0 {
+		return amount
+	}
+
+	return math.Min(amount, utils.RoundAmount(pocket.TargetAmount-pocket.Balance))
+}
+
+func setPocketAutoSave(pocket *models.Pocket, req *models.PocketAutoSaveRequest) error {
+	expr, timezone, err := RecurringSchedule(&req.RecurringTransferScheduleRequest)
+	if err != nil {
+		return err
+	}
+
+	pocket.AutoSaveAmount = utils.RoundAmount(req.Amount)
+	pocket.AutoSaveCron = expr
+	pocket.AutoSaveTimezone = timezone
+	pocket.NextAutoSaveAt = nextPocketAutoSave(pocket, time.Now())
+
+	return nil
+}
+
+// nextPocketAutoSave returns the first occurrence of the auto save schedule
+// after the given time.
+func nextPocketAutoSave(pocket *models.Pocket, after time.Time) *time.Time {
+	schedule, err := cron.Parse(pocket.AutoSaveCron)
+	if err != nil {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(pocket.AutoSaveTimezone)
+	if err != nil {
+		return nil
+	}
+
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+
+	return &next
+}
+
+func parsePocketTargetDate(value string) (*time.Time, error) {
+	targetDate, err := time.Parse("2006-01-02", value)
+	if err != nil || !targetDate.After(time.Now()) {
+		return nil, ErrPocketTargetDate
+	}
+
+	return &targetDate, nil
+}
+
+// clearOtherRoundUps turns round up off on the other pockets of the wallet,
+// round ups are saved into a single pocket.
+func clearOtherRoundUps(tx *gorm.DB, pocket *models.Pocket) error {
+	return tx.Model(&models.Pocket{}).Where("wallet_id = ? and id <> ? and round_up_to > 0", pocket.WalletID, pocket.ID).
+		Updates(map[string]interface{}{"round_up_to": 0, "updated_at": time.Now()}).Error
+}
+
+func lockPocket(tx *gorm.DB, id string) (*models.Pocket, error) {
+	var pocket models.Pocket
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pocket, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &pocket, nil
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPromotionNotFound    = errors.New("No promotion was found with that code")
+	ErrPromotionInactive    = errors.New("This promotion is not running at the moment")
+	ErrPromotionCurrency    = errors.New("This promotion does not apply to this currency")
+	ErrPromotionMinAmount   = errors.New("The amount is below the minimum of this promotion")
+	ErrPromotionNewUsers    = errors.New("This promotion only applies to the first transfer or payment of new users")
+	ErrPromotionUserLimit   = errors.New("You have already redeemed this promotion as many times as allowed")
+	ErrPromotionBudget      = errors.New("The budget of this promotion has been used up")
+	ErrPromotionTransaction = errors.New("No transfer or payment of yours was found with that reference")
+	ErrPromotionBefore      = errors.New("The transaction was made before the promotion started")
+	ErrPromotionRefunded    = errors.New("Refunded or reversed transactions can not earn cashback")
+	ErrPromotionRedeemed    = errors.New("This transaction has already earned cashback")
+	ErrPromotionUnavailable = errors.New("This promotion can not be redeemed at the moment")
+
+	ErrPromotionCode          = errors.New("A promotion with this code already exists")
+	ErrPromotionWindow        = errors.New("ends_at must be after starts_at")
+	ErrPromotionPercentage    = errors.New("A percentage cashback must be at most 100")
+	ErrPromotionFundingWallet = errors.New("No wallet was found with the funding_wallet address")
+	ErrPromotionFundingSystem = errors.New("System wallets can not fund promotions")
+	ErrPromotionBudgetSpent   = errors.New("The budget can not be lower than the cashback already paid")
+)
+
+// promotionTransactionTypes are the transactions that can earn cashback.
+var promotionTransactionTypes = []string{models.TransactionTypeTransfer, models.TransactionTypePayment}
+
+// IsPromotionError reports whether err is caused by the request.
+func IsPromotionError(err error) bool {
+	switch err {
+	case ErrPromotionNotFound, ErrPromotionInactive, ErrPromotionCurrency, ErrPromotionMinAmount, ErrPromotionNewUsers,
+		ErrPromotionUserLimit, ErrPromotionBudget, ErrPromotionTransaction, ErrPromotionBefore, ErrPromotionRefunded,
+		ErrPromotionRedeemed, ErrPromotionUnavailable, ErrPromotionCode, ErrPromotionWindow, ErrPromotionPercentage,
+		ErrPromotionFundingWallet, ErrPromotionFundingSystem, ErrPromotionBudgetSpent:
+		return true
+	}
+
+	return false
+}
+
+func normalizePromotionCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CreatePromotionCampaign validates and stores a new campaign. The currency
+// of the campaign is the one of its funding wallet.
+func CreatePromotionCampaign(db *gorm.DB, req *models.PromotionCampaignCreateRequest, createdByID *uuid.UUID) (*models.PromotionCampaign, error) {
+	address, err := utils.ValidateWalletAddress(req.FundingWallet)
+	if err != nil {
+		return nil, ErrPromotionFundingWallet
+	}
+
+	var wallet models.Wallet
+	if err := db.Where("address = ?", address).First(&wallet).Error; err != nil {
+		if database.IsRecordNotFoundError(err) {
+			return nil, ErrPromotionFundingWallet
+		}
+
+		return nil, err
+	}
+
+	if wallet.SystemAccount != "" {
+		return nil, ErrPromotionFundingSystem
+	}
+
+	campaign := models.PromotionCampaign{
+		Name:            req.Name,
+		Code:            normalizePromotionCode(req.Code),
+		Description:     req.Description,
+		Currency:        wallet.Currency,
+		FundingWalletID: wallet.ID,
+		FundingWallet:   wallet,
+		CashbackType:    req.CashbackType,
+		CashbackValue:   req.CashbackValue,
+		MaxCashback:     utils.RoundAmount(req.MaxCashback),
+		MinAmount:       utils.RoundAmount(req.MinAmount),
+		NewUsersOnly:    req.NewUsersOnly,
+		Budget:          utils.RoundAmount(req.Budget),
+		PerUserLimit:    req.PerUserLimit,
+		Active:          true,
+		StartsAt:        req.StartsAt,
+		EndsAt:          req.EndsAt,
+		CreatedByID:     createdByID,
+	}
+
+	if campaign.CashbackType == models.CashbackTypeFlat {
+		campaign.CashbackValue = utils.RoundAmount(campaign.CashbackValue)
+	}
+
+	if campaign.PerUserLimit == 0 {
+		campaign.PerUserLimit = 1
+	}
+
+	if req.Active != nil {
+		campaign.Active = *req.Active
+	}
+
+	if err := validatePromotionCampaign(&campaign); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := db.Model(&models.PromotionCampaign{}).Where("code = ?", campaign.Code).Count(&count).Error; err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		return nil, ErrPromotionCode
+	}
+
+	// gorm skips a false Active in favour of the column default, so an
+	// inactive campaign is deactivated right after it is created.
+	if err := db.Omit(clause.Associations).Create(&campaign).Error; err != nil {
+		return nil, err
+	}
+
+	if !campaign.Active {
+		if err := db.Model(&campaign).Update("active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &campaign, nil
+}
+
+// UpdatePromotionCampaign changes the given fields of a campaign. The code,
+// funding wallet and cashback rate of a campaign can not be changed, a new
+// campaign has to be created instead.
+func UpdatePromotionCampaign(db *gorm.DB, campaign *models.PromotionCampaign, req *models.PromotionCampaignUpdateRequest) error {
+	if req.Name != nil {
+		campaign.Name = *req.Name
+	}
+
+	if req.Description != nil {
+		campaign.Description = *req.Description
+	}
+
+	if req.MaxCashback != nil {
+		campaign.MaxCashback = utils.RoundAmount(*req.MaxCashback)
+	}
+
+	if req.MinAmount != nil {
+		campaign.MinAmount = utils.RoundAmount(*req.MinAmount)
+	}
+
+	if req.NewUsersOnly != nil {
+		campaign.NewUsersOnly = *req.NewUsersOnly
+	}
+
+	if req.Budget != nil {
+		campaign.Budget = utils.RoundAmount(*req.Budget)
+	}
+
+	if req.PerUserLimit != nil {
+		campaign.PerUserLimit = *req.PerUserLimit
+	}
+
+	if req.Active != nil {
+		campaign.Active = *req.Active
+	}
+
+	if req.StartsAt != nil {
+		campaign.StartsAt = req.StartsAt
+	}
+
+	if req.EndsAt != nil {
+		campaign.EndsAt = req.EndsAt
+	}
+
+	if err := validatePromotionCampaign(campaign); err != nil {
+		return err
+	}
+
+	// The budget is compared with the spent amount under lock, a redemption
+	// may be paid at the same time.
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current models.PromotionCampaign
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, "id = ?", campaign.ID.String()).Error; err != nil {
+			return err
+		}
+
+		if campaign.Budget < current.Spent {
+			return ErrPromotionBudgetSpent
+		}
+
+		campaign.Spent, campaign.Redemptions = current.Spent, current.Redemptions
+
+		return tx.Model(campaign).Updates(map[string]interface{}{
+			"name":           campaign.Name,
+			"description":    campaign.Description,
+			"max_cashback":   campaign.MaxCashback,
+			"min_amount":     campaign.MinAmount,
+			"new_users_only": campaign.NewUsersOnly,
+			"budget":         campaign.Budget,
+			"per_user_limit": campaign.PerUserLimit,
+			"active":         campaign.Active,
+			"starts_at":      campaign.StartsAt,
+			"ends_at":        campaign.EndsAt,
+			"updated_at":     time.Now(),
+		}).Error
+	})
+}
+
+func validatePromotionCampaign(campaign *models.PromotionCampaign) error {
+	if !campaign.EndsAt.After(*campaign.StartsAt) {
+		return ErrPromotionWindow
+	}
+
+	if campaign.CashbackType == models.CashbackTypePercentage && campaign.CashbackValue > 100 {
+		return ErrPromotionPercentage
+	}
+
+	return nil
+}
+
+// FindPromotionCampaign returns a campaign with its funding wallet.
+func FindPromotionCampaign(db *gorm.DB, id string) (*models.PromotionCampaign, error) {
+	var campaign models.PromotionCampaign
+	if err := db.Preload("FundingWallet").Where("id = ?", id).First(&campaign).Error; err != nil {
+		return nil, err
+	}
+
+	return &campaign, nil
+}
+
+// PromotionCampaignStats sums up the redemptions of a campaign and the
+// balance left in its funding wallet.
+func PromotionCampaignStats(db *gorm.DB, campaign *models.PromotionCampaign) (*models.PromotionStats, error) {
+	var stats models.PromotionStats
+	err := db.Model(&models.PromotionRedemption{}).
+		Select("count(*) as redemptions, count(distinct user_id) as unique_users, "+
+			"coalesce(sum(cashback), 0) as cashback_paid, coalesce(sum(amount), 0) as qualifying_total").
+		Where("campaign_id = ?", campaign.ID).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats.CashbackPaid = utils.RoundAmount(stats.CashbackPaid)
+	stats.QualifyingTotal = utils.RoundAmount(stats.QualifyingTotal)
+	stats.RemainingBudget = utils.RoundAmount(campaign.Budget - campaign.Spent)
+	stats.FundingBalance = campaign.FundingWallet.AvailableBalance()
+
+	return &stats, nil
+}
+
+// FindPromotionRedemptions returns the latest redemptions, of one campaign
+// or of one user when the other id is empty.
+func FindPromotionRedemptions(db *gorm.DB, campaignID string, userID string) ([]models.PromotionRedemption, error) {
+	query := db.Preload("Campaign").Preload("User").Preload("Transaction").Preload("CashbackTransaction")
+	if campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var redemptions []models.PromotionRedemption
+	if err := query.Order("created_at desc").Limit(100).Find(&redemptions).Error; err != nil {
+		return nil, err
+	}
+
+	return redemptions, nil
+}
+
+// CheckPromotion returns the campaign of a code and the cashback it would pay
+// the user on a transfer or payment of amount made now.
+func CheckPromotion(db *gorm.DB, userID *uuid.UUID, req *models.PromotionCheckRequest) (*models.PromotionCampaign, float64, error) {
+	var campaign models.PromotionCampaign
+	result := db.Where("code = ?", normalizePromotionCode(req.Code)).Limit(1).Find(&campaign)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, 0, ErrPromotionNotFound
+	}
+
+	cashback, err := promotionCashback(db, &campaign, userID, req.Currency, utils.RoundAmount(req.Amount), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &campaign, cashback, nil
+}
+
+// RedeemPromotion pays the cashback of a code for a transfer or payment the
+// user sent, from the funding wallet of the campaign to the wallet that paid.
+// The campaign is locked, so concurrent redemptions can never exceed its
+// budget.
+func RedeemPromotion(db *gorm.DB, userID *uuid.UUID, req *models.PromotionRedeemRequest) (*models.PromotionRedemption, error) {
+	var redemption models.PromotionRedemption
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var campaign models.PromotionCampaign
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", normalizePromotionCode(req.Code)).Limit(1).Find(&campaign)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrPromotionNotFound
+		}
+
+		var transaction models.Transaction
+		result = tx.Preload("FromWallet").Where("reference = ? and type in ?", req.Reference, promotionTransactionTypes).Limit(1).Find(&transaction)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 || transaction.FromWallet == nil || transaction.FromWallet.UserID == nil ||
+			transaction.FromWallet.UserID.String() != userID.String() {
+			return ErrPromotionTransaction
+		}
+
+		if transaction.Status != models.TransactionStatusCompleted {
+			return ErrPromotionRefunded
+		}
+
+		if transaction.CreatedAt.Before(*campaign.StartsAt) {
+			return ErrPromotionBefore
+		}
+
+		var count int64
+		if err := tx.Model(&models.PromotionRedemption{}).Where("transaction_id = ?", transaction.ID).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return ErrPromotionRedeemed
+		}
+
+		cashback, err := promotionCashback(tx, &campaign, userID, transaction.Currency, transaction.Amount, transaction.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		credit, err := Transfer(tx, TransferParams{
+			FromWalletID: campaign.FundingWalletID,
+			ToWalletID:   transaction.FromWalletID,
+			Amount:       cashback,
+			Type:         models.TransactionTypeCashback,
+			Reference:    utils.GenerateReference("CBK"),
+			Description:  "Cashback " + campaign.Name,
+		})
+		if err != nil {
+			if IsTransferError(err) {
+				log.Warn().Err(err).Str("campaign", campaign.ID.String()).Msg("Cashback could not be paid")
+
+				return ErrPromotionUnavailable
+			}
+
+			return err
+		}
+
+		redemption = models.PromotionRedemption{
+			CampaignID:            campaign.ID,
+			UserID:                userID,
+			TransactionID:         transaction.ID,
+			CashbackTransactionID: credit.ID,
+			Amount:                transaction.Amount,
+			Cashback:              cashback,
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&redemption).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&campaign).Updates(map[string]interface{}{
+			"spent":       gorm.Expr("spent + ?", cashback),
+			"redemptions": gorm.Expr("redemptions + 1"),
+			"updated_at":  time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := db.Preload("Campaign").Preload("User").Preload("Transaction").Preload("CashbackTransaction").First(&redemption, "id = ?", redemption.ID.String())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &redemption, nil
+}
+
+// promotionCashback checks that the user can redeem the campaign for a
+// transfer or payment and returns the cashback. before is when the
+// transaction was made, nil for a transaction that is not made yet.
+func promotionCashback(db *gorm.DB, campaign *models.PromotionCampaign, userID *uuid.UUID, currency string, amount float64, before *time.Time) (float64, error) {
+	now := time.Now()
+	if !campaign.Active || now.Before(*campaign.StartsAt) || !now.Before(*campaign.EndsAt) {
+		return 0, ErrPromotionInactive
+	}
+
+	if strings.ToUpper(currency) != campaign.Currency {
+		return 0, ErrPromotionCurrency
+	}
+
+	cashback := campaign.Cashback(amount)
+	if amount < campaign.MinAmount || cashback <= 0 {
+		return 0, ErrPromotionMinAmount
+	}
+
+	var count int64
+	err := db.Model(&models.PromotionRedemption{}).Where("campaign_id = ? and user_id = ?", campaign.ID, userID).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if count >= int64(campaign.PerUserLimit) {
+		return 0, ErrPromotionUserLimit
+	}
+
+	if campaign.NewUsersOnly {
+		query := db.Model(&models.Transaction{}).
+			Joins("join wallets on wallets.id = transactions.from_wallet_id").
+			Where("wallets.user_id = ? and transactions.type in ?", userID, promotionTransactionTypes)
+		if before != nil {
+			query = query.Where("transactions.created_at < ?", before)
+		}
+
+		if err := query.Count(&count).Error; err != nil {
+			return 0, err
+		}
+
+		if count > 0 {
+			return 0, ErrPromotionNewUsers
+		}
+	}
+
+	if utils.RoundAmount(campaign.Spent+cashback) > campaign.Budget {
+		return 0, ErrPromotionBudget
+	}
+
+	return cashback, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrHandleNotFound    = errors.New("No user was found with that handle")
+	ErrRecipientNoWallet = errors.New("The recipient can not receive payments in this currency")
+	ErrRecipientNotFound = errors.New("No wallet was found with that address")
+	ErrRecipientCurrency = errors.New("The recipient wallet uses a different currency")
+)
+
+// FindUserByHandle looks up a user by their current or a previous handle.
+func FindUserByHandle(db *gorm.DB, handle string) (*models.User, error) {
+	handle, err := utils.NormalizeHandle(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var alias models.UserHandleAlias
+	result := db.Preload("User").Where("handle = ?", handle).First(&alias)
+	if result.Error != nil {
+		if database.IsRecordNotFoundError(result.Error) {
+			return nil, ErrHandleNotFound
+		}
+
+		return nil, result.Error
+	}
+
+	return &alias.User, nil
+}
+
+// DefaultWallets returns the default receiving wallet of the user for every
+// currency they hold.
+func DefaultWallets(db *gorm.DB, userID string) ([]models.Wallet, error) {
+	var wallets []models.Wallet
+	result := db.Where("user_id = ? and is_default = ?", userID, true).Order("currency").Find(&wallets)
+
+	return wallets, result.Error
+}
+
+// ResolveRecipient turns a payment recipient, either a "@handle" or a wallet
+// address, into the wallet that should be credited. Payment flows should use
+// this instead of looking wallets up by address directly.
+func ResolveRecipient(db *gorm.DB, recipient string, currency string) (*models.Wallet, error) {
+	currency = strings.ToUpper(currency)
+
+	var wallet models.Wallet
+
+	if utils.IsHandle(recipient) {
+		user, err := FindUserByHandle(db, recipient)
+		if err != nil {
+			return nil, err
+		}
+
+		result := db.Preload("User").Where("user_id = ? and currency = ? and is_default = ?", user.ID.String(), currency, true).First(&wallet)
+		if result.Error != nil {
+			if database.IsRecordNotFoundError(result.Error) {
+				return nil, ErrRecipientNoWallet
+			}
+
+			return nil, result.Error
+		}
+
+		return &wallet, nil
+	}
+
+	address, err := utils.ValidateWalletAddress(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	result := db.Preload("User").Where("address = ?", address).First(&wallet)
+	if result.Error != nil {
+		if database.IsRecordNotFoundError(result.Error) {
+			return nil, ErrRecipientNotFound
+		}
+
+		return nil, result.Error
+	}
+
+	if currency != "" && wallet.Currency != currency {
+		return nil, ErrRecipientCurrency
+	}
+
+	return &wallet, nil
+}
+
+// EnsureDefaultWallet promotes the oldest wallet of the given currency to be
+// the default when the user has none, e.g. after the default was deleted.
+func EnsureDefaultWallet(db *gorm.DB, userID string, currency string) error {
+	var count int64
+	result := db.Model(&models.Wallet{}).Where("user_id = ? and currency = ? and is_default = ?", userID, currency, true).Count(&count)
+	if result.Error != nil || count > 0 {
+		return result.Error
+	}
+
+	var wallet models.Wallet
+	result = db.Where("user_id = ? and currency = ? and merchant_id is null", userID, currency).Order("created_at").First(&wallet)
+	if result.Error != nil {
+		if database.IsRecordNotFoundError(result.Error) {
+			return nil
+		}
+
+		return result.Error
+	}
+
+	return db.Model(&wallet).Update("is_default", true).Error
+}
+
+// IsRecipientError reports whether err means the recipient is invalid, as
+// opposed to a database failure.
+func IsRecipientError(err error) bool {
+	switch err {
+	case ErrHandleNotFound, ErrRecipientNoWallet, ErrRecipientNotFound, ErrRecipientCurrency, utils.ErrInvalidHandle,
+		utils.ErrWalletAddressEmpty, utils.ErrWalletAddressPrefix, utils.ErrWalletAddressLength,
+		utils.ErrWalletAddressCharacters, utils.ErrWalletAddressChecksum:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,593 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// reconciliationBatch is the number of wallets or settlement records
+	// compared per query.
+	reconciliationBatch = 500
+	// reconciliationTolerance absorbs floating point noise, amounts are
+	// compared in whole cents.
+	reconciliationTolerance = 0.005
+	// settlementMaxRecords is the largest settlement file that can be
+	// imported.
+	settlementMaxRecords = 100000
+	// SettlementMaxFileSize is the largest settlement upload in bytes.
+	SettlementMaxFileSize = 10 << 20
+)
+
+var (
+	ErrSettlementDate      = errors.New("settlement_date must be a date formatted as YYYY-MM-DD")
+	ErrSettlementFile      = errors.New("The settlement file is invalid")
+	ErrSettlementFileSize  = errors.New("Settlement files must be at most 10 MB")
+	ErrSettlementMissing   = errors.New("A settlement file is required")
+	ErrWalletAlreadyFrozen = errors.New("This wallet is already frozen")
+	ErrWalletNotFrozen     = errors.New("This wallet is not frozen")
+	ErrFreezeSystemWallet  = errors.New("System wallets can not be frozen")
+)
+
+// IsReconciliationError reports whether err is caused by the request.
+func IsReconciliationError(err error) bool {
+	if errors.Is(err, ErrSettlementFile) {
+		return true
+	}
+
+	switch err {
+	case ErrSettlementDate, ErrSettlementFileSize, ErrSettlementMissing, ErrWalletAlreadyFrozen, ErrWalletNotFrozen, ErrFreezeSystemWallet:
+		return true
+	}
+
+	return false
+}
+
+type reconciliationJobPayload struct {
+	RunID string `json:"run_id,omitempty"`
+}
+
+// StartReconciliation records a run and queues it. settlementFileID is only
+// set for the settlement scope.
+func StartReconciliation(db *gorm.DB, scope string, settlementFileID *uuid.UUID, freeze bool, triggeredByID *uuid.UUID) (*models.ReconciliationRun, error) {
+	run := models.ReconciliationRun{
+		Scope:            scope,
+		SettlementFileID: settlementFileID,
+		Status:           models.ReconciliationPending,
+		Freeze:           freeze,
+		TriggeredByID:    triggeredByID,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+
+		_, err := EnqueueJob(tx, models.JobKindReconciliationRun, reconciliationJobPayload{RunID: run.ID.String()}, JobOptions{MaxAttempts: 3})
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// ReconciliationJob runs a queued run. The daily scheduled job has no run,
+// it starts a run of every balance that freezes mismatched wallets when
+// freeze is set.
+func ReconciliationJob(db *gorm.DB, job *models.Job, freeze bool) error {
+	var payload reconciliationJobPayload
+	if err := job.DecodePayload(&payload); err != nil {
+		return err
+	}
+
+	if payload.RunID == "" {
+		_, err := StartReconciliation(db, models.ReconciliationScopeBalances, nil, freeze, nil)
+		return err
+	}
+
+	var run models.ReconciliationRun
+	result := db.Where("id = ?", payload.RunID).First(&run)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		return result.Error
+	}
+
+	if run.Status != models.ReconciliationPending && run.Status != models.ReconciliationRunning {
+		return nil
+	}
+
+	err := RunReconciliation(db, &run)
+	if err != nil && job.Attempts+1 >= job.MaxAttempts {
+		now := time.Now()
+		db.Model(&run).Updates(map[string]interface{}{
+			"status":      models.ReconciliationFailed,
+			"error":       err.Error(),
+			"finished_at": now,
+			"updated_at":  now,
+		})
+	}
+
+	return err
+}
+
+// RunReconciliation executes a run. Discrepancies of an earlier attempt of
+// the same run are replaced.
+func RunReconciliation(db *gorm.DB, run *models.ReconciliationRun) error {
+	now := time.Now()
+
+	result := db.Where("run_id = ?", run.ID).Delete(&models.ReconciliationDiscrepancy{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	run.Status, run.StartedAt = models.ReconciliationRunning, &now
+
+	result = db.Model(run).Updates(map[string]interface{}{"status": run.Status, "started_at": now, "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var err error
+	if run.Scope == models.ReconciliationScopeSettlement {
+		err = reconcileSettlement(db, run)
+	} else {
+		err = reconcileBalances(db, run)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	finished := time.Now()
+	run.Status, run.FinishedAt = models.ReconciliationCompleted, &finished
+
+	result = db.Model(run).Updates(map[string]interface{}{
+		"status":         run.Status,
+		"checked":        run.Checked,
+		"discrepancies":  run.Discrepancies,
+		"frozen_wallets": run.FrozenWallets,
+		"finished_at":    run.FinishedAt,
+		"updated_at":     finished,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	event := log.Info()
+	if run.Discrepancies > 0 {
+		event = log.Warn()
+	}
+
+	event.Str("run", run.ID.String()).Str("scope", run.Scope).Int("checked", run.Checked).
+		Int("discrepancies", run.Discrepancies).Int("frozen", run.FrozenWallets).Msg("Reconciliation completed")
+
+	return nil
+}
+
+type walletReconciliation struct {
+	ID            *uuid.UUID
+	Address       string
+	Currency      string
+	Balance       float64
+	SystemAccount string
+	FrozenAt      *time.Time
+	Ledger        float64
+	Received      float64
+	Sent          float64
+	Fees          float64
+}
+
+// reconcileBalances compares every wallet balance with the sum of its ledger
+// entries, and the ledger with the transactions the wallet sent and
+// received. Fee revenue wallets are credited with the fees of their currency.
+// Each batch is read with a single statement, so that it sees one snapshot
+// of balances, entries and transactions.
+func reconcileBalances(db *gorm.DB, run *models.ReconciliationRun) error {
+	var lastID *uuid.UUID
+
+	for {
+		var rows []walletReconciliation
+
+		query := db.Table("wallets w").Select(`w.id, w.address, w.currency, w.balance, w.system_account, w.frozen_at,
+			(select coalesce(sum(le.amount), 0) from ledger_entries le where le.wallet_id = w.id) as ledger,
+			(select coalesce(sum(case when t.fee_paid_by = ? then t.amount - t.fee else t.amount end), 0) from transactions t where t.to_wallet_id = w.id) as received,
+			(select coalesce(sum(case when t.fee_paid_by = ? then t.amount + t.fee else t.amount end), 0) from transactions t where t.from_wallet_id = w.id) as sent,
+			(select coalesce(sum(t.fee), 0) from transactions t where w.system_account = ? and t.currency = w.currency and t.fee > 0) as fees`,
+			models.FeePaidByReceiver, models.FeePaidBySender, models.SystemAccountFeeRevenue).
+			Order("w.id").Limit(reconciliationBatch)
+
+		if lastID != nil {
+			query = query.Where("w.id > ?", lastID)
+		}
+
+		if err := query.Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for i := range rows {
+			if err := reconcileWallet(db, run, &rows[i]); err != nil {
+				return err
+			}
+		}
+
+		run.Checked += len(rows)
+
+		if len(rows) < reconciliationBatch {
+			return nil
+		}
+
+		lastID = rows[len(rows)-1].ID
+	}
+}
+
+func reconcileWallet(db *gorm.DB, run *models.ReconciliationRun, row *walletReconciliation) error {
+	ledger := utils.RoundAmount(row.Ledger)
+	fromTransactions := utils.RoundAmount(row.Received - row.Sent + row.Fees)
+
+	if math.Abs(ledger-row.Balance) >= reconciliationTolerance {
+		err := addWalletDiscrepancy(db, run, row, models.DiscrepancyBalanceLedger, ledger, row.Balance,
+			"The stored balance does not match the sum of the ledger entries")
+		if err != nil {
+			return err
+		}
+	}
+
+	if math.Abs(fromTransactions-ledger) >= reconciliationTolerance {
+		err := addWalletDiscrepancy(db, run, row, models.DiscrepancyLedgerTransactions, fromTransactions, ledger,
+			"The ledger entries do not match the transactions of the wallet")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addWalletDiscrepancy records a mismatch and freezes the wallet when the run
+// asks for it. System wallets are never frozen, that would stop every
+// transfer that is charged a fee.
+func addWalletDiscrepancy(db *gorm.DB, run *models.ReconciliationRun, row *walletReconciliation, kind string, expected float64, actual float64, detail string) error {
+	discrepancy := models.ReconciliationDiscrepancy{
+		RunID:      run.ID,
+		Kind:       kind,
+		WalletID:   row.ID,
+		Address:    row.Address,
+		Currency:   row.Currency,
+		Expected:   expected,
+		Actual:     actual,
+		Difference: utils.RoundAmount(actual - expected),
+		Detail:     detail,
+	}
+
+	if run.Freeze && row.SystemAccount == "" && row.FrozenAt == nil {
+		now := time.Now()
+		result := db.Model(&models.Wallet{}).Where("id = ? and frozen_at is null", row.ID).Updates(map[string]interface{}{
+			"frozen_at":     now,
+			"frozen_reason": "Reconciliation run " + run.ID.String() + ": " + detail,
+			"updated_at":    now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			row.FrozenAt = &now
+			discrepancy.Frozen = true
+			run.FrozenWallets++
+		}
+	}
+
+	if err := db.Create(&discrepancy).Error; err != nil {
+		return err
+	}
+
+	run.Discrepancies++
+
+	return nil
+}
+
+// reconcileSettlement compares the records of a settlement file with the
+// transactions they reference. When the file covers a transaction type, the
+// transactions of that type and day missing from the file are reported too.
+func reconcileSettlement(db *gorm.DB, run *models.ReconciliationRun) error {
+	var file models.SettlementFile
+	if err := db.Where("id = ?", run.SettlementFileID).First(&file).Error; err != nil {
+		return err
+	}
+
+	var records []models.SettlementRecord
+	result := db.Where("file_id = ?", file.ID).FindInBatches(&records, reconciliationBatch, func(tx *gorm.DB, batch int) error {
+		references := make([]string, 0, len(records))
+		for _, record := range records {
+			references = append(references, record.Reference)
+		}
+
+		var transactions []models.Transaction
+		if err := db.Where("reference in ?", references).Find(&transactions).Error; err != nil {
+			return err
+		}
+
+		byReference := make(map[string]*models.Transaction, len(transactions))
+		for i := range transactions {
+			byReference[transactions[i].Reference] = &transactions[i]
+		}
+
+		for _, record := range records {
+			discrepancy := models.ReconciliationDiscrepancy{
+				RunID:     run.ID,
+				Reference: record.Reference,
+				Currency:  record.Currency,
+				Expected:  record.Amount,
+			}
+
+			transaction, ok := byReference[record.Reference]
+			switch {
+			case !ok:
+				discrepancy.Kind = models.DiscrepancySettlementUnknown
+				discrepancy.Difference = utils.RoundAmount(-record.Amount)
+				discrepancy.Detail = fmt.Sprintf("Line %d has no matching transaction", record.Line)
+			case !strings.EqualFold(transaction.Currency, record.Currency):
+				discrepancy.Kind = models.DiscrepancySettlementAmount
+				discrepancy.Actual = transaction.Amount
+				discrepancy.Detail = fmt.Sprintf("Line %d is in %s, the transaction is in %s", record.Line, record.Currency, transaction.Currency)
+			case math.Abs(transaction.Amount-record.Amount) >= reconciliationTolerance:
+				discrepancy.Kind = models.DiscrepancySettlementAmount
+				discrepancy.Actual = transaction.Amount
+				discrepancy.Difference = utils.RoundAmount(transaction.Amount - record.Amount)
+				discrepancy.Detail = fmt.Sprintf("Line %d does not match the amount of the transaction", record.Line)
+			default:
+				continue
+			}
+
+			if err := db.Create(&discrepancy).Error; err != nil {
+				return err
+			}
+
+			run.Discrepancies++
+		}
+
+		run.Checked += len(records)
+
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if file.TransactionType == "" {
+		return nil
+	}
+
+	from := time.Date(file.SettlementDate.Year(), file.SettlementDate.Month(), file.SettlementDate.Day(), 0, 0, 0, 0, time.Local)
+
+	var missing []models.Transaction
+	result = db.Where("type = ? and created_at >= ? and created_at < ?", file.TransactionType, from, from.AddDate(0, 0, 1)).
+		Where("reference not in (?)", db.Model(&models.SettlementRecord{}).Select("reference").Where("file_id = ?", file.ID)).
+		Order("created_at").Find(&missing)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, transaction := range missing {
+		discrepancy := models.ReconciliationDiscrepancy{
+			RunID:      run.ID,
+			Kind:       models.DiscrepancySettlementMissing,
+			Reference:  transaction.Reference,
+			Currency:   transaction.Currency,
+			Actual:     transaction.Amount,
+			Difference: transaction.Amount,
+			Detail:     "The transaction is not in the settlement file",
+		}
+
+		if err := db.Create(&discrepancy).Error; err != nil {
+			return err
+		}
+
+		run.Discrepancies++
+	}
+
+	return nil
+}
+
+// ImportSettlementFile stores a settlement CSV with a reference, amount and
+// currency column and starts its reconciliation.
+func ImportSettlementFile(db *gorm.DB, req *models.SettlementImportRequest, filename string, content []byte, uploadedByID *uuid.UUID) (*models.SettlementFile, *models.ReconciliationRun, error) {
+	settlementDate, err := time.Parse("2006-01-02", req.SettlementDate)
+	if err != nil {
+		return nil, nil, ErrSettlementDate
+	}
+
+	records, err := parseSettlementCSV(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := models.SettlementFile{
+		Provider:        req.Provider,
+		SettlementDate:  settlementDate,
+		TransactionType: req.TransactionType,
+		Filename:        filename,
+		RecordCount:     len(records),
+		UploadedByID:    uploadedByID,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Records").Create(&file).Error; err != nil {
+			return err
+		}
+
+		for i := range records {
+			records[i].FileID = file.ID
+		}
+
+		if len(records) > 0 {
+			if err := tx.CreateInBatches(&records, reconciliationBatch).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run, err := StartReconciliation(db, models.ReconciliationScopeSettlement, file.ID, false, uploadedByID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &file, run, nil
+}
+
+func parseSettlementCSV(content []byte) ([]models.SettlementRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: the header can not be read", ErrSettlementFile)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	for _, column := range []string{"reference", "amount", "currency"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("%w: the %s column is missing", ErrSettlementFile, column)
+		}
+	}
+
+	field := func(row []string, column string) string {
+		if i := columns[column]; i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+
+		return ""
+	}
+
+	records := []models.SettlementRecord{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: line %d can not be read", ErrSettlementFile, line)
+		}
+
+		record := models.SettlementRecord{
+			Line:      line,
+			Reference: field(row, "reference"),
+			Currency:  strings.ToUpper(field(row, "currency")),
+		}
+
+		if record.Reference == "" || len(record.Reference) > 64 {
+			return nil, fmt.Errorf("%w: line %d has an invalid reference", ErrSettlementFile, line)
+		}
+
+		amount, err := strconv.ParseFloat(field(row, "amount"), 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("%w: line %d has an invalid amount", ErrSettlementFile, line)
+		}
+
+		if !utils.ValidWalletCurrency(record.Currency) {
+			return nil, fmt.Errorf("%w: line %d has an unsupported currency", ErrSettlementFile, line)
+		}
+
+		record.Amount = utils.RoundAmount(amount)
+		records = append(records, record)
+
+		if len(records) > settlementMaxRecords {
+			return nil, fmt.Errorf("%w: a file can have at most %d records", ErrSettlementFile, settlementMaxRecords)
+		}
+	}
+
+	return records, nil
+}
+
+// FindReconciliationRun returns a run with its discrepancies.
+func FindReconciliationRun(db *gorm.DB, id string) (*models.ReconciliationRun, error) {
+	var run models.ReconciliationRun
+	result := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).Where("id = ?", id).First(&run)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &run, nil
+}
+
+// FreezeWallet stops a wallet from sending or receiving transfers.
+func FreezeWallet(db *gorm.DB, address string, reason string) (*models.Wallet, error) {
+	wallet, err := FindWalletByAddress(db, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if wallet.SystemAccount != "" {
+		return nil, ErrFreezeSystemWallet
+	}
+
+	now := time.Now()
+	result := db.Model(wallet).Where("frozen_at is null").Updates(map[string]interface{}{
+		"frozen_at":     now,
+		"frozen_reason": reason,
+		"updated_at":    now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrWalletAlreadyFrozen
+	}
+
+	return FindWalletByAddress(db, address)
+}
+
+// UnfreezeWallet lets a frozen wallet make transfers again.
+func UnfreezeWallet(db *gorm.DB, address string) (*models.Wallet, error) {
+	wallet, err := FindWalletByAddress(db, address)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := db.Model(wallet).Where("frozen_at is not null").Updates(map[string]interface{}{
+		"frozen_at":     nil,
+		"frozen_reason": "",
+		"updated_at":    now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrWalletNotFrozen
+	}
+
+	return FindWalletByAddress(db, address)
+}
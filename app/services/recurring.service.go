@@ -0,0 +1,281 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/cron"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRecurringTime     = errors.New("Time must be formatted as HH:MM")
+	ErrRecurringTimezone = errors.New("Unknown timezone, use an IANA name such as Asia/Jakarta")
+	ErrRecurringCron     = errors.New("Cron must be a valid five field cron expression")
+	ErrRecurringEnded    = errors.New("The schedule has no occurrences left")
+	ErrRecurringStatus   = errors.New("Completed or cancelled recurring transfers can not be changed")
+)
+
+// RecurringSchedule turns a schedule request into the cron expression and
+// timezone a recurring transfer is stored with.
+func RecurringSchedule(req *models.RecurringTransferScheduleRequest) (string, string, error) {
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return "", "", ErrRecurringTimezone
+	}
+
+	at := "00:00"
+	if req.Time != "" {
+		at = req.Time
+	}
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return "", "", ErrRecurringTime
+	}
+
+	var expr string
+	switch req.Frequency {
+	case models.RecurringFrequencyDaily:
+		expr = fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour())
+	case models.RecurringFrequencyWeekly:
+		expr = fmt.Sprintf("%d %d * * %d", t.Minute(), t.Hour(), req.DayOfWeek)
+	case models.RecurringFrequencyMonthly:
+		day := req.DayOfMonth
+		if day == 0 {
+			day = 1
+		}
+
+		expr = fmt.Sprintf("%d %d %d * *", t.Minute(), t.Hour(), day)
+	default:
+		expr = strings.TrimSpace(req.Cron)
+	}
+
+	if _, err := cron.Parse(expr); err != nil {
+		return "", "", ErrRecurringCron
+	}
+
+	return expr, timezone, nil
+}
+
+// NextRecurringRun returns the first occurrence of the rule after the given
+// time, or nil when the rule has ended by date or by number of occurrences.
+func NextRecurringRun(rule *models.RecurringTransfer, after time.Time) *time.Time {
+	if rule.MaxOccurrences > 0 && rule.Occurrences >= rule.MaxOccurrences {
+		return nil
+	}
+
+	schedule, err := cron.Parse(rule.Cron)
+	if err != nil {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		return nil
+	}
+
+	// The start time itself is a valid occurrence.
+	if start := rule.StartAt.Add(-time.Minute); start.After(after) {
+		after = start
+	}
+
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() || (rule.EndAt != nil && next.After(*rule.EndAt)) {
+		return nil
+	}
+
+	return &next
+}
+
+type recurringJobPayload struct {
+	ID           string    `json:"id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// DispatchRecurringTransfers enqueues a job for every active rule whose next
+// occurrence is due and moves the rule to its following occurrence.
+// Occurrences missed while the scheduler was not running are not caught up,
+// only the oldest due one is executed.
+func DispatchRecurringTransfers(db *gorm.DB, limit int) (int, error) {
+	dispatched := 0
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rules []models.RecurringTransfer
+
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? and next_run_at <= ?", models.RecurringStatusActive, now).
+			Order("next_run_at").Limit(limit).Find(&rules)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for i := range rules {
+			rule := &rules[i]
+			scheduledFor := rule.NextRunAt.UTC()
+
+			_, err := EnqueueJob(tx, models.JobKindRecurringExecute, recurringJobPayload{
+				ID:           rule.ID.String(),
+				ScheduledFor: scheduledFor,
+			}, JobOptions{
+				UniqueKey: fmt.Sprintf("recurring-transfer:%s:%d", rule.ID.String(), scheduledFor.Unix()),
+			})
+			if err != nil {
+				return err
+			}
+
+			rule.Occurrences++
+			updates := map[string]interface{}{
+				"occurrences": rule.Occurrences,
+				"last_run_at": scheduledFor,
+				"next_run_at": NextRecurringRun(rule, now),
+				"updated_at":  now,
+			}
+
+			if updates["next_run_at"].(*time.Time) == nil {
+				updates["status"] = models.RecurringStatusCompleted
+			}
+
+			if err := tx.Model(rule).Updates(updates).Error; err != nil {
+				return err
+			}
+
+			dispatched++
+		}
+
+		return nil
+	})
+
+	return dispatched, err
+}
+
+// ExecuteRecurringJob runs the occurrence described by a dispatched job.
+func ExecuteRecurringJob(db *gorm.DB, job *models.Job) error {
+	var payload recurringJobPayload
+	if err := job.DecodePayload(&payload); err != nil {
+		return err
+	}
+
+	return ExecuteRecurringTransfer(db, payload.ID, payload.ScheduledFor)
+}
+
+// ExecuteRecurringTransfer makes the transfer of one occurrence. It is safe to
+// call more than once for the same occurrence: the run is recorded in the same
+// transaction as the transfer and a recorded occurrence is skipped. Business
+// failures such as insufficient funds are recorded as failed runs and
+// notified with a recurring_transfer.failed event instead of being retried.
+func ExecuteRecurringTransfer(db *gorm.DB, id string, scheduledFor time.Time) error {
+	return transactionWithRisk(db, func(tx *gorm.DB) error {
+		var rule models.RecurringTransfer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Wallet").First(&rule, "id = ?", id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		if rule.Status == models.RecurringStatusCancelled || rule.Status == models.RecurringStatusPaused {
+			return nil
+		}
+
+		var count int64
+		err = tx.Model(&models.RecurringTransferRun{}).
+			Where("recurring_transfer_id = ? and scheduled_for = ?", id, scheduledFor).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+
+		run := models.RecurringTransferRun{
+			RecurringTransferID: rule.ID,
+			ScheduledFor:        &scheduledFor,
+			Status:              models.RecurringRunSucceeded,
+		}
+
+		transaction, err := executeRecurringTransfer(tx, &rule, scheduledFor)
+		switch {
+		case err == nil:
+			run.TransactionID = transaction.ID
+		case IsTransferError(err) || IsRecipientError(err):
+			run.Status = models.RecurringRunFailed
+			run.Error = err.Error()
+		default:
+			return err
+		}
+
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+
+		if run.Status == models.RecurringRunSucceeded {
+			return nil
+		}
+
+		return PublishEvent(tx, rule.UserID, nil, models.EventRecurringFailed, models.RecurringFailedEventData{
+			ID:           rule.ID,
+			Wallet:       rule.Wallet.Address,
+			Recipient:    rule.Recipient,
+			Amount:       rule.Amount,
+			Currency:     rule.Currency,
+			ScheduledFor: &scheduledFor,
+			Reason:       run.Error,
+		})
+	})
+}
+
+func executeRecurringTransfer(tx *gorm.DB, rule *models.RecurringTransfer, scheduledFor time.Time) (*models.Transaction, error) {
+	// An approval policy set after the rule was created fails the runs it
+	// applies to, nobody is around to approve a scheduled transfer.
+	if err := CheckPaymentApproval(tx, rule.WalletID, rule.Amount); err != nil {
+		return nil, err
+	}
+
+	to, err := ResolveRecipient(tx, rule.Recipient, rule.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	description := rule.Description
+	if description == "" {
+		description = "Recurring transfer to " + rule.Recipient
+	}
+
+	return Transfer(tx, TransferParams{
+		FromWalletID:  rule.WalletID,
+		ToWalletID:    to.ID,
+		Amount:        rule.Amount,
+		Reference:     recurringReference(rule.ID, scheduledFor),
+		Description:   description,
+		InitiatedByID: rule.UserID,
+	})
+}
+
+// recurringReference is the same for every attempt of an occurrence, so the
+// unique transaction reference guards against paying an occurrence twice.
+func recurringReference(id *uuid.UUID, scheduledFor time.Time) string {
+	return fmt.Sprintf("RCR%s%d", strings.ToUpper(strings.ReplaceAll(id.String(), "-", "")), scheduledFor.Unix())
+}
+
+// FindWalletRecurringTransfer returns a recurring transfer of the wallet,
+// whichever member of the wallet created it.
+func FindWalletRecurringTransfer(db *gorm.DB, walletID string, id string) (*models.RecurringTransfer, error) {
+	var rule models.RecurringTransfer
+	result := db.Preload("Wallet").Where("wallet_id = ? and id = ?", walletID, id).First(&rule)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &rule, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefundNotAllowed   = errors.New("Only completed transfers, payments and payouts can be refunded")
+	ErrRefundAmount       = errors.New("The refund exceeds the amount that has not been refunded yet")
+	ErrRefundWalletClosed = errors.New("One of the wallets of the original transaction no longer exists")
+	ErrReversalReasonCode = errors.New("A valid reason code is required to reverse a transaction")
+)
+
+// IsRefundError reports whether err is caused by the state of the original
+// transaction or by the refund itself, as opposed to a database failure.
+func IsRefundError(err error) bool {
+	switch err {
+	case ErrRefundNotAllowed, ErrRefundAmount, ErrRefundWalletClosed, ErrReversalReasonCode:
+		return true
+	}
+
+	return IsTransferError(err)
+}
+
+func preloadTransaction(db *gorm.DB) *gorm.DB {
+	return db.Preload("FromWallet").Preload("ToWallet")
+}
+
+// FindWalletTransaction returns a transaction by reference in which the wallet
+// is either the sender or the receiver.
+func FindWalletTransaction(db *gorm.DB, walletID string, reference string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	err := preloadTransaction(db).
+		Where("reference = ? and (from_wallet_id = ? or to_wallet_id = ?)", reference, walletID, walletID).
+		First(&transaction).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+// FindTransaction returns a transaction by reference.
+func FindTransaction(db *gorm.DB, reference string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := preloadTransaction(db).Where("reference = ?", reference).First(&transaction).Error; err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+// FindTransactionRefunds returns the refunds and reversals posted against a
+// transaction, oldest first.
+func FindTransactionRefunds(db *gorm.DB, transactionID string) ([]models.Transaction, error) {
+	var refunds []models.Transaction
+	err := preloadTransaction(db).
+		Where("original_transaction_id = ?", transactionID).
+		Order("created_at asc").
+		Find(&refunds).Error
+
+	return refunds, err
+}
+
+// RefundParams describes a refund or reversal of a completed transaction. An
+// Amount of zero refunds everything that has not been refunded yet.
+type RefundParams struct {
+	TransactionID *uuid.UUID
+	Type          string
+	Amount        float64
+	Description   string
+	ReasonCode    string
+	InitiatedByID *uuid.UUID
+}
+
+// RefundTransaction moves money back from the receiver to the sender of the
+// original transaction. The original is locked, so concurrent refunds can
+// never exceed its amount together, and it is only ever updated to record the
+// refunded total, the balances are corrected by a new posting.
+func RefundTransaction(db *gorm.DB, params RefundParams) (*models.Transaction, error) {
+	if params.Type == "" {
+		params.Type = models.TransactionTypeRefund
+	}
+
+	if params.Type == models.TransactionTypeReversal && !validReversalReasonCode(params.ReasonCode) {
+		return nil, ErrReversalReasonCode
+	}
+
+	var refund *models.Transaction
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var original models.Transaction
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", params.TransactionID).First(&original)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if original.Type != models.TransactionTypeTransfer && original.Type != models.TransactionTypePayment &&
+			original.Type != models.TransactionTypePayout {
+			return ErrRefundNotAllowed
+		}
+
+		if original.Status != models.TransactionStatusCompleted && original.Status != models.TransactionStatusPartiallyRefunded {
+			return ErrRefundNotAllowed
+		}
+
+		if original.FromWalletID == nil || original.ToWalletID == nil {
+			return ErrRefundWalletClosed
+		}
+
+		remaining := utils.RoundAmount(original.Amount - original.RefundedAmount)
+
+		amount := utils.RoundAmount(params.Amount)
+		if amount == 0 {
+			amount = remaining
+		}
+
+		if amount > remaining {
+			return ErrRefundAmount
+		}
+
+		description := params.Description
+		if description == "" {
+			description = "Refund of " + original.Reference
+			if params.Type == models.TransactionTypeReversal {
+				description = "Reversal of " + original.Reference
+			}
+		}
+
+		transaction, err := Transfer(tx, TransferParams{
+			FromWalletID:          original.ToWalletID,
+			ToWalletID:            original.FromWalletID,
+			Amount:                amount,
+			Type:                  params.Type,
+			Reference:             utils.GenerateReference("RFD"),
+			Description:           description,
+			OriginalTransactionID: original.ID,
+			ReasonCode:            params.ReasonCode,
+			InitiatedByID:         params.InitiatedByID,
+		})
+		if err != nil {
+			return err
+		}
+
+		refunded := utils.RoundAmount(original.RefundedAmount + amount)
+
+		// A partial reversal leaves the original partially refunded, only
+		// the reversal that returns the last of the amount reverses it.
+		status := models.TransactionStatusPartiallyRefunded
+		if refunded >= original.Amount {
+			status = models.TransactionStatusRefunded
+			if params.Type == models.TransactionTypeReversal {
+				status = models.TransactionStatusReversed
+			}
+		}
+
+		result = tx.Model(&original).Updates(map[string]interface{}{
+			"refunded_amount": refunded,
+			"status":          status,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		refund = transaction
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+func validReversalReasonCode(code string) bool {
+	for _, v := range models.ReversalReasonCodes {
+		if v == code {
+			return true
+		}
+	}
+
+	return false
+}
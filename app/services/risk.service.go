@@ -0,0 +1,555 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/risk"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// riskApprovalWindow is how long the sender has to retry a transaction
+	// after its review was approved when it could not be made out of the
+	// hold.
+	riskApprovalWindow = 24 * time.Hour
+
+	// riskReviewHoldWindow is how long the funds of a held transaction stay
+	// reserved while it waits for review.
+	riskReviewHoldWindow = 72 * time.Hour
+)
+
+var (
+	ErrRiskBlocked          = errors.New("This transaction was blocked by our fraud checks, please contact support")
+	ErrRiskReview           = errors.New("This transaction has been held for review, the amount is reserved until then and you will be notified once it has been reviewed")
+	ErrRiskReviewNotPending = errors.New("This review has already been decided")
+)
+
+var riskRules = struct {
+	sync.RWMutex
+	rules  []risk.Rule
+	source string
+}{rules: risk.DefaultRules(), source: "default"}
+
+// LoadRiskRules replaces the risk rules by the rules of the JSON file at path,
+// or by the default rules when path is empty. The current rules are kept when
+// the file is invalid.
+func LoadRiskRules(path string) error {
+	rules, source := risk.DefaultRules(), "default"
+
+	if path != "" {
+		loaded, err := risk.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rules, source = loaded, path
+	}
+
+	riskRules.Lock()
+	riskRules.rules, riskRules.source = rules, source
+	riskRules.Unlock()
+
+	log.Info().Str("source", source).Int("rules", len(rules)).Msg("Risk rules loaded")
+
+	return nil
+}
+
+// CurrentRiskRules returns the rules in use and where they were loaded from.
+func CurrentRiskRules() ([]risk.Rule, string) {
+	riskRules.RLock()
+	defer riskRules.RUnlock()
+
+	return riskRules.rules, riskRules.source
+}
+
+// riskScreenedTypes are the transactions the risk rules evaluate and count in
+// the history of the sender. Payouts are left out: a batch pays many new
+// recipients at once by design, the velocity and new recipient rules would
+// hold or block most of its items.
+var riskScreenedTypes = []string{models.TransactionTypeTransfer, models.TransactionTypePayment}
+
+func riskScreened(transactionType string) bool {
+	for _, t := range riskScreenedTypes {
+		if t == transactionType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type requestDeviceKey struct{}
+
+// WithRequestDevice attaches the device of a request to ctx. Transfers made
+// with a database session carrying this context are evaluated against the
+// device rules, transfers without one, such as scheduled transfers, are not.
+func WithRequestDevice(ctx context.Context, device models.RequestDevice) context.Context {
+	return context.WithValue(ctx, requestDeviceKey{}, device)
+}
+
+func requestDevice(ctx context.Context) (models.RequestDevice, bool) {
+	if ctx == nil {
+		return models.RequestDevice{}, false
+	}
+
+	device, ok := ctx.Value(requestDeviceKey{}).(models.RequestDevice)
+
+	return device, ok && device.ID != ""
+}
+
+// riskStats answers the questions of the risk rules from the transactions of
+// the sender in one currency.
+type riskStats struct {
+	db         *gorm.DB
+	userID     *uuid.UUID
+	currency   string
+	toWalletID *uuid.UUID
+	ownWallet  bool
+	device     *models.RequestDevice
+	now        time.Time
+}
+
+func (s *riskStats) outgoing() *gorm.DB {
+	return s.db.Table("transactions").
+		Joins("join wallets on wallets.id = transactions.from_wallet_id").
+		Where("wallets.user_id = ? and transactions.currency = ?", s.userID, s.currency).
+		Where("transactions.type in ?", riskScreenedTypes)
+}
+
+func (s *riskStats) Outgoing(window time.Duration) (int, float64, error) {
+	var row struct {
+		Count int
+		Total float64
+	}
+
+	result := s.outgoing().
+		Select("count(*) as count, coalesce(sum(transactions.amount), 0) as total").
+		Where("transactions.created_at >= ?", s.now.Add(-window)).
+		Scan(&row)
+
+	return row.Count, row.Total, result.Error
+}
+
+func (s *riskStats) NewRecipients(window time.Duration) (int, bool, error) {
+	if s.ownWallet {
+		return 0, false, nil
+	}
+
+	var paid int64
+	if err := s.outgoing().Where("transactions.to_wallet_id = ?", s.toWalletID).Count(&paid).Error; err != nil {
+		return 0, false, err
+	}
+
+	if paid > 0 {
+		return 0, false, nil
+	}
+
+	var count int64
+	result := s.db.Table("(?) as recipients", s.outgoing().
+		Select("transactions.to_wallet_id").
+		Joins("join wallets recipients on recipients.id = transactions.to_wallet_id").
+		Where("recipients.user_id is distinct from ?", s.userID).
+		Group("transactions.to_wallet_id").
+		Having("min(transactions.created_at) >= ?", s.now.Add(-window)),
+	).Count(&count)
+
+	return int(count), true, result.Error
+}
+
+func (s *riskStats) Device() (time.Time, bool, error) {
+	if s.device == nil {
+		return time.Time{}, false, nil
+	}
+
+	var device models.UserDevice
+	result := s.db.Where("user_id = ? and device_id = ?", s.userID, s.device.ID).First(&device)
+	if database.IsRecordNotFoundError(result.Error) {
+		return s.now, true, nil
+	} else if result.Error != nil {
+		return time.Time{}, false, result.Error
+	}
+
+	return device.FirstSeenAt, true, nil
+}
+
+// riskDecision is a transaction the risk rules blocked or held for review.
+// It is recorded by recordRiskDecision once the transfer was rolled back.
+type riskDecision struct {
+	evaluation models.RiskEvaluation
+	device     *models.RequestDevice
+	review     *models.RiskReview
+	holdAmount float64
+	now        time.Time
+}
+
+// evaluateTransferRisk runs the risk rules before a transfer or payment from
+// a user's wallet is posted. Allowed transactions are logged within the
+// transfer. When the transaction is blocked or held, the decision is returned
+// with ErrRiskBlocked or ErrRiskReview instead, so that it is recorded after
+// the transfer is rolled back rather than lost with it. Transactions made for
+// an approved review are not evaluated again.
+func evaluateTransferRisk(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet, to *models.Wallet, reviewID *uuid.UUID) (*riskDecision, error) {
+	if !riskScreened(transaction.Type) || reviewID != nil {
+		return nil, nil
+	}
+
+	if from.UserID == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+
+	stats := &riskStats{
+		db:         tx,
+		userID:     from.UserID,
+		currency:   transaction.Currency,
+		toWalletID: to.ID,
+		ownWallet:  to.UserID != nil && to.UserID.String() == from.UserID.String(),
+		now:        now,
+	}
+
+	device, hasDevice := requestDevice(tx.Statement.Context)
+	if hasDevice {
+		stats.device = &device
+	}
+
+	rules, _ := CurrentRiskRules()
+
+	result, err := risk.Evaluate(rules, transaction.Currency, transaction.Amount, stats, now)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := json.Marshal(result.Hits)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := &riskDecision{
+		evaluation: models.RiskEvaluation{
+			UserID:       from.UserID,
+			FromWalletID: from.ID,
+			ToWalletID:   to.ID,
+			Reference:    transaction.Reference,
+			Type:         transaction.Type,
+			Amount:       transaction.Amount,
+			Currency:     transaction.Currency,
+			DeviceID:     device.ID,
+			IP:           device.IP,
+			Outcome:      result.Outcome,
+			Hits:         string(hits),
+		},
+		now: now,
+	}
+
+	if hasDevice {
+		decision.device = &device
+	}
+
+	switch result.Outcome {
+	case risk.OutcomeBlock:
+		return decision, ErrRiskBlocked
+	case risk.OutcomeReview:
+		approved, err := useApprovedRiskReview(tx, transaction, from, to, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if !approved {
+			decision.review = &models.RiskReview{
+				UserID:        from.UserID,
+				FromWalletID:  from.ID,
+				ToWalletID:    to.ID,
+				FromAddress:   from.Address,
+				ToAddress:     to.Address,
+				Type:          transaction.Type,
+				Amount:        transaction.Amount,
+				Currency:      transaction.Currency,
+				Description:   transaction.Description,
+				Reference:     transaction.Reference,
+				InitiatedByID: transaction.InitiatedByID,
+				Hits:          string(hits),
+				Status:        models.RiskReviewPending,
+			}
+			decision.holdAmount = transaction.DebitAmount()
+
+			return decision, ErrRiskReview
+		}
+	}
+
+	return nil, logRiskEvaluation(tx, decision)
+}
+
+// logRiskEvaluation saves the evaluation of a decision and remembers the
+// device it was made from.
+func logRiskEvaluation(db *gorm.DB, decision *riskDecision) error {
+	if err := db.Create(&decision.evaluation).Error; err != nil {
+		return err
+	}
+
+	if decision.device != nil {
+		return touchUserDevice(db, decision.evaluation.UserID, decision.device, decision.now)
+	}
+
+	return nil
+}
+
+// recordRiskDecision saves a blocked or held transaction after its transfer
+// was rolled back. A held transaction reserves what it would have debited
+// until its review is decided.
+func recordRiskDecision(db *gorm.DB, decision *riskDecision) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := logRiskEvaluation(tx, decision); err != nil {
+			return err
+		}
+
+		review := decision.review
+		if review == nil {
+			return nil
+		}
+
+		reason := "Held for review"
+		if review.Description != "" {
+			reason += ": " + review.Description
+		}
+
+		hold, err := PlaceHold(tx, review.FromWalletID, decision.holdAmount, reason, decision.now.Add(riskReviewHoldWindow))
+		if err != nil {
+			return err
+		}
+
+		review.EvaluationID, review.HoldID, review.Hold = decision.evaluation.ID, hold.ID, hold
+
+		if err := tx.Omit(clause.Associations).Create(review).Error; err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, review.UserID, nil, models.EventRiskReviewCreated, models.RiskReviewFilterRecord(review))
+	})
+}
+
+type pendingRiskKey struct{}
+
+// pendingRisk collects the decisions of transfers made inside a transaction
+// started by transactionWithRisk.
+type pendingRisk struct {
+	decisions []*riskDecision
+}
+
+// transactionWithRisk runs fn in a transaction like db.Transaction. Transfers
+// made by fn that are blocked or held for review are recorded once the
+// transaction has ended, so they are kept when fn returns their error and
+// the transaction is rolled back. A nested call joins the outermost one.
+func transactionWithRisk(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if _, ok := ctx.Value(pendingRiskKey{}).(*pendingRisk); ok {
+		return db.Transaction(fn)
+	}
+
+	pending := &pendingRisk{}
+	err := db.WithContext(context.WithValue(ctx, pendingRiskKey{}, pending)).Transaction(fn)
+
+	for _, decision := range pending.decisions {
+		if err := recordRiskDecision(db, decision); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// deferRiskDecision hands decision to the transactionWithRisk db was started
+// by, it returns false when there is none.
+func deferRiskDecision(db *gorm.DB, decision *riskDecision) bool {
+	if db.Statement.Context == nil {
+		return false
+	}
+
+	pending, ok := db.Statement.Context.Value(pendingRiskKey{}).(*pendingRisk)
+	if ok {
+		pending.decisions = append(pending.decisions, decision)
+	}
+
+	return ok
+}
+
+// useApprovedRiskReview lets a transaction through that is identical to one
+// whose review was approved, once. It runs inside the transaction, so the
+// approval is only used when the transfer is committed.
+func useApprovedRiskReview(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet, to *models.Wallet, now time.Time) (bool, error) {
+	var review models.RiskReview
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("from_wallet_id = ? and to_wallet_id = ? and type = ? and amount = ?", from.ID, to.ID, transaction.Type, transaction.Amount).
+		Where("status = ? and approval_expiry > ?", models.RiskReviewApproved, now).
+		Order("reviewed_at asc").
+		First(&review)
+	if database.IsRecordNotFoundError(result.Error) {
+		return false, nil
+	} else if result.Error != nil {
+		return false, result.Error
+	}
+
+	result = tx.Model(&review).Updates(map[string]interface{}{
+		"status":         models.RiskReviewCompleted,
+		"used_reference": transaction.Reference,
+		"updated_at":     now,
+	})
+
+	return result.Error == nil, result.Error
+}
+
+func touchUserDevice(db *gorm.DB, userID *uuid.UUID, device *models.RequestDevice, now time.Time) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "device_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_seen_at": now, "ip": device.IP, "user_agent": device.UserAgent}),
+	}).Create(&models.UserDevice{
+		UserID:      userID,
+		DeviceID:    device.ID,
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}).Error
+}
+
+// ApproveRiskReview approves a held transaction and makes it out of the held
+// funds. When it can no longer be made, the funds are released and the
+// sender can retry it within riskApprovalWindow instead.
+func ApproveRiskReview(db *gorm.DB, id string, reviewerID *uuid.UUID, note string) (*models.RiskReview, error) {
+	return decideRiskReview(db, id, reviewerID, models.RiskReviewApproved, note)
+}
+
+// RejectRiskReview rejects a held transaction and releases the held funds.
+func RejectRiskReview(db *gorm.DB, id string, reviewerID *uuid.UUID, note string) (*models.RiskReview, error) {
+	return decideRiskReview(db, id, reviewerID, models.RiskReviewRejected, note)
+}
+
+func decideRiskReview(db *gorm.DB, id string, reviewerID *uuid.UUID, status string, note string) (*models.RiskReview, error) {
+	var review models.RiskReview
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&review)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if review.Status != models.RiskReviewPending {
+			return ErrRiskReviewNotPending
+		}
+
+		now := time.Now()
+		review.Status, review.Note = status, note
+		review.ReviewerID, review.ReviewedAt = reviewerID, &now
+
+		eventType := models.EventRiskReviewRejected
+		if status == models.RiskReviewApproved {
+			eventType = models.EventRiskReviewApproved
+
+			executed, err := executeRiskReview(tx, &review)
+			if err != nil {
+				return err
+			}
+
+			if !executed {
+				expiry := now.Add(riskApprovalWindow)
+				review.ApprovalExpiry = &expiry
+			}
+		} else if err := releaseRiskReviewHold(tx, &review); err != nil {
+			return err
+		}
+
+		result = tx.Model(&review).Updates(map[string]interface{}{
+			"status":          review.Status,
+			"note":            review.Note,
+			"reviewer_id":     review.ReviewerID,
+			"reviewed_at":     review.ReviewedAt,
+			"approval_expiry": review.ApprovalExpiry,
+			"used_reference":  review.UsedReference,
+			"updated_at":      now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.Preload("Hold").First(&review, "id = ?", review.ID).Error; err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, review.UserID, nil, eventType, models.RiskReviewFilterRecord(&review))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// executeRiskReview makes the transaction of an approved review out of its
+// hold and completes the review. When the transaction is refused, for
+// example because the hold expired or the recipient was frozen meanwhile,
+// the hold is released and false is returned.
+func executeRiskReview(tx *gorm.DB, review *models.RiskReview) (bool, error) {
+	if review.HoldID == nil {
+		return false, nil
+	}
+
+	var transaction *models.Transaction
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		hold, err := lockActiveHold(tx, review.HoldID.String())
+		if err != nil {
+			return err
+		}
+
+		transaction, err = captureHold(tx, hold, TransferParams{
+			FromWalletID:  review.FromWalletID,
+			ToWalletID:    review.ToWalletID,
+			Amount:        review.Amount,
+			Type:          review.Type,
+			Reference:     review.Reference,
+			Description:   review.Description,
+			InitiatedByID: review.InitiatedByID,
+			ApprovalID:    review.ApprovalID,
+			RiskReviewID:  review.ID,
+		})
+
+		return err
+	})
+
+	switch {
+	case err == nil:
+		review.Status, review.UsedReference = models.RiskReviewCompleted, transaction.Reference
+		return true, nil
+	case IsTransferError(err) || IsHoldError(err):
+		return false, releaseRiskReviewHold(tx, review)
+	}
+
+	return false, err
+}
+
+// releaseRiskReviewHold makes the funds held for a review available again.
+func releaseRiskReviewHold(tx *gorm.DB, review *models.RiskReview) error {
+	if review.HoldID == nil {
+		return nil
+	}
+
+	err := closeHold(tx, review.HoldID.String(), models.HoldStatusReleased, models.EventHoldReleased)
+	if err != nil && err != ErrHoldNotActive {
+		return err
+	}
+
+	return nil
+}
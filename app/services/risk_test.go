@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/risk"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// testDB connects to the database of TEST_POSTGRES_HOST and migrates it, the
+// test is skipped when it is not set.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	host := os.Getenv("TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("TEST_POSTGRES_HOST is not set")
+	}
+
+	err := database.ConnectDB(&config.Config{
+		DBHost:         host,
+		DBUserName:     os.Getenv("TEST_POSTGRES_USER"),
+		DBUserPassword: os.Getenv("TEST_POSTGRES_PASSWORD"),
+		DBName:         os.Getenv("TEST_POSTGRES_DB"),
+		DBPort:         os.Getenv("TEST_POSTGRES_PORT"),
+	})
+	if err != nil {
+		t.Fatalf("ConnectDB() error = %v", err)
+	}
+
+	return database.DB
+}
+
+// testWallet creates a user with a wallet holding balance.
+func testWallet(t *testing.T, db *gorm.DB, balance float64) *models.Wallet {
+	t.Helper()
+
+	id := uuid.New()
+	user := models.User{ID: &id, Name: "Test", Email: id.String() + "@example.com", Password: "-"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	address, err := utils.GenerateWalletAddress()
+	if err != nil {
+		t.Fatalf("GenerateWalletAddress() error = %v", err)
+	}
+
+	wallet := models.Wallet{UserID: user.ID, Address: address, Balance: balance, IsDefault: true}
+	if err := db.Create(&wallet).Error; err != nil {
+		t.Fatalf("creating wallet: %v", err)
+	}
+
+	return &wallet
+}
+
+// TestTransferRiskReviewInsideTransaction makes a transfer the risk rules hold
+// for review inside the transaction of a caller, which is rolled back with
+// the error of the transfer or committed without it.
+func TestTransferRiskReviewInsideTransaction(t *testing.T) {
+	db := testDB(t)
+
+	rules, _ := CurrentRiskRules()
+	riskRules.Lock()
+	riskRules.rules = []risk.Rule{{Name: "review-all", Type: risk.RuleVelocity, Outcome: risk.OutcomeReview, Window: risk.Duration(time.Hour), MaxAmount: 1}}
+	riskRules.Unlock()
+
+	t.Cleanup(func() {
+		riskRules.Lock()
+		riskRules.rules = rules
+		riskRules.Unlock()
+	})
+
+	tests := []struct {
+		name     string
+		rollback bool
+	}{
+		{"rolled back", true},
+		{"committed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := testWallet(t, db, 100), testWallet(t, db, 0)
+
+			err := transactionWithRisk(db, func(tx *gorm.DB) error {
+				return tx.Transaction(func(tx *gorm.DB) error {
+					_, err := Transfer(tx, TransferParams{
+						FromWalletID:  from.ID,
+						ToWalletID:    to.ID,
+						Amount:        10,
+						InitiatedByID: from.UserID,
+					})
+					if !errors.Is(err, ErrRiskReview) {
+						t.Errorf("Transfer() error = %v, want %v", err, ErrRiskReview)
+					}
+
+					if tt.rollback {
+						return err
+					}
+
+					return nil
+				})
+			})
+			if tt.rollback && !errors.Is(err, ErrRiskReview) {
+				t.Errorf("transactionWithRisk() error = %v, want %v", err, ErrRiskReview)
+			} else if !tt.rollback && err != nil {
+				t.Errorf("transactionWithRisk() error = %v, want nil", err)
+			}
+
+			var review models.RiskReview
+			if err := db.Preload("Hold").First(&review, "from_wallet_id = ?", from.ID).Error; err != nil {
+				t.Fatalf("finding the review: %v", err)
+			}
+
+			if review.Hold == nil || review.Hold.Status != models.HoldStatusActive || review.Hold.Amount != 10 {
+				t.Errorf("review hold = %+v, want an active hold of 10", review.Hold)
+			}
+
+			var evaluations int64
+			db.Model(&models.RiskEvaluation{}).Where("id = ?", review.EvaluationID).Count(&evaluations)
+			if evaluations != 1 {
+				t.Errorf("evaluations = %d, want 1", evaluations)
+			}
+
+			var wallet models.Wallet
+			db.First(&wallet, "id = ?", from.ID)
+			if wallet.Balance != 100 || wallet.HeldBalance != 10 {
+				t.Errorf("wallet balance = %.2f held %.2f, want 100 held 10", wallet.Balance, wallet.HeldBalance)
+			}
+		})
+	}
+}
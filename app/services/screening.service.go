@@ -0,0 +1,247 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/sanctions"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrScreeningPending         = errors.New("Your account is being reviewed, you can make transactions again once the review is completed")
+	ErrScreeningBlocked         = errors.New("Your account can not make transactions, please contact support")
+	ErrRecipientScreening       = errors.New("The recipient can not receive payments at the moment")
+	ErrScreeningCaseNotPending  = errors.New("This screening case has already been decided")
+	ErrScreeningListUnavailable = errors.New("No watchlist is configured")
+)
+
+var sanctionsList = struct {
+	sync.RWMutex
+	list      *sanctions.List
+	source    string
+	threshold float64
+}{threshold: sanctions.DefaultThreshold}
+
+// LoadSanctionsList replaces the watchlist by the CSV or JSON file at path.
+// Names are not screened when path is empty. The current list is kept when
+// the file is invalid.
+func LoadSanctionsList(path string, threshold float64) error {
+	if threshold <= 0 || threshold > 1 {
+		threshold = sanctions.DefaultThreshold
+	}
+
+	var list *sanctions.List
+	if path != "" {
+		loaded, err := sanctions.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		list = loaded
+	}
+
+	sanctionsList.Lock()
+	sanctionsList.list, sanctionsList.source, sanctionsList.threshold = list, path, threshold
+	sanctionsList.Unlock()
+
+	if list == nil {
+		log.Warn().Msg("No watchlist is configured, names are not screened")
+	} else {
+		log.Info().Str("source", path).Int("entries", list.Len()).Float64("threshold", threshold).Msg("Watchlist loaded")
+	}
+
+	return nil
+}
+
+// CurrentSanctionsList returns the watchlist in use, where it was loaded from
+// and the minimum score of a potential match.
+func CurrentSanctionsList() (*sanctions.List, string, float64) {
+	sanctionsList.RLock()
+	defer sanctionsList.RUnlock()
+
+	return sanctionsList.list, sanctionsList.source, sanctionsList.threshold
+}
+
+// ScreenName screens the name of a user, or of a merchant they own, against
+// the watchlist. A potential match opens a screening case and holds the user
+// until it is reviewed, nil is returned when there was no match.
+func ScreenName(tx *gorm.DB, userID *uuid.UUID, merchantID *uuid.UUID, subject string, name string) (*models.ScreeningCase, error) {
+	list, _, threshold := CurrentSanctionsList()
+
+	matches := list.Screen(name, threshold)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(matches)
+	if err != nil {
+		return nil, err
+	}
+
+	screeningCase := models.ScreeningCase{
+		UserID:     userID,
+		MerchantID: merchantID,
+		Subject:    subject,
+		Name:       name,
+		Matches:    string(encoded),
+		TopScore:   matches[0].Score,
+		Status:     models.ScreeningCasePending,
+	}
+
+	if err := tx.Create(&screeningCase).Error; err != nil {
+		return nil, err
+	}
+
+	// Users that were already confirmed stay blocked.
+	result := tx.Model(&models.User{}).
+		Where("id = ? and screening_status = ?", userID, models.ScreeningClear).
+		Update("screening_status", models.ScreeningPending)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	log.Warn().Str("case", screeningCase.ID.String()).Str("subject", subject).Float64("score", screeningCase.TopScore).Msg("Potential watchlist match")
+
+	return &screeningCase, nil
+}
+
+// checkTransferScreening stops users that are held by a screening case from
+// sending or receiving money. Reversals are made by administrators and are
+// always allowed.
+func checkTransferScreening(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet, to *models.Wallet) error {
+	if transaction.Type == models.TransactionTypeReversal {
+		return nil
+	}
+
+	if from.UserID != nil {
+		status, err := userScreeningStatus(tx, from.UserID)
+		if err != nil {
+			return err
+		}
+
+		switch status {
+		case models.ScreeningPending:
+			return ErrScreeningPending
+		case models.ScreeningBlocked:
+			return ErrScreeningBlocked
+		}
+	}
+
+	if to.UserID != nil {
+		status, err := userScreeningStatus(tx, to.UserID)
+		if err != nil {
+			return err
+		}
+
+		if status != models.ScreeningClear {
+			return ErrRecipientScreening
+		}
+	}
+
+	return nil
+}
+
+func userScreeningStatus(tx *gorm.DB, userID *uuid.UUID) (string, error) {
+	var status string
+	result := tx.Model(&models.User{}).Select("screening_status").Where("id = ?", userID).Scan(&status)
+
+	return status, result.Error
+}
+
+// FindScreeningCase returns a screening case with its user.
+func FindScreeningCase(db *gorm.DB, id string) (*models.ScreeningCase, error) {
+	var screeningCase models.ScreeningCase
+	result := db.Preload("User").Where("id = ?", id).First(&screeningCase)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &screeningCase, nil
+}
+
+// ClearScreeningCase closes a case as a false positive. The user can move
+// money again once none of their cases are pending.
+func ClearScreeningCase(db *gorm.DB, id string, reviewerID *uuid.UUID, note string) (*models.ScreeningCase, error) {
+	return decideScreeningCase(db, id, reviewerID, models.ScreeningCaseCleared, note)
+}
+
+// ConfirmScreeningCase closes a case as a true match and blocks the user.
+func ConfirmScreeningCase(db *gorm.DB, id string, reviewerID *uuid.UUID, note string) (*models.ScreeningCase, error) {
+	return decideScreeningCase(db, id, reviewerID, models.ScreeningCaseConfirmed, note)
+}
+
+func decideScreeningCase(db *gorm.DB, id string, reviewerID *uuid.UUID, status string, note string) (*models.ScreeningCase, error) {
+	var screeningCase models.ScreeningCase
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&screeningCase)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if screeningCase.Status != models.ScreeningCasePending {
+			return ErrScreeningCaseNotPending
+		}
+
+		// The user is locked so that concurrent decisions on their cases
+		// agree on the status they end up with.
+		var user models.User
+		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", screeningCase.UserID).First(&user)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		now := time.Now()
+		result = tx.Model(&screeningCase).Updates(map[string]interface{}{
+			"status":      status,
+			"note":        note,
+			"reviewer_id": reviewerID,
+			"reviewed_at": now,
+			"updated_at":  now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		userStatus := user.ScreeningStatus
+		if status == models.ScreeningCaseConfirmed {
+			userStatus = models.ScreeningBlocked
+		} else if user.ScreeningStatus == models.ScreeningPending {
+			var pending int64
+			result = tx.Model(&models.ScreeningCase{}).
+				Where("user_id = ? and status = ?", user.ID, models.ScreeningCasePending).
+				Count(&pending)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if pending == 0 {
+				userStatus = models.ScreeningClear
+			}
+		}
+
+		if userStatus != user.ScreeningStatus {
+			result = tx.Model(&user).Updates(map[string]interface{}{
+				"screening_status": userStatus,
+				"updated_at":       now,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return FindScreeningCase(db, id)
+}
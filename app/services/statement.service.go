@@ -0,0 +1,560 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/pkg/pdf"
+	"github.com/fatfatcocofat/rosamsoe/pkg/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// statementMaxDays is the longest period a single statement can cover.
+	statementMaxDays = 366
+	// Statements longer than statementSyncDays, or with more than
+	// statementSyncLines transactions, are generated in the background.
+	statementSyncDays  = 31
+	statementSyncLines = 1000
+	// statementExportRetention is how long generated statements can be
+	// downloaded.
+	statementExportRetention = 7 * 24 * time.Hour
+)
+
+var (
+	ErrStatementDate     = errors.New("from and to must be dates formatted as YYYY-MM-DD")
+	ErrStatementPeriod   = errors.New("from must not be after to")
+	ErrStatementRange    = fmt.Errorf("A statement can cover at most %d days", statementMaxDays)
+	ErrStatementFormat   = errors.New("format must be csv or pdf")
+	ErrStatementNotReady = errors.New("This statement is not ready to be downloaded")
+)
+
+// IsStatementError reports whether err is caused by the request.
+func IsStatementError(err error) bool {
+	switch err {
+	case ErrStatementDate, ErrStatementPeriod, ErrStatementRange, ErrStatementFormat, ErrStatementNotReady:
+		return true
+	}
+
+	return false
+}
+
+// ParseStatementPeriod parses the from and to dates of a statement in the
+// server's time zone. The period defaults to the current month up to today.
+func ParseStatementPeriod(from string, to string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	start, end := today.AddDate(0, 0, 1-today.Day()), today
+
+	if from != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrStatementDate
+		}
+
+		start = parsed
+	}
+
+	if to != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrStatementDate
+		}
+
+		end = parsed
+	}
+
+	if start.After(end) {
+		return time.Time{}, time.Time{}, ErrStatementPeriod
+	}
+
+	if statementDays(start, end) > statementMaxDays {
+		return time.Time{}, time.Time{}, ErrStatementRange
+	}
+
+	return start, end, nil
+}
+
+func statementDays(from time.Time, to time.Time) int {
+	return int(to.Sub(from).Hours()/24+0.5) + 1
+}
+
+// ParseStatementFormat validates the requested format, csv by default.
+func ParseStatementFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", models.StatementFormatCSV:
+		return models.StatementFormatCSV, nil
+	case models.StatementFormatPDF:
+		return models.StatementFormatPDF, nil
+	}
+
+	return "", ErrStatementFormat
+}
+
+// StatementNeedsExport reports whether the statement is too large to be
+// generated while the client waits.
+func StatementNeedsExport(db *gorm.DB, wallet *models.Wallet, from time.Time, to time.Time) (bool, error) {
+	if statementDays(from, to) > statementSyncDays {
+		return true, nil
+	}
+
+	var count int64
+	result := db.Model(&models.LedgerEntry{}).
+		Where("wallet_id = ? and created_at >= ? and created_at < ?", wallet.ID, from, to.AddDate(0, 0, 1)).
+		Count(&count)
+
+	return count > statementSyncLines, result.Error
+}
+
+// BuildStatement lists the ledger entries of wallet from the start of from
+// until the end of to. wallet must have its User loaded.
+func BuildStatement(db *gorm.DB, wallet *models.Wallet, from time.Time, to time.Time) (*models.Statement, error) {
+	end := to.AddDate(0, 0, 1)
+
+	statement := models.Statement{
+		User:        models.UserFilterRecord(&wallet.User),
+		Address:     wallet.Address,
+		Currency:    wallet.Currency,
+		From:        from,
+		To:          to,
+		Lines:       []models.StatementLine{},
+		GeneratedAt: time.Now(),
+	}
+
+	var opening models.LedgerEntry
+	result := db.Where("wallet_id = ? and created_at < ?", wallet.ID, from).Order("created_at desc").Limit(1).Find(&opening)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	statement.OpeningBalance = opening.BalanceAfter
+	statement.ClosingBalance = opening.BalanceAfter
+
+	var entries []models.LedgerEntry
+	result = db.Preload("Transaction.FromWallet").Preload("Transaction.ToWallet").
+		Where("wallet_id = ? and created_at >= ? and created_at < ?", wallet.ID, from, end).
+		Order("created_at asc").Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, entry := range entries {
+		line := models.StatementLine{
+			Date:    *entry.CreatedAt,
+			Balance: entry.BalanceAfter,
+		}
+
+		if entry.Amount < 0 {
+			line.Debit = -entry.Amount
+			statement.TotalDebit += line.Debit
+		} else {
+			line.Credit = entry.Amount
+			statement.TotalCredit += line.Credit
+		}
+
+		if transaction := entry.Transaction; transaction != nil {
+			line.Reference = transaction.Reference
+			line.Type = transaction.Type
+			line.Description = transaction.Description
+
+			counterparty := transaction.ToWallet
+			if transaction.ToWalletID != nil && *transaction.ToWalletID == *wallet.ID {
+				counterparty = transaction.FromWallet
+			}
+
+			if counterparty != nil {
+				line.Counterparty = counterparty.Address
+			}
+		}
+
+		statement.Lines = append(statement.Lines, line)
+		statement.ClosingBalance = entry.BalanceAfter
+	}
+
+	statement.TotalDebit = utils.RoundAmount(statement.TotalDebit)
+	statement.TotalCredit = utils.RoundAmount(statement.TotalCredit)
+
+	return &statement, nil
+}
+
+// RenderStatement renders a statement as a file and returns its content type
+// and file name.
+func RenderStatement(statement *models.Statement, format string) ([]byte, string, string, error) {
+	name := fmt.Sprintf("statement-%s-%s-%s.%s", statement.Address, statement.From.Format("20060102"), statement.To.Format("20060102"), format)
+
+	if format == models.StatementFormatPDF {
+		return renderStatementPDF(statement), "application/pdf", name, nil
+	}
+
+	content, err := renderStatementCSV(statement)
+
+	return content, "text/csv", name, err
+}
+
+// renderStatementCSV writes one row per transaction between an opening and a
+// closing balance row, so that the file can be imported as is.
+func renderStatementCSV(statement *models.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	amount := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+
+		return fmt.Sprintf("%.2f", v)
+	}
+
+	rows := [][]string{
+		{"date", "reference", "type", "description", "counterparty", "debit", "credit", "balance", "currency"},
+		{statement.From.Format("2006-01-02"), "", "opening_balance", "Opening balance", "", "", "", fmt.Sprintf("%.2f", statement.OpeningBalance), statement.Currency},
+	}
+
+	for _, line := range statement.Lines {
+		rows = append(rows, []string{
+			line.Date.Format(time.RFC3339),
+			line.Reference,
+			line.Type,
+			line.Description,
+			line.Counterparty,
+			amount(line.Debit),
+			amount(line.Credit),
+			fmt.Sprintf("%.2f", line.Balance),
+			statement.Currency,
+		})
+	}
+
+	rows = append(rows, []string{
+		statement.To.Format("2006-01-02"), "", "closing_balance", "Closing balance", "",
+		fmt.Sprintf("%.2f", statement.TotalDebit), fmt.Sprintf("%.2f", statement.TotalCredit),
+		fmt.Sprintf("%.2f", statement.ClosingBalance), statement.Currency,
+	})
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderStatementPDF(statement *models.Statement) []byte {
+	const (
+		left     = 40.0
+		right    = pdf.PageWidth - 40
+		top      = pdf.PageHeight - 50
+		bottom   = 50.0
+		rowSize  = 8.0
+		rowSpace = 13.0
+	)
+
+	doc := pdf.New("Statement " + statement.Address)
+	money := func(v float64) string {
+		return fmt.Sprintf("%.2f", v)
+	}
+
+	page := doc.AddPage()
+	y := top
+
+	page.Text(pdf.HelveticaBold, 16, left, y, "Account Statement")
+	y -= 24
+
+	details := [][2]string{
+		{"Name", statement.User.Name},
+		{"Email", statement.User.Email},
+	}
+
+	if statement.User.Handle != nil {
+		details = append(details, [2]string{"Handle", "@" + *statement.User.Handle})
+	}
+
+	details = append(details,
+		[2]string{"Customer ID", statement.User.ID.String()},
+		[2]string{"Wallet", statement.Address},
+		[2]string{"Currency", statement.Currency},
+		[2]string{"Period", statement.From.Format("2 January 2006") + " - " + statement.To.Format("2 January 2006")},
+		[2]string{"Generated", statement.GeneratedAt.Format("2 January 2006 15:04 MST")},
+	)
+
+	for _, detail := range details {
+		page.Text(pdf.HelveticaBold, 9, left, y, detail[0])
+		page.Text(pdf.Helvetica, 9, left+80, y, detail[1])
+		y -= 13
+	}
+
+	y -= 8
+	summary := [][2]string{
+		{"Opening balance", money(statement.OpeningBalance)},
+		{"Total debit", money(statement.TotalDebit)},
+		{"Total credit", money(statement.TotalCredit)},
+		{"Closing balance", money(statement.ClosingBalance)},
+	}
+
+	for _, row := range summary {
+		page.Text(pdf.HelveticaBold, 9, left, y, row[0])
+		page.TextRight(9, left+220, y, row[1])
+		y -= 13
+	}
+
+	columns := []struct {
+		title string
+		x     float64
+		right bool
+	}{
+		{"Date", left, false},
+		{"Reference", left + 62, false},
+		{"Description", left + 185, false},
+		{"Debit", right - 140, true},
+		{"Credit", right - 70, true},
+		{"Balance", right, true},
+	}
+
+	header := func() {
+		for _, column := range columns {
+			if column.right {
+				page.Text(pdf.HelveticaBold, rowSize, column.x-float64(len(column.title))*rowSize*0.55, y, column.title)
+			} else {
+				page.Text(pdf.HelveticaBold, rowSize, column.x, y, column.title)
+			}
+		}
+
+		page.Line(left, y-4, right, y-4, 0.5)
+		y -= rowSpace + 2
+	}
+
+	y -= 12
+	header()
+
+	for _, line := range statement.Lines {
+		if y < bottom {
+			page = doc.AddPage()
+			y = top
+			header()
+		}
+
+		description := line.Description
+		if description == "" {
+			description = line.Type
+		}
+
+		if line.Counterparty != "" {
+			description += " / " + line.Counterparty
+		}
+
+		page.Text(pdf.Courier, rowSize, columns[0].x, y, line.Date.Format("2006-01-02"))
+		page.Text(pdf.Courier, rowSize, columns[1].x, y, truncateStatementText(line.Reference, 24))
+		page.Text(pdf.Helvetica, rowSize, columns[2].x, y, truncateStatementText(description, 30))
+
+		if line.Debit != 0 {
+			page.TextRight(rowSize, columns[3].x, y, money(line.Debit))
+		}
+
+		if line.Credit != 0 {
+			page.TextRight(rowSize, columns[4].x, y, money(line.Credit))
+		}
+
+		page.TextRight(rowSize, columns[5].x, y, money(line.Balance))
+		y -= rowSpace
+	}
+
+	if len(statement.Lines) == 0 {
+		page.Text(pdf.Helvetica, rowSize, left, y, "No transactions in this period.")
+	}
+
+	return doc.Bytes()
+}
+
+func truncateStatementText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n-3]) + "..."
+}
+
+type statementJobPayload struct {
+	ID string `json:"id"`
+}
+
+// CreateStatementExport queues a statement to be generated in the
+// background. The dates are stored as calendar dates, the period is
+// generated in the server's time zone like other statements.
+func CreateStatementExport(db *gorm.DB, wallet *models.Wallet, from time.Time, to time.Time, format string) (*models.StatementExport, error) {
+	export := models.StatementExport{
+		UserID:   wallet.UserID,
+		WalletID: wallet.ID,
+		Wallet:   *wallet,
+		From:     time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC),
+		To:       time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC),
+		Format:   format,
+		Status:   models.StatementExportPending,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Wallet").Create(&export).Error; err != nil {
+			return err
+		}
+
+		_, err := EnqueueJob(tx, models.JobKindStatementGenerate, statementJobPayload{ID: export.ID.String()}, JobOptions{MaxAttempts: 3})
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// FindStatementExport returns a statement export of a wallet.
+func FindStatementExport(db *gorm.DB, walletID string, id string) (*models.StatementExport, error) {
+	var export models.StatementExport
+	result := db.Preload("Wallet").Where("wallet_id = ? and id = ?", walletID, id).First(&export)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &export, nil
+}
+
+// GenerateStatementJob generates the statement of a queued export, stores it
+// and notifies the user with a statement.ready event. The export is marked as
+// failed once the job runs out of attempts.
+func GenerateStatementJob(db *gorm.DB, store storage.Blob, job *models.Job) error {
+	var payload statementJobPayload
+	if err := job.DecodePayload(&payload); err != nil {
+		return err
+	}
+
+	err := generateStatementExport(db, store, payload.ID)
+	if err != nil && job.Attempts+1 >= job.MaxAttempts {
+		db.Model(&models.StatementExport{}).Where("id = ?", payload.ID).Updates(map[string]interface{}{
+			"status":     models.StatementExportFailed,
+			"error":      "The statement could not be generated, please try again",
+			"updated_at": time.Now(),
+		})
+	}
+
+	return err
+}
+
+func generateStatementExport(db *gorm.DB, store storage.Blob, id string) error {
+	var export models.StatementExport
+	result := db.Preload("Wallet.User").Where("id = ?", id).First(&export)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		return result.Error
+	}
+
+	if export.Status != models.StatementExportPending {
+		return nil
+	}
+
+	from := time.Date(export.From.Year(), export.From.Month(), export.From.Day(), 0, 0, 0, 0, time.Local)
+	to := time.Date(export.To.Year(), export.To.Month(), export.To.Day(), 0, 0, 0, 0, time.Local)
+
+	statement, err := BuildStatement(db, &export.Wallet, from, to)
+	if err != nil {
+		return err
+	}
+
+	content, contentType, _, err := RenderStatement(statement, export.Format)
+	if err != nil {
+		return err
+	}
+
+	key := "statements/" + export.UserID.String() + "/" + export.ID.String() + "." + export.Format
+	if err := store.Put(context.Background(), key, bytes.NewReader(content), contentType); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		expiresAt := now.Add(statementExportRetention)
+
+		export.Status, export.StorageKey = models.StatementExportCompleted, key
+		export.CompletedAt, export.ExpiresAt = &now, &expiresAt
+
+		result := tx.Model(&export).Updates(map[string]interface{}{
+			"status":       export.Status,
+			"storage_key":  export.StorageKey,
+			"completed_at": export.CompletedAt,
+			"expires_at":   export.ExpiresAt,
+			"updated_at":   now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return PublishEvent(tx, export.UserID, nil, models.EventStatementReady, models.StatementExportFilterRecord(&export))
+	})
+}
+
+// OpenStatementExport reads the file of a completed export and returns it
+// with its content type and file name.
+func OpenStatementExport(store storage.Blob, export *models.StatementExport) ([]byte, string, string, error) {
+	if export.Status != models.StatementExportCompleted {
+		return nil, "", "", ErrStatementNotReady
+	}
+
+	r, err := store.Get(context.Background(), export.StorageKey)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, "", "", err
+	}
+
+	contentType := "text/csv"
+	if export.Format == models.StatementFormatPDF {
+		contentType = "application/pdf"
+	}
+
+	name := fmt.Sprintf("statement-%s-%s-%s.%s", export.Wallet.Address, export.From.Format("20060102"), export.To.Format("20060102"), export.Format)
+
+	return buf.Bytes(), contentType, name, nil
+}
+
+// PurgeStatementExports deletes exports whose download period has ended,
+// together with their files.
+func PurgeStatementExports(db *gorm.DB, store storage.Blob) (int, error) {
+	var exports []models.StatementExport
+	result := db.Where("expires_at < ?", time.Now()).Limit(500).Find(&exports)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	ids := make([]*uuid.UUID, 0, len(exports))
+	for _, export := range exports {
+		if export.StorageKey != "" {
+			err := store.Delete(context.Background(), export.StorageKey)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return 0, err
+			}
+		}
+
+		ids = append(ids, export.ID)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result = db.Where("id in ?", ids).Delete(&models.StatementExport{})
+
+	return int(result.RowsAffected), result.Error
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidAmount     = errors.New("Amount must be greater than zero")
+	ErrSameWallet        = errors.New("Can not transfer to the same wallet")
+	ErrCurrencyMismatch  = errors.New("Both wallets must use the same currency")
+	ErrInsufficientFunds = errors.New("Insufficient balance in the source wallet")
+	ErrSystemWallet      = errors.New("System wallets can not send or receive transfers")
+	ErrWalletFrozen      = errors.New("This wallet is frozen, please contact support")
+	ErrRecipientFrozen   = errors.New("The recipient wallet can not receive payments at the moment")
+)
+
+type TransferParams struct {
+	FromWalletID *uuid.UUID
+	ToWalletID   *uuid.UUID
+	Amount       float64
+	Type         string
+	Reference    string
+	Description  string
+
+	// OriginalTransactionID links refunds and reversals to the transaction
+	// they undo.
+	OriginalTransactionID *uuid.UUID
+	ReasonCode            string
+	InitiatedByID         *uuid.UUID
+
+	// ApprovalID is set when the transfer is made for an approved
+	// TransferApproval, so the approval policy of the wallet is satisfied.
+	ApprovalID *uuid.UUID
+
+	// RiskReviewID is set when the transfer is made for an approved
+	// RiskReview, the risk rules are not evaluated again.
+	RiskReviewID *uuid.UUID
+}
+
+// Transfer moves money between two wallets inside a database transaction.
+// Both wallets are locked, so concurrent transfers can never overdraw a wallet.
+// Only the available balance can be spent, held funds are captured with
+// CaptureHold.
+func Transfer(db *gorm.DB, params TransferParams) (*models.Transaction, error) {
+	amount := utils.RoundAmount(params.Amount)
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	if params.FromWalletID.String() == params.ToWalletID.String() {
+		return nil, ErrSameWallet
+	}
+
+	if params.Type == "" {
+		params.Type = models.TransactionTypeTransfer
+	}
+
+	if params.Reference == "" {
+		params.Reference = utils.GenerateReference("TRX")
+	}
+
+	var transaction models.Transaction
+	var decision *riskDecision
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		quote, feeWallet, err := quoteTransferFee(tx, params.Type, params.FromWalletID, amount)
+		if err != nil {
+			return err
+		}
+
+		ids := []*uuid.UUID{params.FromWalletID, params.ToWalletID}
+		if feeWallet != nil {
+			ids = append(ids, feeWallet.ID)
+		}
+
+		wallets, err := lockWallets(tx, ids...)
+		if err != nil {
+			return err
+		}
+
+		from, to := wallets[params.FromWalletID.String()], wallets[params.ToWalletID.String()]
+
+		if from.SystemAccount != "" || to.SystemAccount != "" {
+			return ErrSystemWallet
+		}
+
+		// Reversals are corrections made by administrators and may move
+		// money out of frozen wallets.
+		if params.Type != models.TransactionTypeReversal {
+			if from.FrozenAt != nil {
+				return ErrWalletFrozen
+			}
+
+			if to.FrozenAt != nil {
+				return ErrRecipientFrozen
+			}
+		}
+
+		if from.Currency != to.Currency || from.Currency != quote.Currency {
+			return ErrCurrencyMismatch
+		}
+
+		if from.AvailableBalance() < quote.Total {
+			return ErrInsufficientFunds
+		}
+
+		transaction = models.Transaction{
+			Reference:    params.Reference,
+			Type:         params.Type,
+			Status:       models.TransactionStatusCompleted,
+			FromWalletID: from.ID,
+			ToWalletID:   to.ID,
+			Amount:       amount,
+			Currency:     from.Currency,
+			Description:  params.Description,
+			Fee:          quote.Fee,
+			FeePaidBy:    quote.PaidBy,
+			FeeRuleID:    quote.RuleID,
+
+			OriginalTransactionID: params.OriginalTransactionID,
+			ReasonCode:            params.ReasonCode,
+			InitiatedByID:         params.InitiatedByID,
+		}
+
+		if err := checkMemberSpending(tx, &transaction, from); err != nil {
+			return err
+		}
+
+		if err := checkApprovalPolicy(tx, &transaction, from, params.ApprovalID); err != nil {
+			return err
+		}
+
+		if err := checkTransferScreening(tx, &transaction, from, to); err != nil {
+			return err
+		}
+
+		if err := checkTransferLimits(tx, &transaction, from, to); err != nil {
+			return err
+		}
+
+		decision, err = evaluateTransferRisk(tx, &transaction, from, to, params.RiskReviewID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+
+		if err := postEntry(tx, &transaction, from, -transaction.DebitAmount()); err != nil {
+			return err
+		}
+
+		if err := postEntry(tx, &transaction, to, transaction.CreditAmount()); err != nil {
+			return err
+		}
+
+		if feeWallet != nil {
+			if err := postEntry(tx, &transaction, wallets[feeWallet.ID.String()], transaction.Fee); err != nil {
+				return err
+			}
+		}
+
+		if err := saveRoundUp(tx, &transaction, from); err != nil {
+			return err
+		}
+
+		return publishTransferEvents(tx, &transaction, from, to)
+	})
+
+	// A blocked or held transaction is recorded with db once the transfer
+	// is rolled back, the wallets are no longer locked by then. Inside a
+	// transactionWithRisk it is recorded after the caller's transaction,
+	// which is rolled back as well when the caller returns the error.
+	if decision != nil && (err == ErrRiskBlocked || err == ErrRiskReview) {
+		if decision.review != nil {
+			decision.review.ApprovalID = params.ApprovalID
+		}
+
+		if deferRiskDecision(db, decision) {
+			return nil, err
+		}
+
+		if err := recordRiskDecision(db, decision); err != nil {
+			return nil, err
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	db.Preload("FromWallet").Preload("ToWallet").First(&transaction, "id = ?", transaction.ID.String())
+
+	return &transaction, nil
+}
+
+// publishTransferEvents notifies the sender and the receiver, once when both
+// wallets belong to the same user.
+func publishTransferEvents(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet, to *models.Wallet) error {
+	eventType := models.EventTransferCompleted
+	switch transaction.Type {
+	case models.TransactionTypePayment:
+		eventType = models.EventPaymentCompleted
+	case models.TransactionTypeRefund:
+		eventType = models.EventRefundCompleted
+	case models.TransactionTypeReversal:
+		eventType = models.EventReversalCompleted
+	case models.TransactionTypeCashback:
+		eventType = models.EventCashbackCompleted
+	}
+
+	transaction.FromWallet, transaction.ToWallet = from, to
+	data := models.TransactionFilterRecord(transaction)
+
+	for _, w := range []*models.Wallet{from, to} {
+		change := transaction.CreditAmount()
+		if w == from {
+			change = -transaction.DebitAmount()
+		}
+
+		err := PublishEvent(tx, w.UserID, w.MerchantID, models.EventWalletBalance, models.WalletBalanceEventData{
+			Address:   w.Address,
+			Currency:  w.Currency,
+			Balance:   w.Balance,
+			Available: w.AvailableBalance(),
+			Change:    change,
+			Reference: transaction.Reference,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := PublishEvent(tx, from.UserID, from.MerchantID, eventType, data); err != nil {
+		return err
+	}
+
+	if from.UserID != nil && to.UserID != nil && from.UserID.String() == to.UserID.String() && to.MerchantID == nil {
+		return nil
+	}
+
+	return PublishEvent(tx, to.UserID, to.MerchantID, eventType, data)
+}
+
+// quoteTransferFee evaluates the fee of a transfer before the wallets are
+// locked, so that the fee revenue wallet can be locked in the same order as
+// the others. The fee wallet is only returned when there is a fee to post.
+func quoteTransferFee(tx *gorm.DB, transactionType string, fromWalletID *uuid.UUID, amount float64) (*models.FeeQuote, *models.Wallet, error) {
+	var from models.Wallet
+	if err := tx.Select("id", "currency").First(&from, "id = ?", fromWalletID.String()).Error; err != nil {
+		return nil, nil, err
+	}
+
+	quote, err := QuoteFee(tx, feeOperation(transactionType), from.Currency, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if quote.Fee <= 0 {
+		return quote, nil, nil
+	}
+
+	feeWallet, err := FindSystemWallet(tx, models.SystemAccountFeeRevenue, from.Currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return quote, feeWallet, nil
+}
+
+// lockWallets selects the wallets FOR UPDATE, always in the same order to
+// avoid deadlocks between two opposite transfers.
+func lockWallets(tx *gorm.DB, ids ...*uuid.UUID) (map[string]*models.Wallet, error) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, id.String())
+	}
+	sort.Strings(keys)
+
+	wallets := make(map[string]*models.Wallet, len(keys))
+	for _, key := range keys {
+		var wallet models.Wallet
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&wallet, "id = ?", key)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		wallets[key] = &wallet
+	}
+
+	return wallets, nil
+}
+
+// postEntry changes the balance of a locked wallet and records the ledger entry.
+func postEntry(tx *gorm.DB, transaction *models.Transaction, wallet *models.Wallet, amount float64) error {
+	wallet.Balance = utils.RoundAmount(wallet.Balance + amount)
+
+	result := tx.Model(wallet).Updates(map[string]interface{}{"balance": wallet.Balance, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return tx.Create(&models.LedgerEntry{
+		TransactionID: transaction.ID,
+		WalletID:      wallet.ID,
+		Amount:        amount,
+		BalanceAfter:  wallet.Balance,
+	}).Error
+}
+
+// IsTransferError reports whether err is caused by the request rather than by
+// the database, so that its message can be shown to the user.
+func IsTransferError(err error) bool {
+	switch err {
+	case ErrInvalidAmount, ErrSameWallet, ErrCurrencyMismatch, ErrInsufficientFunds, ErrSystemWallet, ErrWalletFrozen, ErrRecipientFrozen,
+		ErrWalletPermission, ErrMemberSpendingLimit, ErrApprovalRequired, ErrApprovalUnsupported, ErrRiskBlocked, ErrRiskReview,
+		ErrScreeningPending, ErrScreeningBlocked, ErrRecipientScreening:
+		return true
+	}
+
+	return IsLimitError(err)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWalletHasBalance = errors.New("Transfer the balance out of the wallet before deleting it")
+	ErrWalletHasHolds   = errors.New("Wallets with active holds can not be deleted")
+	ErrWalletHasPockets = errors.New("Move the money in pockets back to the wallet before deleting it")
+)
+
+// IsWalletDeleteError reports whether err is why a wallet can not be deleted.
+func IsWalletDeleteError(err error) bool {
+	return err == ErrWalletHasBalance || err == ErrWalletHasHolds || err == ErrWalletHasPockets
+}
+
+// FindUserWallet returns the wallet with the given address when the user
+// owns it or is a member of it with a role that grants access, with Role set
+// to the role of the user. A gorm.ErrRecordNotFound is returned when the user
+// has no access at all, ErrWalletPermission when the role is not enough.
+func FindUserWallet(db *gorm.DB, userID string, address string, access string) (*models.Wallet, error) {
+	var wallet models.Wallet
+	result := userWallets(db, userID).Preload("User").Where("address = ?", address).First(&wallet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	role, err := userWalletRole(db, userID, &wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	if !models.WalletRoleAllows(role, access) {
+		return nil, ErrWalletPermission
+	}
+
+	wallet.Role = role
+
+	return &wallet, nil
+}
+
+// FindUserWallets returns the wallets the user owns or is a member of.
+func FindUserWallets(db *gorm.DB, userID string) ([]models.Wallet, error) {
+	var wallets []models.Wallet
+	result := userWallets(db, userID).Preload("User").Order("created_at").Find(&wallets)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var members []models.WalletMember
+	if err := db.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]string, len(members))
+	for _, member := range members {
+		roles[member.WalletID.String()] = member.Role
+	}
+
+	for i := range wallets {
+		wallets[i].Role = models.WalletRoleOwner
+		if wallets[i].UserID == nil || wallets[i].UserID.String() != userID {
+			wallets[i].Role = roles[wallets[i].ID.String()]
+		}
+	}
+
+	return wallets, nil
+}
+
+// userWallets limits a query of wallets to the ones the user owns or is a
+// member of.
+func userWallets(db *gorm.DB, userID string) *gorm.DB {
+	return db.Where("wallets.user_id = ? or wallets.id in (?)", userID,
+		db.Model(&models.WalletMember{}).Select("wallet_id").Where("user_id = ?", userID))
+}
+
+// userWalletRole returns the role of the user in a wallet, or an empty role
+// when the user has no access.
+func userWalletRole(db *gorm.DB, userID string, wallet *models.Wallet) (string, error) {
+	if wallet.UserID != nil && wallet.UserID.String() == userID {
+		return models.WalletRoleOwner, nil
+	}
+
+	var member models.WalletMember
+	result := db.Where("wallet_id = ? and user_id = ?", wallet.ID, userID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return member.Role, nil
+}
+
+// FindWalletByAddress returns any wallet by its address, regardless of owner.
+func FindWalletByAddress(db *gorm.DB, address string) (*models.Wallet, error) {
+	var wallet models.Wallet
+	result := db.Preload("User").Where("address = ?", address).First(&wallet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &wallet, nil
+}
+
+// GenerateUniqueWalletAddress generates wallet addresses until one is found
+// that is not used by any wallet yet.
+func GenerateUniqueWalletAddress(db *gorm.DB) (string, error) {
+	for {
+		address, err := utils.GenerateWalletAddress()
+		if err != nil {
+			return "", err
+		}
+
+		var wallet models.Wallet
+		result := db.First(&wallet, "address = ?", address)
+		if database.IsRecordNotFoundError(result.Error) {
+			return address, nil
+		} else if result.Error != nil {
+			return "", result.Error
+		}
+	}
+}
+
+// DeleteWallet deletes an empty wallet. The wallet is locked and checked
+// within the transaction, so a transfer can not land in it in between.
+func DeleteWallet(db *gorm.DB, wallet *models.Wallet) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, wallet.ID)
+		if err != nil {
+			return err
+		}
+
+		locked := wallets[wallet.ID.String()]
+
+		switch {
+		case locked.Balance != 0:
+			return ErrWalletHasBalance
+		case locked.HeldBalance > 0:
+			return ErrWalletHasHolds
+		case locked.PocketBalance > 0:
+			return ErrWalletHasPockets
+		}
+
+		if err := tx.Delete(locked).Error; err != nil {
+			return err
+		}
+
+		if locked.IsDefault {
+			if err := EnsureDefaultWallet(tx, fmt.Sprint(locked.UserID), locked.Currency); err != nil {
+				return err
+			}
+		}
+
+		return PublishEvent(tx, wallet.UserID, nil, models.EventWalletDeleted, models.WalletFilterRecord(wallet))
+	})
+}
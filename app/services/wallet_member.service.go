@@ -0,0 +1,369 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// walletInvitationTTL is how long an invitation can be accepted.
+const walletInvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrWalletPermission         = errors.New("Your role in this wallet does not allow this")
+	ErrWalletInviteeNotFound    = errors.New("No user was found with that email or handle")
+	ErrWalletInviteeMember      = errors.New("This user already has access to the wallet")
+	ErrWalletInvitePending      = errors.New("This user already has a pending invitation to the wallet")
+	ErrWalletShareMerchant      = errors.New("Merchant settlement wallets can not be shared")
+	ErrWalletInvitationNotFound = errors.New("The invitation was not found or is no longer pending")
+	ErrWalletInvitationExpired  = errors.New("This invitation has expired")
+	ErrMemberSpendingLimit      = errors.New("The amount exceeds your remaining daily spending limit for this wallet")
+)
+
+// IsWalletMemberError reports whether err is caused by the request rather
+// than by the database.
+func IsWalletMemberError(err error) bool {
+	switch err {
+	case ErrWalletInviteeNotFound, ErrWalletInviteeMember, ErrWalletInvitePending, ErrWalletShareMerchant,
+		ErrWalletInvitationNotFound, ErrWalletInvitationExpired:
+		return true
+	}
+
+	return false
+}
+
+func preloadWalletInvitation(db *gorm.DB) *gorm.DB {
+	return db.Preload("Wallet").Preload("Invitee").Preload("InvitedBy")
+}
+
+// FindWalletMembers returns the members of a wallet, oldest first. The owner
+// of the wallet is not a member.
+func FindWalletMembers(db *gorm.DB, walletID string) ([]models.WalletMember, error) {
+	var members []models.WalletMember
+	result := db.Preload("User").Where("wallet_id = ?", walletID).Order("created_at").Find(&members)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return members, nil
+}
+
+// FindWalletInvitations returns the pending invitations of a wallet.
+func FindWalletInvitations(db *gorm.DB, walletID string) ([]models.WalletInvitation, error) {
+	var invitations []models.WalletInvitation
+	result := preloadWalletInvitation(db).Where("wallet_id = ? and status = ? and expires_at > ?", walletID, models.WalletInvitationPending, time.Now()).
+		Order("created_at").Find(&invitations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return invitations, nil
+}
+
+// FindUserWalletInvitations returns the pending invitations sent to a user.
+func FindUserWalletInvitations(db *gorm.DB, userID string) ([]models.WalletInvitation, error) {
+	var invitations []models.WalletInvitation
+	result := preloadWalletInvitation(db).Where("invitee_id = ? and status = ? and expires_at > ?", userID, models.WalletInvitationPending, time.Now()).
+		Order("created_at desc").Find(&invitations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return invitations, nil
+}
+
+// InviteWalletMember invites the user with the email address or @handle of
+// the request to the wallet and notifies them with a
+// wallet_invitation.created event.
+func InviteWalletMember(db *gorm.DB, wallet *models.Wallet, invitedByID *uuid.UUID, req *models.WalletInviteRequest) (*models.WalletInvitation, error) {
+	if wallet.MerchantID != nil {
+		return nil, ErrWalletShareMerchant
+	}
+
+	invitee, err := findInvitee(db, req.Invitee)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := userWalletRole(db, invitee.ID.String(), wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	if role != "" {
+		return nil, ErrWalletInviteeMember
+	}
+
+	expiresAt := time.Now().Add(walletInvitationTTL)
+	invitation := models.WalletInvitation{
+		WalletID:    wallet.ID,
+		InviteeID:   invitee.ID,
+		InvitedByID: invitedByID,
+		Role:        req.Role,
+		Status:      models.WalletInvitationPending,
+		ExpiresAt:   &expiresAt,
+	}
+
+	if req.Role == models.WalletRoleSpender {
+		invitation.DailySpendingLimit = utils.RoundAmount(req.DailySpendingLimit)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		err := tx.Model(&models.WalletInvitation{}).
+			Where("wallet_id = ? and invitee_id = ? and status = ? and expires_at > ?", wallet.ID, invitee.ID, models.WalletInvitationPending, time.Now()).
+			Count(&pending).Error
+		if err != nil {
+			return err
+		}
+
+		if pending > 0 {
+			return ErrWalletInvitePending
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&invitation).Error; err != nil {
+			return err
+		}
+
+		if err := preloadWalletInvitation(tx).First(&invitation, "id = ?", invitation.ID).Error; err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, invitee.ID, nil, models.EventWalletInvitationCreated, models.WalletInvitationFilterRecord(&invitation))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+func findInvitee(db *gorm.DB, invitee string) (*models.User, error) {
+	if utils.IsHandle(invitee) {
+		user, err := FindUserByHandle(db, invitee)
+		if err == ErrHandleNotFound || err == utils.ErrInvalidHandle {
+			return nil, ErrWalletInviteeNotFound
+		}
+
+		return user, err
+	}
+
+	var user models.User
+	result := db.Where("lower(email) = ?", strings.ToLower(strings.TrimSpace(invitee))).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrWalletInviteeNotFound
+	}
+
+	return &user, nil
+}
+
+// AcceptWalletInvitation makes the invitee a member of the wallet with the
+// role of the invitation.
+func AcceptWalletInvitation(db *gorm.DB, userID string, id string) (*models.WalletMember, error) {
+	var member models.WalletMember
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := respondWalletInvitation(tx, userID, id, models.WalletInvitationAccepted)
+		if err != nil {
+			return err
+		}
+
+		member = models.WalletMember{
+			WalletID:           invitation.WalletID,
+			UserID:             invitation.InviteeID,
+			Role:               invitation.Role,
+			DailySpendingLimit: invitation.DailySpendingLimit,
+			AddedByID:          invitation.InvitedByID,
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&member)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrWalletInviteeMember
+		}
+
+		if err := tx.Preload("User").Preload("Wallet.User").First(&member, "id = ?", member.ID).Error; err != nil {
+			return err
+		}
+
+		return PublishEvent(tx, invitation.InvitedByID, nil, models.EventWalletMemberAdded, models.WalletMemberFilterRecord(&member))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// DeclineWalletInvitation closes a pending invitation sent to the user.
+func DeclineWalletInvitation(db *gorm.DB, userID string, id string) (*models.WalletInvitation, error) {
+	var invitation *models.WalletInvitation
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invitation, err = respondWalletInvitation(tx, userID, id, models.WalletInvitationDeclined)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// respondWalletInvitation locks a pending invitation of the invitee and
+// closes it with the given status. Expired invitations are closed as expired
+// and ErrWalletInvitationExpired is returned.
+func respondWalletInvitation(tx *gorm.DB, userID string, id string, status string) (*models.WalletInvitation, error) {
+	var invitation models.WalletInvitation
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? and invitee_id = ? and status = ?", id, userID, models.WalletInvitationPending).Limit(1).Find(&invitation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrWalletInvitationNotFound
+	}
+
+	now := time.Now()
+	if invitation.ExpiresAt.Before(now) {
+		status = models.WalletInvitationExpired
+	}
+
+	err := tx.Model(&invitation).Updates(map[string]interface{}{"status": status, "responded_at": now, "updated_at": now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if status == models.WalletInvitationExpired {
+		return nil, ErrWalletInvitationExpired
+	}
+
+	if err := preloadWalletInvitation(tx).First(&invitation, "id = ?", invitation.ID).Error; err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// RevokeWalletInvitation withdraws a pending invitation of the wallet.
+func RevokeWalletInvitation(db *gorm.DB, walletID string, id string) error {
+	now := time.Now()
+	result := db.Model(&models.WalletInvitation{}).
+		Where("id = ? and wallet_id = ? and status = ?", id, walletID, models.WalletInvitationPending).
+		Updates(map[string]interface{}{"status": models.WalletInvitationRevoked, "responded_at": now, "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrWalletInvitationNotFound
+	}
+
+	return nil
+}
+
+// FindWalletMember returns a member of the wallet.
+func FindWalletMember(db *gorm.DB, walletID string, id string) (*models.WalletMember, error) {
+	var member models.WalletMember
+	result := db.Preload("User").Where("wallet_id = ? and id = ?", walletID, id).First(&member)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &member, nil
+}
+
+// UpdateWalletMember changes the role or the daily spending limit of a
+// member. Only spenders have a limit.
+func UpdateWalletMember(db *gorm.DB, member *models.WalletMember, req *models.WalletMemberUpdateRequest) (*models.WalletMember, error) {
+	if req.Role != "" {
+		member.Role = req.Role
+	}
+
+	if req.DailySpendingLimit != nil {
+		member.DailySpendingLimit = utils.RoundAmount(*req.DailySpendingLimit)
+	}
+
+	if member.Role != models.WalletRoleSpender {
+		member.DailySpendingLimit = 0
+	}
+
+	err := db.Model(member).Updates(map[string]interface{}{
+		"role":                 member.Role,
+		"daily_spending_limit": member.DailySpendingLimit,
+		"updated_at":           time.Now(),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return FindWalletMember(db, member.WalletID.String(), member.ID.String())
+}
+
+// RemoveWalletMember takes the access of a member to the wallet away.
+func RemoveWalletMember(db *gorm.DB, member *models.WalletMember) error {
+	return db.Delete(&models.WalletMember{}, "id = ?", member.ID).Error
+}
+
+// checkMemberSpending enforces the role and the daily spending limit of the
+// member who initiated a transaction from a wallet, locked by the caller. The
+// owner of the wallet and transactions without an initiator are not limited.
+func checkMemberSpending(tx *gorm.DB, transaction *models.Transaction, from *models.Wallet) error {
+	if transaction.InitiatedByID == nil || transaction.Type == models.TransactionTypeReversal {
+		return nil
+	}
+
+	if from.UserID != nil && from.UserID.String() == transaction.InitiatedByID.String() {
+		return nil
+	}
+
+	var member models.WalletMember
+	result := tx.Where("wallet_id = ? and user_id = ?", from.ID, transaction.InitiatedByID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 || !models.WalletRoleAllows(member.Role, models.WalletAccessSpend) {
+		return ErrWalletPermission
+	}
+
+	// Refunds move money out of the wallet like any payment, so they count
+	// against the limit as well.
+	if member.Role != models.WalletRoleSpender || member.DailySpendingLimit <= 0 {
+		return nil
+	}
+
+	day, _ := limitPeriods(time.Now())
+
+	var spent float64
+	err := tx.Model(&models.Transaction{}).
+		Select("coalesce(sum(case when fee_paid_by = ? then amount + fee else amount end), 0)", models.FeePaidBySender).
+		Where("from_wallet_id = ? and initiated_by_id = ? and created_at >= ?", from.ID, transaction.InitiatedByID, day).
+		Where("type <> ?", models.TransactionTypeReversal).
+		Scan(&spent).Error
+	if err != nil {
+		return err
+	}
+
+	if utils.RoundAmount(spent+transaction.DebitAmount()) > member.DailySpendingLimit {
+		return ErrMemberSpendingLimit
+	}
+
+	return nil
+}
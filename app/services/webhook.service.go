@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/webhook"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EnqueueWebhookDeliveries creates a pending delivery of the event for every
+// active endpoint of the user that is subscribed to it. Endpoints scoped to a
+// merchant only receive events of that merchant. Endpoints that already have
+// a delivery of the event are skipped, so relaying an event twice is harmless.
+func EnqueueWebhookDeliveries(tx *gorm.DB, event *models.OutboxEvent) error {
+	if event.UserID == nil {
+		return nil
+	}
+
+	query := tx.Where("user_id = ? and active = ?", event.UserID.String(), true)
+	if event.MerchantID != nil {
+		query = query.Where("merchant_id is null or merchant_id = ?", event.MerchantID.String())
+	} else {
+		query = query.Where("merchant_id is null")
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := query.Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribed(event.Type) {
+			continue
+		}
+
+		var count int64
+		err := tx.Model(&models.WebhookDelivery{}).
+			Where("endpoint_id = ? and event_id = ?", endpoint.ID.String(), event.ID.String()).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		delivery := models.WebhookDelivery{
+			EndpointID: endpoint.ID,
+			EventID:    event.ID,
+			EventType:  event.Type,
+			Payload:    event.Payload,
+			Status:     models.WebhookDeliveryPending,
+		}
+
+		if err := tx.Create(&delivery).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RedeliverWebhook queues a new delivery with the payload of an earlier one.
+func RedeliverWebhook(db *gorm.DB, delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	redelivery := models.WebhookDelivery{
+		EndpointID: delivery.EndpointID,
+		EventID:    delivery.EventID,
+		EventType:  delivery.EventType,
+		Payload:    delivery.Payload,
+		Status:     models.WebhookDeliveryPending,
+	}
+
+	if err := db.Create(&redelivery).Error; err != nil {
+		return nil, err
+	}
+
+	return &redelivery, nil
+}
+
+// webhookLease is how long a claimed delivery is hidden from other workers
+// while it is being sent.
+const webhookLease = 2 * time.Minute
+
+// DeliverDueWebhooks sends up to limit pending deliveries whose next attempt
+// is due. Deliveries are claimed with SKIP LOCKED and a short lease before
+// sending, so several instances can run this concurrently without sending
+// the same delivery twice and without holding a transaction during requests.
+func DeliverDueWebhooks(ctx context.Context, db *gorm.DB, client *http.Client, limit int) (int, error) {
+	var deliveries []models.WebhookDelivery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? and next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+			Order("next_attempt_at").Limit(limit).Find(&deliveries)
+		if result.Error != nil || len(deliveries) == 0 {
+			return result.Error
+		}
+
+		ids := make([]string, 0, len(deliveries))
+		for _, d := range deliveries {
+			ids = append(ids, d.ID.String())
+		}
+
+		return tx.Model(&models.WebhookDelivery{}).Where("id in ?", ids).
+			Update("next_attempt_at", time.Now().Add(webhookLease)).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		if err := db.Preload("Endpoint").First(&deliveries[i], "id = ?", deliveries[i].ID.String()).Error; err != nil {
+			return i, err
+		}
+
+		if err := attemptWebhookDelivery(ctx, db, client, &deliveries[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+func attemptWebhookDelivery(ctx context.Context, db *gorm.DB, client *http.Client, delivery *models.WebhookDelivery) error {
+	result, sendErr := webhook.Send(ctx, client, webhook.Request{
+		URL:        delivery.Endpoint.URL,
+		Secret:     delivery.Endpoint.Secret,
+		Event:      delivery.EventType,
+		DeliveryID: delivery.ID.String(),
+		Body:       []byte(delivery.Payload),
+	})
+
+	attempt := models.WebhookAttempt{
+		DeliveryID:   delivery.ID,
+		StatusCode:   result.StatusCode,
+		ResponseBody: result.Body,
+		DurationMs:   result.Duration.Milliseconds(),
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts":         delivery.Attempts + 1,
+		"last_status_code": result.StatusCode,
+		"updated_at":       now,
+	}
+
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case delivery.Attempts+1 >= delivery.MaxAttempts || !delivery.Endpoint.Active:
+		attempt.Error = sendErr.Error()
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["last_error"] = sendErr.Error()
+	default:
+		attempt.Error = sendErr.Error()
+		updates["next_attempt_at"] = now.Add(webhook.Backoff(delivery.Attempts + 1))
+		updates["last_error"] = sendErr.Error()
+	}
+
+	if err := db.Create(&attempt).Error; err != nil {
+		return err
+	}
+
+	return db.Model(delivery).Updates(updates).Error
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"strings"
+	"time"
+)
+
+// RoundAmount rounds an amount to the 2 decimals stored in the database.
+func RoundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// GenerateReference returns a unique, human readable reference such as
+// TRX20240101A1B2C3D4E5F6.
+func GenerateReference(prefix string) string {
+	randomBytes := make([]byte, 6)
+	_, _ = rand.Read(randomBytes)
+
+	return prefix + time.Now().Format("20060102") + strings.ToUpper(hex.EncodeToString(randomBytes))
+}
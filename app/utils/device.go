@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ParseDeviceFromCtx identifies the device of the request by its X-Device-ID
+// header. Clients that do not send one are identified by a fingerprint of
+// their user agent.
+func ParseDeviceFromCtx(c *fiber.Ctx) models.RequestDevice {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+
+	id := c.Get("X-Device-ID")
+	if len(id) > 128 {
+		id = id[:128]
+	}
+
+	if id == "" && userAgent != "" {
+		sum := sha256.Sum256([]byte(userAgent))
+		id = "ua:" + hex.EncodeToString(sum[:16])
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	return models.RequestDevice{
+		ID:        id,
+		IP:        c.IP(),
+		UserAgent: userAgent,
+	}
+}
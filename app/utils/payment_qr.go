@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/signer"
+)
+
+const PaymentQRPrefix = "RSMPAY1."
+
+var (
+	ErrPaymentQRInvalid = errors.New("The payment QR code is invalid or has been tampered with")
+	ErrPaymentQRExpired = errors.New("The payment QR code has expired")
+)
+
+func SignPaymentQR(secret string, payload *models.PaymentQRPayload) (string, error) {
+	return signer.Sign(secret, PaymentQRPrefix, payload)
+}
+
+// VerifyPaymentQR checks the signature, expiry and address of a payment QR
+// payload before it is shown to the payer.
+func VerifyPaymentQR(secret string, token string) (*models.PaymentQRPayload, error) {
+	var payload models.PaymentQRPayload
+	if err := signer.Verify(secret, PaymentQRPrefix, token, &payload); err != nil {
+		return nil, ErrPaymentQRInvalid
+	}
+
+	if _, err := ValidateWalletAddress(payload.Address); err != nil {
+		return nil, ErrPaymentQRInvalid
+	}
+
+	if time.Now().Unix() > payload.ExpiresAt {
+		return nil, ErrPaymentQRExpired
+	}
+
+	return &payload, nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/pkg/qris"
+)
+
+const (
+	// QRISGloballyUniqueID identifies Rosamsoe wallets in the merchant
+	// account information of a QRIS payload.
+	QRISGloballyUniqueID = "ID.CO.ROSAMSOE.WWW"
+
+	QRISDefaultMerchantCategory = "5999"
+	qrisMerchantCriteria        = "UMI"
+	qrisMerchantAccountTag      = "26"
+)
+
+// BuildWalletQRIS encodes a static, or when an amount is given dynamic, QRIS
+// payload that pays into the wallet.
+func BuildWalletQRIS(wallet *models.Wallet, merchantName string, payload *models.QRISCreateRequest) (string, error) {
+	currency, err := qris.CurrencyCode(wallet.Currency)
+	if err != nil {
+		return "", err
+	}
+
+	category := payload.MerchantCategory
+	if category == "" {
+		category = QRISDefaultMerchantCategory
+	}
+
+	return qris.Encode(&qris.Payload{
+		Dynamic: payload.Amount > 0,
+		MerchantAccounts: []qris.MerchantAccount{{
+			Tag:              qrisMerchantAccountTag,
+			GloballyUniqueID: QRISGloballyUniqueID,
+			PAN:              wallet.Address,
+			Criteria:         qrisMerchantCriteria,
+		}},
+		MerchantCategory: category,
+		Currency:         currency,
+		Amount:           RoundAmount(payload.Amount),
+		CountryCode:      "ID",
+		MerchantName:     strings.ToUpper(merchantName),
+		MerchantCity:     strings.ToUpper(payload.MerchantCity),
+		PostalCode:       payload.PostalCode,
+		BillNumber:       payload.BillNumber,
+	})
+}
+
+// QRISWalletAddress returns the Rosamsoe wallet address inside a parsed QRIS
+// payload, if the payload can be paid with Rosamsoe.
+func QRISWalletAddress(p *qris.Payload) (string, bool) {
+	account, ok := p.MerchantAccount(QRISGloballyUniqueID)
+	if !ok {
+		return "", false
+	}
+
+	address, err := ValidateWalletAddress(account.PAN)
+	if err != nil {
+		return "", false
+	}
+
+	return address, true
+}
+
+// QRISFilterRecord describes a QRIS payload. The merchant of a Rosamsoe
+// payload is the merchant its wallet settles payments for, nil when it does
+// not resolve to one. Its name, city and category are shown instead of those
+// in the payload, which anyone can write, and only then is it payable.
+func QRISFilterRecord(data string, p *qris.Payload, merchant *models.Merchant) models.QRISResponse {
+	currency, _ := qris.CurrencyName(p.Currency)
+	address, payable := QRISWalletAddress(p)
+
+	res := models.QRISResponse{
+		Payload:          data,
+		Dynamic:          p.Dynamic,
+		MerchantName:     p.MerchantName,
+		MerchantCity:     p.MerchantCity,
+		MerchantCategory: p.MerchantCategory,
+		Amount:           p.Amount,
+		Currency:         currency,
+		BillNumber:       p.BillNumber,
+		Address:          address,
+		Payable:          payable && merchant != nil && currency != "",
+	}
+
+	if merchant != nil {
+		res.MerchantName, res.MerchantCity, res.MerchantCategory = merchant.Name, merchant.City, merchant.MerchantCategory
+	}
+
+	return res
+}
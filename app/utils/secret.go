@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// GenerateSecret returns a random secret with the given prefix, e.g. whsec_...
+func GenerateSecret(prefix string) (string, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + hex.EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+var ErrInvalidHandle = errors.New("Handle must be 3-30 characters long and may only contain letters, numbers and underscores")
+
+// NormalizeHandle strips the optional leading "@" and lowercases the handle,
+// so "@Alice" and "alice" refer to the same user.
+func NormalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+
+	if !handlePattern.MatchString(handle) {
+		return "", ErrInvalidHandle
+	}
+
+	return handle, nil
+}
+
+// IsHandle reports whether a payment recipient refers to a handle rather than
+// a wallet address.
+func IsHandle(recipient string) bool {
+	return strings.HasPrefix(strings.TrimSpace(recipient), "@")
+}
@@ -2,15 +2,40 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"strings"
 
 	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Wallet addresses are made of a network prefix, a random 40 character hex
+// body and a trailing 8 character hex checksum, e.g.
+//
+//	rsm 3f9c...e41a 1b2c3d4e
+//
+// The checksum is the first 4 bytes of sha256(prefix + body), which makes it
+// practically impossible for a mistyped address to still be valid.
+const (
+	WalletAddressPrefix = "rsm"
+
+	walletAddressBodyLength     = 40
+	walletAddressChecksumLength = 8
+	WalletAddressLength         = len(WalletAddressPrefix) + walletAddressBodyLength + walletAddressChecksumLength
+)
+
+var (
+	ErrWalletAddressEmpty      = errors.New("Wallet address is required")
+	ErrWalletAddressPrefix     = errors.New("Wallet address must start with \"" + WalletAddressPrefix + "\"")
+	ErrWalletAddressLength     = errors.New("Wallet address has an invalid length, please check that it was copied completely")
+	ErrWalletAddressCharacters = errors.New("Wallet address contains invalid characters, only 0-9 and a-f are allowed after the prefix")
+	ErrWalletAddressChecksum   = errors.New("Wallet address checksum does not match, please check the address for typos")
 )
 
 func GenerateWalletAddress() (string, error) {
-	length := 40
-	byteLength := length / 2
+	byteLength := walletAddressBodyLength / 2
 	randomBytes := make([]byte, byteLength)
 
 	_, err := rand.Read(randomBytes)
@@ -18,11 +43,72 @@ func GenerateWalletAddress() (string, error) {
 		return "", err
 	}
 
-	address := hex.EncodeToString(randomBytes)
+	return ChecksumWalletAddress(hex.EncodeToString(randomBytes)), nil
+}
+
+// ChecksumWalletAddress builds a full wallet address from a 40 character hex body.
+func ChecksumWalletAddress(body string) string {
+	body = strings.ToLower(body)
+
+	return WalletAddressPrefix + body + walletAddressChecksum(body)
+}
+
+// ValidateWalletAddress checks the prefix, length, characters and checksum of
+// the given address and returns it in its canonical (lowercase) form.
+func ValidateWalletAddress(address string) (string, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+
+	if address == "" {
+		return "", ErrWalletAddressEmpty
+	}
+
+	if !strings.HasPrefix(address, WalletAddressPrefix) {
+		return "", ErrWalletAddressPrefix
+	}
+
+	if len(address) != WalletAddressLength {
+		return "", ErrWalletAddressLength
+	}
+
+	rest := strings.TrimPrefix(address, WalletAddressPrefix)
+	if _, err := hex.DecodeString(rest); err != nil {
+		return "", ErrWalletAddressCharacters
+	}
+
+	body := rest[:walletAddressBodyLength]
+	checksum := rest[walletAddressBodyLength:]
+	if checksum != walletAddressChecksum(body) {
+		return "", ErrWalletAddressChecksum
+	}
 
 	return address, nil
 }
 
+// IsLegacyWalletAddress reports whether the address was generated before
+// checksummed addresses were introduced (40 raw hex characters).
+func IsLegacyWalletAddress(address string) bool {
+	if len(address) != walletAddressBodyLength {
+		return false
+	}
+
+	_, err := hex.DecodeString(address)
+
+	return err == nil
+}
+
+// ParseAddressFromCtx returns the address validated by the wallet address middleware.
+func ParseAddressFromCtx(c *fiber.Ctx) string {
+	address := c.Locals("address").(string)
+
+	return address
+}
+
+func walletAddressChecksum(body string) string {
+	sum := sha256.Sum256([]byte(WalletAddressPrefix + body))
+
+	return hex.EncodeToString(sum[:walletAddressChecksumLength/2])
+}
+
 func ValidWalletCurrency(currency string) bool {
 	for _, v := range models.WalletCurrencies {
 		if strings.EqualFold(v, currency) {
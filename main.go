@@ -1,11 +1,14 @@
 package main
 
 import (
+	"github.com/fatfatcocofat/rosamsoe/app/services"
 	_ "github.com/fatfatcocofat/rosamsoe/docs"
 	"github.com/fatfatcocofat/rosamsoe/pkg/config"
 	"github.com/fatfatcocofat/rosamsoe/pkg/server"
+	"github.com/fatfatcocofat/rosamsoe/platform/broker"
 	"github.com/fatfatcocofat/rosamsoe/platform/database"
 	"github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"github.com/fatfatcocofat/rosamsoe/platform/storage"
 )
 
 // @title Rosamsoe API
@@ -27,11 +30,36 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to load environment variables")
 	}
 
+	err = cfg.Validate()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
 	err = database.ConnectDB(&cfg)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to connect to the Database")
 	}
 
+	err = broker.ConnectBroker(&cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to start the realtime broker")
+	}
+
+	err = storage.ConnectStorage(&cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to connect to the blob storage")
+	}
+
+	err = services.LoadRiskRules(cfg.RiskRulesFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load the risk rules")
+	}
+
+	err = services.LoadSanctionsList(cfg.SanctionsListFile, cfg.SanctionsMatchThreshold)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load the watchlist")
+	}
+
 	app := server.New(&cfg)
 	app.Serve()
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"time"
 
 	"github.com/spf13/viper"
@@ -18,6 +19,47 @@ type Config struct {
 
 	JwtSecret    string        `mapstructure:"JWT_SECRET"`
 	JwtExpiresIn time.Duration `mapstructure:"JWT_EXPIRED_IN"`
+
+	PaymentSigningSecret string `mapstructure:"PAYMENT_SIGNING_SECRET"`
+
+	PubSubDriver string `mapstructure:"PUBSUB_DRIVER"`
+
+	OutboxPublishers string `mapstructure:"OUTBOX_PUBLISHERS"`
+	OutboxHTTPURL    string `mapstructure:"OUTBOX_HTTP_URL"`
+
+	AdminUserIDs string `mapstructure:"ADMIN_USER_IDS"`
+
+	StorageDriver    string `mapstructure:"STORAGE_DRIVER"`
+	StorageLocalPath string `mapstructure:"STORAGE_LOCAL_PATH"`
+
+	RiskRulesFile string `mapstructure:"RISK_RULES_FILE"`
+
+	SanctionsListFile       string  `mapstructure:"SANCTIONS_LIST_FILE"`
+	SanctionsMatchThreshold float64 `mapstructure:"SANCTIONS_MATCH_THRESHOLD"`
+
+	ReconciliationFreeze bool `mapstructure:"RECONCILIATION_FREEZE"`
+}
+
+// MinSecretLength is the minimum length in bytes of the keys tokens and
+// payment payloads are signed with.
+const MinSecretLength = 32
+
+var (
+	ErrJwtSecret            = errors.New("JWT_SECRET must be at least 32 bytes long")
+	ErrPaymentSigningSecret = errors.New("PAYMENT_SIGNING_SECRET must be at least 32 bytes long")
+)
+
+// Validate reports settings the server can not safely run with.
+func (c *Config) Validate() error {
+	if len(c.JwtSecret) < MinSecretLength {
+		return ErrJwtSecret
+	}
+
+	if len(c.PaymentSigningSecret) < MinSecretLength {
+		return ErrPaymentSigningSecret
+	}
+
+	return nil
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	secret := strings.Repeat("s", MinSecretLength)
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr error
+	}{
+		{"valid", Config{JwtSecret: secret, PaymentSigningSecret: secret}, nil},
+		{"missing jwt secret", Config{PaymentSigningSecret: secret}, ErrJwtSecret},
+		{"short jwt secret", Config{JwtSecret: secret[1:], PaymentSigningSecret: secret}, ErrJwtSecret},
+		{"missing payment signing secret", Config{JwtSecret: secret}, ErrPaymentSigningSecret},
+		{"short payment signing secret", Config{JwtSecret: secret, PaymentSigningSecret: "secret"}, ErrPaymentSigningSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"a * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"@every",
+	}
+
+	for _, expr := range tests {
+		if _, err := Parse(expr); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("Parse(%q) error = %v, want %v", expr, err, ErrInvalidExpression)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, jakarta)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2024-03-10 10:15", "2024-03-10 10:16"},
+		{"*/15 * * * *", "2024-03-10 10:15", "2024-03-10 10:30"},
+		{"*/15 * * * *", "2024-03-10 10:50", "2024-03-10 11:00"},
+		{"5/20 * * * *", "2024-03-10 10:30", "2024-03-10 10:45"},
+		{"0 2 * * *", "2024-03-10 02:00", "2024-03-11 02:00"},
+		{"30 9-17/4 * * *", "2024-03-10 14:00", "2024-03-10 17:30"},
+		{"0 0 1,15 * *", "2024-03-02 00:00", "2024-03-15 00:00"},
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 9 * * 1-5", "2024-03-08 10:00", "2024-03-11 09:00"},
+		{"0 9 * * 7", "2024-03-08 10:00", "2024-03-10 09:00"},
+		{"0 9 * * 0", "2024-03-08 10:00", "2024-03-10 09:00"},
+		{"0 0 13 * 5", "2024-03-02 00:00", "2024-03-08 00:00"},
+		{"59 23 31 12 *", "2024-12-31 23:59", "2025-12-31 23:59"},
+		{"@hourly", "2024-03-10 10:15", "2024-03-10 11:00"},
+		{"@daily", "2024-03-10 10:15", "2024-03-11 00:00"},
+		{"@weekly", "2024-03-10 10:15", "2024-03-17 00:00"},
+		{"@monthly", "2024-12-10 10:15", "2025-01-01 00:00"},
+		{"@YEARLY", "2024-03-10 10:15", "2025-01-01 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+" after "+tt.from, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			got := schedule.Next(at(tt.from))
+			if want := at(tt.want); !got.Equal(want) || got.Location() != jakarta {
+				t.Errorf("Next() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNextSkipsSeconds(t *testing.T) {
+	schedule, err := Parse("* * * * *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	from := time.Date(2024, 3, 10, 10, 15, 59, 999, time.UTC)
+	if got, want := schedule.Next(from), time.Date(2024, 3, 10, 10, 16, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next() = %v, want the zero time", got)
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+func WalletAddressMiddleware(c *fiber.Ctx) error {
+	address, err := utils.ValidateWalletAddress(c.Params("address"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
+
+	c.Locals("address", address)
+
+	return c.Next()
+}
+
+func UseWalletAddressMiddleware() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return WalletAddressMiddleware(c)
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminMiddleware only lets users with the admin role through, it must run
+// after the auth middleware.
+func AdminMiddleware(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.UserResponse)
+	if !ok || user.Role != models.UserRoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "This endpoint is only available to administrators",
+		})
+	}
+
+	return c.Next()
+}
+
+func UseAdminMiddleware() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return AdminMiddleware(c)
+	}
+}
@@ -71,3 +71,20 @@ func UseAuthMiddleware(config *config.Config) func(c *fiber.Ctx) error {
 		return AuthMiddleware(config, c)
 	}
 }
+
+// QueryTokenMiddleware copies an access_token query parameter into the
+// Authorization header. It is only meant for endpoints used by clients that
+// can not set headers, such as the browser EventSource API.
+func QueryTokenMiddleware(c *fiber.Ctx) error {
+	if token := c.Query("access_token"); token != "" && c.Get("Authorization") == "" {
+		c.Request().Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.Next()
+}
+
+func UseQueryTokenMiddleware() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return QueryTokenMiddleware(c)
+	}
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// UUIDParamMiddleware rejects requests whose route param is not a valid UUID,
+// so controllers never query the database with malformed IDs.
+func UUIDParamMiddleware(param string, c *fiber.Ctx) error {
+	if _, err := uuid.Parse(c.Params(param)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid " + param + " format",
+		})
+	}
+
+	return c.Next()
+}
+
+func UseUUIDParamMiddleware(param string) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return UUIDParamMiddleware(param, c)
+	}
+}
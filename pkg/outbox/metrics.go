@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Metrics tracks how far the relay is behind the events written to the outbox.
+type Metrics struct {
+	mu sync.Mutex
+
+	Published      int64
+	Failed         int64
+	Dead           int64
+	Pending        int64
+	OldestPending  time.Duration
+	LastPublishLag time.Duration
+	LastRelayAt    time.Time
+}
+
+func (m *Metrics) ObservePublished(createdAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Published++
+	m.LastPublishLag = time.Since(createdAt)
+}
+
+func (m *Metrics) ObserveFailed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Failed++
+}
+
+// ObserveDead counts an event that is given up on.
+func (m *Metrics) ObserveDead() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Dead++
+}
+
+func (m *Metrics) ObserveBacklog(pending int64, oldest time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Pending = pending
+	m.OldestPending = oldest
+	m.LastRelayAt = time.Now()
+}
+
+func (m *Metrics) Snapshot() Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return Metrics{
+		Published:      m.Published,
+		Failed:         m.Failed,
+		Dead:           m.Dead,
+		Pending:        m.Pending,
+		OldestPending:  m.OldestPending,
+		LastPublishLag: m.LastPublishLag,
+		LastRelayAt:    m.LastRelayAt,
+	}
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	s := m.Snapshot()
+
+	fmt.Fprintf(w, "# HELP rosamsoe_outbox_published_total Events published by the outbox relay.\n")
+	fmt.Fprintf(w, "# TYPE rosamsoe_outbox_published_total counter\n")
+	fmt.Fprintf(w, "rosamsoe_outbox_published_total %d\n", s.Published)
+	fmt.Fprintf(w, "# HELP rosamsoe_outbox_failed_total Failed attempts to publish an event.\n")
+	fmt.Fprintf(w, "# TYPE rosamsoe_outbox_failed_total counter\n")
+	fmt.Fprintf(w, "rosamsoe_outbox_failed_total %d\n", s.Failed)
+	fmt.Fprintf(w, "# HELP rosamsoe_outbox_dead_total Events given up on after failing to publish.\n")
+	fmt.Fprintf(w, "# TYPE rosamsoe_outbox_dead_total counter\n")
+	fmt.Fprintf(w, "rosamsoe_outbox_dead_total %d\n", s.Dead)
+	fmt.Fprintf(w, "# HELP rosamsoe_outbox_pending_events Events waiting to be published.\n")
+	fmt.Fprintf(w, "# TYPE rosamsoe_outbox_pending_events gauge\n")
+	fmt.Fprintf(w, "rosamsoe_outbox_pending_events %d\n", s.Pending)
+	fmt.Fprintf(w, "# HELP rosamsoe_outbox_oldest_pending_seconds Age of the oldest pending event.\n")
+	fmt.Fprintf(w, "# TYPE rosamsoe_outbox_oldest_pending_seconds gauge\n")
+	fmt.Fprintf(w, "rosamsoe_outbox_oldest_pending_seconds %f\n", s.OldestPending.Seconds())
+	fmt.Fprintf(w, "# HELP rosamsoe_outbox_publish_lag_seconds Time between writing and publishing the last event.\n")
+	fmt.Fprintf(w, "# TYPE rosamsoe_outbox_publish_lag_seconds gauge\n")
+	fmt.Fprintf(w, "rosamsoe_outbox_publish_lag_seconds %f\n", s.LastPublishLag.Seconds())
+}
@@ -0,0 +1,25 @@
+// Package outbox contains the publishers the outbox relay sends committed
+// domain events to. Delivery is at-least-once: an event may be published
+// more than once, so consumers must deduplicate by Message.ID.
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+type Message struct {
+	// ID is unique per event and stays the same when an event is
+	// published again, consumers use it to drop duplicates.
+	ID         string
+	Type       string
+	UserID     string
+	MerchantID string
+	Payload    []byte
+	CreatedAt  time.Time
+}
+
+type EventPublisher interface {
+	Name() string
+	Publish(ctx context.Context, message Message) error
+}
@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogPublisher writes every event to the log, which is useful in development.
+type LogPublisher struct {
+	Logger *zerolog.Logger
+}
+
+func (p *LogPublisher) Name() string {
+	return "log"
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, message Message) error {
+	p.Logger.Info().Str("id", message.ID).Str("type", message.Type).RawJSON("payload", message.Payload).Msg("Outbox event")
+
+	return nil
+}
+
+// HTTPPublisher posts every event as JSON to a fixed URL, e.g. an internal
+// event collector. The event ID is sent in the Idempotency-Key header.
+type HTTPPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *HTTPPublisher) Name() string {
+	return "http"
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, message Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(message.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", message.ID)
+	req.Header.Set("Rosamsoe-Event", message.Type)
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("outbox: http publisher got status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// SubjectConn is the part of a NATS style connection the broker publisher
+// needs: publishing to a subject with a message ID used for deduplication
+// (the Nats-Msg-Id header in JetStream).
+type SubjectConn interface {
+	PublishMsg(ctx context.Context, subject string, msgID string, data []byte) error
+}
+
+// BrokerPublisher publishes every event to "<prefix>.<event type>", e.g.
+// rosamsoe.events.wallet.created.
+type BrokerPublisher struct {
+	Conn   SubjectConn
+	Prefix string
+}
+
+func (p *BrokerPublisher) Name() string {
+	return "broker"
+}
+
+func (p *BrokerPublisher) Publish(ctx context.Context, message Message) error {
+	return p.Conn.PublishMsg(ctx, p.Prefix+"."+message.Type, message.ID, message.Payload)
+}
+
+// FakeBroker is an in-memory SubjectConn that deduplicates messages by ID
+// within a window, like a JetStream stream does. It stands in for a real
+// broker in development.
+type FakeBroker struct {
+	Window time.Duration
+
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	messages []FakeBrokerMessage
+	handlers map[string][]func(FakeBrokerMessage)
+}
+
+type FakeBrokerMessage struct {
+	Subject string
+	MsgID   string
+	Data    []byte
+}
+
+func NewFakeBroker(window time.Duration) *FakeBroker {
+	return &FakeBroker{
+		Window:   window,
+		seen:     make(map[string]time.Time),
+		handlers: make(map[string][]func(FakeBrokerMessage)),
+	}
+}
+
+func (b *FakeBroker) PublishMsg(ctx context.Context, subject string, msgID string, data []byte) error {
+	b.mu.Lock()
+
+	now := time.Now()
+	for id, at := range b.seen {
+		if now.Sub(at) > b.Window {
+			delete(b.seen, id)
+		}
+	}
+
+	if _, duplicate := b.seen[msgID]; duplicate {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.seen[msgID] = now
+	message := FakeBrokerMessage{Subject: subject, MsgID: msgID, Data: data}
+	b.messages = append(b.messages, message)
+
+	var handlers []func(FakeBrokerMessage)
+	for prefix, hs := range b.handlers {
+		if strings.HasPrefix(subject, prefix) {
+			handlers = append(handlers, hs...)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, h := range handlers {
+		h(message)
+	}
+
+	return nil
+}
+
+// Subscribe registers a handler for every subject starting with prefix.
+func (b *FakeBroker) Subscribe(prefix string, handler func(FakeBrokerMessage)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[prefix] = append(b.handlers[prefix], handler)
+}
+
+// Messages returns the deduplicated messages published so far.
+func (b *FakeBroker) Messages() []FakeBrokerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]FakeBrokerMessage(nil), b.messages...)
+}
@@ -0,0 +1,159 @@
+// Package pdf writes simple text-only PDF documents, such as statements, using
+// the standard Helvetica and Courier fonts so that no font has to be
+// embedded. Text is encoded with WinAnsiEncoding, characters outside of it
+// are replaced by a question mark.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points.
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+type Font string
+
+const (
+	Helvetica     Font = "F1"
+	HelveticaBold Font = "F2"
+	Courier       Font = "F3"
+)
+
+var baseFonts = []struct {
+	font Font
+	name string
+}{
+	{Helvetica, "Helvetica"},
+	{HelveticaBold, "Helvetica-Bold"},
+	{Courier, "Courier"},
+}
+
+// CourierWidth is the width of a string set in Courier, every glyph of which
+// is 0.6 of the font size wide. It is used to right align figures.
+func CourierWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * 0.6 * size
+}
+
+type Page struct {
+	content bytes.Buffer
+}
+
+// Text draws s with its baseline starting at x, y, measured in points from
+// the bottom left corner of the page.
+func (p *Page) Text(font Font, size float64, x float64, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// TextRight draws s in Courier ending at x.
+func (p *Page) TextRight(size float64, x float64, y float64, s string) {
+	p.Text(Courier, size, x-CourierWidth(s, size), y, s)
+}
+
+// Line draws a line of the given width from x1, y1 to x2, y2.
+func (p *Page) Line(x1 float64, y1 float64, x2 float64, y2 float64, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+type Document struct {
+	Title string
+	pages []*Page
+}
+
+func New(title string) *Document {
+	return &Document{Title: title}
+}
+
+// AddPage appends a blank A4 page to the document.
+func (d *Document) AddPage() *Page {
+	page := &Page{}
+	d.pages = append(d.pages, page)
+
+	return page
+}
+
+// Bytes renders the document. A document without pages gets one blank page.
+func (d *Document) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var buf bytes.Buffer
+	offsets := []int{}
+
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and the page tree, followed by the
+	// fonts, the document information and a page and content stream object
+	// per page.
+	fontsStart := 3
+	infoID := fontsStart + len(baseFonts)
+	pagesStart := infoID + 1
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pagesStart+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	fonts := make([]string, len(baseFonts))
+	for i, f := range baseFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.name))
+		fonts[i] = fmt.Sprintf("/%s %d 0 R", f.font, fontsStart+i)
+	}
+
+	object(fmt.Sprintf("<< /Title (%s) /Producer (Rosamsoe) >>", escape(d.Title)))
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, strings.Join(fonts, " "), pagesStart+i*2+1,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, infoID, xref)
+
+	return buf.Bytes()
+}
+
+// escape encodes s as the body of a PDF string literal in WinAnsiEncoding,
+// which matches Latin-1 for the characters that are kept.
+func escape(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+const subscriberBuffer = 64
+
+// MemoryBroker is an in-process Broker. It is enough for a single instance
+// and is used by PostgresBroker to fan out notifications locally.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Message]struct{}
+	closed      bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[string]map[chan Message]struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[topic] {
+		select {
+		case ch <- Message{Topic: topic, Payload: payload}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	ch := make(chan Message, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, nil
+	}
+
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan Message]struct{})
+	}
+	b.subscribers[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(topic, ch)
+	}()
+
+	return ch, nil
+}
+
+func (b *MemoryBroker) unsubscribe(topic string, ch chan Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[topic][ch]; !ok {
+		return
+	}
+
+	delete(b.subscribers[topic], ch)
+	if len(b.subscribers[topic]) == 0 {
+		delete(b.subscribers, topic)
+	}
+
+	close(ch)
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for topic, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(b.subscribers, topic)
+	}
+
+	b.closed = true
+
+	return nil
+}
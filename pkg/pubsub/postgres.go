@@ -0,0 +1,116 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxNotifyPayload is the size in bytes a NOTIFY payload must stay below.
+const maxNotifyPayload = 8000
+
+// PostgresBroker publishes messages with NOTIFY and listens on a single
+// channel, so that subscribers connected to any instance receive them.
+// Postgres limits a notification payload to 8000 bytes, larger messages are
+// refused with ErrMessageTooLarge.
+type PostgresBroker struct {
+	db      *sql.DB
+	dsn     string
+	channel string
+	local   *MemoryBroker
+	cancel  context.CancelFunc
+	done    chan struct{}
+	onError func(error)
+}
+
+// NewPostgresBroker starts listening on the channel with its own connection
+// and publishes through db. Listen errors are reported to onError and the
+// connection is re-established.
+func NewPostgresBroker(db *sql.DB, dsn string, channel string, onError func(error)) *PostgresBroker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &PostgresBroker{
+		db:      db,
+		dsn:     dsn,
+		channel: channel,
+		local:   NewMemoryBroker(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		onError: onError,
+	}
+
+	go b.listen(ctx)
+
+	return b
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	data, err := json.Marshal(Message{Topic: topic, Payload: payload})
+	if err != nil {
+		return err
+	}
+
+	if len(data) >= maxNotifyPayload {
+		return ErrMessageTooLarge
+	}
+
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, string(data))
+
+	return err
+}
+
+func (b *PostgresBroker) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	return b.local.Subscribe(ctx, topic)
+}
+
+func (b *PostgresBroker) Close() error {
+	b.cancel()
+	<-b.done
+
+	return b.local.Close()
+}
+
+func (b *PostgresBroker) listen(ctx context.Context) {
+	defer close(b.done)
+
+	for ctx.Err() == nil {
+		if err := b.listenOnce(ctx); err != nil && ctx.Err() == nil {
+			b.onError(err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+func (b *PostgresBroker) listenOnce(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var message Message
+		if err := json.Unmarshal([]byte(notification.Payload), &message); err != nil {
+			b.onError(err)
+			continue
+		}
+
+		_ = b.local.Publish(ctx, message.Topic, message.Payload)
+	}
+}
@@ -0,0 +1,17 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPostgresBrokerRefusesLargeMessages(t *testing.T) {
+	// The size is checked before the database is used.
+	b := &PostgresBroker{channel: "test"}
+
+	payload := []byte(`"` + strings.Repeat("x", maxNotifyPayload) + `"`)
+	if err := b.Publish(context.Background(), "user:1", payload); err != ErrMessageTooLarge {
+		t.Errorf("Publish() error = %v, want %v", err, ErrMessageTooLarge)
+	}
+}
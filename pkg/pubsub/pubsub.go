@@ -0,0 +1,29 @@
+// Package pubsub fans messages out to subscribers of a topic, either inside a
+// single process or across instances through Postgres LISTEN/NOTIFY.
+package pubsub
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMessageTooLarge is returned by brokers that can not carry a message of
+// this size, publishing it again will not help.
+var ErrMessageTooLarge = errors.New("pubsub: message too large")
+
+type Message struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+type Broker interface {
+	// Publish sends the payload to every current subscriber of the topic.
+	// Delivery is best effort, slow subscribers may miss messages.
+	Publish(ctx context.Context, topic string, payload []byte) error
+
+	// Subscribe returns a channel receiving the messages of the topic until
+	// ctx is cancelled, after which the channel is closed.
+	Subscribe(ctx context.Context, topic string) (<-chan Message, error)
+
+	Close() error
+}
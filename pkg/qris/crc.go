@@ -0,0 +1,26 @@
+package qris
+
+import "fmt"
+
+// CRC16 computes the CRC-16/CCITT-FALSE checksum (polynomial 0x1021, initial
+// value 0xFFFF) used by EMVCo merchant presented QR codes.
+func CRC16(data string) uint16 {
+	crc := uint16(0xFFFF)
+
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+func formatCRC(crc uint16) string {
+	return fmt.Sprintf("%04X", crc)
+}
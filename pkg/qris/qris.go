@@ -0,0 +1,345 @@
+// Package qris encodes and parses EMVCo merchant presented QR payloads as used
+// by QRIS, the Indonesian QR payment standard.
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	TagPayloadFormat       = "00"
+	TagPointOfInitiation   = "01"
+	TagMerchantCategory    = "52"
+	TagTransactionCurrency = "53"
+	TagTransactionAmount   = "54"
+	TagCountryCode         = "58"
+	TagMerchantName        = "59"
+	TagMerchantCity        = "60"
+	TagPostalCode          = "61"
+	TagAdditionalData      = "62"
+	TagCRC                 = "63"
+
+	// Sub tags of the merchant account information templates (26-51).
+	TagGloballyUniqueID = "00"
+	TagMerchantPAN      = "01"
+	TagMerchantID       = "02"
+	TagMerchantCriteria = "03"
+
+	// Sub tags of the additional data field template (62).
+	TagBillNumber     = "01"
+	TagReferenceLabel = "05"
+	TagTerminalLabel  = "07"
+
+	PayloadFormatIndicator   = "01"
+	PointOfInitiationStatic  = "11"
+	PointOfInitiationDynamic = "12"
+
+	CurrencyIDR = "360"
+	CurrencyUSD = "840"
+)
+
+var (
+	ErrInvalidCRC          = errors.New("qris: CRC checksum does not match, the code is damaged or was altered")
+	ErrMissingCRC          = errors.New("qris: payload does not end with a CRC")
+	ErrInvalidFormat       = errors.New("qris: unsupported payload format indicator")
+	ErrMissingMerchant     = errors.New("qris: payload has no merchant account information")
+	ErrInvalidAmount       = errors.New("qris: transaction amount is invalid")
+	ErrAmountOnStatic      = errors.New("qris: static payloads must not contain an amount")
+	ErrMissingAmount       = errors.New("qris: dynamic payloads must contain an amount")
+	ErrMissingMerchantName = errors.New("qris: merchant name and city are required")
+)
+
+// MerchantAccount is one of the merchant account information templates
+// (tags 26 to 51) identifying the acquirer and the merchant.
+type MerchantAccount struct {
+	Tag              string
+	GloballyUniqueID string
+	PAN              string
+	MerchantID       string
+	Criteria         string
+}
+
+type Payload struct {
+	Dynamic          bool
+	MerchantAccounts []MerchantAccount
+	MerchantCategory string
+	Currency         string
+	Amount           float64
+	CountryCode      string
+	MerchantName     string
+	MerchantCity     string
+	PostalCode       string
+	BillNumber       string
+	ReferenceLabel   string
+	TerminalLabel    string
+}
+
+// MerchantAccount returns the merchant account template with the given
+// globally unique identifier.
+func (p *Payload) MerchantAccount(guid string) (MerchantAccount, bool) {
+	for _, account := range p.MerchantAccounts {
+		if strings.EqualFold(account.GloballyUniqueID, guid) {
+			return account, true
+		}
+	}
+
+	return MerchantAccount{}, false
+}
+
+// Encode serialises the payload and appends its CRC.
+func Encode(p *Payload) (string, error) {
+	if len(p.MerchantAccounts) == 0 {
+		return "", ErrMissingMerchant
+	}
+
+	if p.MerchantName == "" || p.MerchantCity == "" {
+		return "", ErrMissingMerchantName
+	}
+
+	if p.Dynamic && p.Amount <= 0 {
+		return "", ErrMissingAmount
+	}
+
+	if !p.Dynamic && p.Amount != 0 {
+		return "", ErrAmountOnStatic
+	}
+
+	initiation := PointOfInitiationStatic
+	if p.Dynamic {
+		initiation = PointOfInitiationDynamic
+	}
+
+	objects := []TLV{
+		{TagPayloadFormat, PayloadFormatIndicator},
+		{TagPointOfInitiation, initiation},
+	}
+
+	for _, account := range p.MerchantAccounts {
+		value, err := EncodeTLV(nonEmpty([]TLV{
+			{TagGloballyUniqueID, account.GloballyUniqueID},
+			{TagMerchantPAN, account.PAN},
+			{TagMerchantID, account.MerchantID},
+			{TagMerchantCriteria, account.Criteria},
+		}))
+		if err != nil {
+			return "", err
+		}
+
+		objects = append(objects, TLV{account.Tag, value})
+	}
+
+	objects = append(objects,
+		TLV{TagMerchantCategory, p.MerchantCategory},
+		TLV{TagTransactionCurrency, p.Currency},
+	)
+
+	if p.Dynamic {
+		objects = append(objects, TLV{TagTransactionAmount, formatAmount(p.Amount)})
+	}
+
+	objects = append(objects,
+		TLV{TagCountryCode, p.CountryCode},
+		TLV{TagMerchantName, truncate(p.MerchantName, 25)},
+		TLV{TagMerchantCity, truncate(p.MerchantCity, 15)},
+		TLV{TagPostalCode, p.PostalCode},
+	)
+
+	additional, err := EncodeTLV(nonEmpty([]TLV{
+		{TagBillNumber, p.BillNumber},
+		{TagReferenceLabel, p.ReferenceLabel},
+		{TagTerminalLabel, p.TerminalLabel},
+	}))
+	if err != nil {
+		return "", err
+	}
+
+	objects = append(objects, TLV{TagAdditionalData, additional})
+
+	data, err := EncodeTLV(nonEmpty(objects))
+	if err != nil {
+		return "", err
+	}
+
+	data += TagCRC + "04"
+
+	return data + formatCRC(CRC16(data)), nil
+}
+
+// Parse validates the CRC of a payload and decodes it.
+func Parse(data string) (*Payload, error) {
+	data = strings.TrimSpace(data)
+
+	if len(data) < 8 || data[len(data)-8:len(data)-4] != TagCRC+"04" {
+		return nil, ErrMissingCRC
+	}
+
+	if !strings.EqualFold(data[len(data)-4:], formatCRC(CRC16(data[:len(data)-4]))) {
+		return nil, ErrInvalidCRC
+	}
+
+	objects, err := DecodeTLV(data[:len(data)-8])
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Payload{}
+	format := ""
+
+	for _, o := range objects {
+		switch {
+		case o.Tag == TagPayloadFormat:
+			format = o.Value
+		case o.Tag == TagPointOfInitiation:
+			p.Dynamic = o.Value == PointOfInitiationDynamic
+		case o.Tag >= "26" && o.Tag <= "51":
+			account, err := parseMerchantAccount(o)
+			if err != nil {
+				return nil, err
+			}
+
+			p.MerchantAccounts = append(p.MerchantAccounts, account)
+		case o.Tag == TagMerchantCategory:
+			p.MerchantCategory = o.Value
+		case o.Tag == TagTransactionCurrency:
+			p.Currency = o.Value
+		case o.Tag == TagTransactionAmount:
+			amount, err := strconv.ParseFloat(o.Value, 64)
+			if err != nil || amount <= 0 {
+				return nil, ErrInvalidAmount
+			}
+
+			p.Amount = amount
+		case o.Tag == TagCountryCode:
+			p.CountryCode = o.Value
+		case o.Tag == TagMerchantName:
+			p.MerchantName = o.Value
+		case o.Tag == TagMerchantCity:
+			p.MerchantCity = o.Value
+		case o.Tag == TagPostalCode:
+			p.PostalCode = o.Value
+		case o.Tag == TagAdditionalData:
+			if err := parseAdditionalData(p, o.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if format != PayloadFormatIndicator {
+		return nil, ErrInvalidFormat
+	}
+
+	if len(p.MerchantAccounts) == 0 {
+		return nil, ErrMissingMerchant
+	}
+
+	return p, nil
+}
+
+// WithAmount turns a static payload into a dynamic one carrying the amount,
+// which is what a payer app does after the payer typed in the amount.
+func WithAmount(data string, amount float64) (string, error) {
+	p, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+
+	p.Dynamic = true
+	p.Amount = amount
+
+	return Encode(p)
+}
+
+func parseMerchantAccount(o TLV) (MerchantAccount, error) {
+	objects, err := DecodeTLV(o.Value)
+	if err != nil {
+		return MerchantAccount{}, err
+	}
+
+	account := MerchantAccount{Tag: o.Tag}
+	for _, sub := range objects {
+		switch sub.Tag {
+		case TagGloballyUniqueID:
+			account.GloballyUniqueID = sub.Value
+		case TagMerchantPAN:
+			account.PAN = sub.Value
+		case TagMerchantID:
+			account.MerchantID = sub.Value
+		case TagMerchantCriteria:
+			account.Criteria = sub.Value
+		}
+	}
+
+	return account, nil
+}
+
+func parseAdditionalData(p *Payload, value string) error {
+	objects, err := DecodeTLV(value)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range objects {
+		switch sub.Tag {
+		case TagBillNumber:
+			p.BillNumber = sub.Value
+		case TagReferenceLabel:
+			p.ReferenceLabel = sub.Value
+		case TagTerminalLabel:
+			p.TerminalLabel = sub.Value
+		}
+	}
+
+	return nil
+}
+
+func formatAmount(amount float64) string {
+	s := strconv.FormatFloat(amount, 'f', 2, 64)
+
+	return strings.TrimSuffix(s, ".00")
+}
+
+func truncate(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max])
+	}
+
+	return s
+}
+
+func nonEmpty(objects []TLV) []TLV {
+	var result []TLV
+	for _, o := range objects {
+		if o.Value != "" {
+			result = append(result, o)
+		}
+	}
+
+	return result
+}
+
+// CurrencyCode returns the ISO 4217 numeric code of an alphabetic currency code.
+func CurrencyCode(currency string) (string, error) {
+	switch strings.ToUpper(currency) {
+	case "IDR":
+		return CurrencyIDR, nil
+	case "USD":
+		return CurrencyUSD, nil
+	}
+
+	return "", fmt.Errorf("qris: currency %s is not supported", currency)
+}
+
+// CurrencyName returns the ISO 4217 alphabetic code of a numeric currency code.
+func CurrencyName(code string) (string, error) {
+	switch code {
+	case CurrencyIDR:
+		return "IDR", nil
+	case CurrencyUSD:
+		return "USD", nil
+	}
+
+	return "", fmt.Errorf("qris: currency %s is not supported", code)
+}
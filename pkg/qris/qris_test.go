@@ -0,0 +1,262 @@
+package qris
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// emvcoExample is the merchant presented QR example of the EMVCo
+// specification, including its CRC.
+const emvcoExample = "00020101021229300012D156000000000510A93FO3230Q31280012D15600000001030812345678520441115802CN5914BEST TRANSPORT6007BEIJING64200002ZH0104最佳运输0202北京540523.7253031565502016233030412340603***0708A60086670902ME91320016A0112233449988770708123456786304A13A"
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want uint16
+	}{
+		{"check value", "123456789", 0x29B1},
+		{"empty", "", 0xFFFF},
+		{"emvco example", strings.TrimSuffix(emvcoExample, "A13A"), 0xA13A},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CRC16(tt.data); got != tt.want {
+				t.Errorf("CRC16() = %04X, want %04X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLVRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []TLV
+		want    string
+	}{
+		{"single", []TLV{{"00", "01"}}, "000201"},
+		{"several", []TLV{{"00", "01"}, {"01", "12"}, {"59", "Toko Rosa"}}, "0002010102125909Toko Rosa"},
+		{"empty value", []TLV{{"62", ""}}, "6200"},
+		{"longest value", []TLV{{"59", strings.Repeat("x", 99)}}, "5999" + strings.Repeat("x", 99)},
+		{"length counts characters", []TLV{{"01", "最佳运输"}, {"02", "北京"}}, "0104最佳运输0202北京"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeTLV(tt.objects)
+			if err != nil {
+				t.Fatalf("EncodeTLV() error = %v", err)
+			}
+
+			if data != tt.want {
+				t.Errorf("EncodeTLV() = %q, want %q", data, tt.want)
+			}
+
+			objects, err := DecodeTLV(data)
+			if err != nil {
+				t.Fatalf("DecodeTLV() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(objects, tt.objects) {
+				t.Errorf("DecodeTLV() = %v, want %v", objects, tt.objects)
+			}
+		})
+	}
+}
+
+func TestEncodeTLVInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []TLV
+	}{
+		{"short tag", []TLV{{"1", "a"}}},
+		{"long tag", []TLV{{"100", "a"}}},
+		{"value too long", []TLV{{"59", strings.Repeat("x", 100)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := EncodeTLV(tt.objects); err == nil {
+				t.Error("EncodeTLV() returned no error")
+			}
+		})
+	}
+}
+
+func TestDecodeTLVMalformed(t *testing.T) {
+	for _, data := range []string{"0", "000", "00x1a", "0005abc", "000201590", "00-1a"} {
+		if _, err := DecodeTLV(data); err != ErrMalformedTLV {
+			t.Errorf("DecodeTLV(%q) error = %v, want %v", data, err, ErrMalformedTLV)
+		}
+	}
+}
+
+func TestParseEMVCoExample(t *testing.T) {
+	p, err := Parse(emvcoExample)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := &Payload{
+		Dynamic: true,
+		MerchantAccounts: []MerchantAccount{
+			{Tag: "29", GloballyUniqueID: "D15600000000"},
+			{Tag: "31", GloballyUniqueID: "D15600000001", Criteria: "12345678"},
+		},
+		MerchantCategory: "4111",
+		Currency:         "156",
+		Amount:           23.72,
+		CountryCode:      "CN",
+		MerchantName:     "BEST TRANSPORT",
+		MerchantCity:     "BEIJING",
+		TerminalLabel:    "A6008667",
+	}
+
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Parse() = %+v, want %+v", p, want)
+	}
+}
+
+func testPayload() *Payload {
+	return &Payload{
+		MerchantAccounts: []MerchantAccount{
+			{Tag: "26", GloballyUniqueID: "ID.CO.ROSAMSOE.WWW", PAN: "9360012300000000011", MerchantID: "M0001", Criteria: "UMI"},
+		},
+		MerchantCategory: "5812",
+		Currency:         CurrencyIDR,
+		CountryCode:      "ID",
+		MerchantName:     "Warung Rosamsoe",
+		MerchantCity:     "Jakarta",
+		PostalCode:       "10110",
+		TerminalLabel:    "T01",
+	}
+}
+
+func TestEncodeParseRoundTrip(t *testing.T) {
+	dynamic := testPayload()
+	dynamic.Dynamic = true
+	dynamic.Amount = 15000.5
+	dynamic.BillNumber = "INV-1"
+	dynamic.ReferenceLabel = "REF-1"
+
+	tests := []struct {
+		name    string
+		payload *Payload
+	}{
+		{"static", testPayload()},
+		{"dynamic", dynamic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(tt.payload)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			if crc := data[len(data)-4:]; crc != formatCRC(CRC16(data[:len(data)-4])) {
+				t.Errorf("Encode() CRC = %s, want the CRC of the payload", crc)
+			}
+
+			p, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(p, tt.payload) {
+				t.Errorf("Parse(Encode()) = %+v, want %+v", p, tt.payload)
+			}
+		})
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(p *Payload)
+		wantErr error
+	}{
+		{"no merchant account", func(p *Payload) { p.MerchantAccounts = nil }, ErrMissingMerchant},
+		{"no merchant name", func(p *Payload) { p.MerchantName = "" }, ErrMissingMerchantName},
+		{"no merchant city", func(p *Payload) { p.MerchantCity = "" }, ErrMissingMerchantName},
+		{"static with amount", func(p *Payload) { p.Amount = 1000 }, ErrAmountOnStatic},
+		{"dynamic without amount", func(p *Payload) { p.Dynamic = true }, ErrMissingAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPayload()
+			tt.modify(p)
+
+			if _, err := Encode(p); err != tt.wantErr {
+				t.Errorf("Encode() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	static, err := Encode(testPayload())
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	withoutCRC := static[:len(static)-4]
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"too short", "6304", ErrMissingCRC},
+		{"no crc", withoutCRC[:len(withoutCRC)-4], ErrMissingCRC},
+		{"altered", strings.Replace(static, "Warung", "Wurang", 1), ErrInvalidCRC},
+		{"wrong crc", withoutCRC + "0000", ErrInvalidCRC},
+		{"unsupported format", signed("000202" + strings.TrimSuffix(strings.TrimPrefix(withoutCRC, "000201"), "6304")), ErrInvalidFormat},
+		{"no merchant account", signed("000201010211"), ErrMissingMerchant},
+		{"zero amount", signed("0002010102125403000"), ErrInvalidAmount},
+		{"malformed", signed("00020101"), ErrMalformedTLV},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); err != tt.wantErr {
+				t.Errorf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithAmount(t *testing.T) {
+	static, err := Encode(testPayload())
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	data, err := WithAmount(static, 25000)
+	if err != nil {
+		t.Fatalf("WithAmount() error = %v", err)
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !p.Dynamic || p.Amount != 25000 {
+		t.Errorf("WithAmount() = dynamic %v amount %v, want dynamic true amount 25000", p.Dynamic, p.Amount)
+	}
+
+	if !strings.Contains(data, "540525000") {
+		t.Errorf("WithAmount() = %q, want a whole amount without decimals", data)
+	}
+}
+
+// signed appends a valid CRC to data.
+func signed(data string) string {
+	data += TagCRC + "04"
+
+	return data + formatCRC(CRC16(data))
+}
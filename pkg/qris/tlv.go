@@ -0,0 +1,63 @@
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrMalformedTLV = errors.New("qris: malformed tag-length-value data")
+
+// TLV is a single EMVCo data object: a 2 digit tag, a 2 digit length and the
+// value. The length counts characters, not bytes, so that values in other
+// scripts such as the merchant name template (64) are encoded correctly.
+type TLV struct {
+	Tag   string
+	Value string
+}
+
+func (t TLV) String() string {
+	return fmt.Sprintf("%s%02d%s", t.Tag, utf8.RuneCountInString(t.Value), t.Value)
+}
+
+// EncodeTLV serialises the data objects in the given order.
+func EncodeTLV(objects []TLV) (string, error) {
+	var b strings.Builder
+	for _, o := range objects {
+		if len(o.Tag) != 2 {
+			return "", fmt.Errorf("qris: invalid tag %q", o.Tag)
+		}
+
+		if utf8.RuneCountInString(o.Value) > 99 {
+			return "", fmt.Errorf("qris: value of tag %s is longer than 99 characters", o.Tag)
+		}
+
+		b.WriteString(o.String())
+	}
+
+	return b.String(), nil
+}
+
+// DecodeTLV splits data into its data objects without interpreting them.
+func DecodeTLV(data string) ([]TLV, error) {
+	var objects []TLV
+
+	runes := []rune(data)
+	for len(runes) > 0 {
+		if len(runes) < 4 {
+			return nil, ErrMalformedTLV
+		}
+
+		length, err := strconv.Atoi(string(runes[2:4]))
+		if err != nil || length < 0 || len(runes) < 4+length {
+			return nil, ErrMalformedTLV
+		}
+
+		objects = append(objects, TLV{Tag: string(runes[:2]), Value: string(runes[4 : 4+length])})
+		runes = runes[4+length:]
+	}
+
+	return objects, nil
+}
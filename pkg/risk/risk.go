@@ -0,0 +1,263 @@
+// Package risk evaluates configurable fraud rules against an outgoing
+// transaction. The rules only describe thresholds, the figures they are
+// compared with are provided by a Stats implementation, so the engine does not
+// depend on how transactions are stored.
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	OutcomeAllow  = "allow"
+	OutcomeReview = "review"
+	OutcomeBlock  = "block"
+
+	// RuleVelocity limits the number and the total amount of outgoing
+	// transactions within Window.
+	RuleVelocity = "velocity"
+	// RuleNewDevice flags transactions of at least MinAmount from a device
+	// first seen less than DeviceAge ago.
+	RuleNewDevice = "new_device"
+	// RuleNewRecipients flags a payment to a new recipient when more than
+	// MaxCount new recipients have been paid within Window.
+	RuleNewRecipients = "new_recipients"
+	// RuleAmountAnomaly flags transactions of at least MinAmount that are
+	// more than Multiplier times the average amount of the transactions
+	// within Window, once there are at least MinHistory of them.
+	RuleAmountAnomaly = "amount_anomaly"
+)
+
+var severity = map[string]int{
+	OutcomeAllow:  0,
+	OutcomeReview: 1,
+	OutcomeBlock:  2,
+}
+
+// Duration is a time.Duration written as a string such as "1h" or "30m" in
+// rule files.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+type Rule struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Outcome    string   `json:"outcome"`
+	Disabled   bool     `json:"disabled,omitempty"`
+	Currency   string   `json:"currency,omitempty"`
+	Window     Duration `json:"window,omitempty"`
+	MaxCount   int      `json:"max_count,omitempty"`
+	MaxAmount  float64  `json:"max_amount,omitempty"`
+	MinAmount  float64  `json:"min_amount,omitempty"`
+	DeviceAge  Duration `json:"device_age,omitempty"`
+	Multiplier float64  `json:"multiplier,omitempty"`
+	MinHistory int      `json:"min_history,omitempty"`
+}
+
+// Validate reports the first setting that makes the rule unusable.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("risk: rule without a name")
+	}
+
+	if _, ok := severity[r.Outcome]; !ok {
+		return fmt.Errorf("risk: rule %q has an unknown outcome %q", r.Name, r.Outcome)
+	}
+
+	switch r.Type {
+	case RuleVelocity:
+		if r.Window <= 0 || (r.MaxCount <= 0 && r.MaxAmount <= 0) {
+			return fmt.Errorf("risk: velocity rule %q needs a window and a max_count or max_amount", r.Name)
+		}
+	case RuleNewDevice:
+		if r.DeviceAge <= 0 {
+			return fmt.Errorf("risk: new_device rule %q needs a device_age", r.Name)
+		}
+	case RuleNewRecipients:
+		if r.Window <= 0 {
+			return fmt.Errorf("risk: new_recipients rule %q needs a window", r.Name)
+		}
+	case RuleAmountAnomaly:
+		if r.Window <= 0 || r.Multiplier <= 1 {
+			return fmt.Errorf("risk: amount_anomaly rule %q needs a window and a multiplier above 1", r.Name)
+		}
+	default:
+		return fmt.Errorf("risk: rule %q has an unknown type %q", r.Name, r.Type)
+	}
+
+	return nil
+}
+
+// Stats provides the history of the sender in the currency of the
+// transaction that rules are evaluated against. Windows end now, the
+// transaction being evaluated is not included.
+type Stats interface {
+	// Outgoing returns the number and total amount of outgoing transactions.
+	Outgoing(window time.Duration) (int, float64, error)
+
+	// NewRecipients returns how many recipients were paid for the first
+	// time within the window, and whether the current recipient is new.
+	NewRecipients(window time.Duration) (int, bool, error)
+
+	// Device returns when the device of the request was first seen, ok is
+	// false when the request did not come from a device, e.g. a scheduled
+	// transfer.
+	Device() (firstSeen time.Time, ok bool, err error)
+}
+
+// Hit is a rule that matched, with a human readable reason for reviewers.
+type Hit struct {
+	Rule    string `json:"rule"`
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason"`
+}
+
+type Result struct {
+	Outcome string `json:"outcome"`
+	Hits    []Hit  `json:"hits"`
+}
+
+// Evaluate runs every enabled rule of the currency, rules without a currency
+// apply to all, and returns the most severe outcome of the rules that
+// matched, allow when none did.
+func Evaluate(rules []Rule, currency string, amount float64, stats Stats, now time.Time) (Result, error) {
+	result := Result{Outcome: OutcomeAllow, Hits: []Hit{}}
+
+	for _, rule := range rules {
+		if rule.Disabled || (rule.Currency != "" && rule.Currency != currency) {
+			continue
+		}
+
+		reason, err := evaluateRule(&rule, amount, stats, now)
+		if err != nil {
+			return result, err
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		result.Hits = append(result.Hits, Hit{Rule: rule.Name, Outcome: rule.Outcome, Reason: reason})
+		if severity[rule.Outcome] > severity[result.Outcome] {
+			result.Outcome = rule.Outcome
+		}
+	}
+
+	return result, nil
+}
+
+func evaluateRule(rule *Rule, amount float64, stats Stats, now time.Time) (string, error) {
+	window := time.Duration(rule.Window)
+
+	switch rule.Type {
+	case RuleVelocity:
+		count, total, err := stats.Outgoing(window)
+		if err != nil {
+			return "", err
+		}
+
+		if rule.MaxCount > 0 && count+1 > rule.MaxCount {
+			return fmt.Sprintf("%d transactions within %s, the limit is %d", count+1, window, rule.MaxCount), nil
+		}
+
+		if rule.MaxAmount > 0 && total+amount > rule.MaxAmount {
+			return fmt.Sprintf("%.2f sent within %s, the limit is %.2f", total+amount, window, rule.MaxAmount), nil
+		}
+	case RuleNewDevice:
+		if amount < rule.MinAmount {
+			return "", nil
+		}
+
+		firstSeen, ok, err := stats.Device()
+		if err != nil || !ok {
+			return "", err
+		}
+
+		if age := now.Sub(firstSeen); age < time.Duration(rule.DeviceAge) {
+			return fmt.Sprintf("%.2f sent from a device first seen %s ago", amount, age.Round(time.Second)), nil
+		}
+	case RuleNewRecipients:
+		count, isNew, err := stats.NewRecipients(window)
+		if err != nil || !isNew {
+			return "", err
+		}
+
+		if count+1 > rule.MaxCount {
+			return fmt.Sprintf("%d new recipients within %s, the limit is %d", count+1, window, rule.MaxCount), nil
+		}
+	case RuleAmountAnomaly:
+		if amount < rule.MinAmount {
+			return "", nil
+		}
+
+		count, total, err := stats.Outgoing(window)
+		if err != nil || count == 0 || count < rule.MinHistory {
+			return "", err
+		}
+
+		if average := total / float64(count); amount > average*rule.Multiplier {
+			return fmt.Sprintf("%.2f is more than %.1f times the average of %.2f over %s", amount, rule.Multiplier, average, window), nil
+		}
+	}
+
+	return "", nil
+}
+
+type ruleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadFile reads and validates the rules of a JSON rule file.
+func LoadFile(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file ruleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("risk: %s: %w", path, err)
+	}
+
+	for i := range file.Rules {
+		if err := file.Rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return file.Rules, nil
+}
+
+// DefaultRules are used when no rule file is configured.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "hourly-velocity", Type: RuleVelocity, Outcome: OutcomeReview, Window: Duration(time.Hour), MaxCount: 10},
+		{Name: "daily-velocity", Type: RuleVelocity, Outcome: OutcomeBlock, Window: Duration(24 * time.Hour), MaxCount: 50},
+		{Name: "new-device-large-transfer", Type: RuleNewDevice, Outcome: OutcomeReview, Currency: "IDR", DeviceAge: Duration(24 * time.Hour), MinAmount: 1000000},
+		{Name: "many-new-recipients", Type: RuleNewRecipients, Outcome: OutcomeReview, Window: Duration(24 * time.Hour), MaxCount: 5},
+		{Name: "amount-anomaly", Type: RuleAmountAnomaly, Outcome: OutcomeReview, Currency: "IDR", Window: Duration(30 * 24 * time.Hour), Multiplier: 5, MinHistory: 5, MinAmount: 500000},
+	}
+}
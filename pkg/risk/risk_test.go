@@ -0,0 +1,234 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeStats returns fixed figures, the outgoing history is the same for
+// every window unless perWindow has an entry for it.
+type fakeStats struct {
+	count     int
+	total     float64
+	perWindow map[time.Duration][2]float64
+
+	newRecipients int
+	isNew         bool
+
+	firstSeen time.Time
+	hasDevice bool
+
+	err error
+}
+
+func (s *fakeStats) Outgoing(window time.Duration) (int, float64, error) {
+	if figures, ok := s.perWindow[window]; ok {
+		return int(figures[0]), figures[1], s.err
+	}
+
+	return s.count, s.total, s.err
+}
+
+func (s *fakeStats) NewRecipients(window time.Duration) (int, bool, error) {
+	return s.newRecipients, s.isNew, s.err
+}
+
+func (s *fakeStats) Device() (time.Time, bool, error) {
+	return s.firstSeen, s.hasDevice, s.err
+}
+
+func TestDefaultRulesAreValid(t *testing.T) {
+	for _, rule := range DefaultRules() {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("default rule %q: %v", rule.Name, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	hour := Duration(time.Hour)
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"velocity", Rule{Name: "r", Type: RuleVelocity, Outcome: OutcomeReview, Window: hour, MaxCount: 1}, false},
+		{"velocity by amount", Rule{Name: "r", Type: RuleVelocity, Outcome: OutcomeBlock, Window: hour, MaxAmount: 1}, false},
+		{"velocity without limit", Rule{Name: "r", Type: RuleVelocity, Outcome: OutcomeReview, Window: hour}, true},
+		{"velocity without window", Rule{Name: "r", Type: RuleVelocity, Outcome: OutcomeReview, MaxCount: 1}, true},
+		{"new device", Rule{Name: "r", Type: RuleNewDevice, Outcome: OutcomeReview, DeviceAge: hour}, false},
+		{"new device without age", Rule{Name: "r", Type: RuleNewDevice, Outcome: OutcomeReview}, true},
+		{"new recipients", Rule{Name: "r", Type: RuleNewRecipients, Outcome: OutcomeReview, Window: hour}, false},
+		{"new recipients without window", Rule{Name: "r", Type: RuleNewRecipients, Outcome: OutcomeReview}, true},
+		{"amount anomaly", Rule{Name: "r", Type: RuleAmountAnomaly, Outcome: OutcomeReview, Window: hour, Multiplier: 2}, false},
+		{"amount anomaly multiplier of 1", Rule{Name: "r", Type: RuleAmountAnomaly, Outcome: OutcomeReview, Window: hour, Multiplier: 1}, true},
+		{"no name", Rule{Type: RuleVelocity, Outcome: OutcomeReview, Window: hour, MaxCount: 1}, true},
+		{"unknown outcome", Rule{Name: "r", Type: RuleVelocity, Outcome: "deny", Window: hour, MaxCount: 1}, true},
+		{"unknown type", Rule{Name: "r", Type: "geo", Outcome: OutcomeReview}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	hour := Duration(time.Hour)
+	day := Duration(24 * time.Hour)
+
+	velocity := Rule{Name: "velocity", Type: RuleVelocity, Outcome: OutcomeReview, Window: hour, MaxCount: 3, MaxAmount: 1000}
+	device := Rule{Name: "device", Type: RuleNewDevice, Outcome: OutcomeReview, DeviceAge: day, MinAmount: 500}
+	recipients := Rule{Name: "recipients", Type: RuleNewRecipients, Outcome: OutcomeBlock, Window: day, MaxCount: 2}
+	anomaly := Rule{Name: "anomaly", Type: RuleAmountAnomaly, Outcome: OutcomeReview, Window: day, Multiplier: 5, MinHistory: 3, MinAmount: 100}
+
+	tests := []struct {
+		name     string
+		rules    []Rule
+		currency string
+		amount   float64
+		stats    *fakeStats
+		want     string
+		wantHits []string
+	}{
+		{"no rules", nil, "IDR", 100, &fakeStats{}, OutcomeAllow, nil},
+		{"velocity under limits", []Rule{velocity}, "IDR", 100, &fakeStats{count: 2, total: 800}, OutcomeAllow, nil},
+		{"velocity count", []Rule{velocity}, "IDR", 1, &fakeStats{count: 3, total: 10}, OutcomeReview, []string{"velocity"}},
+		{"velocity amount", []Rule{velocity}, "IDR", 300, &fakeStats{count: 1, total: 800}, OutcomeReview, []string{"velocity"}},
+		{"disabled rule", []Rule{{Name: "velocity", Type: RuleVelocity, Outcome: OutcomeBlock, Window: hour, MaxCount: 1, Disabled: true}}, "IDR", 1, &fakeStats{count: 5}, OutcomeAllow, nil},
+		{"rule of another currency", []Rule{{Name: "velocity", Type: RuleVelocity, Outcome: OutcomeBlock, Currency: "USD", Window: hour, MaxCount: 1}}, "IDR", 1, &fakeStats{count: 5}, OutcomeAllow, nil},
+		{"rule of the currency", []Rule{{Name: "velocity", Type: RuleVelocity, Outcome: OutcomeBlock, Currency: "IDR", Window: hour, MaxCount: 1}}, "IDR", 1, &fakeStats{count: 5}, OutcomeBlock, []string{"velocity"}},
+		{"new device", []Rule{device}, "IDR", 500, &fakeStats{firstSeen: now.Add(-time.Hour), hasDevice: true}, OutcomeReview, []string{"device"}},
+		{"new device small amount", []Rule{device}, "IDR", 499, &fakeStats{firstSeen: now.Add(-time.Hour), hasDevice: true}, OutcomeAllow, nil},
+		{"known device", []Rule{device}, "IDR", 500, &fakeStats{firstSeen: now.Add(-48 * time.Hour), hasDevice: true}, OutcomeAllow, nil},
+		{"no device", []Rule{device}, "IDR", 500, &fakeStats{}, OutcomeAllow, nil},
+		{"new recipients", []Rule{recipients}, "IDR", 1, &fakeStats{newRecipients: 2, isNew: true}, OutcomeBlock, []string{"recipients"}},
+		{"new recipients under limit", []Rule{recipients}, "IDR", 1, &fakeStats{newRecipients: 1, isNew: true}, OutcomeAllow, nil},
+		{"known recipient", []Rule{recipients}, "IDR", 1, &fakeStats{newRecipients: 10}, OutcomeAllow, nil},
+		{"amount anomaly", []Rule{anomaly}, "IDR", 600, &fakeStats{count: 3, total: 300}, OutcomeReview, []string{"anomaly"}},
+		{"amount anomaly within multiplier", []Rule{anomaly}, "IDR", 500, &fakeStats{count: 3, total: 300}, OutcomeAllow, nil},
+		{"amount anomaly without history", []Rule{anomaly}, "IDR", 600, &fakeStats{count: 2, total: 20}, OutcomeAllow, nil},
+		{"amount anomaly small amount", []Rule{anomaly}, "IDR", 99, &fakeStats{count: 3, total: 3}, OutcomeAllow, nil},
+		{
+			"most severe outcome wins",
+			[]Rule{velocity, recipients, anomaly},
+			"IDR", 600,
+			&fakeStats{count: 3, total: 300, newRecipients: 2, isNew: true},
+			OutcomeBlock,
+			[]string{"velocity", "recipients", "anomaly"},
+		},
+		{
+			"windows are evaluated separately",
+			DefaultRules(),
+			"USD", 10,
+			&fakeStats{perWindow: map[time.Duration][2]float64{time.Hour: {2, 20}, 24 * time.Hour: {50, 500}}},
+			OutcomeBlock,
+			[]string{"daily-velocity"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Evaluate(tt.rules, tt.currency, tt.amount, tt.stats, now)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+
+			if result.Outcome != tt.want {
+				t.Errorf("Outcome = %q, want %q", result.Outcome, tt.want)
+			}
+
+			if len(result.Hits) != len(tt.wantHits) {
+				t.Fatalf("Hits = %+v, want rules %v", result.Hits, tt.wantHits)
+			}
+
+			for i, hit := range result.Hits {
+				if hit.Rule != tt.wantHits[i] || hit.Reason == "" {
+					t.Errorf("Hits[%d] = %+v, want rule %q with a reason", i, hit, tt.wantHits[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateStatsError(t *testing.T) {
+	failure := errors.New("database is down")
+	rules := []Rule{{Name: "velocity", Type: RuleVelocity, Outcome: OutcomeReview, Window: Duration(time.Hour), MaxCount: 1}}
+
+	if _, err := Evaluate(rules, "IDR", 1, &fakeStats{err: failure}, time.Now()); err != failure {
+		t.Errorf("Evaluate() error = %v, want %v", err, failure)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	var rule Rule
+	if err := json.Unmarshal([]byte(`{"name":"r","window":"1h30m"}`), &rule); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if time.Duration(rule.Window) != 90*time.Minute {
+		t.Errorf("Window = %v, want %v", time.Duration(rule.Window), 90*time.Minute)
+	}
+
+	data, err := json.Marshal(rule.Window)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	if string(data) != `"1h30m0s"` {
+		t.Errorf("Marshal() = %s, want %s", data, `"1h30m0s"`)
+	}
+
+	for _, invalid := range []string{`{"window":"soon"}`, `{"window":3600}`} {
+		if err := json.Unmarshal([]byte(invalid), &rule); err == nil {
+			t.Errorf("Unmarshal(%s) returned no error", invalid)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantRules int
+		wantErr   bool
+	}{
+		{"example file", filepath.Join("..", "..", "risk-rules.example.json"), -1, false},
+		{"valid", write("valid.json", `{"rules":[{"name":"r","type":"velocity","outcome":"block","window":"1h","max_count":5}]}`), 1, false},
+		{"invalid rule", write("invalid.json", `{"rules":[{"name":"r","type":"velocity","outcome":"block"}]}`), 0, true},
+		{"invalid json", write("broken.json", `{"rules":`), 0, true},
+		{"missing", filepath.Join(dir, "missing.json"), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadFile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantRules >= 0 && len(rules) != tt.wantRules {
+				t.Errorf("LoadFile() = %d rules, want %d", len(rules), tt.wantRules)
+			}
+		})
+	}
+}
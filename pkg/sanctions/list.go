@@ -0,0 +1,210 @@
+// Package sanctions screens names against a watchlist, such as a sanctions
+// list, loaded from a local CSV or JSON file. Names are normalized and
+// transliterated before they are compared, and compared with a fuzzy score
+// so that spelling variants still match.
+package sanctions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultThreshold is the minimum score of a potential match when no
+// threshold is configured.
+const DefaultThreshold = 0.9
+
+type Entry struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	Source  string   `json:"source,omitempty"`
+}
+
+// Match is a list entry that a screened name is similar to. MatchedName is
+// the name or alias of the entry that scored best.
+type Match struct {
+	EntryID     string  `json:"entry_id"`
+	Name        string  `json:"name"`
+	MatchedName string  `json:"matched_name"`
+	Source      string  `json:"source,omitempty"`
+	Score       float64 `json:"score"`
+}
+
+type name struct {
+	original   string
+	normalized string
+}
+
+type List struct {
+	entries []Entry
+	names   [][]name
+}
+
+// NewList prepares entries for screening. Entries without an ID or a name
+// are rejected.
+func NewList(entries []Entry) (*List, error) {
+	list := &List{entries: entries, names: make([][]name, len(entries))}
+
+	for i, entry := range entries {
+		if strings.TrimSpace(entry.ID) == "" || strings.TrimSpace(entry.Name) == "" {
+			return nil, fmt.Errorf("sanctions: entry %d needs an id and a name", i+1)
+		}
+
+		for _, n := range append([]string{entry.Name}, entry.Aliases...) {
+			if normalized := Normalize(n); normalized != "" {
+				list.names[i] = append(list.names[i], name{original: n, normalized: normalized})
+			}
+		}
+	}
+
+	return list, nil
+}
+
+// Len returns the number of entries of the list.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	return len(l.entries)
+}
+
+// Screen returns the entries whose name or one of whose aliases scores at
+// least threshold against name, best match first.
+func (l *List) Screen(screened string, threshold float64) []Match {
+	matches := []Match{}
+
+	normalized := Normalize(screened)
+	if l == nil || normalized == "" {
+		return matches
+	}
+
+	for i, entry := range l.entries {
+		best := Match{}
+
+		for _, n := range l.names[i] {
+			if score := Score(normalized, n.normalized); score > best.Score {
+				best = Match{
+					EntryID:     entry.ID,
+					Name:        entry.Name,
+					MatchedName: n.original,
+					Source:      entry.Source,
+					Score:       score,
+				}
+			}
+		}
+
+		if best.Score >= threshold {
+			best.Score = float64(int(best.Score*1000)) / 1000
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	return matches
+}
+
+type listFile struct {
+	Entries []Entry `json:"entries"`
+}
+
+// LoadFile reads a list from a JSON file with an "entries" array, or from a
+// CSV file with an id, name, aliases and source header. Aliases in a CSV file
+// are separated by semicolons.
+func LoadFile(path string) (*List, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var content listFile
+		if err := json.NewDecoder(file).Decode(&content); err != nil {
+			return nil, fmt.Errorf("sanctions: %s: %w", path, err)
+		}
+
+		entries = content.Entries
+	case ".csv":
+		entries, err = readCSV(file)
+		if err != nil {
+			return nil, fmt.Errorf("sanctions: %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("sanctions: %s: the list must be a .csv or .json file", path)
+	}
+
+	return NewList(entries)
+}
+
+func readCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	if _, ok := columns["id"]; !ok {
+		return nil, errors.New("missing id column")
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("missing name column")
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		entry := Entry{
+			ID:     field(record, "id"),
+			Name:   field(record, "name"),
+			Source: field(record, "source"),
+		}
+
+		for _, alias := range strings.Split(field(record, "aliases"), ";") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				entry.Aliases = append(entry.Aliases, alias)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,51 @@
+package sanctions
+
+import "testing"
+
+// TestScreenDefaultThreshold screens spelling variants, which should match
+// at the default threshold, and similar but different names, which should
+// not.
+func TestScreenDefaultThreshold(t *testing.T) {
+	list, err := NewList([]Entry{
+		{ID: "1", Name: "Vladimir Putin", Aliases: []string{"Владимир Путин"}},
+		{ID: "2", Name: "Osama bin Laden"},
+		{ID: "3", Name: "John Smith"},
+		{ID: "4", Name: "Mohammed Ali"},
+	})
+	if err != nil {
+		t.Fatalf("NewList() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		wantID  string
+		matches bool
+	}{
+		{"Пу́тин Владимир", "1", true},
+		{"Putin, Vladimir", "1", true},
+		{"Usama bin Ladin", "2", true},
+		{"Jon Smyth", "3", true},
+		{"Muhammad Ali", "4", true},
+		{"Jane Doe", "", false},
+		{"Alan Smithers", "", false},
+		{"Budi Santoso", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := list.Screen(tt.name, DefaultThreshold)
+
+			if !tt.matches {
+				if len(matches) != 0 {
+					t.Errorf("Screen(%q) = %+v, want no match", tt.name, matches)
+				}
+
+				return
+			}
+
+			if len(matches) == 0 || matches[0].EntryID != tt.wantID {
+				t.Errorf("Screen(%q) = %+v, want entry %s first", tt.name, matches, tt.wantID)
+			}
+		})
+	}
+}
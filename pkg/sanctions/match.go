@@ -0,0 +1,222 @@
+package sanctions
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// transliterations maps Latin letters that do not decompose, Cyrillic and
+// Greek letters to their common Latin spelling. Latin letters with diacritics
+// are in accents.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ϊ': "i", 'ΐ': "i", 'ό': "o",
+	'ύ': "y", 'ϋ': "y", 'ΰ': "y", 'ώ': "o",
+}
+
+// accents maps Latin letters with diacritics to their base letter.
+var accents = map[rune]rune{}
+
+func init() {
+	groups := map[rune]string{
+		'a': "àáâãäåāăąǎ",
+		'c': "çćĉċč",
+		'd': "ď",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįǐ",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀ",
+		'n': "ñńņňŉ",
+		'o': "òóôõöōŏőǒ",
+		'r': "ŕŗř",
+		's': "śŝşšș",
+		't': "ţťŧț",
+		'u': "ùúûüũūŭůűųǔ",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+
+	for base, letters := range groups {
+		for _, letter := range letters {
+			accents[letter] = base
+		}
+	}
+}
+
+// honorifics are dropped from names before they are compared.
+var honorifics = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "miss": true, "dr": true, "prof": true, "sir": true,
+}
+
+// Normalize lower cases a name, transliterates it to Latin letters, drops
+// punctuation and honorifics and collapses whitespace, so that spelling
+// variants of a name compare equal.
+func Normalize(name string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(name) {
+		if s, ok := transliterations[r]; ok {
+			b.WriteString(s)
+			continue
+		}
+
+		if base, ok := accents[r]; ok {
+			b.WriteRune(base)
+			continue
+		}
+
+		switch {
+		case r == '\'' || r == '’' || r == '`':
+			// O'Brien and OBrien are the same name.
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks, such as the stress mark of Пу́тин, belong to
+			// the letter before them.
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			// Scripts without a transliteration are kept as they are.
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	tokens := make([]string, 0, 4)
+	for _, token := range strings.Fields(b.String()) {
+		if !honorifics[token] {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// JaroWinkler returns the Jaro-Winkler similarity of a and b, between 0 for
+// nothing in common and 1 for equal strings.
+func JaroWinkler(a, b string) float64 {
+	s1, s2 := []rune(a), []rune(b)
+	if len(s1) == 0 && len(s2) == 0 {
+		return 1
+	}
+
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+
+	window := max(len(s1), len(s2))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matched1 := make([]bool, len(s1))
+	matched2 := make([]bool, len(s2))
+
+	matches := 0
+	for i := range s1 {
+		from, to := max(0, i-window), min(len(s2), i+window+1)
+		for j := from; j < to; j++ {
+			if matched2[j] || s1[i] != s2[j] {
+				continue
+			}
+
+			matched1[i], matched2[j] = true, true
+			matches++
+
+			break
+		}
+	}
+
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range s1 {
+		if !matched1[i] {
+			continue
+		}
+
+		for !matched2[j] {
+			j++
+		}
+
+		if s1[i] != s2[j] {
+			transpositions++
+		}
+
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transpositions/2))/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(s1), len(s2)) && s1[prefix] == s2[prefix] {
+		prefix++
+	}
+
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// Score compares two normalized names. Names are compared as a whole, with
+// their tokens sorted so that the order of given name and family name does
+// not matter, and token by token so that a missing middle name only lowers
+// the score in proportion. The best of the three is returned.
+func Score(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+
+	if a == b {
+		return 1
+	}
+
+	tokensA, tokensB := strings.Fields(a), strings.Fields(b)
+
+	best := JaroWinkler(a, b)
+	best = max(best, JaroWinkler(sortedTokens(tokensA), sortedTokens(tokensB)))
+	best = max(best, tokenScore(tokensA, tokensB))
+
+	return best
+}
+
+func sortedTokens(tokens []string) string {
+	sorted := append([]string(nil), tokens...)
+	sort.Strings(sorted)
+
+	return strings.Join(sorted, " ")
+}
+
+// tokenScore pairs every token of the shorter name with its most similar
+// token of the other name. Tokens of the longer name that are left over
+// count as mismatches.
+func tokenScore(a, b []string) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	total := 0.0
+	for _, token := range a {
+		best := 0.0
+		for _, other := range b {
+			best = max(best, JaroWinkler(token, other))
+		}
+
+		total += best
+	}
+
+	return total / float64(len(b))
+}
@@ -0,0 +1,58 @@
+package sanctions
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"case and whitespace", "  John   SMITH ", "john smith"},
+		{"honorifics", "Dr. John Smith", "john smith"},
+		{"punctuation", "Smith, John-Paul", "smith john paul"},
+		{"apostrophe", "Conor O'Brien", "conor obrien"},
+		{"latin accents", "María José García", "maria jose garcia"},
+		{"letters without decomposition", "Łukasz Straße", "lukasz strasse"},
+		{"cyrillic", "Владимир Путин", "vladimir putin"},
+		{"combining stress mark", "Пу́тин", "putin"},
+		{"combining accent", "José", "jose"},
+		{"greek", "Αλέξης", "alexis"},
+		{"other scripts", "金正恩", "金正恩"},
+		{"empty", " - ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"abc", "", 0},
+		{"abc", "xyz", 0},
+		{"martha", "martha", 1},
+		{"martha", "marhta", 0.961},
+		{"dwayne", "duane", 0.840},
+		{"dixon", "dicksonx", 0.813},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := JaroWinkler(tt.a, tt.b); math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("JaroWinkler(%q, %q) = %.3f, want %.3f", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
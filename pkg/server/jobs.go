@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	"github.com/fatfatcocofat/rosamsoe/platform/storage"
+)
+
+// registerJobs sets the handlers of every job kind and the cron schedules of
+// recurring jobs.
+func (s *Server) registerJobs() error {
+	services.RegisterJobHandler(models.JobKindCheckoutExpire, func(ctx context.Context, job *models.Job) error {
+		_, err := services.ExpireCheckoutSessions(database.DB)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindOutboxPurge, func(ctx context.Context, job *models.Job) error {
+		_, err := services.PurgeOutbox(database.DB, 7*24*time.Hour)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindJobsPrune, func(ctx context.Context, job *models.Job) error {
+		_, err := services.PruneJobs(database.DB, 7*24*time.Hour)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindRecurringDispatch, func(ctx context.Context, job *models.Job) error {
+		_, err := services.DispatchRecurringTransfers(database.DB, 100)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindRecurringExecute, func(ctx context.Context, job *models.Job) error {
+		return services.ExecuteRecurringJob(database.DB, job)
+	})
+
+	services.RegisterJobHandler(models.JobKindPaymentRequestExpire, func(ctx context.Context, job *models.Job) error {
+		_, err := services.ExpirePaymentRequests(database.DB)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindHoldExpire, func(ctx context.Context, job *models.Job) error {
+		_, err := services.ExpireHolds(database.DB)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindStatementGenerate, func(ctx context.Context, job *models.Job) error {
+		return services.GenerateStatementJob(database.DB, storage.Storage, job)
+	})
+
+	services.RegisterJobHandler(models.JobKindStatementPurge, func(ctx context.Context, job *models.Job) error {
+		_, err := services.PurgeStatementExports(database.DB, storage.Storage)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindReconciliationRun, func(ctx context.Context, job *models.Job) error {
+		return services.ReconciliationJob(database.DB, job, s.Config.ReconciliationFreeze)
+	})
+
+	services.RegisterJobHandler(models.JobKindPocketAutoSave, func(ctx context.Context, job *models.Job) error {
+		_, err := services.DispatchPocketAutoSaves(database.DB, 100)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindApprovalExpire, func(ctx context.Context, job *models.Job) error {
+		_, err := services.ExpireTransferApprovals(database.DB)
+		return err
+	})
+
+	services.RegisterJobHandler(models.JobKindPayoutExecute, func(ctx context.Context, job *models.Job) error {
+		return services.ExecutePayoutJob(database.DB, job)
+	})
+
+	schedules := []struct {
+		name string
+		cron string
+		kind string
+	}{
+		{"checkout-expiry", "* * * * *", models.JobKindCheckoutExpire},
+		{"outbox-purge", "@hourly", models.JobKindOutboxPurge},
+		{"jobs-prune", "@daily", models.JobKindJobsPrune},
+		{"recurring-transfers", "* * * * *", models.JobKindRecurringDispatch},
+		{"payment-request-expiry", "*/5 * * * *", models.JobKindPaymentRequestExpire},
+		{"hold-expiry", "* * * * *", models.JobKindHoldExpire},
+		{"statement-purge", "@hourly", models.JobKindStatementPurge},
+		{"reconciliation", "0 2 * * *", models.JobKindReconciliationRun},
+		{"pocket-auto-save", "* * * * *", models.JobKindPocketAutoSave},
+		{"transfer-approval-expiry", "* * * * *", models.JobKindApprovalExpire},
+	}
+
+	for _, schedule := range schedules {
+		if err := services.EnsureJobSchedule(database.DB, schedule.name, schedule.cron, schedule.kind, struct{}{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
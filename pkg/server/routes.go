@@ -27,6 +27,9 @@ func (s *Server) routes() {
 		})
 	})
 
+	metricsController := controllers.NewMetricsController(s.Config, s.Logger)
+	s.App.Get("/metrics", middlewares.UseAuthMiddleware(s.Config), middlewares.UseAdminMiddleware(), metricsController.ShowController)
+
 	v1 := s.App.Group("/api/v1")
 
 	authController := controllers.NewAuthController(s.Config, s.Logger)
@@ -39,17 +42,249 @@ func (s *Server) routes() {
 	v1.Route("/user", func(router fiber.Router) {
 		router.Use(middlewares.UseAuthMiddleware(s.Config))
 		router.Get("/", userController.InfoController)
+		router.Get("/handle", userController.HandleHistoryController)
+		router.Put("/handle", userController.UpdateHandleController)
+		router.Get("/limits", userController.LimitsController)
 	})
 
 	walletController := controllers.NewWalletController(s.Config, s.Logger)
+	paymentQRController := controllers.NewPaymentQRController(s.Config, s.Logger)
+	qrisController := controllers.NewQRISController(s.Config, s.Logger)
+	recurringTransferController := controllers.NewRecurringTransferController(s.Config, s.Logger)
+	holdController := controllers.NewHoldController(s.Config, s.Logger)
+	transactionController := controllers.NewTransactionController(s.Config, s.Logger)
+	statementController := controllers.NewStatementController(s.Config, s.Logger)
+	pocketController := controllers.NewPocketController(s.Config, s.Logger)
+	walletMemberController := controllers.NewWalletMemberController(s.Config, s.Logger)
+	approvalController := controllers.NewApprovalController(s.Config, s.Logger)
+	payoutController := controllers.NewPayoutController(s.Config, s.Logger)
 	v1.Route("/wallet", func(router fiber.Router) {
 		router.Use(middlewares.UseAuthMiddleware(s.Config))
 		router.Get("/", walletController.ListController)
 		router.Post("/", walletController.CreateController)
 
-		router.Get("/:address", walletController.ShowController)
-		router.Delete("/:address", walletController.DeleteController)
-		router.Patch("/:address", walletController.UpdateController)
+		router.Get("/:address", middlewares.UseWalletAddressMiddleware(), walletController.ShowController)
+		router.Delete("/:address", middlewares.UseWalletAddressMiddleware(), walletController.DeleteController)
+		router.Patch("/:address", middlewares.UseWalletAddressMiddleware(), walletController.UpdateController)
+		router.Put("/:address/default", middlewares.UseWalletAddressMiddleware(), walletController.DefaultController)
+
+		router.Post("/:address/qr", middlewares.UseWalletAddressMiddleware(), paymentQRController.CreateController)
+		router.Get("/:address/qr", middlewares.UseWalletAddressMiddleware(), paymentQRController.ImageController)
+		router.Post("/:address/qris", middlewares.UseWalletAddressMiddleware(), qrisController.CreateController)
+
+		router.Get("/:address/recurring", middlewares.UseWalletAddressMiddleware(), recurringTransferController.ListController)
+		router.Post("/:address/recurring", middlewares.UseWalletAddressMiddleware(), recurringTransferController.CreateController)
+		router.Get("/:address/recurring/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), recurringTransferController.ShowController)
+		router.Patch("/:address/recurring/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), recurringTransferController.UpdateController)
+		router.Delete("/:address/recurring/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), recurringTransferController.DeleteController)
+
+		router.Get("/:address/holds", middlewares.UseWalletAddressMiddleware(), holdController.ListController)
+		router.Post("/:address/holds", middlewares.UseWalletAddressMiddleware(), holdController.CreateController)
+		router.Get("/:address/holds/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), holdController.ShowController)
+		router.Post("/:address/holds/:id/capture", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), holdController.CaptureController)
+		router.Post("/:address/holds/:id/release", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), holdController.ReleaseController)
+
+		router.Post("/:address/transactions", middlewares.UseWalletAddressMiddleware(), transactionController.CreateController)
+		router.Get("/:address/transactions/:reference", middlewares.UseWalletAddressMiddleware(), transactionController.ShowController)
+		router.Post("/:address/transactions/:reference/refund", middlewares.UseWalletAddressMiddleware(), transactionController.RefundController)
+
+		router.Get("/:address/statement", middlewares.UseWalletAddressMiddleware(), statementController.ShowController)
+		router.Get("/:address/statements/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), statementController.ExportController)
+		router.Get("/:address/statements/:id/download", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), statementController.DownloadController)
+
+		router.Get("/:address/pockets", middlewares.UseWalletAddressMiddleware(), pocketController.ListController)
+		router.Post("/:address/pockets", middlewares.UseWalletAddressMiddleware(), pocketController.CreateController)
+		router.Get("/:address/pockets/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), pocketController.ShowController)
+		router.Patch("/:address/pockets/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), pocketController.UpdateController)
+		router.Delete("/:address/pockets/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), pocketController.DeleteController)
+		router.Post("/:address/pockets/:id/deposit", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), pocketController.DepositController)
+		router.Post("/:address/pockets/:id/withdraw", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), pocketController.WithdrawController)
+
+		router.Get("/:address/members", middlewares.UseWalletAddressMiddleware(), walletMemberController.ListController)
+		router.Post("/:address/members", middlewares.UseWalletAddressMiddleware(), walletMemberController.InviteController)
+		router.Patch("/:address/members/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), walletMemberController.UpdateController)
+		router.Delete("/:address/members/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), walletMemberController.DeleteController)
+		router.Get("/:address/invitations", middlewares.UseWalletAddressMiddleware(), walletMemberController.InvitationListController)
+		router.Delete("/:address/invitations/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), walletMemberController.RevokeController)
+
+		router.Get("/:address/approval-policy", middlewares.UseWalletAddressMiddleware(), approvalController.PolicyController)
+		router.Put("/:address/approval-policy", middlewares.UseWalletAddressMiddleware(), approvalController.UpdatePolicyController)
+		router.Delete("/:address/approval-policy", middlewares.UseWalletAddressMiddleware(), approvalController.DeletePolicyController)
+		router.Get("/:address/approvals", middlewares.UseWalletAddressMiddleware(), approvalController.ListController)
+		router.Get("/:address/approvals/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), approvalController.ShowController)
+		router.Post("/:address/approvals/:id/approve", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), approvalController.ApproveController)
+		router.Post("/:address/approvals/:id/reject", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), approvalController.RejectController)
+		router.Post("/:address/approvals/:id/cancel", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), approvalController.CancelController)
+
+		router.Get("/:address/payouts", middlewares.UseWalletAddressMiddleware(), payoutController.ListController)
+		router.Post("/:address/payouts", middlewares.UseWalletAddressMiddleware(), payoutController.CreateController)
+		router.Get("/:address/payouts/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), payoutController.ShowController)
+		router.Delete("/:address/payouts/:id", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), payoutController.DeleteController)
+		router.Post("/:address/payouts/:id/execute", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), payoutController.ExecuteController)
+		router.Get("/:address/payouts/:id/result", middlewares.UseWalletAddressMiddleware(), middlewares.UseUUIDParamMiddleware("id"), payoutController.ResultController)
+	})
+
+	v1.Route("/wallet-invitations", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/", walletMemberController.ReceivedController)
+		router.Post("/:id/accept", middlewares.UseUUIDParamMiddleware("id"), walletMemberController.AcceptController)
+		router.Post("/:id/decline", middlewares.UseUUIDParamMiddleware("id"), walletMemberController.DeclineController)
+	})
+
+	v1.Route("/payment-qr", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Post("/decode", paymentQRController.DecodeController)
+	})
+
+	v1.Route("/qris", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Post("/parse", qrisController.ParseController)
+		router.Post("/pay", qrisController.PayController)
+	})
+
+	merchantController := controllers.NewMerchantController(s.Config, s.Logger)
+	checkoutController := controllers.NewCheckoutController(s.Config, s.Logger)
+	v1.Route("/merchant", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/", merchantController.ListController)
+		router.Post("/", merchantController.CreateController)
+
+		router.Get("/:id", middlewares.UseUUIDParamMiddleware("id"), merchantController.ShowController)
+		router.Patch("/:id", middlewares.UseUUIDParamMiddleware("id"), merchantController.UpdateController)
+
+		router.Get("/:id/checkout", middlewares.UseUUIDParamMiddleware("id"), checkoutController.ListController)
+		router.Post("/:id/checkout", middlewares.UseUUIDParamMiddleware("id"), checkoutController.CreateController)
+	})
+
+	v1.Route("/checkout", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/:id", middlewares.UseUUIDParamMiddleware("id"), checkoutController.ShowController)
+		router.Post("/:id/pay", middlewares.UseUUIDParamMiddleware("id"), checkoutController.PayController)
+		router.Post("/:id/cancel", middlewares.UseUUIDParamMiddleware("id"), checkoutController.CancelController)
+	})
+
+	webhookController := controllers.NewWebhookController(s.Config, s.Logger)
+	v1.Route("/webhook", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/", webhookController.ListController)
+		router.Post("/", webhookController.CreateController)
+
+		router.Patch("/:id", middlewares.UseUUIDParamMiddleware("id"), webhookController.UpdateController)
+		router.Delete("/:id", middlewares.UseUUIDParamMiddleware("id"), webhookController.DeleteController)
+		router.Get("/:id/deliveries", middlewares.UseUUIDParamMiddleware("id"), webhookController.DeliveriesController)
+		router.Post("/:id/deliveries/:delivery/redeliver", middlewares.UseUUIDParamMiddleware("id"), middlewares.UseUUIDParamMiddleware("delivery"), webhookController.RedeliverController)
+	})
+
+	paymentRequestController := controllers.NewPaymentRequestController(s.Config, s.Logger)
+	v1.Route("/payment-request", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/", paymentRequestController.ListController)
+		router.Post("/", paymentRequestController.CreateController)
+
+		router.Get("/:id", middlewares.UseUUIDParamMiddleware("id"), paymentRequestController.ShowController)
+		router.Post("/:id/accept", middlewares.UseUUIDParamMiddleware("id"), paymentRequestController.AcceptController)
+		router.Post("/:id/decline", middlewares.UseUUIDParamMiddleware("id"), paymentRequestController.DeclineController)
+		router.Post("/:id/cancel", middlewares.UseUUIDParamMiddleware("id"), paymentRequestController.CancelController)
+	})
+
+	splitBillController := controllers.NewSplitBillController(s.Config, s.Logger)
+	v1.Route("/split-bill", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/", splitBillController.ListController)
+		router.Post("/", splitBillController.CreateController)
+
+		router.Get("/:id", middlewares.UseUUIDParamMiddleware("id"), splitBillController.ShowController)
+		router.Post("/:id/cancel", middlewares.UseUUIDParamMiddleware("id"), splitBillController.CancelController)
+	})
+
+	eventController := controllers.NewEventController(s.Config, s.Logger)
+	v1.Route("/events", func(router fiber.Router) {
+		router.Use(middlewares.UseQueryTokenMiddleware(), middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/stream", eventController.StreamController)
+	})
+
+	resolveController := controllers.NewResolveController(s.Config, s.Logger)
+	v1.Route("/resolve", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/:handle", resolveController.ShowController)
+	})
+
+	kycController := controllers.NewKYCController(s.Config, s.Logger)
+	v1.Route("/kyc", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Get("/", kycController.ListController)
+		router.Post("/", kycController.CreateController)
+	})
+
+	feeController := controllers.NewFeeController(s.Config, s.Logger)
+	v1.Route("/fees", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Post("/quote", feeController.QuoteController)
+	})
+
+	promotionController := controllers.NewPromotionController(s.Config, s.Logger)
+	v1.Route("/promotions", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config))
+		router.Post("/check", promotionController.CheckController)
+		router.Post("/redeem", promotionController.RedeemController)
+		router.Get("/redemptions", promotionController.RedemptionsController)
+	})
+
+	adminTransactionController := controllers.NewAdminTransactionController(s.Config, s.Logger)
+	adminFeeRuleController := controllers.NewAdminFeeRuleController(s.Config, s.Logger)
+	adminTierLimitController := controllers.NewAdminTierLimitController(s.Config, s.Logger)
+	adminKYCController := controllers.NewAdminKYCController(s.Config, s.Logger)
+	adminRiskController := controllers.NewAdminRiskController(s.Config, s.Logger)
+	adminScreeningController := controllers.NewAdminScreeningController(s.Config, s.Logger)
+	adminReconciliationController := controllers.NewAdminReconciliationController(s.Config, s.Logger)
+	adminPromotionController := controllers.NewAdminPromotionController(s.Config, s.Logger)
+	v1.Route("/admin", func(router fiber.Router) {
+		router.Use(middlewares.UseAuthMiddleware(s.Config), middlewares.UseAdminMiddleware())
+		router.Get("/transactions/:reference", adminTransactionController.ShowController)
+		router.Post("/transactions/:reference/reverse", adminTransactionController.ReverseController)
+
+		router.Get("/fee-rules", adminFeeRuleController.ListController)
+		router.Post("/fee-rules", adminFeeRuleController.CreateController)
+		router.Patch("/fee-rules/:id", middlewares.UseUUIDParamMiddleware("id"), adminFeeRuleController.UpdateController)
+		router.Delete("/fee-rules/:id", middlewares.UseUUIDParamMiddleware("id"), adminFeeRuleController.DeleteController)
+
+		router.Get("/tier-limits", adminTierLimitController.ListController)
+		router.Patch("/tier-limits/:id", middlewares.UseUUIDParamMiddleware("id"), adminTierLimitController.UpdateController)
+
+		router.Get("/kyc", adminKYCController.ListController)
+		router.Get("/kyc/:id", middlewares.UseUUIDParamMiddleware("id"), adminKYCController.ShowController)
+		router.Get("/kyc/:id/documents/:document", middlewares.UseUUIDParamMiddleware("id"), adminKYCController.DocumentController)
+		router.Post("/kyc/:id/approve", middlewares.UseUUIDParamMiddleware("id"), adminKYCController.ApproveController)
+		router.Post("/kyc/:id/reject", middlewares.UseUUIDParamMiddleware("id"), adminKYCController.RejectController)
+
+		router.Get("/risk/reviews", adminRiskController.ReviewsController)
+		router.Post("/risk/reviews/:id/approve", middlewares.UseUUIDParamMiddleware("id"), adminRiskController.ApproveController)
+		router.Post("/risk/reviews/:id/reject", middlewares.UseUUIDParamMiddleware("id"), adminRiskController.RejectController)
+		router.Get("/risk/evaluations", adminRiskController.EvaluationsController)
+		router.Get("/risk/rules", adminRiskController.RulesController)
+		router.Post("/risk/rules/reload", adminRiskController.ReloadRulesController)
+
+		router.Get("/screening/cases", adminScreeningController.ListController)
+		router.Get("/screening/cases/:id", middlewares.UseUUIDParamMiddleware("id"), adminScreeningController.ShowController)
+		router.Post("/screening/cases/:id/clear", middlewares.UseUUIDParamMiddleware("id"), adminScreeningController.ClearController)
+		router.Post("/screening/cases/:id/confirm", middlewares.UseUUIDParamMiddleware("id"), adminScreeningController.ConfirmController)
+		router.Post("/screening/check", adminScreeningController.CheckController)
+		router.Get("/screening/watchlist", adminScreeningController.WatchlistController)
+		router.Post("/screening/watchlist/reload", adminScreeningController.ReloadWatchlistController)
+
+		router.Get("/reconciliation/runs", adminReconciliationController.ListController)
+		router.Post("/reconciliation/runs", adminReconciliationController.CreateController)
+		router.Get("/reconciliation/runs/:id", middlewares.UseUUIDParamMiddleware("id"), adminReconciliationController.ShowController)
+		router.Get("/reconciliation/settlements", adminReconciliationController.SettlementsController)
+		router.Post("/reconciliation/settlements", adminReconciliationController.ImportSettlementController)
+		router.Post("/wallets/:address/freeze", middlewares.UseWalletAddressMiddleware(), adminReconciliationController.FreezeController)
+		router.Post("/wallets/:address/unfreeze", middlewares.UseWalletAddressMiddleware(), adminReconciliationController.UnfreezeController)
+
+		router.Get("/promotions", adminPromotionController.ListController)
+		router.Post("/promotions", adminPromotionController.CreateController)
+		router.Get("/promotions/:id", middlewares.UseUUIDParamMiddleware("id"), adminPromotionController.ShowController)
+		router.Patch("/promotions/:id", middlewares.UseUUIDParamMiddleware("id"), adminPromotionController.UpdateController)
+		router.Get("/promotions/:id/redemptions", middlewares.UseUUIDParamMiddleware("id"), adminPromotionController.RedemptionsController)
 	})
 }
 
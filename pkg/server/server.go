@@ -1,13 +1,16 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/platform/broker"
 	"github.com/fatfatcocofat/rosamsoe/platform/logger"
 	"github.com/gofiber/contrib/fiberzerolog"
 	"github.com/gofiber/fiber/v2"
@@ -19,19 +22,26 @@ type Server struct {
 	App    *fiber.App
 	Config *config.Config
 	Logger *zerolog.Logger
+
+	workers sync.WaitGroup
 }
 
 func New(config *config.Config) *Server {
 	srv := &Server{
 		App: fiber.New(fiber.Config{
 			ServerHeader: "Rosamsoe",
+			// KYC submissions upload two documents of up to 5 MB each.
+			BodyLimit: 12 << 20,
 		}),
 		Config: config,
 		Logger: &logger.Logger,
 	}
 
+	// The path is logged rather than the url, so query parameters such as
+	// the access_token of the event stream are never written to the log.
 	srv.App.Use(fiberzerolog.New(fiberzerolog.Config{
 		Logger: &logger.Logger,
+		Fields: []string{fiberzerolog.FieldLatency, fiberzerolog.FieldStatus, fiberzerolog.FieldMethod, fiberzerolog.FieldPath, fiberzerolog.FieldError},
 	}))
 
 	srv.App.Use(cors.New())
@@ -44,12 +54,17 @@ func New(config *config.Config) *Server {
 }
 
 func (s *Server) Serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.startWorkers(ctx)
+
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
 	go func() {
 		<-sigch
 		logger.Info().Msg("Shutting down server....")
+		cancel()
+		_ = broker.Broker.Close()
 		_ = s.App.ShutdownWithTimeout(60 * time.Second)
 	}()
 
@@ -57,4 +72,7 @@ func (s *Server) Serve() {
 	if err := s.App.Listen(listenAddr); err != nil {
 		logger.Fatal().Err(err).Msg("Oops... server is not running")
 	}
+
+	cancel()
+	s.workers.Wait()
 }
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fatfatcocofat/rosamsoe/app/services"
+	"github.com/fatfatcocofat/rosamsoe/pkg/outbox"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+)
+
+// jobWorkers is the number of goroutines running jobs from the job queue.
+const jobWorkers = 4
+
+func (s *Server) startWorkers(ctx context.Context) {
+	if err := s.registerJobs(); err != nil {
+		s.Logger.Error().Err(err).Msg("Failed to register jobs")
+	}
+
+	webhookClient := &http.Client{Timeout: 10 * time.Second}
+	publishers := s.outboxPublishers()
+
+	s.runPeriodically(ctx, "outbox-relay", time.Second, func(ctx context.Context) error {
+		_, err := services.RelayOutbox(ctx, database.DB, publishers, 100)
+		return err
+	})
+
+	s.runPeriodically(ctx, "webhook-deliveries", 5*time.Second, func(ctx context.Context) error {
+		_, err := services.DeliverDueWebhooks(ctx, database.DB, webhookClient, 50)
+		return err
+	})
+
+	s.runPeriodically(ctx, "job-scheduler", 10*time.Second, func(ctx context.Context) error {
+		_, err := services.EnqueueScheduledJobs(database.DB)
+		return err
+	})
+
+	for i := 0; i < jobWorkers; i++ {
+		s.runPeriodically(ctx, "jobs", time.Second, func(ctx context.Context) error {
+			_, err := services.RunDueJobs(ctx, database.DB, 5)
+			return err
+		})
+	}
+}
+
+// outboxPublishers returns the destinations of committed domain events.
+// Webhooks and realtime streams always receive them, the others are enabled
+// with OUTBOX_PUBLISHERS.
+func (s *Server) outboxPublishers() []outbox.EventPublisher {
+	publishers := []outbox.EventPublisher{
+		&services.WebhookPublisher{DB: database.DB},
+		&services.RealtimePublisher{},
+	}
+
+	for _, name := range strings.Split(s.Config.OutboxPublishers, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "log":
+			publishers = append(publishers, &outbox.LogPublisher{Logger: s.Logger})
+		case "http":
+			publishers = append(publishers, &outbox.HTTPPublisher{
+				URL:    s.Config.OutboxHTTPURL,
+				Client: &http.Client{Timeout: 10 * time.Second},
+			})
+		case "broker":
+			publishers = append(publishers, &outbox.BrokerPublisher{
+				Conn:   outbox.NewFakeBroker(2 * time.Minute),
+				Prefix: "rosamsoe.events",
+			})
+		default:
+			s.Logger.Warn().Str("publisher", name).Msg("Unknown outbox publisher")
+		}
+	}
+
+	return publishers
+}
+
+// runPeriodically calls fn every interval in its own goroutine until ctx is
+// cancelled. Serve waits for running calls to finish before returning.
+func (s *Server) runPeriodically(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	s.workers.Add(1)
+
+	go func() {
+		defer s.workers.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil {
+					s.Logger.Error().Err(err).Str("worker", name).Msg("Background worker failed")
+				}
+			}
+		}
+	}()
+}
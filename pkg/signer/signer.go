@@ -0,0 +1,60 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("signature is invalid")
+
+// Sign encodes the payload as JSON and returns "<prefix><payload>.<signature>"
+// where both parts are base64url encoded and the signature is an
+// HMAC-SHA256 over the prefix and the encoded payload.
+func Sign(secret string, prefix string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	signature := base64.RawURLEncoding.EncodeToString(mac(secret, prefix+encoded))
+
+	return prefix + encoded + "." + signature, nil
+}
+
+// Verify checks the signature of a token created by Sign and decodes its
+// payload into out.
+func Verify(secret string, prefix string, token string, out interface{}) error {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, prefix) {
+		return ErrInvalidSignature
+	}
+
+	encoded, signature, ok := strings.Cut(strings.TrimPrefix(token, prefix), ".")
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac(secret, prefix+encoded)) {
+		return ErrInvalidSignature
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func mac(secret string, message string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(message))
+
+	return h.Sum(nil)
+}
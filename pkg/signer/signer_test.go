@@ -0,0 +1,90 @@
+package signer
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testSecret = "3f1d7c0a9e2b48c6a5d4e8f7b1c2a3d4"
+	testPrefix = "rosamsoe:pay:"
+)
+
+type testPayload struct {
+	Wallet string  `json:"w"`
+	Amount float64 `json:"a,omitempty"`
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload testPayload
+	}{
+		{"with amount", testPayload{Wallet: "RSM1abc", Amount: 15000.5}},
+		{"without amount", testPayload{Wallet: "RSM1abc"}},
+		{"unicode", testPayload{Wallet: "Warung Sate 🍢"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Sign(testSecret, testPrefix, tt.payload)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			if !strings.HasPrefix(token, testPrefix) {
+				t.Errorf("Sign() = %q, want prefix %q", token, testPrefix)
+			}
+
+			if strings.ContainsAny(strings.TrimPrefix(token, testPrefix), "+/=") {
+				t.Errorf("Sign() = %q, want a URL safe token", token)
+			}
+
+			var got testPayload
+			if err := Verify(testSecret, testPrefix, " "+token+"\n", &got); err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.payload) {
+				t.Errorf("Verify() payload = %+v, want %+v", got, tt.payload)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	token, err := Sign(testSecret, testPrefix, testPayload{Wallet: "RSM1abc", Amount: 100})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	encoded, signature, _ := strings.Cut(strings.TrimPrefix(token, testPrefix), ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"w":"RSM1abc","a":1}`))
+
+	tests := []struct {
+		name   string
+		secret string
+		prefix string
+		token  string
+	}{
+		{"wrong secret", "another-secret-of-at-least-32-bytes", testPrefix, token},
+		{"wrong prefix", testSecret, "rosamsoe:other:", token},
+		{"prefix swapped", testSecret, "rosamsoe:other:", "rosamsoe:other:" + encoded + "." + signature},
+		{"altered payload", testSecret, testPrefix, testPrefix + forged + "." + signature},
+		{"altered signature", testSecret, testPrefix, testPrefix + encoded + "." + strings.Repeat("A", len(signature))},
+		{"signature not base64", testSecret, testPrefix, testPrefix + encoded + ".!!"},
+		{"no signature", testSecret, testPrefix, testPrefix + encoded},
+		{"empty", testSecret, testPrefix, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testPayload
+			if err := Verify(tt.secret, tt.prefix, tt.token, &got); err != ErrInvalidSignature {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Package storage keeps uploaded files such as identity documents in a blob
+// store. Blobs are addressed by slash separated keys like
+// "kyc/<user>/<submission>/selfie.jpg".
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: blob not found")
+	ErrInvalidKey = errors.New("storage: invalid blob key")
+)
+
+type Blob interface {
+	// Put stores the content of r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+
+	// Get opens the blob stored under key. ErrNotFound is returned when there
+	// is none. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey reports whether key is a relative slash separated path without
+// empty, "." or ".." segments, so it can never escape the store.
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,138 @@
+// Package webhook signs and sends outgoing webhook requests.
+//
+// Every request carries a Rosamsoe-Signature header of the form
+//
+//	t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// Receivers should recompute the HMAC with their endpoint secret and reject
+// requests whose timestamp is too old to protect against replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "Rosamsoe-Signature"
+	HeaderEvent     = "Rosamsoe-Event"
+	HeaderDelivery  = "Rosamsoe-Delivery"
+
+	maxResponseBody = 1024
+)
+
+var ErrInvalidSignature = errors.New("webhook: signature is invalid")
+
+// Sign returns the signature header value for the body at the given time.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a signature header value and that it is not older than tolerance.
+func Verify(secret string, header string, body []byte, tolerance time.Duration) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+
+	signature, err := hex.DecodeString(v1)
+	if err != nil || !hmac.Equal(signature, mac(secret, t, body)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID string
+	Body       []byte
+}
+
+type Result struct {
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+}
+
+// Send posts a signed request. Any non 2xx response is returned as an error
+// together with the result so that it can be logged.
+func Send(ctx context.Context, client *http.Client, r Request) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(r.Body))
+	if err != nil {
+		return Result{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Rosamsoe-Webhook/1.0")
+	req.Header.Set(HeaderSignature, Sign(r.Secret, time.Now(), r.Body))
+	req.Header.Set(HeaderEvent, r.Event)
+	req.Header.Set(HeaderDelivery, r.DeliveryID)
+
+	start := time.Now()
+	res, err := client.Do(req)
+	result := Result{Duration: time.Since(start)}
+	if err != nil {
+		return result, err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	result.StatusCode = res.StatusCode
+	result.Body = string(body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return result, fmt.Errorf("webhook: endpoint responded with status %d", res.StatusCode)
+	}
+
+	return result, nil
+}
+
+// Backoff returns the delay before the next attempt: 30s, 1m, 2m, 4m, ...
+// capped at 6 hours.
+func Backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+
+	return delay
+}
+
+func mac(secret string, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+
+	return h.Sum(nil)
+}
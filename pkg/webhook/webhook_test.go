@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test"
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"transfer.completed"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		wantErr error
+	}{
+		{"valid", testSecret, Sign(testSecret, now, body), body, nil},
+		{"valid within tolerance", testSecret, Sign(testSecret, now.Add(-4*time.Minute), body), body, nil},
+		{"wrong secret", "whsec_other", Sign(testSecret, now, body), body, ErrInvalidSignature},
+		{"tampered body", testSecret, Sign(testSecret, now, body), []byte(`{"type":"transfer.failed"}`), ErrInvalidSignature},
+		{"expired", testSecret, Sign(testSecret, now.Add(-6*time.Minute), body), body, ErrInvalidSignature},
+		{"missing timestamp", testSecret, "v1=" + strings.Split(Sign(testSecret, now, body), "v1=")[1], body, ErrInvalidSignature},
+		{"missing signature", testSecret, strings.Split(Sign(testSecret, now, body), ",")[0], body, ErrInvalidSignature},
+		{"signature not hex", testSecret, strings.Split(Sign(testSecret, now, body), ",")[0] + ",v1=zz", body, ErrInvalidSignature},
+		{"empty header", testSecret, "", body, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute); err != tt.wantErr {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantStatus int
+		wantBody   string
+		wantErr    bool
+	}{
+		{"ok", http.StatusOK, "received", http.StatusOK, "received", false},
+		{"no content", http.StatusNoContent, "", http.StatusNoContent, "", false},
+		{"redirect is not followed as success", http.StatusNotModified, "", http.StatusNotModified, "", true},
+		{"client error", http.StatusBadRequest, "bad request", http.StatusBadRequest, "bad request", true},
+		{"server error", http.StatusInternalServerError, "oops", http.StatusInternalServerError, "oops", true},
+		{"response body is truncated", http.StatusOK, strings.Repeat("a", 2*maxResponseBody), http.StatusOK, strings.Repeat("a", maxResponseBody), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"id":"evt_1"}`)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ := io.ReadAll(r.Body)
+				if err := Verify(testSecret, r.Header.Get(HeaderSignature), received, time.Minute); err != nil {
+					t.Errorf("receiver could not verify the request: %v", err)
+				}
+
+				if got := r.Header.Get(HeaderEvent); got != "transfer.completed" {
+					t.Errorf("%s = %q, want %q", HeaderEvent, got, "transfer.completed")
+				}
+
+				if got := r.Header.Get(HeaderDelivery); got != "delivery-1" {
+					t.Errorf("%s = %q, want %q", HeaderDelivery, got, "delivery-1")
+				}
+
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			result, err := Send(context.Background(), server.Client(), Request{
+				URL:        server.URL,
+				Secret:     testSecret,
+				Event:      "transfer.completed",
+				DeliveryID: "delivery-1",
+				Body:       body,
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if result.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", result.StatusCode, tt.wantStatus)
+			}
+
+			if result.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", result.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestSendRetries follows a delivery that fails until the endpoint
+// recovers, waiting Backoff between attempts like the delivery worker does.
+func TestSendRetries(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		_, err := Send(context.Background(), server.Client(), Request{URL: server.URL, Secret: testSecret, Body: []byte("{}")})
+		if err == nil {
+			break
+		}
+
+		if attempt == 5 {
+			t.Fatalf("Send() still failing after %d attempts: %v", attempt, err)
+		}
+
+		waited += Backoff(attempt)
+	}
+
+	if calls != 3 {
+		t.Errorf("endpoint called %d times, want 3", calls)
+	}
+
+	if waited != 90*time.Second {
+		t.Errorf("waited %v between attempts, want %v", waited, 90*time.Second)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		client *http.Client
+	}{
+		{
+			name:   "client timeout",
+			ctx:    func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			client: &http.Client{Timeout: 50 * time.Millisecond},
+		},
+		{
+			name: "context deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			client: server.Client(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			result, err := Send(ctx, tt.client, Request{URL: server.URL, Secret: testSecret, Body: []byte("{}")})
+			if err == nil {
+				t.Fatal("Send() returned no error for an endpoint that never answers")
+			}
+
+			if result.StatusCode != 0 {
+				t.Errorf("StatusCode = %d, want 0", result.StatusCode)
+			}
+
+			if result.Duration <= 0 || result.Duration > 5*time.Second {
+				t.Errorf("Duration = %v, want the time until the timeout", result.Duration)
+			}
+		})
+	}
+}
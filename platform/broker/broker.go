@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/pubsub"
+	"github.com/fatfatcocofat/rosamsoe/platform/database"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+)
+
+const postgresChannel = "rosamsoe_events"
+
+// Broker delivers realtime notifications to connected clients. It defaults to
+// an in-process broker until ConnectBroker is called.
+var Broker pubsub.Broker = pubsub.NewMemoryBroker()
+
+func ConnectBroker(config *config.Config) error {
+	switch config.PubSubDriver {
+	case "", "memory":
+		Broker = pubsub.NewMemoryBroker()
+	case "postgres":
+		sqlDB, err := database.DB.DB()
+		if err != nil {
+			return err
+		}
+
+		Broker = pubsub.NewPostgresBroker(sqlDB, database.DSN(config), postgresChannel, func(err error) {
+			log.Error().Err(err).Msg("Realtime broker failed to listen for notifications")
+		})
+	default:
+		return fmt.Errorf("unknown pubsub driver %q", config.PubSubDriver)
+	}
+
+	log.Info().Str("driver", config.PubSubDriver).Msg("Realtime broker started")
+
+	return nil
+}
+
+// UserTopic is the topic receiving every realtime event of a user.
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
@@ -13,9 +13,12 @@ import (
 
 var DB *gorm.DB
 
+func DSN(config *config.Config) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta", config.DBHost, config.DBUserName, config.DBUserPassword, config.DBName, config.DBPort)
+}
+
 func ConnectDB(config *config.Config) (err error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta", config.DBHost, config.DBUserName, config.DBUserPassword, config.DBName, config.DBPort)
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(DSN(config)), &gorm.Config{})
 	if err != nil {
 		return
 	}
@@ -25,7 +28,80 @@ func ConnectDB(config *config.Config) (err error) {
 
 	log.Info().Msg("Running Migrations")
 
-	err = DB.AutoMigrate(&models.User{}, &models.Wallet{})
+	err = DB.AutoMigrate(
+		&models.User{},
+		&models.UserHandleAlias{},
+		&models.Merchant{},
+		&models.Wallet{},
+		&models.Transaction{},
+		&models.LedgerEntry{},
+		&models.CheckoutSession{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
+		&models.OutboxEvent{},
+		&models.Job{},
+		&models.JobSchedule{},
+		&models.RecurringTransfer{},
+		&models.RecurringTransferRun{},
+		&models.SplitBill{},
+		&models.PaymentRequest{},
+		&models.Hold{},
+		&models.FeeRule{},
+		&models.TierLimit{},
+		&models.KYCSubmission{},
+		&models.KYCStatusHistory{},
+		&models.UserDevice{},
+		&models.RiskEvaluation{},
+		&models.RiskReview{},
+		&models.ScreeningCase{},
+		&models.StatementExport{},
+		&models.ReconciliationRun{},
+		&models.ReconciliationDiscrepancy{},
+		&models.SettlementFile{},
+		&models.SettlementRecord{},
+		&models.Pocket{},
+		&models.PocketMovement{},
+		&models.WalletMember{},
+		&models.WalletInvitation{},
+		&models.ApprovalPolicy{},
+		&models.TransferApproval{},
+		&models.TransferApprovalDecision{},
+		&models.PayoutBatch{},
+		&models.PayoutItem{},
+		&models.PromotionCampaign{},
+		&models.PromotionRedemption{},
+	)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Migration Failed")
+	}
+
+	err = migrateMoneyColumns()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Migration Failed")
+	}
+
+	err = migrateLegacyWalletAddresses()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Migration Failed")
+	}
+
+	err = migrateDefaultWallets()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Migration Failed")
+	}
+
+	err = migrateSystemWallets()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Migration Failed")
+	}
+
+	err = migrateTierLimits()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Migration Failed")
+	}
+
+	err = migrateAdminUsers(config.AdminUserIDs)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Migration Failed")
 	}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatfatcocofat/rosamsoe/app/models"
+	"github.com/fatfatcocofat/rosamsoe/app/utils"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// migrateLegacyWalletAddresses upgrades wallets created before addresses were
+// checksummed. The original 40 character body is kept, so the new address is
+// simply the old one with the network prefix and checksum around it.
+func migrateLegacyWalletAddresses() error {
+	var wallets []models.Wallet
+	result := DB.Where("length(address) = ?", 40).Find(&wallets)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, wallet := range wallets {
+		if !utils.IsLegacyWalletAddress(wallet.Address) {
+			continue
+		}
+
+		address := utils.ChecksumWalletAddress(wallet.Address)
+		result = DB.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Update("address", address)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		log.Info().Str("from", wallet.Address).Str("to", address).Msg("Migrated legacy wallet address")
+	}
+
+	return nil
+}
+
+// migrateDefaultWallets marks the oldest wallet of every user and currency as
+// the default when none is, which is the case for wallets created before
+// default wallets existed.
+func migrateDefaultWallets() error {
+	return DB.Exec(`UPDATE wallets SET is_default = true WHERE id IN (
+		SELECT DISTINCT ON (user_id, currency) id FROM wallets w
+		WHERE w.merchant_id IS NULL AND w.user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM wallets d WHERE d.user_id = w.user_id AND d.currency = w.currency AND d.is_default)
+		ORDER BY user_id, currency, created_at
+	)`).Error
+}
+
+// migrateMoneyColumns widens the money columns of tables created while
+// amounts were stored with less precision. AutoMigrate never changes the
+// precision of an existing numeric column.
+func migrateMoneyColumns() error {
+	var columns []struct {
+		TableName  string
+		ColumnName string
+	}
+
+	result := DB.Raw(`SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND data_type = 'numeric' AND numeric_scale = 2 AND numeric_precision < 18`).Scan(&columns)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, column := range columns {
+		result = DB.Exec("ALTER TABLE ? ALTER COLUMN ? TYPE numeric(18,2)", clause.Table{Name: column.TableName}, clause.Column{Name: column.ColumnName})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		log.Info().Str("table", column.TableName).Str("column", column.ColumnName).Msg("Widened money column")
+	}
+
+	return nil
+}
+
+// migrateAdminUsers bootstraps the first administrators from the configured
+// user IDs. Emails are never verified, so they can not be trusted to pick
+// admins. It does nothing once an admin exists, admins are never promoted
+// or demoted here after that, that has to be done by hand.
+func migrateAdminUsers(ids string) error {
+	var list []uuid.UUID
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return fmt.Errorf("ADMIN_USER_IDS: %q is not a user ID", id)
+		}
+
+		list = append(list, parsed)
+	}
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	var admins int64
+	if err := DB.Model(&models.User{}).Where("role = ?", models.UserRoleAdmin).Count(&admins).Error; err != nil {
+		return err
+	}
+
+	if admins > 0 {
+		return nil
+	}
+
+	result := DB.Model(&models.User{}).Where("id in ?", list).Update("role", models.UserRoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	log.Info().Int64("users", result.RowsAffected).Msg("Promoted the first administrators")
+
+	return nil
+}
+
+// migrateSystemWallets creates the fee revenue wallet of every currency that
+// does not have one yet.
+func migrateSystemWallets() error {
+	for _, currency := range models.WalletCurrencies {
+		var count int64
+		result := DB.Model(&models.Wallet{}).Where("system_account = ? and currency = ?", models.SystemAccountFeeRevenue, currency).Count(&count)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		address, err := utils.GenerateWalletAddress()
+		if err != nil {
+			return err
+		}
+
+		result = DB.Create(&models.Wallet{
+			Address:       address,
+			Currency:      currency,
+			SystemAccount: models.SystemAccountFeeRevenue,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		log.Info().Str("currency", currency).Str("address", address).Msg("Created fee revenue wallet")
+	}
+
+	return nil
+}
+
+// defaultTierLimits follow the Bank Indonesia e-money caps: unverified
+// accounts may hold at most IDR 2 million, verified accounts IDR 20 million,
+// and both may receive at most IDR 40 million a month.
+var defaultTierLimits = []models.TierLimit{
+	{Tier: models.KYCTierUnverified, Currency: "IDR", MaxBalance: 2000000, PerTransaction: 2000000, DailyVolume: 5000000, MonthlyVolume: 20000000, MonthlyInflow: 40000000},
+	{Tier: models.KYCTierVerified, Currency: "IDR", MaxBalance: 20000000, PerTransaction: 20000000, DailyVolume: 20000000, MonthlyVolume: 40000000, MonthlyInflow: 40000000},
+	{Tier: models.KYCTierUnverified, Currency: "USD", MaxBalance: 150, PerTransaction: 150, DailyVolume: 350, MonthlyVolume: 1500, MonthlyInflow: 3000},
+	{Tier: models.KYCTierVerified, Currency: "USD", MaxBalance: 1500, PerTransaction: 1500, DailyVolume: 1500, MonthlyVolume: 3000, MonthlyInflow: 3000},
+}
+
+// migrateTierLimits creates the default limits of every tier and currency
+// that has none yet. Limits changed by an administrator are left alone.
+func migrateTierLimits() error {
+	for _, limit := range defaultTierLimits {
+		var count int64
+		result := DB.Model(&models.TierLimit{}).Where("tier = ? and currency = ?", limit.Tier, limit.Currency).Count(&count)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		limit := limit
+		if result = DB.Create(&limit); result.Error != nil {
+			return result.Error
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/fatfatcocofat/rosamsoe/pkg/config"
+	"github.com/fatfatcocofat/rosamsoe/pkg/storage"
+	log "github.com/fatfatcocofat/rosamsoe/platform/logger"
+)
+
+const defaultLocalPath = "./storage"
+
+// Storage keeps uploaded files, it is set by ConnectStorage.
+var Storage storage.Blob
+
+func ConnectStorage(config *config.Config) error {
+	switch config.StorageDriver {
+	case "", "local":
+		path := config.StorageLocalPath
+		if path == "" {
+			path = defaultLocalPath
+		}
+
+		local, err := storage.NewLocalStorage(path)
+		if err != nil {
+			return err
+		}
+
+		Storage = local
+	default:
+		return fmt.Errorf("unknown storage driver %q", config.StorageDriver)
+	}
+
+	log.Info().Str("driver", config.StorageDriver).Msg("Blob storage connected")
+
+	return nil
+}